@@ -0,0 +1,357 @@
+// Package audio reads the duration of audio files from their container, without decoding the samples
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+var ErrUnknownFormat = errors.New("unknown audio format, supported formats are wav, mp3, m4a, ogg and webm")
+
+// Duration returns the duration of an audio file in seconds, the format is detected from the content
+func Duration(data []byte) (float64, error) {
+	var duration float64
+	var err error
+	switch {
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WAVE":
+		duration, err = wavDuration(data)
+	case len(data) >= 4 && string(data[0:4]) == "OggS":
+		duration, err = oggDuration(data)
+	case len(data) >= 4 && bytes.Equal(data[0:4], []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		duration, err = webmDuration(data)
+	case len(data) >= 8 && string(data[4:8]) == "ftyp":
+		duration, err = mp4Duration(data)
+	case len(data) >= 3 && string(data[0:3]) == "ID3", len(data) >= 2 && data[0] == 0xFF && data[1]&0xE0 == 0xE0:
+		duration, err = mp3Duration(data)
+	default:
+		return 0, ErrUnknownFormat
+	}
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(duration) || math.IsInf(duration, 0) || duration < 0 {
+		return 0, fmt.Errorf("invalid audio duration %f", duration)
+	}
+	return duration, nil
+}
+
+func wavDuration(data []byte) (float64, error) {
+	var byteRate uint32
+	pos := 12
+	for pos+8 <= len(data) {
+		id := string(data[pos : pos+4])
+		size := int64(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		body := pos + 8
+		switch id {
+		case "fmt ":
+			if body+12 > len(data) {
+				return 0, errors.New("invalid wav file: truncated fmt chunk")
+			}
+			byteRate = binary.LittleEndian.Uint32(data[body+8 : body+12])
+		case "data":
+			if byteRate == 0 {
+				return 0, errors.New("invalid wav file: fmt chunk missing")
+			}
+			// streamed files may leave the size as a placeholder
+			if size == 0 || size > int64(len(data)-body) {
+				size = int64(len(data) - body)
+			}
+			return float64(size) / float64(byteRate), nil
+		}
+		pos = body + int(size) + int(size&1)
+	}
+	return 0, errors.New("invalid wav file: data chunk missing")
+}
+
+var mp3Bitrates = [2][3][15]int{
+	{ // MPEG 1, layer I, II, III
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	},
+	{ // MPEG 2 and 2.5
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	},
+}
+
+var mp3SampleRates = [4][3]int{
+	{11025, 12000, 8000},  // MPEG 2.5
+	{},                    // reserved
+	{22050, 24000, 16000}, // MPEG 2
+	{44100, 48000, 32000}, // MPEG 1
+}
+
+// mp3Frame parses the frame header at the start of data, it returns the frame length and its samples
+func mp3Frame(data []byte) (length int, samples int, sampleRate int, ok bool) {
+	if len(data) < 4 || data[0] != 0xFF || data[1]&0xE0 != 0xE0 {
+		return 0, 0, 0, false
+	}
+	version := int(data[1]>>3) & 3
+	layer := 4 - int(data[1]>>1)&3 // 1, 2 or 3, 4 is reserved
+	bitrateIndex := int(data[2] >> 4)
+	sampleRateIndex := int(data[2]>>2) & 3
+	padding := int(data[2]>>1) & 1
+	if version == 1 || layer == 4 || bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		return 0, 0, 0, false
+	}
+	table := 0
+	if version != 3 {
+		table = 1
+	}
+	bitrate := mp3Bitrates[table][layer-1][bitrateIndex] * 1000
+	sampleRate = mp3SampleRates[version][sampleRateIndex]
+	switch {
+	case layer == 1:
+		samples = 384
+		length = (12*bitrate/sampleRate + padding) * 4
+	case layer == 3 && version != 3:
+		samples = 576
+		length = 72*bitrate/sampleRate + padding
+	default:
+		samples = 1152
+		length = 144*bitrate/sampleRate + padding
+	}
+	return length, samples, sampleRate, true
+}
+
+// mp3Duration adds up the samples of all frames, which is exact for both constant and variable bitrates
+func mp3Duration(data []byte) (float64, error) {
+	pos := 0
+	if len(data) >= 10 && string(data[0:3]) == "ID3" {
+		size := int(data[6]&0x7F)<<21 | int(data[7]&0x7F)<<14 | int(data[8]&0x7F)<<7 | int(data[9]&0x7F)
+		pos = 10 + size
+		if data[5]&0x10 != 0 {
+			pos += 10 // footer
+		}
+	}
+	var duration float64
+	frames := 0
+	for pos+4 <= len(data) {
+		length, samples, sampleRate, ok := mp3Frame(data[pos:])
+		if !ok || pos+length > len(data) {
+			// not a frame, e.g. a trailing tag or junk, look for the next one
+			pos++
+			continue
+		}
+		duration += float64(samples) / float64(sampleRate)
+		frames++
+		pos += length
+	}
+	if frames == 0 {
+		return 0, errors.New("invalid mp3 file: no frame found")
+	}
+	return duration, nil
+}
+
+// mp4Box finds the box of the given type among the boxes of data
+func mp4Box(data []byte, boxType string) ([]byte, bool) {
+	pos := 0
+	for pos+8 <= len(data) {
+		size := uint64(binary.BigEndian.Uint32(data[pos : pos+4]))
+		header := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data) - pos)
+		case 1:
+			if pos+16 > len(data) {
+				return nil, false
+			}
+			size = binary.BigEndian.Uint64(data[pos+8 : pos+16])
+			header = 16
+		}
+		if size < header || size > uint64(len(data)-pos) {
+			return nil, false
+		}
+		if string(data[pos+4:pos+8]) == boxType {
+			return data[pos+int(header) : pos+int(size)], true
+		}
+		pos += int(size)
+	}
+	return nil, false
+}
+
+func mp4Duration(data []byte) (float64, error) {
+	moov, ok := mp4Box(data, "moov")
+	if !ok {
+		return 0, errors.New("invalid m4a file: moov box missing")
+	}
+	mvhd, ok := mp4Box(moov, "mvhd")
+	if !ok || len(mvhd) < 20 {
+		return 0, errors.New("invalid m4a file: mvhd box missing")
+	}
+	var timescale uint32
+	var duration uint64
+	if mvhd[0] == 1 {
+		if len(mvhd) < 32 {
+			return 0, errors.New("invalid m4a file: truncated mvhd box")
+		}
+		timescale = binary.BigEndian.Uint32(mvhd[20:24])
+		duration = binary.BigEndian.Uint64(mvhd[24:32])
+	} else {
+		timescale = binary.BigEndian.Uint32(mvhd[12:16])
+		duration = uint64(binary.BigEndian.Uint32(mvhd[16:20]))
+	}
+	if timescale == 0 {
+		return 0, errors.New("invalid m4a file: zero timescale")
+	}
+	return float64(duration) / float64(timescale), nil
+}
+
+// oggDuration reads the granule position of the last page, which counts the samples of vorbis and opus streams
+func oggDuration(data []byte) (float64, error) {
+	var serial uint32
+	var sampleRate float64
+	var preSkip uint64
+	var granule uint64
+	pos := 0
+	for first := true; pos+27 <= len(data); first = false {
+		if string(data[pos:pos+4]) != "OggS" {
+			return 0, errors.New("invalid ogg file: bad page")
+		}
+		pageGranule := binary.LittleEndian.Uint64(data[pos+6 : pos+14])
+		pageSerial := binary.LittleEndian.Uint32(data[pos+14 : pos+18])
+		segments := int(data[pos+26])
+		if pos+27+segments > len(data) {
+			break
+		}
+		bodySize := 0
+		for _, lacing := range data[pos+27 : pos+27+segments] {
+			bodySize += int(lacing)
+		}
+		body := data[pos+27+segments : min(pos+27+segments+bodySize, len(data))]
+		if first {
+			serial = pageSerial
+			switch {
+			case len(body) >= 16 && string(body[0:7]) == "\x01vorbis":
+				sampleRate = float64(binary.LittleEndian.Uint32(body[12:16]))
+			case len(body) >= 12 && string(body[0:8]) == "OpusHead":
+				// opus granule positions are always at 48 kHz
+				sampleRate = 48000
+				preSkip = uint64(binary.LittleEndian.Uint16(body[10:12]))
+			default:
+				return 0, errors.New("unsupported ogg codec, only vorbis and opus are supported")
+			}
+		}
+		if pageSerial == serial && pageGranule != math.MaxUint64 {
+			granule = pageGranule
+		}
+		pos += 27 + segments + bodySize
+	}
+	if sampleRate == 0 {
+		return 0, errors.New("invalid ogg file: zero sample rate")
+	}
+	if granule < preSkip {
+		return 0, nil
+	}
+	return float64(granule-preSkip) / sampleRate, nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+const (
+	ebmlSegment       = 0x18538067
+	ebmlInfo          = 0x1549A966
+	ebmlTimecodeScale = 0x2AD7B1
+	ebmlDuration      = 0x4489
+	ebmlCluster       = 0x1F43B675
+	ebmlTimecode      = 0xE7
+	ebmlBlockGroup    = 0xA0
+	ebmlBlock         = 0xA1
+	ebmlSimpleBlock   = 0xA3
+)
+
+// readVint reads an EBML variable size integer, element ids keep their length marker
+func readVint(data []byte, keepMarker bool) (value uint64, length int, unknown bool, err error) {
+	if len(data) == 0 || data[0] == 0 {
+		return 0, 0, false, errors.New("invalid webm file: bad variable size integer")
+	}
+	length = bits.LeadingZeros8(data[0]) + 1
+	if length > len(data) {
+		return 0, 0, false, errors.New("invalid webm file: truncated variable size integer")
+	}
+	value = uint64(data[0])
+	if !keepMarker {
+		value &= 1<<(8-length) - 1
+	}
+	for i := 1; i < length; i++ {
+		value = value<<8 | uint64(data[i])
+	}
+	unknown = !keepMarker && value == 1<<(7*length)-1
+	return value, length, unknown, nil
+}
+
+func readUint(data []byte) uint64 {
+	var value uint64
+	for _, b := range data {
+		value = value<<8 | uint64(b)
+	}
+	return value
+}
+
+// webmDuration reads the duration of the segment info, files recorded by browsers often lack it,
+// then the timecode of the last block is used
+func webmDuration(data []byte) (float64, error) {
+	timecodeScale := uint64(1000000) // nanoseconds
+	var duration float64
+	var clusterTimecode, lastTimecode int64
+	pos := 0
+	for pos < len(data) {
+		id, idLength, _, err := readVint(data[pos:], true)
+		if err != nil {
+			break
+		}
+		size, sizeLength, unknown, err := readVint(data[pos+idLength:], false)
+		if err != nil {
+			break
+		}
+		body := pos + idLength + sizeLength
+		end := len(data)
+		if !unknown && size <= uint64(len(data)-body) {
+			end = body + int(size)
+		}
+		switch id {
+		case ebmlSegment, ebmlInfo, ebmlCluster, ebmlBlockGroup:
+			// step into master elements, their children follow
+			pos = body
+			continue
+		case ebmlTimecodeScale:
+			timecodeScale = readUint(data[body:end])
+		case ebmlDuration:
+			switch end - body {
+			case 4:
+				duration = float64(math.Float32frombits(binary.BigEndian.Uint32(data[body:end])))
+			case 8:
+				duration = math.Float64frombits(binary.BigEndian.Uint64(data[body:end]))
+			}
+		case ebmlTimecode:
+			clusterTimecode = int64(readUint(data[body:end]))
+		case ebmlSimpleBlock, ebmlBlock:
+			_, trackLength, _, err := readVint(data[body:end], false)
+			if err == nil && body+trackLength+2 <= end {
+				relative := int16(binary.BigEndian.Uint16(data[body+trackLength : body+trackLength+2]))
+				if timecode := clusterTimecode + int64(relative); timecode > lastTimecode {
+					lastTimecode = timecode
+				}
+			}
+		}
+		pos = end
+	}
+	if duration <= 0 {
+		duration = float64(lastTimecode)
+	}
+	if duration <= 0 {
+		return 0, errors.New("invalid webm file: duration not found")
+	}
+	return duration * float64(timecodeScale) / 1e9, nil
+}
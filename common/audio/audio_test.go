@@ -0,0 +1,131 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func wavFile(seconds int) []byte {
+	buf := &bytes.Buffer{}
+	dataSize := uint32(seconds * 32000) // 16 kHz, 16 bits, mono
+	buf.WriteString("RIFF")
+	_ = binary.Write(buf, binary.LittleEndian, 36+dataSize)
+	buf.WriteString("WAVEfmt ")
+	for _, v := range []any{uint32(16), uint16(1), uint16(1), uint32(16000), uint32(32000), uint16(2), uint16(16)} {
+		_ = binary.Write(buf, binary.LittleEndian, v)
+	}
+	buf.WriteString("data")
+	_ = binary.Write(buf, binary.LittleEndian, dataSize)
+	buf.Write(make([]byte, dataSize))
+	return buf.Bytes()
+}
+
+func mp3File(frames int) []byte {
+	// ID3v2 tag of 5 bytes, then MPEG 1 layer III frames at 128 kbps, 44.1 kHz, 417 bytes each
+	data := []byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 5, 0, 0, 0, 0, 0}
+	for i := 0; i < frames; i++ {
+		frame := make([]byte, 417)
+		copy(frame, []byte{0xFF, 0xFB, 0x90, 0x00})
+		data = append(data, frame...)
+	}
+	return append(data, []byte("TAG")...)
+}
+
+func box(boxType string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	data := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(data, boxType...), body...)
+}
+
+func m4aFile() []byte {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:16], 44100)
+	binary.BigEndian.PutUint32(mvhd[16:20], 44100*90)
+	return bytes.Join([][]byte{
+		box("ftyp", []byte("M4A \x00\x00\x00\x00")),
+		box("mdat", make([]byte, 64)),
+		box("moov", box("mvhd", mvhd), box("trak")),
+	}, nil)
+}
+
+func oggPage(granule uint64, body []byte) []byte {
+	page := []byte("OggS\x00\x00")
+	page = binary.LittleEndian.AppendUint64(page, granule)
+	page = binary.LittleEndian.AppendUint32(page, 1) // serial
+	page = append(page, make([]byte, 8)...)          // sequence and crc
+	page = append(page, 1, byte(len(body)))
+	return append(page, body...)
+}
+
+func oggFile() []byte {
+	head := []byte("OpusHead\x01\x01")
+	head = binary.LittleEndian.AppendUint16(head, 312)
+	head = binary.LittleEndian.AppendUint32(head, 16000)
+	return bytes.Join([][]byte{
+		oggPage(0, head),
+		oggPage(math.MaxUint64, make([]byte, 10)),
+		oggPage(312+48000*5, make([]byte, 10)),
+	}, nil)
+}
+
+func ebml(id uint32, body []byte) []byte {
+	data := binary.BigEndian.AppendUint32(nil, id)
+	for len(data) > 1 && data[0] == 0 {
+		data = data[1:]
+	}
+	// 8 bytes size
+	data = append(data, 0x01)
+	data = append(data, binary.BigEndian.AppendUint64(nil, uint64(len(body)))[1:]...)
+	return append(data, body...)
+}
+
+func webmFile(withDuration bool) []byte {
+	var info []byte
+	info = append(info, ebml(ebmlTimecodeScale, []byte{0x0F, 0x42, 0x40})...)
+	if withDuration {
+		info = append(info, ebml(ebmlDuration, binary.BigEndian.AppendUint64(nil, math.Float64bits(12500)))...)
+	}
+	block := func(relative int16) []byte {
+		return ebml(ebmlSimpleBlock, binary.BigEndian.AppendUint16([]byte{0x81}, uint16(relative)))
+	}
+	cluster := func(timecode byte, blocks ...[]byte) []byte {
+		return ebml(ebmlCluster, append(ebml(ebmlTimecode, []byte{0, timecode}), bytes.Join(blocks, nil)...))
+	}
+	segment := bytes.Join([][]byte{
+		ebml(ebmlInfo, info),
+		cluster(0, block(0), block(20)),
+		cluster(200, block(0), block(30)),
+	}, nil)
+	// the segment size is unknown, as written by browsers
+	segment = append([]byte{0x18, 0x53, 0x80, 0x67, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, segment...)
+	return append(ebml(0x1A45DFA3, nil), segment...)
+}
+
+func TestDuration(t *testing.T) {
+	cases := []struct {
+		name     string
+		data     []byte
+		duration float64
+	}{
+		{"wav", wavFile(3), 3},
+		{"mp3", mp3File(100), 100 * 1152 / 44100.0},
+		{"m4a", m4aFile(), 90},
+		{"ogg", oggFile(), 5},
+		{"webm", webmFile(true), 12.5},
+		{"webm without duration", webmFile(false), 0.23},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			duration, err := Duration(c.data)
+			require.NoError(t, err)
+			assert.InDelta(t, c.duration, duration, 0.001)
+		})
+	}
+	_, err := Duration([]byte("not audio at all"))
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+}
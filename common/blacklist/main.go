@@ -3,10 +3,21 @@ package blacklist
 import (
 	"fmt"
 	"sync"
+
+	"github.com/songquanpeng/one-api/common/logger"
 )
 
+// Store persists the ban list so that it survives restarts and is shared by all nodes
+type Store interface {
+	Ban(id int) error
+	Unban(id int) error
+	List() ([]int, error)
+}
+
 var blackList sync.Map
 
+var store Store
+
 func init() {
 	blackList = sync.Map{}
 }
@@ -15,11 +26,26 @@ func userId2Key(id int) string {
 	return fmt.Sprintf("userid_%d", id)
 }
 
+// SetStore sets the persistent store, without it the ban list only lives in memory
+func SetStore(s Store) {
+	store = s
+}
+
 func BanUser(id int) {
+	if store != nil {
+		if err := store.Ban(id); err != nil {
+			logger.SysError(fmt.Sprintf("failed to persist the ban of user %d: %s", id, err.Error()))
+		}
+	}
 	blackList.Store(userId2Key(id), true)
 }
 
 func UnbanUser(id int) {
+	if store != nil {
+		if err := store.Unban(id); err != nil {
+			logger.SysError(fmt.Sprintf("failed to persist the unban of user %d: %s", id, err.Error()))
+		}
+	}
 	blackList.Delete(userId2Key(id))
 }
 
@@ -27,3 +53,26 @@ func IsUserBanned(id int) bool {
 	_, ok := blackList.Load(userId2Key(id))
 	return ok
 }
+
+// Load replaces the ban list of this node with the persisted one, bans of other nodes are picked up this way
+func Load() error {
+	if store == nil {
+		return nil
+	}
+	ids, err := store.List()
+	if err != nil {
+		return err
+	}
+	banned := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		banned[userId2Key(id)] = true
+		blackList.Store(userId2Key(id), true)
+	}
+	blackList.Range(func(key, _ any) bool {
+		if !banned[key.(string)] {
+			blackList.Delete(key)
+		}
+		return true
+	})
+	return nil
+}
@@ -17,6 +17,11 @@ var ServerAddress = "http://localhost:3000"
 var Footer = ""
 var Logo = ""
 var TopUpLink = ""
+
+var PaymentProvider = "" // "stripe" or "fake", empty disables online payments
+var PaymentCurrency = "usd"
+var StripeApiSecret = ""
+var PaymentWebhookSecret = ""
 var ChatLink = ""
 var QuotaPerUnit = 500 * 1000.0 // $0.002 / 1K tokens
 var DisplayInCurrencyEnabled = true
@@ -37,10 +42,14 @@ var PasswordRegisterEnabled = true
 var EmailVerificationEnabled = false
 var GitHubOAuthEnabled = false
 var OidcEnabled = false
+var SAMLEnabled = false
 var WeChatAuthEnabled = false
 var TurnstileCheckEnabled = false
 var RegisterEnabled = true
 
+// TwoFactorEnforcementEnabled requires admin and root users to log in with a second factor
+var TwoFactorEnforcementEnabled = false
+
 var EmailDomainRestrictionEnabled = false
 var EmailDomainWhitelist = []string{
 	"gmail.com",
@@ -79,6 +88,18 @@ var OidcAuthorizationEndpoint = ""
 var OidcTokenEndpoint = ""
 var OidcUserinfoEndpoint = ""
 
+var SAMLIdpEntityId = ""
+var SAMLIdpSsoUrl = ""
+var SAMLIdpCertificate = ""
+var SAMLSpEntityId = "" // defaults to the metadata url
+var SAMLUsernameAttribute = ""
+var SAMLEmailAttribute = ""
+var SAMLDisplayNameAttribute = ""
+var SAMLGroupAttribute = ""
+var SAMLGroupMapping = "" // json array of {"idp_group", "group", "role"}
+
+var SCIMToken = "" // bearer token of the SCIM provisioning API, empty disables it
+
 var WeChatServerAddress = ""
 var WeChatServerToken = ""
 var WeChatAccountQRCodeImageURL = ""
@@ -93,6 +114,8 @@ var QuotaForNewUser int64 = 0
 var QuotaForInviter int64 = 0
 var QuotaForInvitee int64 = 0
 var ChannelDisableThreshold = 5.0
+var ChannelLowBalanceThreshold = 0.0 // alert root when a channel balance falls below it in dollars, 0 to disable
+var PricingCatalogSource = ""        // url or local file of the pricing catalog synced into the model ratios
 var AutomaticDisableChannelEnabled = false
 var AutomaticEnableChannelEnabled = false
 var QuotaRemindThreshold int64 = 1000
@@ -100,6 +123,10 @@ var PreConsumedQuota int64 = 500
 var ApproximateTokenEnabled = false
 var RetryTimes = 0
 
+var TokenExpiryRemindDays = 7        // days before its expiry the owner of a token is reminded, 0 disables reminders
+var TokenMaxLifetimeDays = 0         // longest lifetime of tokens in days, 0 means unlimited
+var TokenRotationGracePeriod = 86400 // seconds the old key of a rotated token stays valid
+
 var RootUserEmail = ""
 
 var IsMasterNode = os.Getenv("NODE_TYPE") != "slave"
@@ -162,5 +189,14 @@ var RelayProxy = env.String("RELAY_PROXY", "")
 var UserContentRequestProxy = env.String("USER_CONTENT_REQUEST_PROXY", "")
 var UserContentRequestTimeout = env.Int("USER_CONTENT_REQUEST_TIMEOUT", 30)
 
+// TrustedProxies is a comma-separated list of IPs or CIDRs, X-Forwarded-For is only honored from them when set
+var TrustedProxies = env.String("TRUSTED_PROXIES", "")
+
 var EnforceIncludeUsage = env.Bool("ENFORCE_INCLUDE_USAGE", false)
 var TestPrompt = env.String("TEST_PROMPT", "Output only your specific model name with no additional text.")
+
+// EncryptionKey is the master key used to encrypt channel keys and secret options at rest, empty means disabled.
+// EncryptionOldKeys is a comma-separated list of previous master keys which are only used for decryption during rotation.
+var EncryptionKey = env.String("ENCRYPTION_KEY", "")
+var EncryptionKeyFile = env.String("ENCRYPTION_KEY_FILE", "")
+var EncryptionOldKeys = env.String("ENCRYPTION_OLD_KEYS", "")
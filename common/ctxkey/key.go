@@ -15,10 +15,15 @@ const (
 	Group             = "group"
 	ModelMapping      = "model_mapping"
 	ChannelName       = "channel_name"
+	ChannelKeyHash    = "channel_key_hash"
 	TokenId           = "token_id"
 	TokenName         = "token_name"
 	BaseURL           = "base_url"
 	AvailableModels   = "available_models"
 	KeyRequestBody    = "key_request_body"
 	SystemPrompt      = "system_prompt"
+	ParamPolicy       = "param_policy"
+	TokenModelQuotaId = "token_model_quota_id"
+	AudioMaxDuration  = "audio_max_duration"
+	AudioMaxFileSize  = "audio_max_file_size"
 )
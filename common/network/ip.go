@@ -9,15 +9,34 @@ import (
 )
 
 func splitSubnets(subnets string) []string {
-	res := strings.Split(subnets, ",")
-	for i := 0; i < len(res); i++ {
-		res[i] = strings.TrimSpace(res[i])
+	var res []string
+	for _, subnet := range strings.Split(subnets, ",") {
+		subnet = strings.TrimSpace(subnet)
+		if subnet != "" {
+			res = append(res, subnet)
+		}
 	}
 	return res
 }
 
+// parseSubnet accepts the CIDR notation as well as a single IPv4 or IPv6 address
+func parseSubnet(subnet string) (*net.IPNet, error) {
+	if !strings.Contains(subnet, "/") {
+		ip := net.ParseIP(subnet)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address: %s", subnet)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	_, ipNet, err := net.ParseCIDR(subnet)
+	return ipNet, err
+}
+
 func isValidSubnet(subnet string) error {
-	_, _, err := net.ParseCIDR(subnet)
+	_, err := parseSubnet(subnet)
 	if err != nil {
 		return fmt.Errorf("failed to parse subnet: %w", err)
 	}
@@ -25,12 +44,16 @@ func isValidSubnet(subnet string) error {
 }
 
 func isIpInSubnet(ctx context.Context, ip string, subnet string) bool {
-	_, ipNet, err := net.ParseCIDR(subnet)
+	ipNet, err := parseSubnet(subnet)
 	if err != nil {
 		logger.Errorf(ctx, "failed to parse subnet: %s", err.Error())
 		return false
 	}
-	return ipNet.Contains(net.ParseIP(ip))
+	parsedIp := net.ParseIP(ip)
+	if parsedIp == nil {
+		return false
+	}
+	return ipNet.Contains(parsedIp)
 }
 
 func IsValidSubnets(subnets string) error {
@@ -50,3 +73,25 @@ func IsIpInSubnets(ctx context.Context, ip string, subnets string) bool {
 	}
 	return false
 }
+
+// IsIpAllowed checks the ip against the deny subnets first, then the allow subnets if there are any
+func IsIpAllowed(ctx context.Context, ip string, allowSubnets string, denySubnets string) bool {
+	if denySubnets != "" && IsIpInSubnets(ctx, ip, denySubnets) {
+		return false
+	}
+	if len(splitSubnets(allowSubnets)) == 0 {
+		return true
+	}
+	return IsIpInSubnets(ctx, ip, allowSubnets)
+}
+
+// ParseTrustedProxies splits the trusted proxy list and checks every entry
+func ParseTrustedProxies(proxies string) ([]string, error) {
+	list := splitSubnets(proxies)
+	for _, proxy := range list {
+		if err := isValidSubnet(proxy); err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
@@ -17,3 +17,37 @@ func TestIsIpInSubnet(t *testing.T) {
 		So(isIpInSubnet(ctx, ip2, subnet), ShouldBeFalse)
 	})
 }
+
+func TestIsIpInSubnetIPv6(t *testing.T) {
+	ctx := context.Background()
+	Convey("TestIsIpInSubnetIPv6", t, func() {
+		So(isIpInSubnet(ctx, "2001:db8::1", "2001:db8::/32"), ShouldBeTrue)
+		So(isIpInSubnet(ctx, "2001:db9::1", "2001:db8::/32"), ShouldBeFalse)
+		So(isIpInSubnet(ctx, "fe80::1", "fe80::1"), ShouldBeTrue)
+		So(isIpInSubnet(ctx, "fe80::2", "fe80::1"), ShouldBeFalse)
+		So(isIpInSubnet(ctx, "::ffff:192.168.0.5", "192.168.0.0/24"), ShouldBeTrue)
+		So(isIpInSubnet(ctx, "192.168.0.5", "2001:db8::/32"), ShouldBeFalse)
+		So(isIpInSubnet(ctx, "not-an-ip", "2001:db8::/32"), ShouldBeFalse)
+	})
+}
+
+func TestIsValidSubnets(t *testing.T) {
+	Convey("TestIsValidSubnets", t, func() {
+		So(IsValidSubnets("192.168.0.0/24, 10.0.0.1, 2001:db8::/32, ::1"), ShouldBeNil)
+		So(IsValidSubnets("192.168.0.0/24,"), ShouldBeNil)
+		So(IsValidSubnets("2001:db8::/129"), ShouldNotBeNil)
+		So(IsValidSubnets("192.168.0.256"), ShouldNotBeNil)
+	})
+}
+
+func TestIsIpAllowed(t *testing.T) {
+	ctx := context.Background()
+	Convey("TestIsIpAllowed", t, func() {
+		So(IsIpAllowed(ctx, "10.0.0.1", "", ""), ShouldBeTrue)
+		So(IsIpAllowed(ctx, "10.0.0.1", "10.0.0.0/8", ""), ShouldBeTrue)
+		So(IsIpAllowed(ctx, "10.0.0.1", "10.0.0.0/8", "10.0.0.0/24"), ShouldBeFalse)
+		So(IsIpAllowed(ctx, "10.0.1.1", "10.0.0.0/8", "10.0.0.0/24"), ShouldBeTrue)
+		So(IsIpAllowed(ctx, "2001:db8::1", "", "2001:db8::/48"), ShouldBeFalse)
+		So(IsIpAllowed(ctx, "2001:db9::1", "", "2001:db8::/48"), ShouldBeTrue)
+	})
+}
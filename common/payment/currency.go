@@ -0,0 +1,31 @@
+package payment
+
+import (
+	"strconv"
+	"strings"
+)
+
+// the currencies whose minor unit isn't a hundredth, as documented by Stripe
+var currencyExponents = map[string]int{
+	"bif": 0, "clp": 0, "djf": 0, "gnf": 0, "jpy": 0, "kmf": 0, "krw": 0, "mga": 0,
+	"pyg": 0, "rwf": 0, "ugx": 0, "vnd": 0, "vuv": 0, "xaf": 0, "xof": 0, "xpf": 0,
+	"bhd": 3, "jod": 3, "kwd": 3, "omr": 3, "tnd": 3,
+}
+
+// CurrencyExponent returns the number of decimals of the minor unit of a currency, e.g. 2 for usd and 0 for jpy
+func CurrencyExponent(currency string) int {
+	if exponent, ok := currencyExponents[strings.ToLower(currency)]; ok {
+		return exponent
+	}
+	return 2
+}
+
+// FormatAmount formats an amount given in the minor unit of its currency, e.g. 1050 usd as 10.50
+func FormatAmount(amount int64, currency string) string {
+	exponent := CurrencyExponent(currency)
+	value := float64(amount)
+	for i := 0; i < exponent; i++ {
+		value /= 10
+	}
+	return strconv.FormatFloat(value, 'f', exponent, 64)
+}
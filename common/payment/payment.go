@@ -0,0 +1,75 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+// EventType is what a webhook event means for the order it refers to
+type EventType string
+
+const (
+	EventIgnored  EventType = ""
+	EventPaid     EventType = "paid"
+	EventFailed   EventType = "failed"
+	EventRefunded EventType = "refunded"
+)
+
+// CheckoutRequest describes the payment of an order, amounts are in the minor unit of the currency (e.g. cents)
+type CheckoutRequest struct {
+	OrderNo       string
+	Amount        int64
+	Currency      string
+	Description   string
+	CustomerEmail string
+	SuccessURL    string
+	CancelURL     string
+}
+
+// Checkout is a payment page hosted by the provider
+type Checkout struct {
+	SessionId string
+	URL       string
+}
+
+// Event is a verified webhook event, the order is identified by OrderNo or, for refunds, by PaymentId
+type Event struct {
+	Id        string    `json:"id"`
+	Type      EventType `json:"type"`
+	OrderNo   string    `json:"order_no"`
+	SessionId string    `json:"session_id"`
+	PaymentId string    `json:"payment_id"`
+	Amount    int64     `json:"amount"`
+	Currency  string    `json:"currency"`
+}
+
+type Provider interface {
+	Name() string
+	// CreateCheckout opens a checkout session the user is redirected to
+	CreateCheckout(ctx context.Context, req *CheckoutRequest) (*Checkout, error)
+	// ParseWebhook verifies the signature of a webhook request and extracts its event
+	ParseWebhook(payload []byte, header http.Header) (*Event, error)
+}
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// GetProvider returns the configured provider, it fails if online payments are disabled
+func GetProvider() (Provider, error) {
+	switch config.PaymentProvider {
+	case "":
+		return nil, errors.New("online payment is not enabled")
+	case "stripe":
+		if config.StripeApiSecret == "" || config.PaymentWebhookSecret == "" {
+			return nil, errors.New("stripe is not configured")
+		}
+		return &Stripe{ApiSecret: config.StripeApiSecret, WebhookSecret: config.PaymentWebhookSecret}, nil
+	case "fake":
+		return &Fake{WebhookSecret: config.PaymentWebhookSecret}, nil
+	default:
+		return nil, fmt.Errorf("unknown payment provider: %s", config.PaymentProvider)
+	}
+}
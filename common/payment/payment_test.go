@@ -0,0 +1,69 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signStripe(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(payload)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func TestStripeWebhook(t *testing.T) {
+	stripe := &Stripe{WebhookSecret: "whsec_test"}
+	payload := []byte(`{"id":"evt_1","type":"checkout.session.completed","data":{"object":{"id":"cs_1","client_reference_id":"ord_1","payment_status":"paid","amount_total":500,"currency":"usd","payment_intent":"pi_1"}}}`)
+	header := http.Header{}
+	header.Set("Stripe-Signature", signStripe("whsec_test", time.Now().Unix(), payload))
+	event, err := stripe.ParseWebhook(payload, header)
+	require.NoError(t, err)
+	assert.Equal(t, &Event{Id: "evt_1", Type: EventPaid, OrderNo: "ord_1", SessionId: "cs_1", PaymentId: "pi_1", Amount: 500, Currency: "usd"}, event)
+
+	header.Set("Stripe-Signature", signStripe("whsec_other", time.Now().Unix(), payload))
+	_, err = stripe.ParseWebhook(payload, header)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	header.Set("Stripe-Signature", signStripe("whsec_test", time.Now().Add(-time.Hour).Unix(), payload))
+	_, err = stripe.ParseWebhook(payload, header)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	payload = []byte(`{"id":"evt_2","type":"charge.refunded","data":{"object":{"payment_intent":"pi_1","amount":500,"currency":"usd","refunded":true}}}`)
+	header.Set("Stripe-Signature", signStripe("whsec_test", time.Now().Unix(), payload))
+	event, err = stripe.ParseWebhook(payload, header)
+	require.NoError(t, err)
+	assert.Equal(t, EventRefunded, event.Type)
+	assert.Equal(t, "pi_1", event.PaymentId)
+}
+
+func TestFakeWebhook(t *testing.T) {
+	fake := &Fake{WebhookSecret: "secret"}
+	payload := []byte(`{"id":"evt_1","type":"paid","order_no":"ord_1","amount":500,"currency":"usd"}`)
+	header := http.Header{}
+	header.Set(FakeSignatureHeader, SignFakeWebhook("secret", payload))
+	event, err := fake.ParseWebhook(payload, header)
+	require.NoError(t, err)
+	assert.Equal(t, EventPaid, event.Type)
+	assert.Equal(t, "ord_1", event.OrderNo)
+
+	header.Set(FakeSignatureHeader, SignFakeWebhook("other", payload))
+	_, err = fake.ParseWebhook(payload, header)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+}
+
+func TestFormatAmount(t *testing.T) {
+	assert.Equal(t, "10.50", FormatAmount(1050, "usd"))
+	assert.Equal(t, "1050", FormatAmount(1050, "JPY"))
+	assert.Equal(t, "1.050", FormatAmount(1050, "kwd"))
+	assert.Equal(t, "-0.05", FormatAmount(-5, "eur"))
+}
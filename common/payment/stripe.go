@@ -0,0 +1,205 @@
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/client"
+)
+
+const stripeApiBase = "https://api.stripe.com/v1"
+
+// tolerance between the timestamp of a webhook signature and now, it protects against replays
+const stripeSignatureTolerance = 5 * time.Minute
+
+// Stripe creates hosted checkout sessions, see https://docs.stripe.com/api/checkout/sessions
+type Stripe struct {
+	ApiSecret     string
+	WebhookSecret string
+	BaseURL       string // defaults to the Stripe API, overridden in tests
+}
+
+func (s *Stripe) Name() string {
+	return "stripe"
+}
+
+type stripeError struct {
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (s *Stripe) CreateCheckout(ctx context.Context, req *CheckoutRequest) (*Checkout, error) {
+	form := url.Values{}
+	form.Set("mode", "payment")
+	form.Set("success_url", req.SuccessURL)
+	form.Set("cancel_url", req.CancelURL)
+	form.Set("client_reference_id", req.OrderNo)
+	form.Set("metadata[order_no]", req.OrderNo)
+	form.Set("payment_intent_data[metadata][order_no]", req.OrderNo)
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("line_items[0][price_data][currency]", strings.ToLower(req.Currency))
+	form.Set("line_items[0][price_data][unit_amount]", strconv.FormatInt(req.Amount, 10))
+	form.Set("line_items[0][price_data][product_data][name]", req.Description)
+	if req.CustomerEmail != "" {
+		form.Set("customer_email", req.CustomerEmail)
+	}
+	baseURL := s.BaseURL
+	if baseURL == "" {
+		baseURL = stripeApiBase
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/checkout/sessions", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+s.ApiSecret)
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// the order number makes retries of the same checkout return the same session
+	httpReq.Header.Set("Idempotency-Key", req.OrderNo)
+	resp, err := client.HTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var stripeErr stripeError
+		if json.Unmarshal(body, &stripeErr) == nil && stripeErr.Error != nil {
+			return nil, fmt.Errorf("stripe: %s", stripeErr.Error.Message)
+		}
+		return nil, fmt.Errorf("stripe: status code %d", resp.StatusCode)
+	}
+	var session struct {
+		Id  string `json:"id"`
+		URL string `json:"url"`
+	}
+	if err = json.Unmarshal(body, &session); err != nil {
+		return nil, err
+	}
+	return &Checkout{SessionId: session.Id, URL: session.URL}, nil
+}
+
+// verifySignature checks the Stripe-Signature header, see https://docs.stripe.com/webhooks#verify-manually
+func (s *Stripe) verifySignature(payload []byte, header string, now time.Time) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	t, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(t, 0)); age > stripeSignatureTolerance || age < -stripeSignatureTolerance {
+		return ErrInvalidSignature
+	}
+	mac := hmac.New(sha256.New, []byte(s.WebhookSecret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+	for _, signature := range signatures {
+		actual, err := hex.DecodeString(signature)
+		if err == nil && hmac.Equal(actual, expected) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+type stripeEvent struct {
+	Id   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+type stripeCheckoutSession struct {
+	Id                string            `json:"id"`
+	ClientReferenceId string            `json:"client_reference_id"`
+	PaymentStatus     string            `json:"payment_status"`
+	AmountTotal       int64             `json:"amount_total"`
+	Currency          string            `json:"currency"`
+	PaymentIntent     string            `json:"payment_intent"`
+	Metadata          map[string]string `json:"metadata"`
+}
+
+type stripeCharge struct {
+	PaymentIntent string `json:"payment_intent"`
+	Amount        int64  `json:"amount"`
+	Currency      string `json:"currency"`
+	Refunded      bool   `json:"refunded"`
+}
+
+func (s *Stripe) ParseWebhook(payload []byte, header http.Header) (*Event, error) {
+	if err := s.verifySignature(payload, header.Get("Stripe-Signature"), time.Now()); err != nil {
+		return nil, err
+	}
+	var stripeEvt stripeEvent
+	if err := json.Unmarshal(payload, &stripeEvt); err != nil {
+		return nil, err
+	}
+	event := &Event{Id: stripeEvt.Id}
+	switch stripeEvt.Type {
+	case "checkout.session.completed", "checkout.session.async_payment_succeeded",
+		"checkout.session.async_payment_failed", "checkout.session.expired":
+		var session stripeCheckoutSession
+		if err := json.Unmarshal(stripeEvt.Data.Object, &session); err != nil {
+			return nil, err
+		}
+		event.OrderNo = session.ClientReferenceId
+		if event.OrderNo == "" {
+			event.OrderNo = session.Metadata["order_no"]
+		}
+		event.SessionId = session.Id
+		event.PaymentId = session.PaymentIntent
+		event.Amount = session.AmountTotal
+		event.Currency = session.Currency
+		switch stripeEvt.Type {
+		case "checkout.session.completed":
+			// delayed payment methods complete the session unpaid, they are settled by async_payment_succeeded
+			if session.PaymentStatus == "paid" || session.PaymentStatus == "no_payment_required" {
+				event.Type = EventPaid
+			}
+		case "checkout.session.async_payment_succeeded":
+			event.Type = EventPaid
+		default:
+			event.Type = EventFailed
+		}
+	case "charge.refunded":
+		var charge stripeCharge
+		if err := json.Unmarshal(stripeEvt.Data.Object, &charge); err != nil {
+			return nil, err
+		}
+		// partial refunds are left to the admins, the credited quota can't be split reliably
+		if charge.Refunded {
+			event.Type = EventRefunded
+			event.PaymentId = charge.PaymentIntent
+			event.Amount = charge.Amount
+			event.Currency = charge.Currency
+		}
+	}
+	return event, nil
+}
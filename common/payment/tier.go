@@ -0,0 +1,65 @@
+package payment
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// PriceTier is a top-up package, the price is in the minor unit of the payment currency
+type PriceTier struct {
+	Name  string `json:"name"`
+	Price int64  `json:"price"`
+	Quota int64  `json:"quota"`
+}
+
+var priceTiersLock sync.RWMutex
+var PriceTiers = []PriceTier{
+	{Name: "$5", Price: 500, Quota: 2500000},
+	{Name: "$20", Price: 2000, Quota: 10000000},
+	{Name: "$100", Price: 10000, Quota: 50000000},
+}
+
+func PriceTiers2JSONString() string {
+	priceTiersLock.RLock()
+	defer priceTiersLock.RUnlock()
+	jsonBytes, err := json.Marshal(PriceTiers)
+	if err != nil {
+		logger.SysError("error marshalling price tiers: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdatePriceTiersByJSONString(jsonStr string) error {
+	var tiers []PriceTier
+	if err := json.Unmarshal([]byte(jsonStr), &tiers); err != nil {
+		return err
+	}
+	for _, tier := range tiers {
+		if tier.Price <= 0 || tier.Quota <= 0 {
+			return errors.New("the price and quota of price tiers must be positive")
+		}
+	}
+	priceTiersLock.Lock()
+	defer priceTiersLock.Unlock()
+	PriceTiers = tiers
+	return nil
+}
+
+// GetPriceTiers returns a copy of the price tiers
+func GetPriceTiers() []PriceTier {
+	priceTiersLock.RLock()
+	defer priceTiersLock.RUnlock()
+	return append([]PriceTier(nil), PriceTiers...)
+}
+
+func GetPriceTier(index int) (PriceTier, bool) {
+	priceTiersLock.RLock()
+	defer priceTiersLock.RUnlock()
+	if index < 0 || index >= len(PriceTiers) {
+		return PriceTier{}, false
+	}
+	return PriceTiers[index], true
+}
@@ -0,0 +1,134 @@
+// Package pdf writes simple text documents, enough for statements and reports without a dependency
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+type Font string
+
+const (
+	Helvetica     Font = "F1"
+	HelveticaBold Font = "F2"
+	Courier       Font = "F3" // monospace, to align table columns
+)
+
+var baseFonts = map[Font]string{
+	Helvetica:     "Helvetica",
+	HelveticaBold: "Helvetica-Bold",
+	Courier:       "Courier",
+}
+
+// A4 in points
+const (
+	pageWidth  = 595
+	pageHeight = 842
+	margin     = 50
+)
+
+type Line struct {
+	Text string
+	Font Font
+	Size float64
+}
+
+// Document lays lines out top to bottom and starts a new page when one is full
+type Document struct {
+	pages [][]positionedLine
+	y     float64
+}
+
+type positionedLine struct {
+	Line
+	y float64
+}
+
+func New() *Document {
+	return &Document{}
+}
+
+// Add appends a line, an empty text adds vertical space
+func (d *Document) Add(text string, font Font, size float64) {
+	leading := size * 1.4
+	if len(d.pages) == 0 || d.y-leading < margin {
+		d.pages = append(d.pages, nil)
+		d.y = pageHeight - margin
+	}
+	d.y -= leading
+	page := len(d.pages) - 1
+	d.pages[page] = append(d.pages[page], positionedLine{Line: Line{Text: text, Font: font, Size: size}, y: d.y})
+}
+
+// escape makes text fit in a literal string with the standard encoding, other characters are replaced
+func escape(text string) string {
+	var sb strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case r >= 32 && r < 127:
+			sb.WriteRune(r)
+		default:
+			sb.WriteByte('?')
+		}
+	}
+	return sb.String()
+}
+
+// Bytes renders the document
+func (d *Document) Bytes() []byte {
+	if len(d.pages) == 0 {
+		d.pages = append(d.pages, nil)
+	}
+	var objects []string
+	addObject := func(content string) int {
+		objects = append(objects, content)
+		return len(objects)
+	}
+	catalog := addObject("")
+	pagesId := addObject("")
+	fontIds := make(map[Font]int)
+	for _, font := range []Font{Helvetica, HelveticaBold, Courier} {
+		fontIds[font] = addObject(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", baseFonts[font]))
+	}
+	var resources strings.Builder
+	resources.WriteString("<< /Font <<")
+	for _, font := range []Font{Helvetica, HelveticaBold, Courier} {
+		resources.WriteString(fmt.Sprintf(" /%s %d 0 R", font, fontIds[font]))
+	}
+	resources.WriteString(" >> >>")
+	var kids []string
+	for _, lines := range d.pages {
+		var content strings.Builder
+		for _, line := range lines {
+			if line.Text == "" {
+				continue
+			}
+			content.WriteString(fmt.Sprintf("BT /%s %.1f Tf %d %.1f Td (%s) Tj ET\n", line.Font, line.Size, margin, line.y, escape(line.Text)))
+		}
+		contentId := addObject(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+		pageId := addObject(fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %d %d] /Resources %s /Contents %d 0 R >>",
+			pagesId, pageWidth, pageHeight, resources.String(), contentId))
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageId))
+	}
+	objects[catalog-1] = fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesId)
+	objects[pagesId-1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids))
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		buf.WriteString(fmt.Sprintf("%d 0 obj\n%s\nendobj\n", i+1, object))
+	}
+	xref := buf.Len()
+	buf.WriteString(fmt.Sprintf("xref\n0 %d\n0000000000 65535 f \n", len(objects)+1))
+	for _, offset := range offsets {
+		buf.WriteString(fmt.Sprintf("%010d 00000 n \n", offset))
+	}
+	buf.WriteString(fmt.Sprintf("trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, catalog, xref))
+	return buf.Bytes()
+}
@@ -0,0 +1,35 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocument(t *testing.T) {
+	doc := New()
+	doc.Add("Statement (2026-09)", HelveticaBold, 16)
+	for i := 0; i < 100; i++ {
+		doc.Add(fmt.Sprintf("gpt-4o %d", i), Courier, 9)
+	}
+	data := doc.Bytes()
+	assert.True(t, bytes.HasPrefix(data, []byte("%PDF-1.4")))
+	assert.Contains(t, string(data), `(Statement \(2026-09\)) Tj`)
+	assert.Contains(t, string(data), "/Count 2")
+
+	// the xref offsets must point at the objects
+	match := regexp.MustCompile(`startxref\n(\d+)`).FindSubmatch(data)
+	require.NotNil(t, match)
+	xref, _ := strconv.Atoi(string(match[1]))
+	assert.True(t, bytes.HasPrefix(data[xref:], []byte("xref")))
+	offsets := regexp.MustCompile(`(\d{10}) 00000 n`).FindAllSubmatch(data, -1)
+	for i, offset := range offsets {
+		value, _ := strconv.Atoi(string(offset[1]))
+		assert.True(t, bytes.HasPrefix(data[value:], []byte(fmt.Sprintf("%d 0 obj", i+1))))
+	}
+}
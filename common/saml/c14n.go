@@ -0,0 +1,161 @@
+package saml
+
+import (
+	"sort"
+	"strings"
+)
+
+// exclusive XML canonicalization (https://www.w3.org/TR/xml-exc-c14n/) of an element subtree
+
+type canonicalizer struct {
+	inclusivePrefixes map[string]bool
+	withComments      bool
+	exclude           *element // the enveloped signature
+	sb                strings.Builder
+}
+
+func canonicalize(e *element, inclusivePrefixes []string, withComments bool, exclude *element) []byte {
+	c := &canonicalizer{
+		inclusivePrefixes: make(map[string]bool),
+		withComments:      withComments,
+		exclude:           exclude,
+	}
+	for _, prefix := range inclusivePrefixes {
+		if prefix == "#default" {
+			prefix = ""
+		}
+		c.inclusivePrefixes[prefix] = true
+	}
+	c.writeElement(e, map[string]string{})
+	return []byte(c.sb.String())
+}
+
+func (c *canonicalizer) writeElement(e *element, rendered map[string]string) {
+	// the namespaces which are visibly utilized by the element or listed as inclusive
+	used := map[string]bool{e.Prefix: true}
+	for _, a := range e.Attrs {
+		if a.Prefix != "" && a.Prefix != "xml" {
+			used[a.Prefix] = true
+		}
+	}
+	for prefix := range c.inclusivePrefixes {
+		used[prefix] = true
+	}
+	var decls []attr
+	for prefix := range used {
+		uri := e.lookupNamespace(prefix)
+		previous, ok := rendered[prefix]
+		if prefix == "" {
+			if uri == "" && (!ok || previous == "") {
+				continue
+			}
+		} else if uri == "" {
+			// an inclusive prefix which isn't in scope
+			continue
+		}
+		if ok && previous == uri {
+			continue
+		}
+		decls = append(decls, attr{Local: prefix, Value: uri})
+	}
+	sort.Slice(decls, func(i, j int) bool {
+		return decls[i].Local < decls[j].Local
+	})
+	newRendered := rendered
+	if len(decls) > 0 {
+		newRendered = make(map[string]string, len(rendered)+len(decls))
+		for prefix, uri := range rendered {
+			newRendered[prefix] = uri
+		}
+		for _, decl := range decls {
+			newRendered[decl.Local] = decl.Value
+		}
+	}
+
+	attrs := append([]attr(nil), e.Attrs...)
+	sort.SliceStable(attrs, func(i, j int) bool {
+		nsI := attrNamespace(e, attrs[i])
+		nsJ := attrNamespace(e, attrs[j])
+		if nsI != nsJ {
+			return nsI < nsJ
+		}
+		return attrs[i].Local < attrs[j].Local
+	})
+
+	c.sb.WriteString("<")
+	c.sb.WriteString(qualifiedName(e.Prefix, e.Local))
+	for _, decl := range decls {
+		if decl.Local == "" {
+			c.sb.WriteString(` xmlns="`)
+		} else {
+			c.sb.WriteString(` xmlns:` + decl.Local + `="`)
+		}
+		c.sb.WriteString(escapeAttr(decl.Value))
+		c.sb.WriteString(`"`)
+	}
+	for _, a := range attrs {
+		c.sb.WriteString(" " + qualifiedName(a.Prefix, a.Local) + `="`)
+		c.sb.WriteString(escapeAttr(a.Value))
+		c.sb.WriteString(`"`)
+	}
+	c.sb.WriteString(">")
+	for _, child := range e.Children {
+		switch node := child.(type) {
+		case *element:
+			if node != c.exclude {
+				c.writeElement(node, newRendered)
+			}
+		case text:
+			c.sb.WriteString(escapeText(string(node)))
+		case comment:
+			if c.withComments {
+				c.sb.WriteString("<!--" + string(node) + "-->")
+			}
+		case procInst:
+			c.sb.WriteString("<?" + node.Target)
+			if node.Inst != "" {
+				c.sb.WriteString(" " + node.Inst)
+			}
+			c.sb.WriteString("?>")
+		}
+	}
+	c.sb.WriteString("</" + qualifiedName(e.Prefix, e.Local) + ">")
+}
+
+func attrNamespace(e *element, a attr) string {
+	if a.Prefix == "" {
+		return ""
+	}
+	return e.lookupNamespace(a.Prefix)
+}
+
+func qualifiedName(prefix string, local string) string {
+	if prefix == "" {
+		return local
+	}
+	return prefix + ":" + local
+}
+
+var attrEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	`"`, "&quot;",
+	"\t", "&#x9;",
+	"\n", "&#xA;",
+	"\r", "&#xD;",
+)
+
+var textEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	"\r", "&#xD;",
+)
+
+func escapeAttr(s string) string {
+	return attrEscaper.Replace(s)
+}
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
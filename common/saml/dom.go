@@ -0,0 +1,199 @@
+package saml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// a minimal DOM which keeps the namespace prefixes and declarations of the document,
+// encoding/xml resolves them away but canonicalization needs them
+
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+type attr struct {
+	Prefix string
+	Local  string
+	Value  string
+}
+
+type text string
+
+type comment string
+
+type procInst struct {
+	Target string
+	Inst   string
+}
+
+type element struct {
+	Prefix   string
+	Local    string
+	Attrs    []attr
+	NsDecls  []attr // Local is the declared prefix, empty for the default namespace
+	Children []any  // *element, text, comment or procInst
+	Parent   *element
+}
+
+func parseDocument(data []byte) (*element, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = true
+	var root, current *element
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if current == nil && root != nil {
+				return nil, errors.New("xml: multiple root elements")
+			}
+			el := &element{Prefix: t.Name.Space, Local: t.Name.Local, Parent: current}
+			for _, a := range t.Attr {
+				switch {
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+					el.NsDecls = append(el.NsDecls, attr{Local: "", Value: a.Value})
+				case a.Name.Space == "xmlns":
+					el.NsDecls = append(el.NsDecls, attr{Local: a.Name.Local, Value: a.Value})
+				default:
+					el.Attrs = append(el.Attrs, attr{Prefix: a.Name.Space, Local: a.Name.Local, Value: a.Value})
+				}
+			}
+			if current != nil {
+				current.Children = append(current.Children, el)
+			} else {
+				root = el
+			}
+			current = el
+		case xml.EndElement:
+			if current == nil || current.Prefix != t.Name.Space || current.Local != t.Name.Local {
+				return nil, fmt.Errorf("xml: unexpected end element %s", t.Name.Local)
+			}
+			current = current.Parent
+		case xml.CharData:
+			if current != nil {
+				current.Children = append(current.Children, text(t))
+			} else if len(bytes.TrimSpace(t)) != 0 {
+				return nil, errors.New("xml: text outside of the root element")
+			}
+		case xml.Comment:
+			if current != nil {
+				current.Children = append(current.Children, comment(t))
+			}
+		case xml.ProcInst:
+			if current != nil {
+				current.Children = append(current.Children, procInst{Target: t.Target, Inst: string(t.Inst)})
+			}
+		case xml.Directive:
+			// DTDs could define entities, they have no place in a SAML message
+			return nil, errors.New("xml: directives are not allowed")
+		}
+	}
+	if root == nil || current != nil {
+		return nil, errors.New("xml: incomplete document")
+	}
+	for _, el := range root.descendants() {
+		for _, a := range el.Attrs {
+			if a.Prefix != "" && el.lookupNamespace(a.Prefix) == "" {
+				return nil, fmt.Errorf("xml: undeclared namespace prefix %s", a.Prefix)
+			}
+		}
+		if el.Prefix != "" && el.lookupNamespace(el.Prefix) == "" {
+			return nil, fmt.Errorf("xml: undeclared namespace prefix %s", el.Prefix)
+		}
+	}
+	return root, nil
+}
+
+func (e *element) lookupNamespace(prefix string) string {
+	if prefix == "xml" {
+		return xmlNamespace
+	}
+	for el := e; el != nil; el = el.Parent {
+		for _, decl := range el.NsDecls {
+			if decl.Local == prefix {
+				return decl.Value
+			}
+		}
+	}
+	return ""
+}
+
+func (e *element) namespace() string {
+	return e.lookupNamespace(e.Prefix)
+}
+
+func (e *element) is(namespace string, local string) bool {
+	return e.Local == local && e.namespace() == namespace
+}
+
+func (e *element) attr(local string) (string, bool) {
+	for _, a := range e.Attrs {
+		if a.Prefix == "" && a.Local == local {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+func (e *element) attrValue(local string) string {
+	value, _ := e.attr(local)
+	return value
+}
+
+func (e *element) childElements() []*element {
+	var res []*element
+	for _, child := range e.Children {
+		if el, ok := child.(*element); ok {
+			res = append(res, el)
+		}
+	}
+	return res
+}
+
+func (e *element) children(namespace string, local string) []*element {
+	var res []*element
+	for _, el := range e.childElements() {
+		if el.is(namespace, local) {
+			res = append(res, el)
+		}
+	}
+	return res
+}
+
+func (e *element) child(namespace string, local string) *element {
+	children := e.children(namespace, local)
+	if len(children) == 0 {
+		return nil
+	}
+	return children[0]
+}
+
+// textContent returns the concatenated text of the element and its descendants
+func (e *element) textContent() string {
+	var sb strings.Builder
+	for _, child := range e.Children {
+		switch c := child.(type) {
+		case text:
+			sb.WriteString(string(c))
+		case *element:
+			sb.WriteString(c.textContent())
+		}
+	}
+	return sb.String()
+}
+
+func (e *element) descendants() []*element {
+	res := []*element{e}
+	for _, el := range e.childElements() {
+		res = append(res, el.descendants()...)
+	}
+	return res
+}
@@ -0,0 +1,62 @@
+package saml
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// GroupMapping maps a group sent by the identity provider to a one-api group and role
+type GroupMapping struct {
+	IdpGroup string `json:"idp_group"`
+	Group    string `json:"group,omitempty"`
+	Role     int    `json:"role,omitempty"`
+}
+
+func ParseGroupMapping(value string) ([]GroupMapping, error) {
+	var mappings []GroupMapping
+	if value == "" {
+		return mappings, nil
+	}
+	if err := json.Unmarshal([]byte(value), &mappings); err != nil {
+		return nil, err
+	}
+	for _, mapping := range mappings {
+		if mapping.IdpGroup == "" {
+			return nil, fmt.Errorf("idp_group of a group mapping is empty")
+		}
+		// root users can't be created through single sign-on
+		if mapping.Role != 0 && mapping.Role != 1 && mapping.Role != 10 {
+			return nil, fmt.Errorf("role of group %s must be 1 (common user) or 10 (admin)", mapping.IdpGroup)
+		}
+	}
+	return mappings, nil
+}
+
+// MapGroups returns the group of the first mapping which matches and the highest matching role,
+// empty group and zero role if nothing matches
+func MapGroups(mappings []GroupMapping, idpGroups []string) (group string, role int) {
+	for _, mapping := range mappings {
+		for _, idpGroup := range idpGroups {
+			if idpGroup != mapping.IdpGroup {
+				continue
+			}
+			if group == "" {
+				group = mapping.Group
+			}
+			if mapping.Role > role {
+				role = mapping.Role
+			}
+		}
+	}
+	return group, role
+}
+
+// ManagesRoles reports whether the mappings define roles, the role of users is then derived from their groups
+func ManagesRoles(mappings []GroupMapping) bool {
+	for _, mapping := range mappings {
+		if mapping.Role != 0 {
+			return true
+		}
+	}
+	return false
+}
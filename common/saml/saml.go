@@ -0,0 +1,315 @@
+// Package saml implements the service provider side of SAML 2.0 web browser SSO:
+// HTTP-Redirect AuthnRequests, HTTP-POST responses with signed assertions and SP metadata.
+// Encrypted assertions are not supported.
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	protocolNamespace  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	assertionNamespace = "urn:oasis:names:tc:SAML:2.0:assertion"
+	metadataNamespace  = "urn:oasis:names:tc:SAML:2.0:metadata"
+
+	statusSuccess          = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	bindingHTTPPost        = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	confirmationBearer     = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	nameIdFormatUnspecfied = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+
+	// tolerated clock difference between the identity provider and us
+	clockSkew = 3 * time.Minute
+)
+
+type ServiceProvider struct {
+	EntityId       string
+	AcsURL         string
+	IdpEntityId    string // the expected issuer, not checked if empty
+	IdpSsoURL      string
+	IdpCertificate *x509.Certificate
+}
+
+type Assertion struct {
+	Id           string
+	NameId       string
+	Issuer       string
+	SessionIndex string
+	NotOnOrAfter time.Time
+	// attribute values by name, attributes with a friendly name can be found by both
+	Attributes map[string][]string
+}
+
+func (a *Assertion) Attribute(name string) string {
+	values := a.Attributes[name]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func newId() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	// xml ids must not start with a digit
+	return "_" + hex.EncodeToString(buf), nil
+}
+
+func escapeXML(s string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// AuthnRequestURL returns the url which redirects the browser to the identity provider, along with the request id
+func (sp *ServiceProvider) AuthnRequestURL(relayState string) (string, string, error) {
+	id, err := newId()
+	if err != nil {
+		return "", "", err
+	}
+	request := fmt.Sprintf(`<samlp:AuthnRequest xmlns:samlp="%s" xmlns:saml="%s" ID="%s" Version="2.0" IssueInstant="%s" Destination="%s" AssertionConsumerServiceURL="%s" ProtocolBinding="%s"><saml:Issuer>%s</saml:Issuer><samlp:NameIDPolicy Format="%s" AllowCreate="true"/></samlp:AuthnRequest>`,
+		protocolNamespace, assertionNamespace, id, time.Now().UTC().Format(time.RFC3339),
+		escapeXML(sp.IdpSsoURL), escapeXML(sp.AcsURL), bindingHTTPPost, escapeXML(sp.EntityId), nameIdFormatUnspecfied)
+	var buf bytes.Buffer
+	writer, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err = writer.Write([]byte(request)); err != nil {
+		return "", "", err
+	}
+	if err = writer.Close(); err != nil {
+		return "", "", err
+	}
+	ssoURL, err := url.Parse(sp.IdpSsoURL)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid SSO url: %w", err)
+	}
+	query := ssoURL.Query()
+	query.Set("SAMLRequest", base64.StdEncoding.EncodeToString(buf.Bytes()))
+	if relayState != "" {
+		query.Set("RelayState", relayState)
+	}
+	ssoURL.RawQuery = query.Encode()
+	return ssoURL.String(), id, nil
+}
+
+func (sp *ServiceProvider) Metadata() []byte {
+	return []byte(fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<md:EntityDescriptor xmlns:md="%s" entityID="%s">
+  <md:SPSSODescriptor AuthnRequestsSigned="false" WantAssertionsSigned="true" protocolSupportEnumeration="%s">
+    <md:NameIDFormat>%s</md:NameIDFormat>
+    <md:AssertionConsumerService Binding="%s" Location="%s" index="0" isDefault="true"/>
+  </md:SPSSODescriptor>
+</md:EntityDescriptor>
+`, metadataNamespace, escapeXML(sp.EntityId), protocolNamespace, nameIdFormatUnspecfied, bindingHTTPPost, escapeXML(sp.AcsURL)))
+}
+
+func parseTime(value string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, strings.TrimSpace(value))
+}
+
+// checkNotOnOrAfter returns an error if the optional NotOnOrAfter attribute of el has passed
+func checkNotOnOrAfter(el *element, now time.Time) (time.Time, error) {
+	value, ok := el.attr("NotOnOrAfter")
+	if !ok {
+		return time.Time{}, nil
+	}
+	notOnOrAfter, err := parseTime(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid NotOnOrAfter: %w", err)
+	}
+	if !now.Before(notOnOrAfter.Add(clockSkew)) {
+		return time.Time{}, errors.New("assertion has expired")
+	}
+	return notOnOrAfter, nil
+}
+
+// ParseResponse validates the base64 encoded SAMLResponse of the HTTP-POST binding,
+// isRequestIdValid reports whether an InResponseTo id belongs to a request we have sent
+func (sp *ServiceProvider) ParseResponse(encoded string, isRequestIdValid func(id string) bool) (*Assertion, error) {
+	if sp.IdpCertificate == nil {
+		return nil, errors.New("the certificate of the identity provider is not configured")
+	}
+	data, err := decodeBase64(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SAMLResponse encoding: %w", err)
+	}
+	response, err := parseDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	if !response.is(protocolNamespace, "Response") {
+		return nil, errors.New("not a SAML response")
+	}
+	if destination, ok := response.attr("Destination"); ok && destination != sp.AcsURL {
+		return nil, fmt.Errorf("unexpected destination: %s", destination)
+	}
+	status := response.child(protocolNamespace, "Status")
+	if status == nil {
+		return nil, errors.New("response has no status")
+	}
+	statusCode := status.child(protocolNamespace, "StatusCode")
+	if statusCode == nil || statusCode.attrValue("Value") != statusSuccess {
+		message := ""
+		if statusMessage := status.child(protocolNamespace, "StatusMessage"); statusMessage != nil {
+			message = statusMessage.textContent()
+		}
+		return nil, fmt.Errorf("identity provider returned an error: %s", strings.TrimSpace(message))
+	}
+	responseSignature, err := signatureOf(response)
+	if err != nil {
+		return nil, err
+	}
+	if responseSignature != nil {
+		if err := verifySignature(response, sp.IdpCertificate); err != nil {
+			return nil, fmt.Errorf("invalid response signature: %w", err)
+		}
+	}
+	if len(response.children(assertionNamespace, "EncryptedAssertion")) != 0 {
+		return nil, errors.New("encrypted assertions are not supported")
+	}
+	assertions := response.children(assertionNamespace, "Assertion")
+	if len(assertions) != 1 {
+		return nil, errors.New("response must contain exactly one assertion")
+	}
+	assertionEl := assertions[0]
+	assertionSignature, err := signatureOf(assertionEl)
+	if err != nil {
+		return nil, err
+	}
+	if assertionSignature == nil && responseSignature == nil {
+		return nil, errors.New("neither the response nor the assertion is signed")
+	}
+	if assertionSignature != nil {
+		if err := verifySignature(assertionEl, sp.IdpCertificate); err != nil {
+			return nil, fmt.Errorf("invalid assertion signature: %w", err)
+		}
+	}
+	return sp.parseAssertion(assertionEl, response.attrValue("InResponseTo"), isRequestIdValid)
+}
+
+func (sp *ServiceProvider) parseAssertion(el *element, inResponseTo string, isRequestIdValid func(id string) bool) (*Assertion, error) {
+	now := time.Now()
+	assertion := &Assertion{
+		Id:         el.attrValue("ID"),
+		Attributes: make(map[string][]string),
+	}
+	if assertion.Id == "" {
+		return nil, errors.New("assertion has no ID")
+	}
+	if issuer := el.child(assertionNamespace, "Issuer"); issuer != nil {
+		assertion.Issuer = strings.TrimSpace(issuer.textContent())
+	}
+	if sp.IdpEntityId != "" && assertion.Issuer != sp.IdpEntityId {
+		return nil, fmt.Errorf("unexpected issuer: %s", assertion.Issuer)
+	}
+
+	subject := el.child(assertionNamespace, "Subject")
+	if subject == nil {
+		return nil, errors.New("assertion has no subject")
+	}
+	if nameId := subject.child(assertionNamespace, "NameID"); nameId != nil {
+		assertion.NameId = strings.TrimSpace(nameId.textContent())
+	}
+	if assertion.NameId == "" {
+		return nil, errors.New("assertion has no NameID")
+	}
+	confirmed := false
+	for _, confirmation := range subject.children(assertionNamespace, "SubjectConfirmation") {
+		if confirmation.attrValue("Method") != confirmationBearer {
+			continue
+		}
+		data := confirmation.child(assertionNamespace, "SubjectConfirmationData")
+		if data == nil {
+			continue
+		}
+		if recipient := data.attrValue("Recipient"); recipient != sp.AcsURL {
+			return nil, fmt.Errorf("unexpected recipient: %s", recipient)
+		}
+		notOnOrAfter, err := checkNotOnOrAfter(data, now)
+		if err != nil {
+			return nil, err
+		}
+		if notOnOrAfter.IsZero() {
+			return nil, errors.New("bearer confirmation has no NotOnOrAfter")
+		}
+		if id, ok := data.attr("InResponseTo"); ok {
+			if inResponseTo != "" && inResponseTo != id {
+				return nil, errors.New("InResponseTo of the response and the assertion don't match")
+			}
+			inResponseTo = id
+		}
+		assertion.NotOnOrAfter = notOnOrAfter
+		confirmed = true
+		break
+	}
+	if !confirmed {
+		return nil, errors.New("assertion has no bearer subject confirmation")
+	}
+	// unsolicited responses are refused, they can't be bound to the browser which started the login
+	if inResponseTo == "" || !isRequestIdValid(inResponseTo) {
+		return nil, errors.New("response doesn't answer a pending login request")
+	}
+
+	conditions := el.child(assertionNamespace, "Conditions")
+	if conditions != nil {
+		if value, ok := conditions.attr("NotBefore"); ok {
+			notBefore, err := parseTime(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid NotBefore: %w", err)
+			}
+			if now.Add(clockSkew).Before(notBefore) {
+				return nil, errors.New("assertion is not yet valid")
+			}
+		}
+		notOnOrAfter, err := checkNotOnOrAfter(conditions, now)
+		if err != nil {
+			return nil, err
+		}
+		if !notOnOrAfter.IsZero() && notOnOrAfter.Before(assertion.NotOnOrAfter) {
+			assertion.NotOnOrAfter = notOnOrAfter
+		}
+		for _, restriction := range conditions.children(assertionNamespace, "AudienceRestriction") {
+			matched := false
+			for _, audience := range restriction.children(assertionNamespace, "Audience") {
+				if strings.TrimSpace(audience.textContent()) == sp.EntityId {
+					matched = true
+				}
+			}
+			if !matched {
+				return nil, errors.New("assertion is meant for another audience")
+			}
+		}
+	}
+
+	if authnStatement := el.child(assertionNamespace, "AuthnStatement"); authnStatement != nil {
+		assertion.SessionIndex = authnStatement.attrValue("SessionIndex")
+	}
+	for _, statement := range el.children(assertionNamespace, "AttributeStatement") {
+		for _, attribute := range statement.children(assertionNamespace, "Attribute") {
+			var values []string
+			for _, value := range attribute.children(assertionNamespace, "AttributeValue") {
+				values = append(values, strings.TrimSpace(value.textContent()))
+			}
+			name, friendlyName := attribute.attrValue("Name"), attribute.attrValue("FriendlyName")
+			assertion.Attributes[name] = append(assertion.Attributes[name], values...)
+			if friendlyName != "" && friendlyName != name {
+				assertion.Attributes[friendlyName] = append(assertion.Attributes[friendlyName], values...)
+			}
+		}
+	}
+	return assertion, nil
+}
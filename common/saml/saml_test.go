@@ -0,0 +1,123 @@
+package saml
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalize(t *testing.T) {
+	doc, err := parseDocument([]byte(`<root xmlns="urn:a" xmlns:b="urn:b" xmlns:unused="urn:u"><b:child z="1" b:y="2" a="3">t&amp;&lt;&gt;</b:child><!--c--><x/></root>`))
+	require.NoError(t, err)
+	assert.Equal(t, `<root xmlns="urn:a"><b:child xmlns:b="urn:b" a="3" z="1" b:y="2">t&amp;&lt;&gt;</b:child><x></x></root>`, string(canonicalize(doc, nil, false, nil)))
+	assert.Equal(t, `<b:child xmlns:b="urn:b" a="3" z="1" b:y="2">t&amp;&lt;&gt;</b:child>`, string(canonicalize(doc.childElements()[0], nil, false, nil)))
+	assert.Equal(t, `<b:child xmlns="urn:a" xmlns:b="urn:b" a="3" z="1" b:y="2">t&amp;&lt;&gt;</b:child>`, string(canonicalize(doc.childElements()[0], []string{"#default"}, false, nil)))
+
+	_, err = parseDocument([]byte(`<!DOCTYPE x [<!ENTITY a "b">]><x>&a;</x>`))
+	assert.Error(t, err)
+}
+
+const (
+	testAcsURL   = "https://one-api.example.com/api/oauth/saml/acs"
+	testEntityId = "https://one-api.example.com/api/oauth/saml/metadata"
+	testIssuer   = "https://idp.example.com"
+)
+
+func newTestIdp(t *testing.T) (*rsa.PrivateKey, *x509.Certificate) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return key, cert
+}
+
+// signAssertion inserts an enveloped signature into the assertion of a response
+func signAssertion(t *testing.T, key *rsa.PrivateKey, response string) string {
+	doc, err := parseDocument([]byte(response))
+	require.NoError(t, err)
+	assertion := doc.child(assertionNamespace, "Assertion")
+	sum := sha256.Sum256(canonicalize(assertion, nil, false, nil))
+	signature := fmt.Sprintf(`<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo><ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/><ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"/><ds:Reference URI="#%s"><ds:Transforms><ds:Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"/><ds:Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/></ds:Transforms><ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"/><ds:DigestValue>%s</ds:DigestValue></ds:Reference></ds:SignedInfo><ds:SignatureValue>SIGNATURE</ds:SignatureValue></ds:Signature>`,
+		assertion.attrValue("ID"), base64.StdEncoding.EncodeToString(sum[:]))
+	marker := "</saml:Issuer>"
+	index := strings.Index(response, "<saml:Assertion")
+	index += strings.Index(response[index:], marker) + len(marker)
+	signed := response[:index] + signature + response[index:]
+
+	doc, err = parseDocument([]byte(signed))
+	require.NoError(t, err)
+	signedInfo := doc.child(assertionNamespace, "Assertion").child(dsigNamespace, "Signature").child(dsigNamespace, "SignedInfo")
+	hashed := sha256.Sum256(canonicalize(signedInfo, nil, false, nil))
+	value, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	require.NoError(t, err)
+	return strings.Replace(signed, "SIGNATURE", base64.StdEncoding.EncodeToString(value), 1)
+}
+
+func testResponse(requestId string, email string) string {
+	now := time.Now().UTC()
+	return fmt.Sprintf(`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_resp" Version="2.0" Destination="%[1]s" InResponseTo="%[2]s">
+<saml:Issuer>%[3]s</saml:Issuer>
+<samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>
+<saml:Assertion ID="_assertion" Version="2.0" IssueInstant="%[4]s">
+<saml:Issuer>%[3]s</saml:Issuer>
+<saml:Subject><saml:NameID>alice</saml:NameID><saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer"><saml:SubjectConfirmationData Recipient="%[1]s" InResponseTo="%[2]s" NotOnOrAfter="%[5]s"/></saml:SubjectConfirmation></saml:Subject>
+<saml:Conditions NotBefore="%[4]s" NotOnOrAfter="%[5]s"><saml:AudienceRestriction><saml:Audience>%[6]s</saml:Audience></saml:AudienceRestriction></saml:Conditions>
+<saml:AttributeStatement><saml:Attribute Name="urn:oid:0.9.2342.19200300.100.1.3" FriendlyName="mail"><saml:AttributeValue>%[7]s</saml:AttributeValue></saml:Attribute><saml:Attribute Name="groups"><saml:AttributeValue>staff</saml:AttributeValue><saml:AttributeValue>admins</saml:AttributeValue></saml:Attribute></saml:AttributeStatement>
+</saml:Assertion>
+</samlp:Response>`, testAcsURL, requestId, testIssuer, now.Format(time.RFC3339), now.Add(5*time.Minute).Format(time.RFC3339), testEntityId, email)
+}
+
+func TestParseResponse(t *testing.T) {
+	key, cert := newTestIdp(t)
+	sp := &ServiceProvider{EntityId: testEntityId, AcsURL: testAcsURL, IdpEntityId: testIssuer, IdpCertificate: cert}
+	isValid := func(id string) bool { return id == "_req" }
+	encode := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+
+	signed := signAssertion(t, key, testResponse("_req", "alice@example.com"))
+	assertion, err := sp.ParseResponse(encode(signed), isValid)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", assertion.NameId)
+	assert.Equal(t, "alice@example.com", assertion.Attribute("mail"))
+	assert.Equal(t, []string{"staff", "admins"}, assertion.Attributes["groups"])
+
+	_, err = sp.ParseResponse(encode(signed), func(string) bool { return false })
+	assert.Error(t, err, "unsolicited responses are refused")
+
+	tampered := strings.Replace(signed, "alice@example.com", "mallory@example.com", 1)
+	_, err = sp.ParseResponse(encode(tampered), isValid)
+	assert.ErrorContains(t, err, "digest mismatch")
+
+	_, err = sp.ParseResponse(encode(testResponse("_req", "alice@example.com")), isValid)
+	assert.Error(t, err, "unsigned responses are refused")
+
+	// an unsigned assertion next to the signed one
+	index := strings.Index(signed, "</samlp:Response>")
+	wrapped := signed[:index] + `<saml:Assertion ID="_evil"><saml:Subject><saml:NameID>root</saml:NameID></saml:Subject></saml:Assertion>` + signed[index:]
+	_, err = sp.ParseResponse(encode(wrapped), isValid)
+	assert.Error(t, err)
+
+	_, otherCert := newTestIdp(t)
+	sp.IdpCertificate = otherCert
+	_, err = sp.ParseResponse(encode(signed), isValid)
+	assert.ErrorContains(t, err, "invalid signature")
+}
@@ -0,0 +1,232 @@
+package saml
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"strings"
+)
+
+// XML signature (https://www.w3.org/TR/xmldsig-core1/) verification, limited to what SAML identity providers use:
+// one enveloped signature per element, referencing the element by its ID and exclusive canonicalization
+
+const (
+	dsigNamespace = "http://www.w3.org/2000/09/xmldsig#"
+
+	transformEnveloped       = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	canonicalizationExc      = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	canonicalizationExcWithC = "http://www.w3.org/2001/10/xml-exc-c14n#WithComments"
+)
+
+var digestAlgorithms = map[string]crypto.Hash{
+	"http://www.w3.org/2000/09/xmldsig#sha1":  crypto.SHA1,
+	"http://www.w3.org/2001/04/xmlenc#sha256": crypto.SHA256,
+	"http://www.w3.org/2001/04/xmlenc#sha512": crypto.SHA512,
+}
+
+var signatureAlgorithms = map[string]crypto.Hash{
+	"http://www.w3.org/2000/09/xmldsig#rsa-sha1":          crypto.SHA1,
+	"http://www.w3.org/2001/04/xmldsig-more#rsa-sha256":   crypto.SHA256,
+	"http://www.w3.org/2001/04/xmldsig-more#rsa-sha512":   crypto.SHA512,
+	"http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256": crypto.SHA256,
+	"http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha512": crypto.SHA512,
+}
+
+func newHash(h crypto.Hash) hash.Hash {
+	switch h {
+	case crypto.SHA1:
+		return sha1.New()
+	case crypto.SHA512:
+		return sha512.New()
+	}
+	return sha256.New()
+}
+
+func digest(h crypto.Hash, data []byte) []byte {
+	hasher := newHash(h)
+	hasher.Write(data)
+	return hasher.Sum(nil)
+}
+
+// canonicalizationOf returns the canonicalization settings of a CanonicalizationMethod or Transform element
+func canonicalizationOf(method *element) (withComments bool, prefixes []string, err error) {
+	switch method.attrValue("Algorithm") {
+	case canonicalizationExc:
+	case canonicalizationExcWithC:
+		withComments = true
+	default:
+		return false, nil, fmt.Errorf("unsupported canonicalization: %s", method.attrValue("Algorithm"))
+	}
+	for _, el := range method.childElements() {
+		if el.Local == "InclusiveNamespaces" {
+			prefixes = strings.Fields(el.attrValue("PrefixList"))
+		}
+	}
+	return withComments, prefixes, nil
+}
+
+// signatureOf returns the enveloped signature of the element, nil if it isn't signed
+func signatureOf(e *element) (*element, error) {
+	signatures := e.children(dsigNamespace, "Signature")
+	if len(signatures) > 1 {
+		return nil, errors.New("multiple signatures")
+	}
+	if len(signatures) == 0 {
+		return nil, nil
+	}
+	return signatures[0], nil
+}
+
+// verifySignature checks the enveloped signature of the element against the certificate of the identity provider,
+// the signature must cover the element itself so that no unsigned content can be wrapped around it
+func verifySignature(e *element, cert *x509.Certificate) error {
+	signature, err := signatureOf(e)
+	if err != nil {
+		return err
+	}
+	if signature == nil {
+		return errors.New("element is not signed")
+	}
+	signedInfo := signature.child(dsigNamespace, "SignedInfo")
+	if signedInfo == nil {
+		return errors.New("signature has no SignedInfo")
+	}
+	references := signedInfo.children(dsigNamespace, "Reference")
+	if len(references) != 1 {
+		return errors.New("signature must have exactly one reference")
+	}
+	reference := references[0]
+	id := e.attrValue("ID")
+	if id == "" || reference.attrValue("URI") != "#"+id {
+		return errors.New("signature doesn't reference the signed element")
+	}
+
+	// digest of the referenced element
+	withComments, prefixes := false, []string(nil)
+	enveloped := false
+	if transforms := reference.child(dsigNamespace, "Transforms"); transforms != nil {
+		for _, transform := range transforms.children(dsigNamespace, "Transform") {
+			if transform.attrValue("Algorithm") == transformEnveloped {
+				enveloped = true
+				continue
+			}
+			withComments, prefixes, err = canonicalizationOf(transform)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if !enveloped {
+		return errors.New("signature must be enveloped")
+	}
+	digestMethod := reference.child(dsigNamespace, "DigestMethod")
+	if digestMethod == nil {
+		return errors.New("reference has no DigestMethod")
+	}
+	digestHash, ok := digestAlgorithms[digestMethod.attrValue("Algorithm")]
+	if !ok {
+		return fmt.Errorf("unsupported digest algorithm: %s", digestMethod.attrValue("Algorithm"))
+	}
+	digestValueEl := reference.child(dsigNamespace, "DigestValue")
+	if digestValueEl == nil {
+		return errors.New("reference has no DigestValue")
+	}
+	digestValue, err := decodeBase64(digestValueEl.textContent())
+	if err != nil {
+		return fmt.Errorf("invalid digest value: %w", err)
+	}
+	actualDigest := digest(digestHash, canonicalize(e, prefixes, withComments, signature))
+	if subtle.ConstantTimeCompare(actualDigest, digestValue) != 1 {
+		return errors.New("digest mismatch, the signed element has been modified")
+	}
+
+	// signature of SignedInfo
+	canonicalizationMethod := signedInfo.child(dsigNamespace, "CanonicalizationMethod")
+	if canonicalizationMethod == nil {
+		return errors.New("signature has no CanonicalizationMethod")
+	}
+	withComments, prefixes, err = canonicalizationOf(canonicalizationMethod)
+	if err != nil {
+		return err
+	}
+	signatureMethod := signedInfo.child(dsigNamespace, "SignatureMethod")
+	if signatureMethod == nil {
+		return errors.New("signature has no SignatureMethod")
+	}
+	algorithm := signatureMethod.attrValue("Algorithm")
+	signatureHash, ok := signatureAlgorithms[algorithm]
+	if !ok {
+		return fmt.Errorf("unsupported signature algorithm: %s", algorithm)
+	}
+	signatureValueEl := signature.child(dsigNamespace, "SignatureValue")
+	if signatureValueEl == nil {
+		return errors.New("signature has no SignatureValue")
+	}
+	signatureValue, err := decodeBase64(signatureValueEl.textContent())
+	if err != nil {
+		return fmt.Errorf("invalid signature value: %w", err)
+	}
+	hashed := digest(signatureHash, canonicalize(signedInfo, prefixes, withComments, nil))
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if !strings.Contains(algorithm, "#rsa-") {
+			return errors.New("signature algorithm doesn't match the certificate")
+		}
+		if err := rsa.VerifyPKCS1v15(key, signatureHash, hashed, signatureValue); err != nil {
+			return errors.New("invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		if !strings.Contains(algorithm, "#ecdsa-") {
+			return errors.New("signature algorithm doesn't match the certificate")
+		}
+		// XML signatures encode r and s as big-endian integers of the size of the curve
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(signatureValue) != 2*size {
+			return errors.New("invalid signature")
+		}
+		r := new(big.Int).SetBytes(signatureValue[:size])
+		s := new(big.Int).SetBytes(signatureValue[size:])
+		if !ecdsa.Verify(key, hashed, r, s) {
+			return errors.New("invalid signature")
+		}
+	default:
+		return errors.New("unsupported certificate key type")
+	}
+	return nil
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, s)
+	return base64.StdEncoding.DecodeString(s)
+}
+
+// ParseCertificate accepts a PEM certificate or its bare base64 body as shown in IdP metadata
+func ParseCertificate(data string) (*x509.Certificate, error) {
+	data = strings.TrimSpace(data)
+	data = strings.TrimPrefix(data, "-----BEGIN CERTIFICATE-----")
+	data = strings.TrimSuffix(data, "-----END CERTIFICATE-----")
+	der, err := decodeBase64(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate: %w", err)
+	}
+	return cert, nil
+}
@@ -0,0 +1,198 @@
+package saml
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalizeNamespaceRedeclarations(t *testing.T) {
+	cases := []struct {
+		input     string
+		canonical string
+	}{
+		// a redeclaration of the same namespace is not rendered again
+		{`<a xmlns:p="urn:1"><b xmlns:p="urn:1"><p:c/></b></a>`, `<a><b><p:c xmlns:p="urn:1"></p:c></b></a>`},
+		{`<p:a xmlns:p="urn:1"><p:b xmlns:p="urn:1"/></p:a>`, `<p:a xmlns:p="urn:1"><p:b></p:b></p:a>`},
+		// a prefix bound to another namespace is
+		{`<p:a xmlns:p="urn:1"><p:b xmlns:p="urn:2"><p:c/></p:b></p:a>`, `<p:a xmlns:p="urn:1"><p:b xmlns:p="urn:2"><p:c></p:c></p:b></p:a>`},
+		{`<a xmlns="urn:a"><b xmlns="urn:a"/></a>`, `<a xmlns="urn:a"><b></b></a>`},
+		// the default namespace can be undeclared
+		{`<a xmlns="urn:a"><b xmlns=""><c/></b></a>`, `<a xmlns="urn:a"><b xmlns=""><c></c></b></a>`},
+		{`<a><b xmlns=""/></a>`, `<a><b></b></a>`},
+		// attributes are sorted by namespace uri, not by prefix
+		{`<a xmlns:x="urn:z" xmlns:y="urn:a" x:k="1" y:k="2"/>`, `<a xmlns:x="urn:z" xmlns:y="urn:a" y:k="2" x:k="1"></a>`},
+	}
+	for _, c := range cases {
+		doc, err := parseDocument([]byte(c.input))
+		require.NoError(t, err)
+		assert.Equal(t, c.canonical, string(canonicalize(doc, nil, false, nil)), c.input)
+	}
+
+	_, err := parseDocument([]byte(`<a><p:b/></a>`))
+	assert.Error(t, err, "undeclared prefixes are refused")
+}
+
+// cut returns the first occurrence of the element starting with start and ending with end in s
+func cut(s string, start string, end string) string {
+	index := strings.Index(s, start)
+	return s[index : index+strings.Index(s[index:], end)+len(end)]
+}
+
+func TestSignatureWrapping(t *testing.T) {
+	key, cert := newTestIdp(t)
+	sp := &ServiceProvider{EntityId: testEntityId, AcsURL: testAcsURL, IdpEntityId: testIssuer, IdpCertificate: cert}
+	isValid := func(id string) bool { return id == "_req" }
+	encode := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+
+	signed := signAssertion(t, key, testResponse("_req", "alice@example.com"))
+	signedAssertion := cut(signed, "<saml:Assertion", "</saml:Assertion>")
+	signature := cut(signed, "<ds:Signature", "</ds:Signature>")
+	forged := strings.Replace(signedAssertion, "<saml:NameID>alice</saml:NameID>", "<saml:NameID>root</saml:NameID>", 1)
+	unsigned := strings.Replace(forged, signature, "", 1)
+	replace := func(assertions string) string {
+		return strings.Replace(signed, signedAssertion, assertions, 1)
+	}
+
+	cases := []struct {
+		name     string
+		response string
+		err      string
+	}{
+		{
+			"the signed assertion wrapped in an unsigned one",
+			replace(strings.Replace(unsigned, "</saml:Assertion>", signedAssertion+"</saml:Assertion>", 1)),
+			"neither the response nor the assertion is signed",
+		},
+		{
+			"the signature moved to a wrapping assertion with another ID",
+			replace(strings.Replace(strings.Replace(forged, `ID="_assertion"`, `ID="_evil"`, 1), "</saml:Assertion>", signedAssertion+"</saml:Assertion>", 1)),
+			"doesn't reference the signed element",
+		},
+		{
+			"a forged assertion with the ID of the signed one, which is hidden in the extensions",
+			strings.Replace(replace(forged), "<samlp:Status>", "<samlp:Extensions>"+signedAssertion+"</samlp:Extensions><samlp:Status>", 1),
+			"digest mismatch",
+		},
+		{
+			"two assertions with the same ID",
+			replace(forged + signedAssertion),
+			"exactly one assertion",
+		},
+		{
+			"two signatures on the assertion",
+			replace(strings.Replace(signedAssertion, signature, signature+signature, 1)),
+			"multiple signatures",
+		},
+	}
+	for _, c := range cases {
+		assertion, err := sp.ParseResponse(encode(c.response), isValid)
+		assert.ErrorContains(t, err, c.err, c.name)
+		assert.Nil(t, assertion, c.name)
+	}
+}
+
+func TestCommentInNameId(t *testing.T) {
+	key, cert := newTestIdp(t)
+	sp := &ServiceProvider{EntityId: testEntityId, AcsURL: testAcsURL, IdpEntityId: testIssuer, IdpCertificate: cert}
+	isValid := func(id string) bool { return id == "_req" }
+
+	// the identity provider signs the account of the attacker
+	response := strings.Replace(testResponse("_req", "x@example.com"), "<saml:NameID>alice</saml:NameID>", "<saml:NameID>admin@example.com.evil.com</saml:NameID>", 1)
+	signed := signAssertion(t, key, response)
+	// comments are not part of the canonical form, so the signature stays valid,
+	// but the name must not be truncated at the comment
+	injected := strings.Replace(signed, "admin@example.com.evil.com", "admin@example.com<!---->.evil.com", 1)
+	assertion, err := sp.ParseResponse(base64.StdEncoding.EncodeToString([]byte(injected)), isValid)
+	require.NoError(t, err)
+	assert.Equal(t, "admin@example.com.evil.com", assertion.NameId)
+}
+
+func TestRedeclaredNamespaceKeepsSignature(t *testing.T) {
+	key, cert := newTestIdp(t)
+	sp := &ServiceProvider{EntityId: testEntityId, AcsURL: testAcsURL, IdpEntityId: testIssuer, IdpCertificate: cert}
+	isValid := func(id string) bool { return id == "_req" }
+	encode := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+
+	signed := signAssertion(t, key, testResponse("_req", "alice@example.com"))
+	// the same namespace declared again on the assertion doesn't change its canonical form
+	redeclared := strings.Replace(signed, `<saml:Assertion ID=`, `<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID=`, 1)
+	_, err := sp.ParseResponse(encode(redeclared), isValid)
+	assert.NoError(t, err)
+
+	// binding the prefix to another namespace does
+	rebound := strings.Replace(signed, `<saml:NameID>`, `<saml:NameID xmlns:saml="urn:evil">`, 1)
+	_, err = sp.ParseResponse(encode(rebound), isValid)
+	assert.Error(t, err)
+}
+
+func newTestEcdsaIdp(t *testing.T) (*ecdsa.PrivateKey, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return key, cert
+}
+
+// signEcdsa signs SignedInfo of the assertion and encodes r and s with the given size each
+func signEcdsa(t *testing.T, key *ecdsa.PrivateKey, response string, size int) string {
+	doc, err := parseDocument([]byte(response))
+	require.NoError(t, err)
+	signedInfo := doc.child(assertionNamespace, "Assertion").child(dsigNamespace, "Signature").child(dsigNamespace, "SignedInfo")
+	hashed := sha256.Sum256(canonicalize(signedInfo, nil, false, nil))
+	r, s, err := ecdsa.Sign(rand.Reader, key, hashed[:])
+	require.NoError(t, err)
+	value := append(r.FillBytes(make([]byte, size)), s.FillBytes(make([]byte, size))...)
+	signatureValue := cut(response, "<ds:SignatureValue>", "</ds:SignatureValue>")
+	return strings.Replace(response, signatureValue, fmt.Sprintf("<ds:SignatureValue>%s</ds:SignatureValue>", base64.StdEncoding.EncodeToString(value)), 1)
+}
+
+func TestEcdsaSignature(t *testing.T) {
+	rsaKey, _ := newTestIdp(t)
+	key, cert := newTestEcdsaIdp(t)
+	sp := &ServiceProvider{EntityId: testEntityId, AcsURL: testAcsURL, IdpEntityId: testIssuer, IdpCertificate: cert}
+	isValid := func(id string) bool { return id == "_req" }
+	encode := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+
+	// reuse the rsa helper for the digest, then replace the signature
+	rsaSigned := signAssertion(t, rsaKey, testResponse("_req", "alice@example.com"))
+	_, err := sp.ParseResponse(encode(rsaSigned), isValid)
+	assert.ErrorContains(t, err, "doesn't match the certificate")
+
+	unsigned := strings.Replace(rsaSigned, "#rsa-sha256", "#ecdsa-sha256", 1)
+	_, err = sp.ParseResponse(encode(signEcdsa(t, key, unsigned, 32)), isValid)
+	assert.NoError(t, err)
+
+	// r and s padded with zeros are the same numbers, but not a valid encoding
+	_, err = sp.ParseResponse(encode(signEcdsa(t, key, unsigned, 33)), isValid)
+	assert.ErrorContains(t, err, "invalid signature")
+	signed := signEcdsa(t, key, unsigned, 32)
+	signatureValue := cut(signed, "<ds:SignatureValue>", "</ds:SignatureValue>")
+	value, err := decodeBase64(strings.TrimSuffix(strings.TrimPrefix(signatureValue, "<ds:SignatureValue>"), "</ds:SignatureValue>"))
+	require.NoError(t, err)
+	for _, truncated := range [][]byte{value[:63], value[:62], {}} {
+		forged := strings.Replace(signed, signatureValue, "<ds:SignatureValue>"+base64.StdEncoding.EncodeToString(truncated)+"</ds:SignatureValue>", 1)
+		_, err = sp.ParseResponse(encode(forged), isValid)
+		assert.ErrorContains(t, err, "invalid signature", "%d bytes", len(truncated))
+	}
+}
@@ -0,0 +1,179 @@
+// Package secret implements envelope encryption for values stored at rest.
+// Every value is encrypted with a random data key, and the data key is encrypted with the master key.
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+// encrypted values look like enc:v1:<key id>:<encrypted data key>:<encrypted value>
+const prefix = "enc:v1:"
+
+type masterKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+var currentKey *masterKey
+var keys = make(map[string]*masterKey)
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func newMasterKey(raw string) (*masterKey, error) {
+	sum := sha256.Sum256([]byte(raw))
+	aead, err := newAEAD(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	idSum := sha256.Sum256(sum[:])
+	return &masterKey{id: hex.EncodeToString(idSum[:4]), aead: aead}, nil
+}
+
+// Init loads the master keys from the environment, encryption stays disabled if no key is configured
+func Init() error {
+	return initKeys(config.EncryptionKey, config.EncryptionKeyFile, config.EncryptionOldKeys)
+}
+
+func initKeys(key string, keyFile string, oldKeys string) error {
+	if key == "" && keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read encryption key file: %w", err)
+		}
+		key = strings.TrimSpace(string(data))
+	}
+	currentKey = nil
+	keys = make(map[string]*masterKey)
+	if key != "" {
+		mk, err := newMasterKey(key)
+		if err != nil {
+			return err
+		}
+		currentKey = mk
+		keys[mk.id] = mk
+	}
+	for _, oldKey := range strings.Split(oldKeys, ",") {
+		oldKey = strings.TrimSpace(oldKey)
+		if oldKey == "" {
+			continue
+		}
+		mk, err := newMasterKey(oldKey)
+		if err != nil {
+			return err
+		}
+		if _, ok := keys[mk.id]; !ok {
+			keys[mk.id] = mk
+		}
+	}
+	return nil
+}
+
+func Enabled() bool {
+	return currentKey != nil
+}
+
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// IsCurrent reports whether the value is already encrypted with the current master key
+func IsCurrent(value string) bool {
+	if !IsEncrypted(value) || currentKey == nil {
+		return false
+	}
+	return strings.HasPrefix(value, prefix+currentKey.id+":")
+}
+
+func seal(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(aead cipher.AEAD, data []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("encrypted data is too short")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+}
+
+// Encrypt encrypts the value with the current master key, it returns the value as is if encryption is disabled
+func Encrypt(value string) (string, error) {
+	if currentKey == nil || value == "" || IsEncrypted(value) {
+		return value, nil
+	}
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	encryptedValue, err := seal(dataAEAD, []byte(value))
+	if err != nil {
+		return "", err
+	}
+	encryptedDataKey, err := seal(currentKey.aead, dataKey)
+	if err != nil {
+		return "", err
+	}
+	return prefix + currentKey.id + ":" +
+		base64.RawStdEncoding.EncodeToString(encryptedDataKey) + ":" +
+		base64.RawStdEncoding.EncodeToString(encryptedValue), nil
+}
+
+// Decrypt decrypts a value produced by Encrypt, values which are not encrypted are returned as is
+func Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return "", errors.New("malformed encrypted value")
+	}
+	mk, ok := keys[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("encryption key %s is not configured", parts[0])
+	}
+	encryptedDataKey, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", err
+	}
+	encryptedValue, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := open(mk.aead, encryptedDataKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt data key: %w", err)
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dataAEAD, encryptedValue)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return string(plaintext), nil
+}
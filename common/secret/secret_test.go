@@ -0,0 +1,54 @@
+package secret
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	require.NoError(t, initKeys("", "", ""))
+	value, err := Encrypt("sk-plain")
+	require.NoError(t, err)
+	assert.Equal(t, "sk-plain", value, "encryption is disabled without a key")
+
+	require.NoError(t, initKeys("master-key", "", ""))
+	encrypted, err := Encrypt("sk-secret")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encrypted, prefix))
+	assert.NotContains(t, encrypted, "sk-secret")
+	assert.True(t, IsCurrent(encrypted))
+
+	decrypted, err := Decrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "sk-secret", decrypted)
+
+	plain, err := Decrypt("sk-legacy")
+	require.NoError(t, err)
+	assert.Equal(t, "sk-legacy", plain)
+
+	_, err = Decrypt(encrypted[:len(encrypted)-2] + "AA")
+	assert.Error(t, err)
+}
+
+func TestKeyRotation(t *testing.T) {
+	require.NoError(t, initKeys("old-key", "", ""))
+	encrypted, err := Encrypt("sk-secret")
+	require.NoError(t, err)
+
+	require.NoError(t, initKeys("new-key", "", ""))
+	_, err = Decrypt(encrypted)
+	assert.Error(t, err, "the old key is no longer known")
+
+	require.NoError(t, initKeys("new-key", "", "old-key"))
+	assert.False(t, IsCurrent(encrypted))
+	decrypted, err := Decrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "sk-secret", decrypted)
+
+	reencrypted, err := Encrypt(decrypted)
+	require.NoError(t, err)
+	assert.True(t, IsCurrent(reencrypted))
+}
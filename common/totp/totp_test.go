@@ -0,0 +1,41 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateCode(t *testing.T) {
+	// test vector of RFC 6238 with the SHA1 secret "12345678901234567890"
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	code, err := GenerateCode(secret, Step(time.Unix(59, 0)))
+	assert.NoError(t, err)
+	assert.Equal(t, "287082", code)
+	code, err = GenerateCode(secret, Step(time.Unix(1111111109, 0)))
+	assert.NoError(t, err)
+	assert.Equal(t, "081804", code)
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	assert.NoError(t, err)
+	now := time.Now()
+	code, err := GenerateCode(secret, Step(now))
+	assert.NoError(t, err)
+
+	step, ok := Validate(secret, code, now, 0)
+	assert.True(t, ok)
+	assert.Equal(t, Step(now), step)
+
+	_, ok = Validate(secret, code, now.Add(30*time.Second), 0)
+	assert.True(t, ok, "the previous period is accepted")
+	_, ok = Validate(secret, code, now.Add(2*time.Minute), 0)
+	assert.False(t, ok)
+	_, ok = Validate(secret, code, now, step)
+	assert.False(t, ok, "a used code can't be replayed")
+	_, ok = Validate(secret, "12345", now, 0)
+	assert.False(t, ok)
+}
@@ -0,0 +1,134 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// a minimal CBOR decoder which covers what authenticators send: integers, byte and text strings,
+// arrays, maps and simple values, indefinite lengths are not supported
+
+var errTruncated = errors.New("cbor: unexpected end of data")
+
+const maxCBORDepth = 16
+
+// decodeCBOR decodes the first item of data and returns the number of bytes consumed
+func decodeCBOR(data []byte) (any, int, error) {
+	return decodeItem(data, 0)
+}
+
+func readArgument(data []byte, info byte) (uint64, int, error) {
+	switch {
+	case info < 24:
+		return uint64(info), 0, nil
+	case info == 24:
+		if len(data) < 1 {
+			return 0, 0, errTruncated
+		}
+		return uint64(data[0]), 1, nil
+	case info == 25:
+		if len(data) < 2 {
+			return 0, 0, errTruncated
+		}
+		return uint64(binary.BigEndian.Uint16(data)), 2, nil
+	case info == 26:
+		if len(data) < 4 {
+			return 0, 0, errTruncated
+		}
+		return uint64(binary.BigEndian.Uint32(data)), 4, nil
+	case info == 27:
+		if len(data) < 8 {
+			return 0, 0, errTruncated
+		}
+		return binary.BigEndian.Uint64(data), 8, nil
+	}
+	return 0, 0, fmt.Errorf("cbor: unsupported additional info %d", info)
+}
+
+func decodeItem(data []byte, depth int) (any, int, error) {
+	if depth > maxCBORDepth {
+		return nil, 0, errors.New("cbor: nesting too deep")
+	}
+	if len(data) < 1 {
+		return nil, 0, errTruncated
+	}
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, 1, nil
+		case 21:
+			return true, 1, nil
+		case 22, 23:
+			return nil, 1, nil
+		}
+		return nil, 0, fmt.Errorf("cbor: unsupported simple value %d", info)
+	}
+	arg, n, err := readArgument(data[1:], info)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset := 1 + n
+	switch major {
+	case 0:
+		if arg > 1<<63-1 {
+			return nil, 0, errors.New("cbor: integer overflow")
+		}
+		return int64(arg), offset, nil
+	case 1:
+		if arg > 1<<63-1 {
+			return nil, 0, errors.New("cbor: integer overflow")
+		}
+		return -1 - int64(arg), offset, nil
+	case 2, 3:
+		if uint64(len(data)-offset) < arg {
+			return nil, 0, errTruncated
+		}
+		value := data[offset : offset+int(arg)]
+		if major == 3 {
+			return string(value), offset + int(arg), nil
+		}
+		return value, offset + int(arg), nil
+	case 4:
+		if arg > uint64(len(data)) {
+			return nil, 0, errTruncated
+		}
+		items := make([]any, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			item, n, err := decodeItem(data[offset:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			items = append(items, item)
+			offset += n
+		}
+		return items, offset, nil
+	case 5:
+		if arg > uint64(len(data)) {
+			return nil, 0, errTruncated
+		}
+		items := make(map[any]any, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, n, err := decodeItem(data[offset:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			offset += n
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, 0, errors.New("cbor: unsupported map key type")
+			}
+			value, n, err := decodeItem(data[offset:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			offset += n
+			items[key] = value
+		}
+		return items, offset, nil
+	}
+	return nil, 0, fmt.Errorf("cbor: unsupported major type %d", major)
+}
@@ -0,0 +1,212 @@
+// Package webauthn verifies the registration and authentication ceremonies of passkeys.
+// Attestation statements are not verified, which is equivalent to requesting "none" attestation.
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+const (
+	flagUserPresent      = 0x01
+	flagAttestedCredData = 0x40
+
+	AlgES256 = -7
+	AlgRS256 = -257
+)
+
+var Encoding = base64.RawURLEncoding
+
+type Credential struct {
+	ID        []byte
+	PublicKey []byte // COSE encoded
+	SignCount uint32
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type authenticatorData struct {
+	rpIdHash  []byte
+	flags     byte
+	signCount uint32
+	// only present during registration
+	credentialId []byte
+	publicKey    []byte
+}
+
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, 32)
+	_, err := rand.Read(challenge)
+	return challenge, err
+}
+
+func verifyClientData(raw []byte, ceremony string, origin string, challenge []byte) error {
+	var data clientData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return fmt.Errorf("invalid client data: %w", err)
+	}
+	if data.Type != ceremony {
+		return fmt.Errorf("unexpected client data type: %s", data.Type)
+	}
+	received, err := Encoding.DecodeString(data.Challenge)
+	if err != nil || subtle.ConstantTimeCompare(received, challenge) != 1 {
+		return errors.New("challenge mismatch")
+	}
+	if data.Origin != origin {
+		return fmt.Errorf("unexpected origin: %s", data.Origin)
+	}
+	return nil
+}
+
+func parseAuthenticatorData(data []byte, rpId string) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, errors.New("authenticator data is too short")
+	}
+	authData := &authenticatorData{
+		rpIdHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rpIdHash := sha256.Sum256([]byte(rpId))
+	if !bytes.Equal(authData.rpIdHash, rpIdHash[:]) {
+		return nil, errors.New("relying party id mismatch")
+	}
+	if authData.flags&flagUserPresent == 0 {
+		return nil, errors.New("user is not present")
+	}
+	if authData.flags&flagAttestedCredData == 0 {
+		return authData, nil
+	}
+	rest := data[37:]
+	// aaguid followed by the length of the credential id
+	if len(rest) < 18 {
+		return nil, errors.New("attested credential data is too short")
+	}
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < idLength {
+		return nil, errors.New("credential id is truncated")
+	}
+	authData.credentialId = rest[:idLength]
+	rest = rest[idLength:]
+	_, n, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credential public key: %w", err)
+	}
+	authData.publicKey = rest[:n]
+	return authData, nil
+}
+
+// VerifyRegistration verifies the response of navigator.credentials.create and returns the new credential
+func VerifyRegistration(rpId string, origin string, challenge []byte, clientDataJSON []byte, attestationObject []byte) (*Credential, error) {
+	if err := verifyClientData(clientDataJSON, "webauthn.create", origin, challenge); err != nil {
+		return nil, err
+	}
+	decoded, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attestation object: %w", err)
+	}
+	attestation, ok := decoded.(map[any]any)
+	if !ok {
+		return nil, errors.New("invalid attestation object")
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, errors.New("attestation object has no authenticator data")
+	}
+	authData, err := parseAuthenticatorData(rawAuthData, rpId)
+	if err != nil {
+		return nil, err
+	}
+	if authData.credentialId == nil {
+		return nil, errors.New("no attested credential data")
+	}
+	if _, err := parsePublicKey(authData.publicKey); err != nil {
+		return nil, err
+	}
+	return &Credential{
+		ID:        append([]byte(nil), authData.credentialId...),
+		PublicKey: append([]byte(nil), authData.publicKey...),
+		SignCount: authData.signCount,
+	}, nil
+}
+
+// VerifyAssertion verifies the response of navigator.credentials.get and returns the new signature counter
+func VerifyAssertion(rpId string, origin string, challenge []byte, credential *Credential, clientDataJSON []byte, rawAuthData []byte, signature []byte) (uint32, error) {
+	if err := verifyClientData(clientDataJSON, "webauthn.get", origin, challenge); err != nil {
+		return 0, err
+	}
+	authData, err := parseAuthenticatorData(rawAuthData, rpId)
+	if err != nil {
+		return 0, err
+	}
+	publicKey, err := parsePublicKey(credential.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte(nil), rawAuthData...), clientDataHash[:]...))
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest[:], signature) {
+			return 0, errors.New("invalid signature")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return 0, errors.New("invalid signature")
+		}
+	}
+	if (authData.signCount != 0 || credential.SignCount != 0) && authData.signCount <= credential.SignCount {
+		return 0, errors.New("signature counter did not increase, the authenticator may be cloned")
+	}
+	return authData.signCount, nil
+}
+
+func parsePublicKey(coseKey []byte) (crypto.PublicKey, error) {
+	decoded, _, err := decodeCBOR(coseKey)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := decoded.(map[any]any)
+	if !ok {
+		return nil, errors.New("invalid COSE key")
+	}
+	alg, _ := key[int64(3)].(int64)
+	switch alg {
+	case AlgES256:
+		x, _ := key[int64(-2)].([]byte)
+		y, _ := key[int64(-3)].([]byte)
+		if len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("invalid EC2 key")
+		}
+		publicKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !publicKey.Curve.IsOnCurve(publicKey.X, publicKey.Y) {
+			return nil, errors.New("EC2 key is not on the curve")
+		}
+		return publicKey, nil
+	case AlgRS256:
+		n, _ := key[int64(-1)].([]byte)
+		e, _ := key[int64(-2)].([]byte)
+		if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	}
+	return nil, fmt.Errorf("unsupported key algorithm: %d", alg)
+}
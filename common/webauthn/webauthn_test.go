@@ -0,0 +1,127 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testRpId   = "example.com"
+	testOrigin = "https://example.com"
+)
+
+func cborHeader(major byte, length int) []byte {
+	if length < 24 {
+		return []byte{major<<5 | byte(length)}
+	}
+	if length < 256 {
+		return []byte{major<<5 | 24, byte(length)}
+	}
+	return []byte{major<<5 | 25, byte(length >> 8), byte(length)}
+}
+
+func cborInt(v int) []byte {
+	if v < 0 {
+		return cborHeader(1, -1-v)
+	}
+	return cborHeader(0, v)
+}
+
+func cborBytes(b []byte) []byte {
+	return append(cborHeader(2, len(b)), b...)
+}
+
+func cborText(s string) []byte {
+	return append(cborHeader(3, len(s)), s...)
+}
+
+func coseKey(key *ecdsa.PublicKey) []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	key.X.FillBytes(x)
+	key.Y.FillBytes(y)
+	data := cborHeader(5, 5)
+	data = append(data, cborInt(1)...)
+	data = append(data, cborInt(2)...)
+	data = append(data, cborInt(3)...)
+	data = append(data, cborInt(AlgES256)...)
+	data = append(data, cborInt(-1)...)
+	data = append(data, cborInt(1)...)
+	data = append(data, cborInt(-2)...)
+	data = append(data, cborBytes(x)...)
+	data = append(data, cborInt(-3)...)
+	data = append(data, cborBytes(y)...)
+	return data
+}
+
+func authData(flags byte, signCount uint32, credentialId []byte, publicKey []byte) []byte {
+	rpIdHash := sha256.Sum256([]byte(testRpId))
+	data := append([]byte(nil), rpIdHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, signCount)
+	if credentialId != nil {
+		data = append(data, make([]byte, 16)...)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(credentialId)))
+		data = append(data, credentialId...)
+		data = append(data, publicKey...)
+	}
+	return data
+}
+
+func clientDataJSON(t *testing.T, ceremony string, challenge []byte) []byte {
+	data, err := json.Marshal(clientData{Type: ceremony, Challenge: Encoding.EncodeToString(challenge), Origin: testOrigin})
+	require.NoError(t, err)
+	return data
+}
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	credentialId := []byte("credential-id")
+
+	challenge, err := NewChallenge()
+	require.NoError(t, err)
+	attestation := cborHeader(5, 3)
+	attestation = append(attestation, cborText("fmt")...)
+	attestation = append(attestation, cborText("none")...)
+	attestation = append(attestation, cborText("attStmt")...)
+	attestation = append(attestation, cborHeader(5, 0)...)
+	attestation = append(attestation, cborText("authData")...)
+	attestation = append(attestation, cborBytes(authData(flagUserPresent|flagAttestedCredData, 0, credentialId, coseKey(&privateKey.PublicKey)))...)
+
+	_, err = VerifyRegistration(testRpId, "https://evil.com", challenge, clientDataJSON(t, "webauthn.create", challenge), attestation)
+	assert.Error(t, err)
+	credential, err := VerifyRegistration(testRpId, testOrigin, challenge, clientDataJSON(t, "webauthn.create", challenge), attestation)
+	require.NoError(t, err)
+	assert.Equal(t, credentialId, credential.ID)
+
+	challenge, err = NewChallenge()
+	require.NoError(t, err)
+	rawAuthData := authData(flagUserPresent, 1, nil, nil)
+	rawClientData := clientDataJSON(t, "webauthn.get", challenge)
+	clientDataHash := sha256.Sum256(rawClientData)
+	digest := sha256.Sum256(append(append([]byte(nil), rawAuthData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, privateKey, digest[:])
+	require.NoError(t, err)
+
+	signCount, err := VerifyAssertion(testRpId, testOrigin, challenge, credential, rawClientData, rawAuthData, signature)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), signCount)
+
+	credential.SignCount = signCount
+	_, err = VerifyAssertion(testRpId, testOrigin, challenge, credential, rawClientData, rawAuthData, signature)
+	assert.Error(t, err, "a replayed assertion is rejected by the counter")
+
+	credential.SignCount = 0
+	signature[len(signature)-1] ^= 0xff
+	_, err = VerifyAssertion(testRpId, testOrigin, challenge, credential, rawClientData, rawAuthData, signature)
+	assert.Error(t, err)
+}
@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// audit logs exported at once are capped to protect the database
+const maxAuditExportRows = 10000
+
+// recordAudit writes the changes of an entity to the audit log, before is nil for creations and after is nil for deletions
+func recordAudit(c *gin.Context, action string, targetType string, targetId any, before any, after any) {
+	diff := model.AuditDiff(before, after)
+	diffJSON, err := json.Marshal(diff)
+	if err != nil {
+		logger.SysError("failed to marshal audit diff: " + err.Error())
+		return
+	}
+	model.RecordAuditLog(c.Request.Context(), &model.AuditLog{
+		UserId:     c.GetInt(ctxkey.Id),
+		Username:   c.GetString("username"),
+		Action:     action,
+		TargetType: targetType,
+		TargetId:   fmt.Sprint(targetId),
+		Diff:       string(diffJSON),
+		Ip:         c.ClientIP(),
+	})
+}
+
+func getAuditLogFilter(c *gin.Context) model.AuditLogFilter {
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	return model.AuditLogFilter{
+		UserId:         userId,
+		Action:         c.Query("action"),
+		TargetType:     c.Query("target_type"),
+		TargetId:       c.Query("target_id"),
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+	}
+}
+
+func GetAuditLogs(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	logs, err := model.GetAuditLogs(getAuditLogFilter(c), p*config.ItemsPerPage, config.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    logs,
+	})
+	return
+}
+
+// csvSafe keeps spreadsheet applications from evaluating a value as formula
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// safeFilename keeps user-provided names from breaking out of the Content-Disposition header
+func safeFilename(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '"' || r == '\\' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// ExportAuditLogs downloads the filtered audit logs as csv, or as json lines with format=jsonl
+func ExportAuditLogs(c *gin.Context) {
+	logs, err := model.GetAuditLogs(getAuditLogFilter(c), 0, maxAuditExportRows)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	filename := fmt.Sprintf("audit-%s", time.Now().Format("20060102150405"))
+	if c.Query("format") == "jsonl" {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.jsonl", filename))
+		c.Header("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(c.Writer)
+		for _, log := range logs {
+			if err := encoder.Encode(log); err != nil {
+				logger.SysError("failed to export audit logs: " + err.Error())
+				return
+			}
+		}
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", filename))
+	c.Header("Content-Type", "text/csv")
+	writer := csv.NewWriter(c.Writer)
+	_ = writer.Write([]string{"id", "created_at", "user_id", "username", "action", "target_type", "target_id", "diff", "ip", "request_id"})
+	for _, log := range logs {
+		_ = writer.Write([]string{
+			strconv.Itoa(log.Id),
+			time.Unix(log.CreatedAt, 0).Format(time.RFC3339),
+			strconv.Itoa(log.UserId),
+			csvSafe(log.Username),
+			log.Action,
+			log.TargetType,
+			csvSafe(log.TargetId),
+			csvSafe(log.Diff),
+			log.Ip,
+			log.RequestId,
+		})
+	}
+	writer.Flush()
+}
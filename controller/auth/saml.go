@@ -0,0 +1,433 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/common/saml"
+	"github.com/songquanpeng/one-api/controller"
+	"github.com/songquanpeng/one-api/model"
+)
+
+const (
+	samlRequestTTL = 10 * time.Minute
+	samlTicketTTL  = 2 * time.Minute
+)
+
+// SAMLLogin is what the ACS endpoint hands over to the login endpoint once the assertion has been verified
+type SAMLLogin struct {
+	NameId      string   `json:"name_id"`
+	Username    string   `json:"username"`
+	Email       string   `json:"email"`
+	DisplayName string   `json:"display_name"`
+	Groups      []string `json:"groups"`
+	BindUserId  int      `json:"bind_user_id"`
+	State       string   `json:"state"` // ties the login to the browser which started it
+}
+
+// samlRequest is kept for every AuthnRequest until its response arrives
+type samlRequest struct {
+	BindUserId int    `json:"bind_user_id"`
+	State      string `json:"state"`
+}
+
+// the ACS request is a cross-site POST which doesn't carry the session cookie,
+// so the login state is kept server side, in redis when it's enabled
+var samlStore = struct {
+	sync.Mutex
+	values map[string]samlStoreValue
+}{values: make(map[string]samlStoreValue)}
+
+type samlStoreValue struct {
+	value   string
+	expires time.Time
+}
+
+func samlStoreSet(key string, value string, ttl time.Duration, onlyIfAbsent bool) (bool, error) {
+	key = "saml:" + key
+	if common.RedisEnabled {
+		if onlyIfAbsent {
+			return common.RDB.SetNX(context.Background(), key, value, ttl).Result()
+		}
+		return true, common.RedisSet(key, value, ttl)
+	}
+	samlStore.Lock()
+	defer samlStore.Unlock()
+	now := time.Now()
+	for k, v := range samlStore.values {
+		if now.After(v.expires) {
+			delete(samlStore.values, k)
+		}
+	}
+	if _, ok := samlStore.values[key]; ok && onlyIfAbsent {
+		return false, nil
+	}
+	samlStore.values[key] = samlStoreValue{value: value, expires: now.Add(ttl)}
+	return true, nil
+}
+
+// samlStoreTake returns a value and removes it, every value can only be used once
+func samlStoreTake(key string) (string, bool) {
+	key = "saml:" + key
+	if common.RedisEnabled {
+		// GET and DEL in one transaction, GETDEL needs redis 6.2
+		pipe := common.RDB.TxPipeline()
+		get := pipe.Get(context.Background(), key)
+		pipe.Del(context.Background(), key)
+		if _, err := pipe.Exec(context.Background()); err != nil {
+			return "", false
+		}
+		return get.Val(), true
+	}
+	samlStore.Lock()
+	defer samlStore.Unlock()
+	v, ok := samlStore.values[key]
+	delete(samlStore.values, key)
+	if !ok || time.Now().After(v.expires) {
+		return "", false
+	}
+	return v.value, true
+}
+
+func getServiceProvider() (*saml.ServiceProvider, error) {
+	if config.ServerAddress == "" {
+		return nil, errors.New("the server address is not configured")
+	}
+	serverAddress := strings.TrimSuffix(config.ServerAddress, "/")
+	sp := &saml.ServiceProvider{
+		EntityId:    config.SAMLSpEntityId,
+		AcsURL:      serverAddress + "/api/oauth/saml/acs",
+		IdpEntityId: config.SAMLIdpEntityId,
+		IdpSsoURL:   config.SAMLIdpSsoUrl,
+	}
+	if sp.EntityId == "" {
+		sp.EntityId = serverAddress + "/api/oauth/saml/metadata"
+	}
+	if config.SAMLIdpCertificate != "" {
+		cert, err := saml.ParseCertificate(config.SAMLIdpCertificate)
+		if err != nil {
+			return nil, err
+		}
+		sp.IdpCertificate = cert
+	}
+	return sp, nil
+}
+
+func SAMLMetadata(c *gin.Context) {
+	sp, err := getServiceProvider()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.Data(http.StatusOK, "application/samlmetadata+xml", sp.Metadata())
+}
+
+// SAMLStart redirects the browser to the identity provider, logged-in users link their SAML account
+func SAMLStart(c *gin.Context) {
+	if !config.SAMLEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "Admins haven't enabled login and registration via SAML yet.",
+		})
+		return
+	}
+	sp, err := getServiceProvider()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	redirectURL, requestId, err := sp.AuthnRequestURL("")
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	request := samlRequest{State: random.GetRandomString(16)}
+	session := sessions.Default(c)
+	if session.Get("username") != nil {
+		request.BindUserId, _ = session.Get("id").(int)
+	}
+	// the ACS request doesn't carry the session cookie, the state is checked when the code is exchanged
+	session.Set("saml_state", request.State)
+	err = session.Save()
+	if err == nil {
+		var data []byte
+		data, err = json.Marshal(request)
+		if err == nil {
+			_, err = samlStoreSet("request:"+requestId, string(data), samlRequestTTL, false)
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.Redirect(http.StatusFound, redirectURL)
+}
+
+// redirectSAMLResult hands the result to the frontend, errors are only passed as codes,
+// their details would end up in the browser history and the logs of proxies
+func redirectSAMLResult(c *gin.Context, query url.Values) {
+	c.Redirect(http.StatusFound, strings.TrimSuffix(config.ServerAddress, "/")+"/oauth/saml?"+query.Encode())
+}
+
+func redirectSAMLError(c *gin.Context, code string, err error) {
+	if err != nil {
+		logger.SysError(fmt.Sprintf("SAML login failed with %s: %s", code, err.Error()))
+	}
+	redirectSAMLResult(c, url.Values{"error": {code}})
+}
+
+// SAMLAcs receives the response of the identity provider and hands a one-time code to the frontend
+func SAMLAcs(c *gin.Context) {
+	if !config.SAMLEnabled {
+		redirectSAMLError(c, "saml_disabled", nil)
+		return
+	}
+	sp, err := getServiceProvider()
+	if err != nil {
+		redirectSAMLError(c, "saml_misconfigured", err)
+		return
+	}
+	var request samlRequest
+	assertion, err := sp.ParseResponse(c.PostForm("SAMLResponse"), func(requestId string) bool {
+		value, ok := samlStoreTake("request:" + requestId)
+		return ok && json.Unmarshal([]byte(value), &request) == nil
+	})
+	if err != nil {
+		redirectSAMLError(c, "saml_invalid_response", err)
+		return
+	}
+	ttl := time.Until(assertion.NotOnOrAfter) + 5*time.Minute
+	if fresh, err := samlStoreSet("assertion:"+assertion.Id, "1", ttl, true); err != nil || !fresh {
+		redirectSAMLError(c, "saml_assertion_used", err)
+		return
+	}
+	login := SAMLLogin{
+		NameId:     assertion.NameId,
+		Username:   assertion.NameId,
+		BindUserId: request.BindUserId,
+		State:      request.State,
+	}
+	if config.SAMLUsernameAttribute != "" {
+		login.Username = assertion.Attribute(config.SAMLUsernameAttribute)
+	}
+	if config.SAMLEmailAttribute != "" {
+		login.Email = assertion.Attribute(config.SAMLEmailAttribute)
+	}
+	if config.SAMLDisplayNameAttribute != "" {
+		login.DisplayName = assertion.Attribute(config.SAMLDisplayNameAttribute)
+	}
+	if config.SAMLGroupAttribute != "" {
+		login.Groups = assertion.Attributes[config.SAMLGroupAttribute]
+	}
+	data, err := json.Marshal(login)
+	if err != nil {
+		redirectSAMLError(c, "saml_internal_error", err)
+		return
+	}
+	code := random.GetUUID()
+	if _, err := samlStoreSet("ticket:"+code, string(data), samlTicketTTL, false); err != nil {
+		redirectSAMLError(c, "saml_internal_error", err)
+		return
+	}
+	redirectSAMLResult(c, url.Values{"code": {code}})
+}
+
+// applySAMLGroups maps the groups of the identity provider to the group and role of the user
+func applySAMLGroups(user *model.User, groups []string) error {
+	mappings, err := saml.ParseGroupMapping(config.SAMLGroupMapping)
+	if err != nil || len(mappings) == 0 || user.Role == model.RoleRootUser {
+		return err
+	}
+	group, role := saml.MapGroups(mappings, groups)
+	if group == "" {
+		group = user.Group
+	}
+	if !saml.ManagesRoles(mappings) {
+		role = user.Role
+	} else if role == 0 {
+		role = model.RoleCommonUser
+	}
+	if group == user.Group && role == user.Role {
+		return nil
+	}
+	if err := model.UpdateUserGroupAndRole(user.Id, group, role); err != nil {
+		return err
+	}
+	logger.SysLog(fmt.Sprintf("SAML groups changed user %d to group %s and role %d", user.Id, group, role))
+	user.Group = group
+	user.Role = role
+	return nil
+}
+
+// SAMLAuth completes the login with the one-time code of the ACS endpoint
+func SAMLAuth(c *gin.Context) {
+	ctx := c.Request.Context()
+	value, ok := samlStoreTake("ticket:" + c.Query("code"))
+	if c.Query("code") == "" || !ok {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "The SAML login has expired, please try again.",
+		})
+		return
+	}
+	var login SAMLLogin
+	if err := json.Unmarshal([]byte(value), &login); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	// a response posted by another browser, e.g. to log the victim into the account of an attacker, has no matching state
+	session := sessions.Default(c)
+	state, _ := session.Get("saml_state").(string)
+	session.Delete("saml_state")
+	_ = session.Save()
+	if state == "" || state != login.State {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "The SAML login must be completed in the browser which started it.",
+		})
+		return
+	}
+	if login.BindUserId != 0 {
+		SAMLBind(c, &login)
+		return
+	}
+	user := model.User{
+		SamlId: login.NameId,
+	}
+	if model.IsSamlIdAlreadyTaken(user.SamlId) {
+		err := user.FillUserBySamlId()
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	} else if provisioned, _, _ := model.GetScimUsers("userName", login.NameId, 0, 1); len(provisioned) == 1 && provisioned[0].ScimUserName != "" && provisioned[0].SamlId == "" {
+		// users provisioned through SCIM are linked on their first single sign-on
+		user = *provisioned[0]
+		user.SamlId = login.NameId
+		if err := user.Update(false); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	} else {
+		if config.RegisterEnabled {
+			user.Email = login.Email
+			user.Username = login.Username
+			if user.Username == "" || len(user.Username) > 12 || model.IsUsernameAlreadyTaken(user.Username) {
+				user.Username = "saml_" + strconv.Itoa(model.GetMaxUserId()+1)
+			}
+			if login.DisplayName != "" {
+				user.DisplayName = login.DisplayName
+			} else {
+				user.DisplayName = "SAML User"
+			}
+			err := user.Insert(ctx, 0)
+			if err != nil {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": err.Error(),
+				})
+				return
+			}
+		} else {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "The admin has disabled new user registration.",
+			})
+			return
+		}
+	}
+
+	if user.Status != model.UserStatusEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "User has been banned.",
+			"success": false,
+		})
+		return
+	}
+	if err := applySAMLGroups(&user, login.Groups); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	controller.SetupLogin(&user, c)
+}
+
+func SAMLBind(c *gin.Context, login *SAMLLogin) {
+	session := sessions.Default(c)
+	id, _ := session.Get("id").(int)
+	if session.Get("username") == nil || id != login.BindUserId {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "The SAML account must be linked from the session which started it.",
+		})
+		return
+	}
+	if model.IsSamlIdAlreadyTaken(login.NameId) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "This SAML account has already been linked.",
+		})
+		return
+	}
+	user := model.User{Id: id}
+	err := user.FillUserById()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	user.SamlId = login.NameId
+	err = user.Update(false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "bind",
+	})
+	return
+}
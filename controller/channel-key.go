@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/i18n"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func GetChannelKeys(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	channel, err := model.GetChannelById(id, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	infos, err := model.GetChannelKeyInfos(channel)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"key_strategy": channel.GetKeyStrategy(),
+			"keys":         infos,
+		},
+	})
+}
+
+type channelKeyStatusRequest struct {
+	KeyHash string `json:"key_hash"`
+	Status  int    `json:"status"`
+}
+
+func UpdateChannelKeyStatus(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	var req channelKeyStatusRequest
+	err = c.ShouldBindJSON(&req)
+	if err != nil || req.KeyHash == "" ||
+		(req.Status != model.ChannelStatusEnabled && req.Status != model.ChannelStatusManuallyDisabled) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": i18n.Translate(c, "invalid_parameter"),
+		})
+		return
+	}
+	channel, err := model.GetChannelById(id, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	found := false
+	for _, key := range channel.GetKeys() {
+		if model.HashChannelKey(key) == req.KeyHash {
+			found = true
+			break
+		}
+	}
+	if !found {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "key not found in this channel",
+		})
+		return
+	}
+	err = model.UpdateChannelKeyStatus(id, req.KeyHash, req.Status)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	recordAudit(c, "channel.key_status", "channel", id, nil, req)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
@@ -65,7 +65,8 @@ func parseTestResponse(resp string) (*openai.TextResponse, string, error) {
 	return response.ToTextResponse(), stringContent, nil
 }
 
-func testChannel(ctx context.Context, channel *model.Channel, request *relaymodel.GeneralOpenAIRequest) (responseMessage string, err error, openaiErr *relaymodel.Error) {
+// testChannel sends a test request with the given key of the channel, or the key picked by its key strategy if the key is empty
+func testChannel(ctx context.Context, channel *model.Channel, key string, request *relaymodel.GeneralOpenAIRequest) (responseMessage string, err error, openaiErr *relaymodel.Error) {
 	startTime := time.Now()
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
@@ -82,6 +83,10 @@ func testChannel(ctx context.Context, channel *model.Channel, request *relaymode
 	cfg, _ := channel.LoadConfig()
 	c.Set(ctxkey.Config, cfg)
 	middleware.SetupContextForSelectedChannel(c, channel, "")
+	if key != "" {
+		c.Request.Header.Set("Authorization", "Bearer "+key)
+		c.Set(ctxkey.ChannelKeyHash, model.HashChannelKey(key))
+	}
 	meta := meta.GetByContext(c)
 	apiType := channeltype.ToAPIType(channel.Type)
 	adaptor := relay.GetAdaptor(apiType)
@@ -187,7 +192,7 @@ func TestChannel(c *gin.Context) {
 	modelName := c.Query("model")
 	testRequest := buildTestRequest(modelName)
 	tik := time.Now()
-	responseMessage, err, _ := testChannel(ctx, channel, testRequest)
+	responseMessage, err, _ := testChannel(ctx, channel, "", testRequest)
 	tok := time.Now()
 	milliseconds := tok.Sub(tik).Milliseconds()
 	if err != nil {
@@ -238,27 +243,38 @@ func testChannels(ctx context.Context, notify bool, scope string) error {
 	go func() {
 		for _, channel := range channels {
 			isChannelEnabled := channel.Status == model.ChannelStatusEnabled
-			tik := time.Now()
-			testRequest := buildTestRequest("")
-			_, err, openaiErr := testChannel(ctx, channel, testRequest)
-			tok := time.Now()
-			milliseconds := tok.Sub(tik).Milliseconds()
-			if isChannelEnabled && milliseconds > disableThreshold {
-				err = fmt.Errorf("response time of %.2fs exceeds the threshold of %.2fs", float64(milliseconds)/1000.0, float64(disableThreshold)/1000.0)
-				if config.AutomaticDisableChannelEnabled {
-					monitor.DisableChannel(channel.Id, channel.Name, err.Error())
-				} else {
-					_ = message.Notify(message.ByAll, fmt.Sprintf("Channel %s (%d) test timed out", channel.Name, channel.Id), "", err.Error())
-				}
-			}
-			if isChannelEnabled && monitor.ShouldDisableChannel(openaiErr, -1) {
-				monitor.DisableChannel(channel.Id, channel.Name, err.Error())
+			// every enabled key of a multi-key channel is tested, so that a bad key only disables itself
+			keys := []string{""}
+			if isChannelEnabled && channel.GetKeyStrategy() != "" {
+				keys = model.GetEnabledChannelKeys(channel)
 			}
-			if !isChannelEnabled && monitor.ShouldEnableChannel(err, openaiErr) {
-				monitor.EnableChannel(channel.Id, channel.Name)
+			for _, key := range keys {
+				keyHash := ""
+				if key != "" {
+					keyHash = model.HashChannelKey(key)
+				}
+				tik := time.Now()
+				testRequest := buildTestRequest("")
+				_, err, openaiErr := testChannel(ctx, channel, key, testRequest)
+				tok := time.Now()
+				milliseconds := tok.Sub(tik).Milliseconds()
+				if isChannelEnabled && milliseconds > disableThreshold {
+					err = fmt.Errorf("response time of %.2fs exceeds the threshold of %.2fs", float64(milliseconds)/1000.0, float64(disableThreshold)/1000.0)
+					if config.AutomaticDisableChannelEnabled {
+						disableTestedChannel(channel, keyHash, err.Error())
+					} else {
+						_ = message.Notify(message.ByAll, fmt.Sprintf("Channel %s (%d) test timed out", channel.Name, channel.Id), "", err.Error())
+					}
+				}
+				if isChannelEnabled && monitor.ShouldDisableChannel(openaiErr, -1) {
+					disableTestedChannel(channel, keyHash, err.Error())
+				}
+				if !isChannelEnabled && monitor.ShouldEnableChannel(err, openaiErr) {
+					monitor.EnableChannel(channel.Id, channel.Name)
+				}
+				channel.UpdateResponseTime(milliseconds)
+				time.Sleep(config.RequestInterval)
 			}
-			channel.UpdateResponseTime(milliseconds)
-			time.Sleep(config.RequestInterval)
 		}
 		testAllChannelsLock.Lock()
 		testAllChannelsRunning = false
@@ -273,6 +289,15 @@ func testChannels(ctx context.Context, notify bool, scope string) error {
 	return nil
 }
 
+// disableTestedChannel disables the tested key of a multi-key channel, or the channel if it has a single key
+func disableTestedChannel(channel *model.Channel, keyHash string, reason string) {
+	if keyHash != "" {
+		monitor.DisableChannelKey(channel.Id, channel.Name, keyHash, reason)
+		return
+	}
+	monitor.DisableChannel(channel.Id, channel.Name, reason)
+}
+
 func TestChannels(c *gin.Context) {
 	ctx := c.Request.Context()
 	scope := c.Query("scope")
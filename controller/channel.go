@@ -1,10 +1,12 @@
 package controller
 
 import (
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/parampolicy"
 	"net/http"
 	"strconv"
 	"strings"
@@ -74,6 +76,16 @@ func GetChannel(c *gin.Context) {
 	return
 }
 
+func validateChannel(channel model.Channel) error {
+	if _, err := parampolicy.Parse(channel.GetParamPolicy()); err != nil {
+		return fmt.Errorf("invalid param policy: %s", err.Error())
+	}
+	if !model.IsValidKeyStrategy(channel.GetKeyStrategy()) {
+		return fmt.Errorf("invalid key strategy: %s", channel.GetKeyStrategy())
+	}
+	return nil
+}
+
 func AddChannel(c *gin.Context) {
 	channel := model.Channel{}
 	err := c.ShouldBindJSON(&channel)
@@ -84,8 +96,20 @@ func AddChannel(c *gin.Context) {
 		})
 		return
 	}
+	err = validateChannel(channel)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	channel.CreatedTime = helper.GetTimestamp()
 	keys := strings.Split(channel.Key, "\n")
+	if channel.GetKeyStrategy() != "" {
+		// all keys belong to the same channel
+		keys = []string{channel.Key}
+	}
 	channels := make([]model.Channel, 0, len(keys))
 	for _, key := range keys {
 		if key == "" {
@@ -103,6 +127,9 @@ func AddChannel(c *gin.Context) {
 		})
 		return
 	}
+	for i := range channels {
+		recordAudit(c, "channel.create", "channel", channels[i].Id, nil, &channels[i])
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -112,6 +139,7 @@ func AddChannel(c *gin.Context) {
 
 func DeleteChannel(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	origin, _ := model.GetChannelById(id, true)
 	channel := model.Channel{Id: id}
 	err := channel.Delete()
 	if err != nil {
@@ -121,6 +149,7 @@ func DeleteChannel(c *gin.Context) {
 		})
 		return
 	}
+	recordAudit(c, "channel.delete", "channel", id, origin, nil)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -137,6 +166,7 @@ func DeleteDisabledChannel(c *gin.Context) {
 		})
 		return
 	}
+	recordAudit(c, "channel.delete_disabled", "channel", "", nil, gin.H{"deleted": rows})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -155,6 +185,22 @@ func UpdateChannel(c *gin.Context) {
 		})
 		return
 	}
+	err = validateChannel(channel)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	origin, err := model.GetChannelById(channel.Id, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	err = channel.Update()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -163,6 +209,9 @@ func UpdateChannel(c *gin.Context) {
 		})
 		return
 	}
+	if updated, err := model.GetChannelById(channel.Id, true); err == nil {
+		recordAudit(c, "channel.update", "channel", channel.Id, origin, updated)
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -12,7 +12,6 @@ import (
 	"github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
 	"net/http"
-	"strings"
 )
 
 // https://platform.openai.com/docs/api-reference/models/list
@@ -131,13 +130,11 @@ func ListAllModels(c *gin.Context) {
 
 func ListModels(c *gin.Context) {
 	ctx := c.Request.Context()
-	var availableModels []string
-	if c.GetString(ctxkey.AvailableModels) != "" {
-		availableModels = strings.Split(c.GetString(ctxkey.AvailableModels), ",")
-	} else {
-		userId := c.GetInt(ctxkey.Id)
-		userGroup, _ := model.CacheGetUserGroup(userId)
-		availableModels, _ = model.CacheGetGroupModels(ctx, userGroup)
+	userId := c.GetInt(ctxkey.Id)
+	userGroup, _ := model.CacheGetUserGroup(userId)
+	availableModels, _ := model.CacheGetGroupModels(ctx, userGroup)
+	if tokenModels := c.GetString(ctxkey.AvailableModels); tokenModels != "" {
+		availableModels = model.FilterModelsByTokenModels(availableModels, tokenModels)
 	}
 	modelSet := make(map[string]bool)
 	for _, availableModel := range availableModels {
@@ -3,6 +3,7 @@ package controller
 import (
 	"encoding/json"
 	"net/http"
+	"path/filepath"
 	"strings"
 
 	"github.com/songquanpeng/one-api/common/config"
@@ -45,6 +46,29 @@ func UpdateOption(c *gin.Context) {
 		return
 	}
 	switch option.Key {
+	case model.TokenHashSaltOption:
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "The token hash salt can't be changed, all tokens would become invalid.",
+		})
+		return
+	case "PaymentProvider":
+		if option.Value != "" && option.Value != "stripe" && option.Value != "fake" {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "Invalid payment provider",
+			})
+			return
+		}
+	case "PricingCatalogSource":
+		if option.Value != "" && !strings.HasPrefix(option.Value, "http://") && !strings.HasPrefix(option.Value, "https://") &&
+			!strings.HasPrefix(option.Value, "file://") && !filepath.IsAbs(option.Value) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "The pricing catalog source must be an http(s) url or an absolute file path",
+			})
+			return
+		}
 	case "Theme":
 		if !config.ValidThemes[option.Value] {
 			c.JSON(http.StatusOK, gin.H{
@@ -86,6 +110,9 @@ func UpdateOption(c *gin.Context) {
 			return
 		}
 	}
+	config.OptionMapRWMutex.RLock()
+	originValue := config.OptionMap[option.Key]
+	config.OptionMapRWMutex.RUnlock()
 	err = model.UpdateOption(option.Key, option.Value)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -94,9 +121,31 @@ func UpdateOption(c *gin.Context) {
 		})
 		return
 	}
+	recordAudit(c, "option.update", "option", option.Key, gin.H{option.Key: originValue}, gin.H{option.Key: option.Value})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
 	})
 	return
 }
+
+// SyncPricingCatalog applies the pricing catalog now, with dry_run=true it only returns the changes
+func SyncPricingCatalog(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "true"
+	changes, err := model.SyncPricingCatalog(c.Request.Context(), dryRun)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if !dryRun {
+		recordAudit(c, "pricing_catalog.sync", "option", "ModelRatio", nil, changes)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    changes,
+	})
+}
@@ -0,0 +1,227 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/payment"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// webhook payloads are small, anything bigger isn't from a payment provider
+const maxWebhookPayloadSize = 1 << 20
+
+func GetPriceTiers(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"enabled":  config.PaymentProvider != "",
+			"currency": config.PaymentCurrency,
+			"tiers":    payment.GetPriceTiers(),
+		},
+	})
+}
+
+type checkoutRequest struct {
+	Tier int `json:"tier"`
+}
+
+// CreateCheckout opens an order for a price tier and returns the payment page of the provider
+func CreateCheckout(c *gin.Context) {
+	ctx := c.Request.Context()
+	req := checkoutRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	provider, err := payment.GetProvider()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	tier, ok := payment.GetPriceTier(req.Tier)
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "Invalid price tier",
+		})
+		return
+	}
+	userId := c.GetInt(ctxkey.Id)
+	order := &model.Order{
+		OrderNo:  model.NewOrderNo(),
+		UserId:   userId,
+		Provider: provider.Name(),
+		TierName: tier.Name,
+		Amount:   tier.Price,
+		Currency: config.PaymentCurrency,
+		Quota:    tier.Quota,
+		Status:   model.OrderStatusPending,
+	}
+	if err = order.Insert(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	email, _ := model.GetUserEmail(userId)
+	returnURL := fmt.Sprintf("%s/topup?order_no=%s", strings.TrimSuffix(config.ServerAddress, "/"), url.QueryEscape(order.OrderNo))
+	checkout, err := provider.CreateCheckout(ctx, &payment.CheckoutRequest{
+		OrderNo:       order.OrderNo,
+		Amount:        order.Amount,
+		Currency:      order.Currency,
+		Description:   fmt.Sprintf("%s %s", config.SystemName, tier.Name),
+		CustomerEmail: email,
+		SuccessURL:    returnURL + "&status=success",
+		CancelURL:     returnURL + "&status=cancel",
+	})
+	if err != nil {
+		logger.Errorf(ctx, "failed to create checkout of order %s: %s", order.OrderNo, err.Error())
+		_ = model.FailOrder(order.OrderNo)
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "Failed to create the payment, please try again later.",
+		})
+		return
+	}
+	order.SessionId = checkout.SessionId
+	if err = model.SetOrderSession(order.Id, checkout.SessionId); err != nil {
+		logger.Errorf(ctx, "failed to save checkout session of order %s: %s", order.OrderNo, err.Error())
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"order":        order,
+			"checkout_url": checkout.URL,
+		},
+	})
+}
+
+func GetSelfOrders(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	orders, err := model.GetUserOrders(c.GetInt(ctxkey.Id), p*config.ItemsPerPage, config.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    orders,
+	})
+}
+
+func GetAllOrders(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	status, _ := strconv.Atoi(c.Query("status"))
+	orders, err := model.GetAllOrders(userId, status, p*config.ItemsPerPage, config.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    orders,
+	})
+}
+
+// refersToOrder tells whether the event carries what is needed to find its order, refunds are also found by their payment
+func refersToOrder(event *payment.Event) bool {
+	if event.Type == payment.EventRefunded {
+		return event.OrderNo != "" || event.PaymentId != ""
+	}
+	return event.OrderNo != ""
+}
+
+// PaymentWebhook applies the events of the payment provider to the orders,
+// errors are answered with a 5xx status so the provider delivers the event again
+func PaymentWebhook(c *gin.Context) {
+	ctx := c.Request.Context()
+	provider, err := payment.GetProvider()
+	if err != nil || provider.Name() != c.Param("provider") {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "payment provider not enabled",
+		})
+		return
+	}
+	payload, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookPayloadSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	event, err := provider.ParseWebhook(payload, c.Request.Header)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	switch {
+	case event.Type == payment.EventIgnored:
+	case !refersToOrder(event):
+		// e.g. a checkout of another integration on the same account, retrying won't help
+		logger.Warnf(ctx, "payment event %s doesn't refer to an order", event.Id)
+	case event.Type == payment.EventPaid:
+		err = model.CompleteOrder(ctx, event.OrderNo, event.PaymentId, event.Amount, event.Currency)
+	case event.Type == payment.EventFailed:
+		err = model.FailOrder(event.OrderNo)
+	case event.Type == payment.EventRefunded:
+		err = model.RefundOrder(ctx, event.OrderNo, event.PaymentId)
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// not an order of ours, retrying won't help
+		logger.Warnf(ctx, "payment event %s refers to an unknown order", event.Id)
+		err = nil
+	}
+	if err != nil {
+		logger.Errorf(ctx, "failed to handle payment event %s: %s", event.Id, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/payment"
+)
+
+func TestPaymentWebhookWithoutOrder(t *testing.T) {
+	setupTestDB(t)
+	provider, secret := config.PaymentProvider, config.PaymentWebhookSecret
+	config.PaymentProvider, config.PaymentWebhookSecret = "fake", "secret"
+	t.Cleanup(func() { config.PaymentProvider, config.PaymentWebhookSecret = provider, secret })
+
+	router := gin.New()
+	router.POST("/api/payment/webhook/:provider", PaymentWebhook)
+	events := []payment.Event{
+		// a checkout of another integration on the same account has no order number of ours
+		{Id: "evt_1", Type: payment.EventPaid, SessionId: "cs_1", PaymentId: "pi_1", Amount: 500, Currency: "usd"},
+		{Id: "evt_2", Type: payment.EventFailed, SessionId: "cs_2"},
+		{Id: "evt_3", Type: payment.EventRefunded},
+		{Id: "evt_4", Type: payment.EventPaid, OrderNo: "unknown", Amount: 500, Currency: "usd"},
+	}
+	for _, event := range events {
+		payload, err := json.Marshal(event)
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/api/payment/webhook/fake", bytes.NewReader(payload))
+		req.Header.Set(payment.FakeSignatureHeader, payment.SignFakeWebhook("secret", payload))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, "event %s must not be delivered again", event.Id)
+	}
+}
@@ -1,16 +1,43 @@
 package controller
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/random"
 	"github.com/songquanpeng/one-api/model"
-	"net/http"
-	"strconv"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
 )
 
+// maxRedemptionBatch is the most codes generated at once for a campaign
+const maxRedemptionBatch = 1000
+
+// validateRedemptionRules checks the campaign settings of a code
+func validateRedemptionRules(redemption *model.Redemption) error {
+	if redemption.MaxRedemptions < 0 || redemption.PerUserLimit < 0 || redemption.NewUserDays < 0 {
+		return errors.New("max redemptions, per user limit and new user days can't be negative")
+	}
+	if redemption.StartTime != 0 && redemption.EndTime != 0 && redemption.EndTime <= redemption.StartTime {
+		return errors.New("the end time must be after the start time")
+	}
+	if redemption.UpgradeGroup != "" {
+		if _, ok := billingratio.GroupRatio[redemption.UpgradeGroup]; !ok {
+			return fmt.Errorf("group %s doesn't exist", redemption.UpgradeGroup)
+		}
+	}
+	return nil
+}
+
 func GetAllRedemptions(c *gin.Context) {
 	p, _ := strconv.Atoi(c.Query("p"))
 	if p < 0 {
@@ -76,7 +103,8 @@ func GetRedemption(c *gin.Context) {
 }
 
 func AddRedemption(c *gin.Context) {
-	redemption := model.Redemption{}
+	// codes are single use unless the request says otherwise
+	redemption := model.Redemption{MaxRedemptions: 1, PerUserLimit: 1}
 	err := c.ShouldBindJSON(&redemption)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -99,10 +127,17 @@ func AddRedemption(c *gin.Context) {
 		})
 		return
 	}
-	if redemption.Count > 100 {
+	if redemption.Count > maxRedemptionBatch {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("The number of bulk redemption code generations cannot be greater than %d.", maxRedemptionBatch),
+		})
+		return
+	}
+	if err = validateRedemptionRules(&redemption); err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
-			"message": "The number of bulk redemption code generations cannot be greater than 100.",
+			"message": err.Error(),
 		})
 		return
 	}
@@ -110,11 +145,18 @@ func AddRedemption(c *gin.Context) {
 	for i := 0; i < redemption.Count; i++ {
 		key := random.GetUUID()
 		cleanRedemption := model.Redemption{
-			UserId:      c.GetInt(ctxkey.Id),
-			Name:        redemption.Name,
-			Key:         key,
-			CreatedTime: helper.GetTimestamp(),
-			Quota:       redemption.Quota,
+			UserId:         c.GetInt(ctxkey.Id),
+			Name:           redemption.Name,
+			Key:            key,
+			CreatedTime:    helper.GetTimestamp(),
+			Quota:          redemption.Quota,
+			MaxRedemptions: redemption.MaxRedemptions,
+			PerUserLimit:   redemption.PerUserLimit,
+			StartTime:      redemption.StartTime,
+			EndTime:        redemption.EndTime,
+			NewUserDays:    redemption.NewUserDays,
+			AllowedGroups:  redemption.AllowedGroups,
+			UpgradeGroup:   redemption.UpgradeGroup,
 		}
 		err = cleanRedemption.Insert()
 		if err != nil {
@@ -125,6 +167,7 @@ func AddRedemption(c *gin.Context) {
 			})
 			return
 		}
+		recordAudit(c, "redemption.create", "redemption", cleanRedemption.Id, nil, &cleanRedemption)
 		keys = append(keys, key)
 	}
 	c.JSON(http.StatusOK, gin.H{
@@ -137,6 +180,7 @@ func AddRedemption(c *gin.Context) {
 
 func DeleteRedemption(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	origin, _ := model.GetRedemptionById(id)
 	err := model.DeleteRedemptionById(id)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -145,6 +189,7 @@ func DeleteRedemption(c *gin.Context) {
 		})
 		return
 	}
+	recordAudit(c, "redemption.delete", "redemption", id, origin, nil)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -155,7 +200,10 @@ func DeleteRedemption(c *gin.Context) {
 func UpdateRedemption(c *gin.Context) {
 	statusOnly := c.Query("status_only")
 	redemption := model.Redemption{}
-	err := c.ShouldBindJSON(&redemption)
+	body, err := common.GetRequestBody(c)
+	if err == nil {
+		err = json.Unmarshal(body, &redemption)
+	}
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -171,12 +219,32 @@ func UpdateRedemption(c *gin.Context) {
 		})
 		return
 	}
+	originRedemption := *cleanRedemption
+	if statusOnly == "" {
+		// the campaign settings absent from the request are kept, older clients don't send them
+		redemption = originRedemption
+		_ = json.Unmarshal(body, &redemption)
+	}
 	if statusOnly != "" {
 		cleanRedemption.Status = redemption.Status
 	} else {
 		// If you add more fields, please also update redemption.Update()
 		cleanRedemption.Name = redemption.Name
 		cleanRedemption.Quota = redemption.Quota
+		cleanRedemption.MaxRedemptions = redemption.MaxRedemptions
+		cleanRedemption.PerUserLimit = redemption.PerUserLimit
+		cleanRedemption.StartTime = redemption.StartTime
+		cleanRedemption.EndTime = redemption.EndTime
+		cleanRedemption.NewUserDays = redemption.NewUserDays
+		cleanRedemption.AllowedGroups = redemption.AllowedGroups
+		cleanRedemption.UpgradeGroup = redemption.UpgradeGroup
+		if err = validateRedemptionRules(cleanRedemption); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 	}
 	err = cleanRedemption.Update()
 	if err != nil {
@@ -186,6 +254,7 @@ func UpdateRedemption(c *gin.Context) {
 		})
 		return
 	}
+	recordAudit(c, "redemption.update", "redemption", cleanRedemption.Id, &originRedemption, cleanRedemption)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -193,3 +262,79 @@ func UpdateRedemption(c *gin.Context) {
 	})
 	return
 }
+
+func GetRedemptionRecords(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	records, err := model.GetRedemptionRecords(id, p*config.ItemsPerPage, config.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    records,
+	})
+}
+
+func formatCsvTime(timestamp int64) string {
+	if timestamp == 0 {
+		return ""
+	}
+	return time.Unix(timestamp, 0).Format(time.RFC3339)
+}
+
+// ExportRedemptions downloads the codes of a campaign as csv
+func ExportRedemptions(c *gin.Context) {
+	name := c.Query("name")
+	if name == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "Campaign name is empty",
+		})
+		return
+	}
+	redemptions, err := model.GetRedemptionsByName(name)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	recordAudit(c, "redemption.export", "redemption", name, nil, gin.H{"count": len(redemptions)})
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="redemptions-%s.csv"`, safeFilename(name)))
+	c.Header("Content-Type", "text/csv")
+	writer := csv.NewWriter(c.Writer)
+	_ = writer.Write([]string{"id", "name", "key", "status", "quota", "max_redemptions", "redeemed_count", "per_user_limit", "start_time", "end_time", "created_time"})
+	for _, redemption := range redemptions {
+		_ = writer.Write([]string{
+			strconv.Itoa(redemption.Id),
+			csvSafe(redemption.Name),
+			redemption.Key,
+			strconv.Itoa(redemption.Status),
+			strconv.FormatInt(redemption.Quota, 10),
+			strconv.Itoa(redemption.MaxRedemptions),
+			strconv.Itoa(redemption.RedeemedCount),
+			strconv.Itoa(redemption.PerUserLimit),
+			formatCsvTime(redemption.StartTime),
+			formatCsvTime(redemption.EndTime),
+			formatCsvTime(redemption.CreatedTime),
+		})
+	}
+	writer.Flush()
+}
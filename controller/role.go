@@ -0,0 +1,197 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/i18n"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func GetPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    model.Permissions,
+	})
+	return
+}
+
+func GetAllCustomRoles(c *gin.Context) {
+	roles, err := model.GetAllCustomRoles()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    roles,
+	})
+	return
+}
+
+func validateCustomRole(role *model.CustomRole) error {
+	if role.Name == "" || len(role.Name) > 32 {
+		return errors.New("the name of the role must be 1 to 32 characters long")
+	}
+	return model.ValidatePermissions(role.Permissions)
+}
+
+func AddCustomRole(c *gin.Context) {
+	role := model.CustomRole{}
+	err := c.ShouldBindJSON(&role)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := validateCustomRole(&role); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	cleanRole := model.CustomRole{
+		Name:        role.Name,
+		Description: role.Description,
+		Permissions: role.Permissions,
+	}
+	err = cleanRole.Insert()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	recordAudit(c, "role.create", "role", cleanRole.Id, nil, &cleanRole)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanRole,
+	})
+	return
+}
+
+func UpdateCustomRole(c *gin.Context) {
+	role := model.CustomRole{}
+	err := c.ShouldBindJSON(&role)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	cleanRole, err := model.GetCustomRoleById(role.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := validateCustomRole(&role); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	originRole := *cleanRole
+	cleanRole.Name = role.Name
+	cleanRole.Description = role.Description
+	cleanRole.Permissions = role.Permissions
+	err = cleanRole.Update()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	recordAudit(c, "role.update", "role", cleanRole.Id, &originRole, cleanRole)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanRole,
+	})
+	return
+}
+
+func DeleteCustomRole(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	role, err := model.GetCustomRoleById(id)
+	if err == nil {
+		err = role.Delete()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	recordAudit(c, "role.delete", "role", id, role, nil)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+type assignCustomRoleRequest struct {
+	UserId int `json:"user_id"`
+	RoleId int `json:"role_id"` // 0 restores the preset of the user's role
+}
+
+func AssignCustomRole(c *gin.Context) {
+	var req assignCustomRoleRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil || req.UserId == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": i18n.Translate(c, "invalid_parameter"),
+		})
+		return
+	}
+	user, err := model.GetUserById(req.UserId, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if user.Role == model.RoleRootUser {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "Root users always have every permission.",
+		})
+		return
+	}
+	err = model.SetUserCustomRole(user.Id, req.RoleId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	recordAudit(c, "user.assign_role", "user", user.Id, gin.H{"custom_role_id": user.CustomRoleId}, gin.H{"custom_role_id": req.RoleId})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
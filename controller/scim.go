@@ -0,0 +1,762 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+)
+
+// SCIM 2.0 provisioning (RFC 7643, RFC 7644), users are one-api users and groups are the groups of GroupRatio
+
+const (
+	scimUserSchema     = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimGroupSchema    = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimListSchema     = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimErrorSchema    = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimMaxResults     = 200
+	scimDefaultGroup   = "default"
+	scimContentType    = "application/scim+json"
+	scimUsernameMaxLen = 12
+)
+
+var scimFilterRegex = regexp.MustCompile(`^\s*([A-Za-z.]+)\s+(?i:eq)\s+"((?:[^"\\]|\\.)*)"\s*$`)
+
+type ScimName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type ScimEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type ScimMember struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type ScimMeta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location"`
+}
+
+type ScimUser struct {
+	Schemas     []string     `json:"schemas"`
+	Id          string       `json:"id,omitempty"`
+	ExternalId  string       `json:"externalId,omitempty"`
+	UserName    string       `json:"userName"`
+	DisplayName string       `json:"displayName,omitempty"`
+	Name        *ScimName    `json:"name,omitempty"`
+	Active      *bool        `json:"active,omitempty"`
+	Emails      []ScimEmail  `json:"emails,omitempty"`
+	Groups      []ScimMember `json:"groups,omitempty"`
+	Meta        *ScimMeta    `json:"meta,omitempty"`
+}
+
+type ScimGroup struct {
+	Schemas     []string     `json:"schemas"`
+	Id          string       `json:"id,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []ScimMember `json:"members,omitempty"`
+	Meta        *ScimMeta    `json:"meta,omitempty"`
+}
+
+type ScimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+type ScimPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []ScimPatchOperation `json:"Operations"`
+}
+
+func scimError(c *gin.Context, status int, scimType string, detail string) {
+	body := gin.H{
+		"schemas": []string{scimErrorSchema},
+		"status":  strconv.Itoa(status),
+		"detail":  detail,
+	}
+	if scimType != "" {
+		body["scimType"] = scimType
+	}
+	scimJSON(c, status, body)
+}
+
+func scimJSON(c *gin.Context, status int, body any) {
+	c.Header("Content-Type", scimContentType)
+	c.JSON(status, body)
+}
+
+func scimLocation(resource string, id string) string {
+	return fmt.Sprintf("%s/scim/v2/%s/%s", strings.TrimSuffix(config.ServerAddress, "/"), resource, id)
+}
+
+// parseScimFilter supports the equality filters identity providers use to look up resources
+func parseScimFilter(filter string) (attribute string, value string, err error) {
+	if filter == "" {
+		return "", "", nil
+	}
+	match := scimFilterRegex.FindStringSubmatch(filter)
+	if match == nil {
+		return "", "", fmt.Errorf("unsupported filter: %s", filter)
+	}
+	value, err = strconv.Unquote(`"` + match[2] + `"`)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid filter: %s", filter)
+	}
+	return match[1], value, nil
+}
+
+// getScimPage converts the 1-based startIndex and count of SCIM to an offset and a limit
+func getScimPage(c *gin.Context) (offset int, limit int) {
+	startIndex, _ := strconv.Atoi(c.Query("startIndex"))
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	limit = scimMaxResults
+	if count, err := strconv.Atoi(c.Query("count")); err == nil && count >= 0 && count < scimMaxResults {
+		limit = count
+	}
+	return startIndex - 1, limit
+}
+
+func scimListResponse(c *gin.Context, total int64, offset int, resources any, count int) {
+	scimJSON(c, http.StatusOK, gin.H{
+		"schemas":      []string{scimListSchema},
+		"totalResults": total,
+		"startIndex":   offset + 1,
+		"itemsPerPage": count,
+		"Resources":    resources,
+	})
+}
+
+func toScimUser(user *model.User) *ScimUser {
+	active := user.Status == model.UserStatusEnabled
+	scimUser := &ScimUser{
+		Schemas:     []string{scimUserSchema},
+		Id:          strconv.Itoa(user.Id),
+		ExternalId:  user.ScimExternalId,
+		UserName:    user.GetScimUserName(),
+		DisplayName: user.DisplayName,
+		Active:      &active,
+		Groups:      []ScimMember{{Value: user.Group, Display: user.Group, Ref: scimLocation("Groups", user.Group)}},
+		Meta:        &ScimMeta{ResourceType: "User", Location: scimLocation("Users", strconv.Itoa(user.Id))},
+	}
+	if user.DisplayName != "" {
+		scimUser.Name = &ScimName{Formatted: user.DisplayName}
+	}
+	if user.Email != "" {
+		scimUser.Emails = []ScimEmail{{Value: user.Email, Type: "work", Primary: true}}
+	}
+	return scimUser
+}
+
+// primaryEmail returns the primary email, or the first one if none is marked as primary
+func (u *ScimUser) primaryEmail() string {
+	for _, email := range u.Emails {
+		if email.Primary {
+			return email.Value
+		}
+	}
+	if len(u.Emails) > 0 {
+		return u.Emails[0].Value
+	}
+	return ""
+}
+
+func (u *ScimUser) displayName() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	if u.Name != nil {
+		if u.Name.Formatted != "" {
+			return u.Name.Formatted
+		}
+		if name := strings.TrimSpace(u.Name.GivenName + " " + u.Name.FamilyName); name != "" {
+			return name
+		}
+	}
+	return u.UserName
+}
+
+// applyScimUser copies the attributes managed by the identity provider to the user
+func applyScimUser(user *model.User, scimUser *ScimUser) {
+	user.ScimUserName = scimUser.UserName
+	user.ScimExternalId = scimUser.ExternalId
+	user.DisplayName = scimUser.displayName()
+	user.Email = scimUser.primaryEmail()
+	if scimUser.Active != nil {
+		if *scimUser.Active {
+			user.Status = model.UserStatusEnabled
+		} else {
+			user.Status = model.UserStatusDisabled
+		}
+	}
+}
+
+func getScimUser(c *gin.Context) *model.User {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		scimError(c, http.StatusNotFound, "", "User not found.")
+		return nil
+	}
+	user, err := model.GetScimUserById(id)
+	if err != nil {
+		scimError(c, http.StatusNotFound, "", "User not found.")
+		return nil
+	}
+	return user
+}
+
+func ScimGetUsers(c *gin.Context) {
+	attribute, value, err := parseScimFilter(c.Query("filter"))
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+	offset, limit := getScimPage(c)
+	users, total, err := model.GetScimUsers(attribute, value, offset, limit)
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+	resources := make([]*ScimUser, 0, len(users))
+	for _, user := range users {
+		resources = append(resources, toScimUser(user))
+	}
+	scimListResponse(c, total, offset, resources, len(resources))
+}
+
+func ScimGetUser(c *gin.Context) {
+	user := getScimUser(c)
+	if user == nil {
+		return
+	}
+	scimJSON(c, http.StatusOK, toScimUser(user))
+}
+
+func ScimCreateUser(c *gin.Context) {
+	var scimUser ScimUser
+	if err := json.NewDecoder(c.Request.Body).Decode(&scimUser); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+	if scimUser.UserName == "" {
+		scimError(c, http.StatusBadRequest, "invalidValue", "userName is required.")
+		return
+	}
+	if model.IsScimUserNameTaken(scimUser.UserName, 0) {
+		scimError(c, http.StatusConflict, "uniqueness", "userName is already taken.")
+		return
+	}
+	user := model.User{}
+	applyScimUser(&user, &scimUser)
+	// the userName of identity providers is usually an email, which doesn't fit the username of one-api
+	user.Username = scimUser.UserName
+	if len(user.Username) > scimUsernameMaxLen || model.IsUsernameAlreadyTaken(user.Username) {
+		user.Username = "scim_" + strconv.Itoa(model.GetMaxUserId()+1)
+	}
+	if err := user.Insert(c.Request.Context(), 0); err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	if user.Status == model.UserStatusDisabled {
+		if err := user.UpdateScimAttributes(); err != nil {
+			scimError(c, http.StatusInternalServerError, "", err.Error())
+			return
+		}
+		if err := model.DisableUserTokens(user.Id); err != nil {
+			logger.SysError(fmt.Sprintf("failed to disable the tokens of user %d: %s", user.Id, err.Error()))
+		}
+	}
+	created, err := model.GetScimUserById(user.Id)
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	recordAudit(c, "user.create", "user", user.Id, nil, created)
+	scimJSON(c, http.StatusCreated, toScimUser(created))
+}
+
+// saveScimUser stores the changes of the identity provider, deactivated users lose their tokens
+func saveScimUser(c *gin.Context, user *model.User, scimUser *ScimUser) {
+	if scimUser.UserName == "" {
+		scimError(c, http.StatusBadRequest, "invalidValue", "userName is required.")
+		return
+	}
+	if scimUser.UserName != user.GetScimUserName() && model.IsScimUserNameTaken(scimUser.UserName, user.Id) {
+		scimError(c, http.StatusConflict, "uniqueness", "userName is already taken.")
+		return
+	}
+	before := *user
+	applyScimUser(user, scimUser)
+	if user.Role == model.RoleRootUser && user.Status != model.UserStatusEnabled {
+		scimError(c, http.StatusBadRequest, "mutability", "Unable to disable the super administrator user.")
+		return
+	}
+	if err := user.UpdateScimAttributes(); err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	// tokens stay disabled when the user is activated again, the user can enable them again
+	if user.Status == model.UserStatusDisabled && before.Status != model.UserStatusDisabled {
+		if err := model.DisableUserTokens(user.Id); err != nil {
+			scimError(c, http.StatusInternalServerError, "", err.Error())
+			return
+		}
+	}
+	recordAudit(c, "user.update", "user", user.Id, &before, user)
+	scimJSON(c, http.StatusOK, toScimUser(user))
+}
+
+func ScimReplaceUser(c *gin.Context) {
+	user := getScimUser(c)
+	if user == nil {
+		return
+	}
+	var scimUser ScimUser
+	if err := json.NewDecoder(c.Request.Body).Decode(&scimUser); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+	saveScimUser(c, user, &scimUser)
+}
+
+// parseScimBool accepts the booleans some identity providers send as strings
+func parseScimBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return false, err
+	}
+	return strconv.ParseBool(strings.ToLower(s))
+}
+
+// applyScimUserPatch applies a single attribute of a patch operation, removals pass a null value
+func applyScimUserPatch(scimUser *ScimUser, path string, value json.RawMessage) error {
+	var str string
+	if len(value) != 0 && string(value) != "null" {
+		_ = json.Unmarshal(value, &str)
+	}
+	if scimUser.Name == nil {
+		scimUser.Name = &ScimName{}
+	}
+	switch strings.ToLower(strings.TrimPrefix(path, scimUserSchema+":")) {
+	case "active":
+		active, err := parseScimBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid value of active: %s", string(value))
+		}
+		scimUser.Active = &active
+	case "username":
+		scimUser.UserName = str
+	case "displayname":
+		scimUser.DisplayName = str
+	case "externalid":
+		scimUser.ExternalId = str
+	case "name.formatted":
+		scimUser.Name.Formatted = str
+	case "name.givenname":
+		scimUser.Name.GivenName = str
+	case "name.familyname":
+		scimUser.Name.FamilyName = str
+	case "name":
+		var name ScimName
+		if str == "" && len(value) != 0 && string(value) != "null" {
+			if err := json.Unmarshal(value, &name); err != nil {
+				return err
+			}
+		}
+		scimUser.Name = &name
+	case "emails", `emails[type eq "work"].value`, `emails[primary eq true].value`:
+		var emails []ScimEmail
+		if str != "" {
+			emails = []ScimEmail{{Value: str, Primary: true}}
+		} else if len(value) != 0 && string(value) != "null" {
+			if err := json.Unmarshal(value, &emails); err != nil {
+				return err
+			}
+		}
+		scimUser.Emails = emails
+	default:
+		// attributes one-api doesn't store are ignored
+	}
+	return nil
+}
+
+func ScimPatchUser(c *gin.Context) {
+	user := getScimUser(c)
+	if user == nil {
+		return
+	}
+	var patch ScimPatchRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&patch); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+	scimUser := toScimUser(user)
+	// name is only a fallback of displayName, it isn't stored
+	scimUser.Name = nil
+	for _, operation := range patch.Operations {
+		var err error
+		switch strings.ToLower(operation.Op) {
+		case "add", "replace":
+			if operation.Path != "" {
+				err = applyScimUserPatch(scimUser, operation.Path, operation.Value)
+				break
+			}
+			var values map[string]json.RawMessage
+			if err = json.Unmarshal(operation.Value, &values); err != nil {
+				break
+			}
+			for path, value := range values {
+				if err = applyScimUserPatch(scimUser, path, value); err != nil {
+					break
+				}
+			}
+		case "remove":
+			err = applyScimUserPatch(scimUser, operation.Path, nil)
+		default:
+			err = fmt.Errorf("unsupported operation: %s", operation.Op)
+		}
+		if err != nil {
+			scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+			return
+		}
+	}
+	saveScimUser(c, user, scimUser)
+}
+
+func ScimDeleteUser(c *gin.Context) {
+	user := getScimUser(c)
+	if user == nil {
+		return
+	}
+	if user.Role == model.RoleRootUser {
+		scimError(c, http.StatusBadRequest, "mutability", "Unable to delete the super admin user.")
+		return
+	}
+	before := *user
+	if err := user.Delete(); err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	if err := model.DisableUserTokens(user.Id); err != nil {
+		logger.SysError(fmt.Sprintf("failed to disable the tokens of user %d: %s", user.Id, err.Error()))
+	}
+	recordAudit(c, "user.delete", "user", user.Id, &before, nil)
+	c.Status(http.StatusNoContent)
+}
+
+func isGroupConfigured(group string) bool {
+	_, ok := billingratio.GroupRatio[group]
+	return ok
+}
+
+func toScimGroup(group string, withMembers bool) (*ScimGroup, error) {
+	scimGroup := &ScimGroup{
+		Schemas:     []string{scimGroupSchema},
+		Id:          group,
+		DisplayName: group,
+		Meta:        &ScimMeta{ResourceType: "Group", Location: scimLocation("Groups", group)},
+	}
+	if !withMembers {
+		return scimGroup, nil
+	}
+	users, err := model.GetGroupMembers(group)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		id := strconv.Itoa(user.Id)
+		scimGroup.Members = append(scimGroup.Members, ScimMember{Value: id, Display: user.GetScimUserName(), Ref: scimLocation("Users", id)})
+	}
+	return scimGroup, nil
+}
+
+func scimWithMembers(c *gin.Context) bool {
+	return !strings.Contains(c.Query("excludedAttributes"), "members")
+}
+
+func ScimGetGroups(c *gin.Context) {
+	attribute, value, err := parseScimFilter(c.Query("filter"))
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+	var groups []string
+	for group := range billingratio.GroupRatio {
+		switch attribute {
+		case "":
+		case "id", "displayName":
+			if group != value {
+				continue
+			}
+		default:
+			scimError(c, http.StatusBadRequest, "invalidFilter", fmt.Sprintf("filtering by %s is not supported", attribute))
+			return
+		}
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	offset, limit := getScimPage(c)
+	total := int64(len(groups))
+	if offset > len(groups) {
+		offset = len(groups)
+	}
+	if offset+limit < len(groups) {
+		groups = groups[:offset+limit]
+	}
+	groups = groups[offset:]
+	resources := make([]*ScimGroup, 0, len(groups))
+	for _, group := range groups {
+		scimGroup, err := toScimGroup(group, scimWithMembers(c))
+		if err != nil {
+			scimError(c, http.StatusInternalServerError, "", err.Error())
+			return
+		}
+		resources = append(resources, scimGroup)
+	}
+	scimListResponse(c, total, offset, resources, len(resources))
+}
+
+func getScimGroup(c *gin.Context) string {
+	group := c.Param("id")
+	if !isGroupConfigured(group) {
+		scimError(c, http.StatusNotFound, "", "Group not found.")
+		return ""
+	}
+	return group
+}
+
+func ScimGetGroup(c *gin.Context) {
+	group := getScimGroup(c)
+	if group == "" {
+		return
+	}
+	scimGroup, err := toScimGroup(group, scimWithMembers(c))
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	scimJSON(c, http.StatusOK, scimGroup)
+}
+
+func parseScimMemberIds(members []ScimMember) ([]int, error) {
+	ids := make([]int, 0, len(members))
+	for _, member := range members {
+		id, err := strconv.Atoi(member.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid member: %s", member.Value)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// setScimGroupMembers makes the users the only members of the group, removed members go back to the default group
+func setScimGroupMembers(c *gin.Context, group string, ids []int) error {
+	current, err := model.GetGroupMembers(group)
+	if err != nil {
+		return err
+	}
+	keep := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		keep[id] = true
+	}
+	var removed []int
+	for _, user := range current {
+		if !keep[user.Id] {
+			removed = append(removed, user.Id)
+		}
+	}
+	if group != scimDefaultGroup {
+		if err := model.SetUsersGroup(removed, scimDefaultGroup); err != nil {
+			return err
+		}
+	}
+	if err := model.SetUsersGroup(ids, group); err != nil {
+		return err
+	}
+	recordAudit(c, "group.members", "group", group, gin.H{"removed": removed}, gin.H{"members": ids})
+	return nil
+}
+
+// ScimCreateGroup links a group of the identity provider to a group configured in GroupRatio,
+// groups can't be created through SCIM since they need a ratio
+func ScimCreateGroup(c *gin.Context) {
+	var scimGroup ScimGroup
+	if err := json.NewDecoder(c.Request.Body).Decode(&scimGroup); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+	if !isGroupConfigured(scimGroup.DisplayName) {
+		scimError(c, http.StatusBadRequest, "invalidValue", fmt.Sprintf("Group %s must be added to the group ratio first.", scimGroup.DisplayName))
+		return
+	}
+	if len(scimGroup.Members) > 0 {
+		ids, err := parseScimMemberIds(scimGroup.Members)
+		if err != nil {
+			scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+			return
+		}
+		if err := model.SetUsersGroup(ids, scimGroup.DisplayName); err != nil {
+			scimError(c, http.StatusInternalServerError, "", err.Error())
+			return
+		}
+		recordAudit(c, "group.members", "group", scimGroup.DisplayName, nil, gin.H{"added": ids})
+	}
+	created, err := toScimGroup(scimGroup.DisplayName, true)
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	scimJSON(c, http.StatusCreated, created)
+}
+
+func ScimReplaceGroup(c *gin.Context) {
+	group := getScimGroup(c)
+	if group == "" {
+		return
+	}
+	var scimGroup ScimGroup
+	if err := json.NewDecoder(c.Request.Body).Decode(&scimGroup); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+	if scimGroup.DisplayName != "" && scimGroup.DisplayName != group {
+		scimError(c, http.StatusBadRequest, "mutability", "Groups can't be renamed.")
+		return
+	}
+	ids, err := parseScimMemberIds(scimGroup.Members)
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+	if err := setScimGroupMembers(c, group, ids); err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	ScimGetGroup(c)
+}
+
+var scimMemberPathRegex = regexp.MustCompile(`^members\[value eq "([^"]*)"\]$`)
+
+func ScimPatchGroup(c *gin.Context) {
+	group := getScimGroup(c)
+	if group == "" {
+		return
+	}
+	var patch ScimPatchRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&patch); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+	for _, operation := range patch.Operations {
+		var members []ScimMember
+		path := operation.Path
+		if match := scimMemberPathRegex.FindStringSubmatch(path); match != nil {
+			members = []ScimMember{{Value: match[1]}}
+			path = "members"
+		} else if len(operation.Value) != 0 && path == "members" {
+			if err := json.Unmarshal(operation.Value, &members); err != nil {
+				scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+				return
+			}
+		} else if path == "" {
+			var value ScimGroup
+			if err := json.Unmarshal(operation.Value, &value); err != nil {
+				scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+				return
+			}
+			if value.DisplayName != "" && value.DisplayName != group {
+				scimError(c, http.StatusBadRequest, "mutability", "Groups can't be renamed.")
+				return
+			}
+			members = value.Members
+			path = "members"
+		}
+		if path != "members" {
+			scimError(c, http.StatusBadRequest, "mutability", fmt.Sprintf("%s can't be changed.", operation.Path))
+			return
+		}
+		ids, err := parseScimMemberIds(members)
+		if err != nil {
+			scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+			return
+		}
+		switch strings.ToLower(operation.Op) {
+		case "add":
+			err = model.SetUsersGroup(ids, group)
+			recordAudit(c, "group.members", "group", group, nil, gin.H{"added": ids})
+		case "remove":
+			if len(ids) == 0 {
+				// removing the members attribute removes all members
+				err = setScimGroupMembers(c, group, nil)
+			} else if group != scimDefaultGroup {
+				err = model.SetUsersGroup(ids, scimDefaultGroup)
+				recordAudit(c, "group.members", "group", group, gin.H{"removed": ids}, nil)
+			}
+		case "replace":
+			err = setScimGroupMembers(c, group, ids)
+		default:
+			scimError(c, http.StatusBadRequest, "invalidValue", fmt.Sprintf("unsupported operation: %s", operation.Op))
+			return
+		}
+		if err != nil {
+			scimError(c, http.StatusInternalServerError, "", err.Error())
+			return
+		}
+	}
+	ScimGetGroup(c)
+}
+
+// ScimDeleteGroup unlinks a group, its members go back to the default group while the group itself stays configured
+func ScimDeleteGroup(c *gin.Context) {
+	group := getScimGroup(c)
+	if group == "" {
+		return
+	}
+	if err := setScimGroupMembers(c, group, nil); err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func ScimServiceProviderConfig(c *gin.Context) {
+	scimJSON(c, http.StatusOK, gin.H{
+		"schemas":        []string{"urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"},
+		"patch":          gin.H{"supported": true},
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": scimMaxResults},
+		"changePassword": gin.H{"supported": false},
+		"sort":           gin.H{"supported": false},
+		"etag":           gin.H{"supported": false},
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "Authentication with the SCIM token configured in the system settings",
+		}},
+	})
+}
@@ -0,0 +1,289 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/blacklist"
+	"github.com/songquanpeng/one-api/model"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+)
+
+func newScimServer(t *testing.T) *gin.Engine {
+	setupTestDB(t)
+	groupRatio := billingratio.GroupRatio
+	billingratio.GroupRatio = map[string]float64{"default": 1, "staff": 0.5, "vip": 0.8}
+	t.Cleanup(func() { billingratio.GroupRatio = groupRatio })
+
+	server := gin.New()
+	scimRouter := server.Group("/scim/v2")
+	scimRouter.GET("/Users", ScimGetUsers)
+	scimRouter.POST("/Users", ScimCreateUser)
+	scimRouter.GET("/Users/:id", ScimGetUser)
+	scimRouter.PUT("/Users/:id", ScimReplaceUser)
+	scimRouter.PATCH("/Users/:id", ScimPatchUser)
+	scimRouter.DELETE("/Users/:id", ScimDeleteUser)
+	scimRouter.GET("/Groups", ScimGetGroups)
+	scimRouter.POST("/Groups", ScimCreateGroup)
+	scimRouter.GET("/Groups/:id", ScimGetGroup)
+	scimRouter.PUT("/Groups/:id", ScimReplaceGroup)
+	scimRouter.PATCH("/Groups/:id", ScimPatchGroup)
+	scimRouter.DELETE("/Groups/:id", ScimDeleteGroup)
+	return server
+}
+
+func scimRequest(t *testing.T, server *gin.Engine, method string, path string, body any, response any) int {
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(method, path, reader))
+	if response != nil && w.Body.Len() != 0 {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), response), w.Body.String())
+	}
+	return w.Code
+}
+
+func createScimUser(t *testing.T, server *gin.Engine, userName string) *ScimUser {
+	created := &ScimUser{}
+	code := scimRequest(t, server, "POST", "/scim/v2/Users", gin.H{
+		"schemas":    []string{scimUserSchema},
+		"userName":   userName,
+		"externalId": "ext-" + userName,
+		"name":       gin.H{"givenName": "Alice", "familyName": "Smith"},
+		"emails":     []gin.H{{"value": "other@example.com"}, {"value": userName, "primary": true}},
+	}, created)
+	require.Equal(t, http.StatusCreated, code)
+	return created
+}
+
+func TestParseScimFilter(t *testing.T) {
+	cases := []struct {
+		filter    string
+		attribute string
+		value     string
+		err       bool
+	}{
+		{"", "", "", false},
+		{`userName eq "alice@example.com"`, "userName", "alice@example.com", false},
+		{` externalId EQ "a\"b" `, "externalId", `a"b`, false},
+		{`emails.value eq "a@b.c"`, "emails.value", "a@b.c", false},
+		{`userName co "alice"`, "", "", true},
+		{`userName eq "a" and active eq true`, "", "", true},
+		{`userName eq alice`, "", "", true},
+	}
+	for _, c := range cases {
+		attribute, value, err := parseScimFilter(c.filter)
+		if c.err {
+			assert.Error(t, err, c.filter)
+			continue
+		}
+		require.NoError(t, err, c.filter)
+		assert.Equal(t, c.attribute, attribute, c.filter)
+		assert.Equal(t, c.value, value, c.filter)
+	}
+}
+
+func TestScimUsers(t *testing.T) {
+	server := newScimServer(t)
+	alice := createScimUser(t, server, "alice@example.com")
+	assert.Equal(t, "alice@example.com", alice.UserName)
+	assert.Equal(t, "Alice Smith", alice.DisplayName)
+	assert.True(t, *alice.Active)
+	assert.Equal(t, "alice@example.com", alice.Emails[0].Value, "the primary email is kept")
+	id, err := strconv.Atoi(alice.Id)
+	require.NoError(t, err)
+	user, err := model.GetUserById(id, false)
+	require.NoError(t, err)
+	assert.Equal(t, "scim_"+alice.Id, user.Username, "userNames too long for a username are replaced")
+
+	assert.Equal(t, http.StatusConflict, scimRequest(t, server, "POST", "/scim/v2/Users", gin.H{"userName": "alice@example.com"}, nil))
+	assert.Equal(t, http.StatusBadRequest, scimRequest(t, server, "POST", "/scim/v2/Users", gin.H{"displayName": "nobody"}, nil))
+	createScimUser(t, server, "bob")
+
+	var list struct {
+		TotalResults int         `json:"totalResults"`
+		Resources    []*ScimUser `json:"Resources"`
+	}
+	require.Equal(t, http.StatusOK, scimRequest(t, server, "GET", `/scim/v2/Users?filter=userName+eq+"alice@example.com"`, nil, &list))
+	require.Equal(t, 1, list.TotalResults)
+	assert.Equal(t, alice.Id, list.Resources[0].Id)
+	require.Equal(t, http.StatusOK, scimRequest(t, server, "GET", `/scim/v2/Users?filter=externalId+eq+"ext-bob"`, nil, &list))
+	require.Equal(t, 1, list.TotalResults)
+	assert.Equal(t, "bob", list.Resources[0].UserName)
+	require.Equal(t, http.StatusOK, scimRequest(t, server, "GET", "/scim/v2/Users?startIndex=2&count=1", nil, &list))
+	assert.Equal(t, 2, list.TotalResults)
+	require.Len(t, list.Resources, 1)
+	assert.Equal(t, "bob", list.Resources[0].UserName)
+	assert.Equal(t, http.StatusBadRequest, scimRequest(t, server, "GET", `/scim/v2/Users?filter=password+eq+"x"`, nil, nil))
+	assert.Equal(t, http.StatusNotFound, scimRequest(t, server, "GET", "/scim/v2/Users/12345", nil, nil))
+}
+
+func TestScimPatchUser(t *testing.T) {
+	server := newScimServer(t)
+	alice := createScimUser(t, server, "alice@example.com")
+	path := "/scim/v2/Users/" + alice.Id
+	patch := func(operations ...gin.H) (*ScimUser, int) {
+		patched := &ScimUser{}
+		code := scimRequest(t, server, "PATCH", path, gin.H{
+			"schemas":    []string{"urn:ietf:params:scim:api:messages:2.0:PatchOp"},
+			"Operations": operations,
+		}, patched)
+		return patched, code
+	}
+
+	patched, code := patch(
+		gin.H{"op": "replace", "path": "displayName", "value": "Alice S."},
+		gin.H{"op": "Replace", "path": `emails[type eq "work"].value`, "value": "alice@corp.example.com"},
+		gin.H{"op": "add", "value": gin.H{"externalId": "ext-2", "userName": "alice@corp.example.com"}},
+	)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "Alice S.", patched.DisplayName)
+	assert.Equal(t, "alice@corp.example.com", patched.UserName)
+	assert.Equal(t, "ext-2", patched.ExternalId)
+	assert.Equal(t, "alice@corp.example.com", patched.Emails[0].Value)
+
+	patched, code = patch(gin.H{"op": "remove", "path": "displayName"}, gin.H{"op": "remove", "path": "emails"})
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "alice@corp.example.com", patched.DisplayName, "the userName is the fallback of displayName")
+	assert.Empty(t, patched.Emails)
+
+	_, code = patch(gin.H{"op": "replace", "path": "active", "value": "maybe"})
+	assert.Equal(t, http.StatusBadRequest, code)
+	_, code = patch(gin.H{"op": "move", "path": "displayName", "value": "x"})
+	assert.Equal(t, http.StatusBadRequest, code)
+	bob := createScimUser(t, server, "bob")
+	_, code = patch(gin.H{"op": "replace", "path": "userName", "value": bob.UserName})
+	assert.Equal(t, http.StatusConflict, code)
+}
+
+func TestScimDeactivateUser(t *testing.T) {
+	server := newScimServer(t)
+	alice := createScimUser(t, server, "alice@example.com")
+	id, _ := strconv.Atoi(alice.Id)
+	token := &model.Token{UserId: id, Name: "default", Status: model.TokenStatusEnabled, RemainQuota: 100}
+	require.NoError(t, token.Insert())
+
+	// okta sends active as a string
+	deactivated := &ScimUser{}
+	require.Equal(t, http.StatusOK, scimRequest(t, server, "PATCH", "/scim/v2/Users/"+alice.Id, gin.H{
+		"Operations": []gin.H{{"op": "replace", "value": gin.H{"active": "False"}}},
+	}, deactivated))
+	assert.False(t, *deactivated.Active)
+	user, err := model.GetUserById(id, false)
+	require.NoError(t, err)
+	assert.Equal(t, model.UserStatusDisabled, user.Status)
+	assert.True(t, blacklist.IsUserBanned(id), "the user is logged out at once")
+	token, err = model.GetTokenById(token.Id)
+	require.NoError(t, err)
+	assert.Equal(t, model.TokenStatusDisabled, token.Status)
+
+	// activating the user again keeps the tokens disabled
+	alice.Active = new(bool)
+	*alice.Active = true
+	require.Equal(t, http.StatusOK, scimRequest(t, server, "PUT", "/scim/v2/Users/"+alice.Id, alice, nil))
+	assert.False(t, blacklist.IsUserBanned(id))
+	token, err = model.GetTokenById(token.Id)
+	require.NoError(t, err)
+	assert.Equal(t, model.TokenStatusDisabled, token.Status)
+
+	require.Equal(t, http.StatusNoContent, scimRequest(t, server, "DELETE", "/scim/v2/Users/"+alice.Id, nil, nil))
+	assert.Equal(t, http.StatusNotFound, scimRequest(t, server, "GET", "/scim/v2/Users/"+alice.Id, nil, nil))
+}
+
+func TestScimRootUserGuards(t *testing.T) {
+	server := newScimServer(t)
+	root := &model.User{Username: "root", Role: model.RoleRootUser, Status: model.UserStatusEnabled}
+	require.NoError(t, root.Insert(context.Background(), 0))
+	// user ids are reused by the databases of other tests, but the ban list is global
+	blacklist.UnbanUser(root.Id)
+	path := "/scim/v2/Users/" + strconv.Itoa(root.Id)
+
+	assert.Equal(t, http.StatusBadRequest, scimRequest(t, server, "PATCH", path, gin.H{
+		"Operations": []gin.H{{"op": "replace", "path": "active", "value": false}},
+	}, nil))
+	assert.Equal(t, http.StatusBadRequest, scimRequest(t, server, "PUT", path, gin.H{"userName": "root", "active": false}, nil))
+	assert.Equal(t, http.StatusBadRequest, scimRequest(t, server, "DELETE", path, nil, nil))
+	user, err := model.GetUserById(root.Id, false)
+	require.NoError(t, err)
+	assert.Equal(t, model.UserStatusEnabled, user.Status)
+	assert.False(t, blacklist.IsUserBanned(root.Id))
+}
+
+func TestScimGroupMembers(t *testing.T) {
+	server := newScimServer(t)
+	alice := createScimUser(t, server, "alice")
+	bob := createScimUser(t, server, "bob")
+	carol := createScimUser(t, server, "carol")
+	groupOf := func(scimUser *ScimUser) string {
+		id, _ := strconv.Atoi(scimUser.Id)
+		user, err := model.GetUserById(id, false)
+		require.NoError(t, err)
+		return user.Group
+	}
+	memberIds := func(group *ScimGroup) []string {
+		ids := make([]string, 0)
+		for _, member := range group.Members {
+			ids = append(ids, member.Value)
+		}
+		return ids
+	}
+
+	assert.Equal(t, http.StatusBadRequest, scimRequest(t, server, "POST", "/scim/v2/Groups", gin.H{"displayName": "unknown"}, nil), "groups need a ratio first")
+	group := &ScimGroup{}
+	require.Equal(t, http.StatusCreated, scimRequest(t, server, "POST", "/scim/v2/Groups", gin.H{
+		"displayName": "staff",
+		"members":     []gin.H{{"value": alice.Id}, {"value": bob.Id}},
+	}, group))
+	assert.Equal(t, []string{alice.Id, bob.Id}, memberIds(group))
+
+	require.Equal(t, http.StatusOK, scimRequest(t, server, "PATCH", "/scim/v2/Groups/staff", gin.H{"Operations": []gin.H{
+		{"op": "add", "path": "members", "value": []gin.H{{"value": carol.Id}}},
+		{"op": "remove", "path": `members[value eq "` + alice.Id + `"]`},
+	}}, group))
+	assert.Equal(t, []string{bob.Id, carol.Id}, memberIds(group))
+	assert.Equal(t, "default", groupOf(alice), "removed members go back to the default group")
+
+	// a replace makes the members the only ones
+	require.Equal(t, http.StatusOK, scimRequest(t, server, "PUT", "/scim/v2/Groups/staff", gin.H{
+		"displayName": "staff",
+		"members":     []gin.H{{"value": alice.Id}},
+	}, group))
+	assert.Equal(t, []string{alice.Id}, memberIds(group))
+	assert.Equal(t, "default", groupOf(bob))
+	assert.Equal(t, "default", groupOf(carol))
+
+	assert.Equal(t, http.StatusBadRequest, scimRequest(t, server, "PATCH", "/scim/v2/Groups/staff", gin.H{"Operations": []gin.H{
+		{"op": "replace", "path": "displayName", "value": "vip"},
+	}}, nil))
+	assert.Equal(t, http.StatusBadRequest, scimRequest(t, server, "PUT", "/scim/v2/Groups/staff", gin.H{"displayName": "vip"}, nil))
+	assert.Equal(t, http.StatusBadRequest, scimRequest(t, server, "PATCH", "/scim/v2/Groups/staff", gin.H{"Operations": []gin.H{
+		{"op": "add", "path": "members", "value": []gin.H{{"value": "alice"}}},
+	}}, nil))
+
+	var list struct {
+		TotalResults int          `json:"totalResults"`
+		Resources    []*ScimGroup `json:"Resources"`
+	}
+	require.Equal(t, http.StatusOK, scimRequest(t, server, "GET", `/scim/v2/Groups?filter=displayName+eq+"staff"&excludedAttributes=members`, nil, &list))
+	require.Equal(t, 1, list.TotalResults)
+	assert.Empty(t, list.Resources[0].Members)
+
+	require.Equal(t, http.StatusNoContent, scimRequest(t, server, "DELETE", "/scim/v2/Groups/staff", nil, nil))
+	assert.Equal(t, "default", groupOf(alice))
+	assert.Equal(t, http.StatusNotFound, scimRequest(t, server, "GET", "/scim/v2/Groups/unknown", nil, nil))
+}
@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func respondSessions(c *gin.Context, userId int) {
+	userSessions, err := model.GetUserSessions(userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	current := ""
+	if id := sessions.Default(c).ID(); id != "" {
+		current = model.HashSessionToken(id)
+	}
+	for _, userSession := range userSessions {
+		userSession.Current = userSession.Id == current
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    userSessions,
+	})
+}
+
+func GetSelfSessions(c *gin.Context) {
+	respondSessions(c, c.GetInt(ctxkey.Id))
+}
+
+func RevokeSelfSession(c *gin.Context) {
+	err := model.RevokeUserSession(c.GetInt(ctxkey.Id), c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// RevokeOtherSelfSessions logs the user out everywhere except in the current session
+func RevokeOtherSelfSessions(c *gin.Context) {
+	current := ""
+	if id := sessions.Default(c).ID(); id != "" {
+		current = model.HashSessionToken(id)
+	}
+	count, err := model.RevokeUserSessions(c.GetInt(ctxkey.Id), current)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    count,
+	})
+}
+
+// getManagedUser returns the user of the id parameter if the current user is allowed to manage it
+func getManagedUser(c *gin.Context) *model.User {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return nil
+	}
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return nil
+	}
+	myRole := c.GetInt(ctxkey.Role)
+	if myRole <= user.Role && myRole != model.RoleRootUser {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "No permission to manage the sessions of users with the same or higher permission level.",
+		})
+		return nil
+	}
+	return user
+}
+
+func GetUserSessions(c *gin.Context) {
+	user := getManagedUser(c)
+	if user == nil {
+		return
+	}
+	respondSessions(c, user.Id)
+}
+
+func RevokeUserSession(c *gin.Context) {
+	user := getManagedUser(c)
+	if user == nil {
+		return
+	}
+	err := model.RevokeUserSession(user.Id, c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	recordAudit(c, "user.revoke_session", "user", user.Id, nil, gin.H{"session_id": c.Param("session_id")})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func RevokeUserSessions(c *gin.Context) {
+	user := getManagedUser(c)
+	if user == nil {
+		return
+	}
+	count, err := model.RevokeUserSessions(user.Id, "")
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	recordAudit(c, "user.revoke_sessions", "user", user.Id, nil, gin.H{"count": count})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    count,
+	})
+}
@@ -0,0 +1,224 @@
+package controller
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/payment"
+	"github.com/songquanpeng/one-api/common/pdf"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func respondStatements(c *gin.Context, userId int) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	group := ""
+	if userId == 0 {
+		userId, _ = strconv.Atoi(c.Query("user_id"))
+		group = c.Query("group")
+	}
+	statements, err := model.GetStatements(userId, group, c.Query("period"), p*config.ItemsPerPage, config.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    statements,
+	})
+}
+
+func GetSelfStatements(c *gin.Context) {
+	respondStatements(c, c.GetInt(ctxkey.Id))
+}
+
+func GetAllStatements(c *gin.Context) {
+	respondStatements(c, 0)
+}
+
+// getStatement returns the statement of the id parameter, users only see their own statements
+func getStatement(c *gin.Context, self bool) *model.Statement {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return nil
+	}
+	statement, err := model.GetStatementById(id)
+	if err == nil && self && statement.UserId != c.GetInt(ctxkey.Id) {
+		err = fmt.Errorf("statement %d not found", id)
+	}
+	if err == nil {
+		err = statement.LoadDetail()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return nil
+	}
+	return statement
+}
+
+func respondStatement(c *gin.Context, self bool) {
+	statement := getStatement(c, self)
+	if statement == nil {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    statement,
+	})
+}
+
+func GetSelfStatement(c *gin.Context) {
+	respondStatement(c, true)
+}
+
+func GetStatement(c *gin.Context) {
+	respondStatement(c, false)
+}
+
+func downloadStatement(c *gin.Context, self bool) {
+	statement := getStatement(c, self)
+	if statement == nil {
+		return
+	}
+	subject := statement.Username
+	if statement.UserId == 0 {
+		subject = "group-" + statement.Group
+	}
+	filename := fmt.Sprintf("statement-%s-%s", statement.Period, subject)
+	if c.Query("format") == "pdf" {
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pdf"`, safeFilename(filename)))
+		c.Data(http.StatusOK, "application/pdf", renderStatementPdf(statement))
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, safeFilename(filename)))
+	c.Header("Content-Type", "text/csv")
+	writeStatementCsv(c, statement)
+}
+
+func DownloadSelfStatement(c *gin.Context) {
+	downloadStatement(c, true)
+}
+
+func DownloadStatement(c *gin.Context) {
+	downloadStatement(c, false)
+}
+
+type generateStatementRequest struct {
+	UserId int    `json:"user_id"`
+	Group  string `json:"group"`
+	Period string `json:"period"`
+}
+
+// GenerateStatement creates the statement of a user or a group for a finished month, if it doesn't exist yet
+func GenerateStatement(c *gin.Context) {
+	req := generateStatementRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	statement, err := model.GenerateStatement(req.UserId, req.Group, req.Period)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	recordAudit(c, "statement.generate", "statement", statement.Id, nil, req)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    statement,
+	})
+}
+
+func formatCurrency(amount float64) string {
+	return fmt.Sprintf("%.2f", amount)
+}
+
+func writeStatementCsv(c *gin.Context, statement *model.Statement) {
+	writer := csv.NewWriter(c.Writer)
+	_ = writer.Write([]string{"section", "item", "requests", "prompt_tokens", "completion_tokens", "quota", "amount_usd"})
+	for _, usage := range statement.Detail.Models {
+		_ = writer.Write([]string{
+			"usage",
+			csvSafe(usage.ModelName),
+			strconv.FormatInt(usage.RequestCount, 10),
+			strconv.FormatInt(usage.PromptTokens, 10),
+			strconv.FormatInt(usage.CompletionTokens, 10),
+			strconv.FormatInt(usage.Quota, 10),
+			formatCurrency(statement.QuotaToCurrency(usage.Quota)),
+		})
+	}
+	_ = writer.Write([]string{
+		"usage", "total",
+		strconv.FormatInt(statement.RequestCount, 10),
+		strconv.FormatInt(statement.PromptTokens, 10),
+		strconv.FormatInt(statement.CompletionTokens, 10),
+		strconv.FormatInt(statement.UsedQuota, 10),
+		formatCurrency(statement.QuotaToCurrency(statement.UsedQuota)),
+	})
+	_ = writer.Write([]string{"top_up", "total", "", "", "", strconv.FormatInt(statement.TopUpQuota, 10), formatCurrency(statement.QuotaToCurrency(statement.TopUpQuota))})
+	_ = writer.Write([]string{"top_up", "redemptions", strconv.FormatInt(statement.RedemptionCount, 10), "", "", strconv.FormatInt(statement.RedemptionQuota, 10), formatCurrency(statement.QuotaToCurrency(statement.RedemptionQuota))})
+	for _, paid := range statement.Detail.Payments {
+		_ = writer.Write([]string{"payment", paid.Currency, strconv.FormatInt(paid.Count, 10), "", "", "", payment.FormatAmount(paid.Amount, paid.Currency)})
+	}
+	writer.Flush()
+}
+
+func renderStatementPdf(statement *model.Statement) []byte {
+	doc := pdf.New()
+	doc.Add(fmt.Sprintf("%s Statement %s", config.SystemName, statement.Period), pdf.HelveticaBold, 16)
+	if statement.UserId != 0 {
+		doc.Add(fmt.Sprintf("User: %s (#%d)", statement.Username, statement.UserId), pdf.Helvetica, 10)
+	} else {
+		doc.Add(fmt.Sprintf("Group: %s", statement.Group), pdf.Helvetica, 10)
+	}
+	doc.Add(fmt.Sprintf("Period: %s - %s", time.Unix(statement.StartTime, 0).Format("2006-01-02"),
+		time.Unix(statement.EndTime-1, 0).Format("2006-01-02")), pdf.Helvetica, 10)
+	doc.Add(fmt.Sprintf("Statement #%d, generated %s", statement.Id, time.Unix(statement.CreatedTime, 0).Format("2006-01-02 15:04:05 MST")), pdf.Helvetica, 10)
+	doc.Add("", pdf.Helvetica, 10)
+
+	doc.Add("Usage", pdf.HelveticaBold, 12)
+	row := "%-32.32s %9s %13s %13s %12s"
+	doc.Add(fmt.Sprintf(row, "Model", "Requests", "Prompt", "Completion", "Amount USD"), pdf.Courier, 8)
+	for _, usage := range statement.Detail.Models {
+		doc.Add(fmt.Sprintf(row, usage.ModelName, strconv.FormatInt(usage.RequestCount, 10), strconv.FormatInt(usage.PromptTokens, 10),
+			strconv.FormatInt(usage.CompletionTokens, 10), formatCurrency(statement.QuotaToCurrency(usage.Quota))), pdf.Courier, 8)
+	}
+	doc.Add(fmt.Sprintf(row, "Total", strconv.FormatInt(statement.RequestCount, 10), strconv.FormatInt(statement.PromptTokens, 10),
+		strconv.FormatInt(statement.CompletionTokens, 10), formatCurrency(statement.QuotaToCurrency(statement.UsedQuota))), pdf.Courier, 8)
+	doc.Add("", pdf.Helvetica, 10)
+
+	doc.Add("Top-ups", pdf.HelveticaBold, 12)
+	doc.Add(fmt.Sprintf("Total top-ups: %s USD", formatCurrency(statement.QuotaToCurrency(statement.TopUpQuota))), pdf.Helvetica, 10)
+	doc.Add(fmt.Sprintf("Redemptions: %d codes, %s USD", statement.RedemptionCount, formatCurrency(statement.QuotaToCurrency(statement.RedemptionQuota))), pdf.Helvetica, 10)
+	for _, paid := range statement.Detail.Payments {
+		doc.Add(fmt.Sprintf("Payments: %d, %s %s", paid.Count, payment.FormatAmount(paid.Amount, paid.Currency), paid.Currency), pdf.Helvetica, 10)
+	}
+	return doc.Bytes()
+}
@@ -22,7 +22,9 @@ func GetAllTokens(c *gin.Context) {
 
 	order := c.Query("order")
 	tokens, err := model.GetAllUserTokens(userId, p*config.ItemsPerPage, config.ItemsPerPage, order)
-
+	if err == nil {
+		err = model.LoadTokenModelQuotas(tokens)
+	}
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -42,6 +44,9 @@ func SearchTokens(c *gin.Context) {
 	userId := c.GetInt(ctxkey.Id)
 	keyword := c.Query("keyword")
 	tokens, err := model.SearchUserTokens(userId, keyword)
+	if err == nil {
+		err = model.LoadTokenModelQuotas(tokens)
+	}
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -68,6 +73,9 @@ func GetToken(c *gin.Context) {
 		return
 	}
 	token, err := model.GetTokenByIds(id, userId)
+	if err == nil {
+		token.ModelQuotas, err = model.GetTokenModelQuotas(token.Id)
+	}
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -117,6 +125,23 @@ func validateToken(c *gin.Context, token model.Token) error {
 			return fmt.Errorf("invalid network segment: %s", err.Error())
 		}
 	}
+	if token.DenySubnet != nil && *token.DenySubnet != "" {
+		err := network.IsValidSubnets(*token.DenySubnet)
+		if err != nil {
+			return fmt.Errorf("invalid denied network segment: %s", err.Error())
+		}
+	}
+	if token.Scopes != nil {
+		if err := model.ValidateTokenScopes(*token.Scopes); err != nil {
+			return err
+		}
+	}
+	if err := model.ValidateTokenModelQuotas(token.ModelQuotas); err != nil {
+		return err
+	}
+	if token.AudioMaxDuration < 0 || token.AudioMaxFileSize < 0 {
+		return fmt.Errorf("audio limits can't be negative")
+	}
 	return nil
 }
 
@@ -138,6 +163,14 @@ func AddToken(c *gin.Context) {
 		})
 		return
 	}
+	err = model.ValidateTokenLifetime(token.ExpiredTime, helper.GetTimestamp())
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 
 	cleanToken := model.Token{
 		UserId:         c.GetInt(ctxkey.Id),
@@ -150,8 +183,19 @@ func AddToken(c *gin.Context) {
 		UnlimitedQuota: token.UnlimitedQuota,
 		Models:         token.Models,
 		Subnet:         token.Subnet,
+		DenySubnet:     token.DenySubnet,
+		Scopes:         token.Scopes,
+
+		AudioMaxDuration: token.AudioMaxDuration,
+		AudioMaxFileSize: token.AudioMaxFileSize,
 	}
 	err = cleanToken.Insert()
+	if err == nil && len(token.ModelQuotas) != 0 {
+		err = model.UpdateTokenModelQuotas(cleanToken.Id, token.ModelQuotas)
+	}
+	if err == nil {
+		cleanToken.ModelQuotas, err = model.GetTokenModelQuotas(cleanToken.Id)
+	}
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -159,6 +203,7 @@ func AddToken(c *gin.Context) {
 		})
 		return
 	}
+	// this is the only time the key is shown, only its hash is stored
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -229,6 +274,16 @@ func UpdateToken(c *gin.Context) {
 			return
 		}
 	}
+	if statusOnly == "" && token.ExpiredTime != cleanToken.ExpiredTime {
+		err = model.ValidateTokenLifetime(token.ExpiredTime, cleanToken.IssuedTime())
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
 	if statusOnly != "" {
 		cleanToken.Status = token.Status
 	} else {
@@ -239,8 +294,19 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.UnlimitedQuota = token.UnlimitedQuota
 		cleanToken.Models = token.Models
 		cleanToken.Subnet = token.Subnet
+		cleanToken.DenySubnet = token.DenySubnet
+		cleanToken.Scopes = token.Scopes
+		cleanToken.AudioMaxDuration = token.AudioMaxDuration
+		cleanToken.AudioMaxFileSize = token.AudioMaxFileSize
 	}
 	err = cleanToken.Update()
+	if err == nil && statusOnly == "" && token.ModelQuotas != nil {
+		// model_quotas is left untouched if it's absent from the request
+		err = model.UpdateTokenModelQuotas(cleanToken.Id, token.ModelQuotas)
+	}
+	if err == nil {
+		cleanToken.ModelQuotas, err = model.GetTokenModelQuotas(cleanToken.Id)
+	}
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -255,3 +321,51 @@ func UpdateToken(c *gin.Context) {
 	})
 	return
 }
+
+// RotateToken issues a new key for the token, the old key stays valid for the grace period
+func RotateToken(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	req := struct {
+		GracePeriod *int64 `json:"grace_period"`
+	}{}
+	if c.Request.ContentLength > 0 {
+		if err = c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+	gracePeriod := int64(config.TokenRotationGracePeriod)
+	if req.GracePeriod != nil {
+		gracePeriod = *req.GracePeriod
+	}
+	token, err := model.GetTokenByIds(id, c.GetInt(ctxkey.Id))
+	if err == nil {
+		_, err = token.Rotate(gracePeriod)
+	}
+	if err == nil {
+		token.ModelQuotas, err = model.GetTokenModelQuotas(token.Id)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	// like on creation, this is the only time the new key is shown
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    token,
+	})
+}
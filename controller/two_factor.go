@@ -0,0 +1,767 @@
+package controller
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/i18n"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/totp"
+	"github.com/songquanpeng/one-api/common/webauthn"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// a pending login expires if the second factor isn't passed in time
+const pendingLoginSeconds = 5 * 60
+
+// a pending login is dropped after this many wrong codes
+const maxPendingLoginFailures = 5
+
+type TwoFactorRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+func startPendingLogin(user *model.User, c *gin.Context, setup bool) {
+	session := sessions.Default(c)
+	session.Clear()
+	session.Set("pending_2fa_id", user.Id)
+	session.Set("pending_2fa_setup", setup)
+	session.Set("pending_2fa_time", helper.GetTimestamp())
+	err := session.Save()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Unable to save session info, please try again!",
+			"success": false,
+		})
+		return
+	}
+	data := gin.H{
+		"require_2fa": !setup,
+		"methods":     user.TwoFactorMethods(),
+	}
+	if setup {
+		data["require_2fa_setup"] = true
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "",
+		"success": true,
+		"data":    data,
+	})
+}
+
+func clearPendingLogin(session sessions.Session) {
+	session.Delete("pending_2fa_id")
+	session.Delete("pending_2fa_setup")
+	session.Delete("pending_2fa_time")
+	session.Delete("pending_2fa_failures")
+	session.Delete("webauthn_challenge")
+	session.Delete("webauthn_challenge_time")
+}
+
+// getPendingLoginUser returns the user who has passed the first factor but not the second one yet
+func getPendingLoginUser(c *gin.Context) *model.User {
+	session := sessions.Default(c)
+	id, _ := session.Get("pending_2fa_id").(int)
+	startTime, _ := session.Get("pending_2fa_time").(int64)
+	if id == 0 || helper.GetTimestamp()-startTime > pendingLoginSeconds {
+		return nil
+	}
+	user, err := model.GetUserById(id, false)
+	if err != nil || user.Status != model.UserStatusEnabled {
+		return nil
+	}
+	return user
+}
+
+func isPendingSetup(c *gin.Context) bool {
+	session := sessions.Default(c)
+	setup, _ := session.Get("pending_2fa_setup").(bool)
+	return session.Get("username") == nil && setup
+}
+
+func verifySecondFactor(user *model.User, req TwoFactorRequest) bool {
+	if req.Code != "" && user.TotpEnabled {
+		return user.VerifyTotp(req.Code)
+	}
+	if req.RecoveryCode != "" {
+		return user.UseRecoveryCode(req.RecoveryCode)
+	}
+	return false
+}
+
+func LoginTwoFactor(c *gin.Context) {
+	user := getPendingLoginUser(c)
+	if user == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Login has expired, please log in again.",
+			"success": false,
+		})
+		return
+	}
+	var req TwoFactorRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": i18n.Translate(c, "invalid_parameter"),
+			"success": false,
+		})
+		return
+	}
+	if req.Code != "" && user.TotpLocked(helper.GetTimestamp()) {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Too many failed attempts, please try again later or use another method.",
+			"success": false,
+		})
+		return
+	}
+	if !verifySecondFactor(user, req) {
+		failLoginTwoFactor(user, c)
+		return
+	}
+	if err = model.ResetTwoFactorFailures(user.Id); err != nil {
+		logger.SysError("failed to reset the second factor failures: " + err.Error())
+	}
+	completeLogin(user, c)
+}
+
+// failLoginTwoFactor counts a wrong code on both the pending login and the user,
+// the pending login is dropped after too many and totp login is locked for a while,
+// so that a code can't be guessed across many logins or addresses
+func failLoginTwoFactor(user *model.User, c *gin.Context) {
+	session := sessions.Default(c)
+	failures, _ := session.Get("pending_2fa_failures").(int)
+	failures++
+	session.Set("pending_2fa_failures", failures)
+	locked, err := model.RecordTwoFactorFailure(user.Id)
+	if err != nil {
+		logger.SysError("failed to record the second factor failure: " + err.Error())
+	}
+	if locked || failures >= maxPendingLoginFailures {
+		clearPendingLogin(session)
+		_ = session.Save()
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Too many failed attempts, please log in again later.",
+			"success": false,
+		})
+		return
+	}
+	_ = session.Save()
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Invalid verification code.",
+		"success": false,
+	})
+}
+
+func GetTwoFactorStatus(c *gin.Context) {
+	user, err := model.GetUserById(c.GetInt(ctxkey.Id), false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	credentials, err := model.GetUserWebAuthnCredentials(user.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"totp_enabled":         user.TotpEnabled,
+			"recovery_codes_left":  user.RecoveryCodesLeft(),
+			"webauthn_credentials": credentials,
+			"required":             config.TwoFactorEnforcementEnabled && user.Role >= model.RoleAdminUser,
+		},
+	})
+}
+
+func SetupTotp(c *gin.Context) {
+	user, err := model.GetUserById(c.GetInt(ctxkey.Id), false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if user.TotpEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "TOTP has already been enabled.",
+		})
+		return
+	}
+	totpSecret, err := totp.GenerateSecret()
+	if err == nil {
+		err = model.SetPendingTotpSecret(user.Id, totpSecret)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"secret": totpSecret,
+			"uri":    totp.URI(config.SystemName, user.Username, totpSecret),
+		},
+	})
+}
+
+// respondSecondFactorEnabled returns new recovery codes if the user has none,
+// and completes the login if the user had to set up a second factor first
+func respondSecondFactorEnabled(user *model.User, c *gin.Context) {
+	data := gin.H{}
+	if user.RecoveryCodes == "" {
+		codes, err := model.GenerateRecoveryCodes(user.Id)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		data["recovery_codes"] = codes
+	}
+	if isPendingSetup(c) {
+		if err := saveLoginSession(user, c); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"message": "Unable to save session info, please try again!",
+				"success": false,
+			})
+			return
+		}
+		data["user"] = cleanLoginUser(user)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    data,
+	})
+}
+
+func EnableTotp(c *gin.Context) {
+	var req TwoFactorRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&req)
+	if err != nil || req.Code == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": i18n.Translate(c, "invalid_parameter"),
+		})
+		return
+	}
+	user, err := model.GetUserById(c.GetInt(ctxkey.Id), false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if user.TotpEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "TOTP has already been enabled.",
+		})
+		return
+	}
+	if !user.VerifyTotp(req.Code) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "Invalid verification code.",
+		})
+		return
+	}
+	err = model.EnableTotp(user.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	user.TotpEnabled = true
+	respondSecondFactorEnabled(user, c)
+}
+
+// canRemoveSecondFactor refuses to remove the last second factor of users for whom it is required
+func canRemoveSecondFactor(user *model.User, removingTotp bool) bool {
+	if !config.TwoFactorEnforcementEnabled || user.Role < model.RoleAdminUser {
+		return true
+	}
+	credentials, err := model.GetUserWebAuthnCredentials(user.Id)
+	if err != nil {
+		return false
+	}
+	remaining := len(credentials)
+	if user.TotpEnabled {
+		remaining++
+	}
+	if !removingTotp {
+		remaining--
+	} else if user.TotpEnabled {
+		remaining--
+	}
+	return remaining > 0
+}
+
+func DisableTotp(c *gin.Context) {
+	var req TwoFactorRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": i18n.Translate(c, "invalid_parameter"),
+		})
+		return
+	}
+	user, err := model.GetUserById(c.GetInt(ctxkey.Id), false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if !user.TotpEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "TOTP is not enabled.",
+		})
+		return
+	}
+	if !canRemoveSecondFactor(user, true) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "Two-factor authentication is required for admins, please add another method first.",
+		})
+		return
+	}
+	if !verifySecondFactor(user, req) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "Invalid verification code.",
+		})
+		return
+	}
+	err = model.DisableTotp(user.Id)
+	if err == nil {
+		err = model.ClearRecoveryCodesIfUnused(user.Id)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var req TwoFactorRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": i18n.Translate(c, "invalid_parameter"),
+		})
+		return
+	}
+	user, err := model.GetUserById(c.GetInt(ctxkey.Id), false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if !user.HasTwoFactor() {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "Two-factor authentication is not enabled.",
+		})
+		return
+	}
+	// users who only have passkeys confirm with an unused recovery code
+	if !verifySecondFactor(user, req) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "Invalid verification code.",
+		})
+		return
+	}
+	codes, err := model.GenerateRecoveryCodes(user.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    codes,
+	})
+}
+
+// getWebAuthnRelyingParty derives the relying party id and origin from the server address
+func getWebAuthnRelyingParty(c *gin.Context) (rpId string, origin string) {
+	if config.ServerAddress != "" {
+		serverURL, err := url.Parse(config.ServerAddress)
+		if err == nil && serverURL.Host != "" {
+			return serverURL.Hostname(), serverURL.Scheme + "://" + serverURL.Host
+		}
+	}
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	host := c.Request.Host
+	rpId = host
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		rpId = hostname
+	}
+	return rpId, scheme + "://" + host
+}
+
+func newWebAuthnChallenge(c *gin.Context) (string, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return "", err
+	}
+	encoded := webauthn.Encoding.EncodeToString(challenge)
+	session := sessions.Default(c)
+	session.Set("webauthn_challenge", encoded)
+	session.Set("webauthn_challenge_time", helper.GetTimestamp())
+	return encoded, session.Save()
+}
+
+// takeWebAuthnChallenge returns the challenge of the session, a challenge can only be used once
+func takeWebAuthnChallenge(c *gin.Context) []byte {
+	session := sessions.Default(c)
+	encoded, _ := session.Get("webauthn_challenge").(string)
+	startTime, _ := session.Get("webauthn_challenge_time").(int64)
+	session.Delete("webauthn_challenge")
+	session.Delete("webauthn_challenge_time")
+	_ = session.Save()
+	if encoded == "" || helper.GetTimestamp()-startTime > pendingLoginSeconds {
+		return nil
+	}
+	challenge, err := webauthn.Encoding.DecodeString(encoded)
+	if err != nil {
+		return nil
+	}
+	return challenge
+}
+
+type webAuthnCredentialResponse struct {
+	Name     string `json:"name"`
+	Id       string `json:"id"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AttestationObject string `json:"attestationObject"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+	} `json:"response"`
+}
+
+func decodeWebAuthnFields(fields ...string) ([][]byte, error) {
+	decoded := make([][]byte, 0, len(fields))
+	for _, field := range fields {
+		data, err := webauthn.Encoding.DecodeString(field)
+		if err != nil {
+			return nil, err
+		}
+		decoded = append(decoded, data)
+	}
+	return decoded, nil
+}
+
+func BeginWebAuthnRegistration(c *gin.Context) {
+	user, err := model.GetUserById(c.GetInt(ctxkey.Id), false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	credentials, err := model.GetUserWebAuthnCredentials(user.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	challenge, err := newWebAuthnChallenge(c)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	excludeCredentials := make([]gin.H, 0, len(credentials))
+	for _, credential := range credentials {
+		excludeCredentials = append(excludeCredentials, gin.H{"type": "public-key", "id": credential.CredentialId})
+	}
+	rpId, _ := getWebAuthnRelyingParty(c)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"challenge": challenge,
+			"rp":        gin.H{"id": rpId, "name": config.SystemName},
+			"user": gin.H{
+				"id":          webauthn.Encoding.EncodeToString([]byte(strconv.Itoa(user.Id))),
+				"name":        user.Username,
+				"displayName": user.DisplayName,
+			},
+			"pubKeyCredParams": []gin.H{
+				{"type": "public-key", "alg": webauthn.AlgES256},
+				{"type": "public-key", "alg": webauthn.AlgRS256},
+			},
+			"timeout":                pendingLoginSeconds * 1000,
+			"attestation":            "none",
+			"excludeCredentials":     excludeCredentials,
+			"authenticatorSelection": gin.H{"residentKey": "preferred", "userVerification": "preferred"},
+		},
+	})
+}
+
+func FinishWebAuthnRegistration(c *gin.Context) {
+	var req webAuthnCredentialResponse
+	err := json.NewDecoder(c.Request.Body).Decode(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": i18n.Translate(c, "invalid_parameter"),
+		})
+		return
+	}
+	if len(req.Name) > 64 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "The name of the passkey is too long.",
+		})
+		return
+	}
+	user, err := model.GetUserById(c.GetInt(ctxkey.Id), false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	challenge := takeWebAuthnChallenge(c)
+	fields, err := decodeWebAuthnFields(req.Response.ClientDataJSON, req.Response.AttestationObject)
+	if challenge == nil || err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": i18n.Translate(c, "invalid_parameter"),
+		})
+		return
+	}
+	rpId, origin := getWebAuthnRelyingParty(c)
+	credential, err := webauthn.VerifyRegistration(rpId, origin, challenge, fields[0], fields[1])
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "Passkey registration failed: " + err.Error(),
+		})
+		return
+	}
+	webAuthnCredential := &model.WebAuthnCredential{
+		UserId:       user.Id,
+		Name:         req.Name,
+		CredentialId: webauthn.Encoding.EncodeToString(credential.ID),
+		PublicKey:    webauthn.Encoding.EncodeToString(credential.PublicKey),
+		SignCount:    credential.SignCount,
+	}
+	err = webAuthnCredential.Insert()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	respondSecondFactorEnabled(user, c)
+}
+
+func DeleteWebAuthnCredential(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	user, err := model.GetUserById(c.GetInt(ctxkey.Id), false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if !canRemoveSecondFactor(user, false) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "Two-factor authentication is required for admins, please add another method first.",
+		})
+		return
+	}
+	err = model.DeleteWebAuthnCredential(id, user.Id)
+	if err == nil {
+		err = model.ClearRecoveryCodesIfUnused(user.Id)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func BeginWebAuthnLogin(c *gin.Context) {
+	user := getPendingLoginUser(c)
+	if user == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Login has expired, please log in again.",
+			"success": false,
+		})
+		return
+	}
+	credentials, err := model.GetUserWebAuthnCredentials(user.Id)
+	if err != nil || len(credentials) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "No passkey has been registered.",
+		})
+		return
+	}
+	challenge, err := newWebAuthnChallenge(c)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	allowCredentials := make([]gin.H, 0, len(credentials))
+	for _, credential := range credentials {
+		allowCredentials = append(allowCredentials, gin.H{"type": "public-key", "id": credential.CredentialId})
+	}
+	rpId, _ := getWebAuthnRelyingParty(c)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"challenge":        challenge,
+			"rpId":             rpId,
+			"allowCredentials": allowCredentials,
+			"timeout":          pendingLoginSeconds * 1000,
+			"userVerification": "preferred",
+		},
+	})
+}
+
+func FinishWebAuthnLogin(c *gin.Context) {
+	user := getPendingLoginUser(c)
+	if user == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Login has expired, please log in again.",
+			"success": false,
+		})
+		return
+	}
+	var req webAuthnCredentialResponse
+	err := json.NewDecoder(c.Request.Body).Decode(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": i18n.Translate(c, "invalid_parameter"),
+		})
+		return
+	}
+	challenge := takeWebAuthnChallenge(c)
+	fields, err := decodeWebAuthnFields(req.Response.ClientDataJSON, req.Response.AuthenticatorData, req.Response.Signature)
+	if challenge == nil || err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": i18n.Translate(c, "invalid_parameter"),
+		})
+		return
+	}
+	webAuthnCredential, err := model.GetWebAuthnCredential(user.Id, req.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "Unknown passkey.",
+		})
+		return
+	}
+	publicKey, err := webauthn.Encoding.DecodeString(webAuthnCredential.PublicKey)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	rpId, origin := getWebAuthnRelyingParty(c)
+	signCount, err := webauthn.VerifyAssertion(rpId, origin, challenge, &webauthn.Credential{
+		PublicKey: publicKey,
+		SignCount: webAuthnCredential.SignCount,
+	}, fields[0], fields[1], fields[2])
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "Passkey verification failed: " + err.Error(),
+		})
+		return
+	}
+	err = model.UpdateWebAuthnCredentialUsage(webAuthnCredential.Id, signCount)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	completeLogin(user, c)
+}
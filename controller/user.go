@@ -14,6 +14,7 @@ import (
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/i18n"
+	"github.com/songquanpeng/one-api/common/network"
 	"github.com/songquanpeng/one-api/common/random"
 	"github.com/songquanpeng/one-api/model"
 )
@@ -64,32 +65,57 @@ func Login(c *gin.Context) {
 	SetupLogin(&user, c)
 }
 
-// setup session & cookies and then return user info
+// setup session & cookies and then return user info,
+// users with a second factor have to pass it before the session is established
 func SetupLogin(user *model.User, c *gin.Context) {
+	if user.HasTwoFactor() {
+		startPendingLogin(user, c, false)
+		return
+	}
+	if config.TwoFactorEnforcementEnabled && user.Role >= model.RoleAdminUser {
+		startPendingLogin(user, c, true)
+		return
+	}
+	completeLogin(user, c)
+}
+
+func saveLoginSession(user *model.User, c *gin.Context) error {
 	session := sessions.Default(c)
+	clearPendingLogin(session)
 	session.Set("id", user.Id)
 	session.Set("username", user.Username)
 	session.Set("role", user.Role)
 	session.Set("status", user.Status)
-	err := session.Save()
-	if err != nil {
-		c.JSON(http.StatusOK, gin.H{
-			"message": "Unable to save session info, please try again!",
-			"success": false,
-		})
-		return
+	if err := session.Save(); err != nil {
+		return err
 	}
-	cleanUser := model.User{
+	model.TouchUserSession(session.ID(), c.ClientIP(), true)
+	return nil
+}
+
+func cleanLoginUser(user *model.User) model.User {
+	return model.User{
 		Id:          user.Id,
 		Username:    user.Username,
 		DisplayName: user.DisplayName,
 		Role:        user.Role,
 		Status:      user.Status,
 	}
+}
+
+func completeLogin(user *model.User, c *gin.Context) {
+	err := saveLoginSession(user, c)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Unable to save session info, please try again!",
+			"success": false,
+		})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"message": "",
 		"success": true,
-		"data":    cleanUser,
+		"data":    cleanLoginUser(user),
 	})
 }
 
@@ -356,6 +382,14 @@ func GetSelf(c *gin.Context) {
 		})
 		return
 	}
+	user.Permissions, err = model.CacheGetUserPermissions(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -408,6 +442,13 @@ func UpdateUser(c *gin.Context) {
 		})
 		return
 	}
+	if err := validateUserSubnets(&updatedUser); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	if updatedUser.Password == "$I_LOVE_U" {
 		updatedUser.Password = "" // rollback to what it should be
 	}
@@ -419,6 +460,9 @@ func UpdateUser(c *gin.Context) {
 		})
 		return
 	}
+	if user, err := model.GetUserById(updatedUser.Id, false); err == nil {
+		recordAudit(c, "user.update", "user", updatedUser.Id, originUser, user)
+	}
 	if originUser.Quota != updatedUser.Quota {
 		model.RecordLog(ctx, originUser.Id, model.LogTypeManage, fmt.Sprintf("Admin changed user's quota from %s to %s", common.LogQuota(originUser.Quota), common.LogQuota(updatedUser.Quota)))
 	}
@@ -509,6 +553,7 @@ func DeleteUser(c *gin.Context) {
 		})
 		return
 	}
+	recordAudit(c, "user.delete", "user", id, originUser, nil)
 }
 
 func DeleteSelf(c *gin.Context) {
@@ -580,6 +625,7 @@ func CreateUser(c *gin.Context) {
 		})
 		return
 	}
+	recordAudit(c, "user.create", "user", cleanUser.Id, nil, &cleanUser)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -625,6 +671,7 @@ func ManageUser(c *gin.Context) {
 		})
 		return
 	}
+	originUser := user
 	switch req.Action {
 	case "disable":
 		user.Status = model.UserStatusDisabled
@@ -668,6 +715,14 @@ func ManageUser(c *gin.Context) {
 			return
 		}
 		user.Role = model.RoleAdminUser
+	case "reset_2fa":
+		if err := model.ResetTwoFactor(user.Id); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 	case "demote":
 		if user.Role == model.RoleRootUser {
 			c.JSON(http.StatusOK, gin.H{
@@ -693,6 +748,7 @@ func ManageUser(c *gin.Context) {
 		})
 		return
 	}
+	recordAudit(c, "user."+req.Action, "user", user.Id, &originUser, &user)
 	clearUser := model.User{
 		Role:   user.Role,
 		Status: user.Status,
@@ -817,9 +873,24 @@ func AdminTopUp(c *gin.Context) {
 		req.Remark = fmt.Sprintf("Recharge %s via API", common.LogQuota(int64(req.Quota)))
 	}
 	model.RecordTopupLog(ctx, req.UserId, req.Remark, req.Quota)
+	recordAudit(c, "user.topup", "user", req.UserId, nil, req)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
 	})
 	return
 }
+
+func validateUserSubnets(user *model.User) error {
+	if user.Subnet != nil && *user.Subnet != "" {
+		if err := network.IsValidSubnets(*user.Subnet); err != nil {
+			return fmt.Errorf("invalid network segment: %s", err.Error())
+		}
+	}
+	if user.DenySubnet != nil && *user.DenySubnet != "" {
+		if err := network.IsValidSubnets(*user.DenySubnet); err != nil {
+			return fmt.Errorf("invalid denied network segment: %s", err.Error())
+		}
+	}
+	return nil
+}
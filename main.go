@@ -7,7 +7,6 @@ import (
 	"strconv"
 
 	"github.com/gin-contrib/sessions"
-	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
 	_ "github.com/joho/godotenv/autoload"
 
@@ -16,6 +15,8 @@ import (
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/i18n"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/network"
+	"github.com/songquanpeng/one-api/common/secret"
 	"github.com/songquanpeng/one-api/controller"
 	"github.com/songquanpeng/one-api/middleware"
 	"github.com/songquanpeng/one-api/model"
@@ -38,10 +39,26 @@ func main() {
 		logger.SysLog("running in debug mode")
 	}
 
+	// Initialize secret encryption
+	if err := secret.Init(); err != nil {
+		logger.FatalLog("failed to initialize secret encryption: " + err.Error())
+	}
+	if secret.Enabled() {
+		logger.SysLog("secret encryption enabled")
+	}
+
 	// Initialize SQL Database
 	model.InitDB()
 	model.InitLogDB()
 
+	if *common.EncryptSecrets {
+		if err := model.EncryptSecrets(); err != nil {
+			logger.FatalLog("failed to encrypt secrets: " + err.Error())
+		}
+		_ = model.CloseDB()
+		return
+	}
+
 	var err error
 	err = model.CreateRootAccountIfNeed()
 	if err != nil {
@@ -76,6 +93,14 @@ func main() {
 		go model.SyncOptions(config.SyncFrequency)
 		go model.SyncChannelCache(config.SyncFrequency)
 	}
+	model.InitBlacklist()
+	go model.SyncBlacklist(config.SyncFrequency)
+	if config.IsMasterNode {
+		go model.CleanExpiredUserSessions(3600)
+		go model.AutomaticallyCheckTokenExpiry(3600)
+		go model.AutomaticallyGenerateStatements(3600)
+		go model.AutomaticallySyncPricingCatalog(3600)
+	}
 	if os.Getenv("CHANNEL_TEST_FREQUENCY") != "" {
 		frequency, err := strconv.Atoi(os.Getenv("CHANNEL_TEST_FREQUENCY"))
 		if err != nil {
@@ -83,6 +108,13 @@ func main() {
 		}
 		go controller.AutomaticallyTestChannels(frequency)
 	}
+	if os.Getenv("CHANNEL_UPDATE_FREQUENCY") != "" {
+		frequency, err := strconv.Atoi(os.Getenv("CHANNEL_UPDATE_FREQUENCY"))
+		if err != nil {
+			logger.FatalLog("failed to parse CHANNEL_UPDATE_FREQUENCY: " + err.Error())
+		}
+		go controller.AutomaticallyUpdateChannels(frequency)
+	}
 	if os.Getenv("BATCH_UPDATE_ENABLED") == "true" {
 		config.BatchUpdateEnabled = true
 		logger.SysLog("batch update enabled with interval " + strconv.Itoa(config.BatchUpdateInterval) + "s")
@@ -101,6 +133,17 @@ func main() {
 
 	// Initialize HTTP server
 	server := gin.New()
+	if config.TrustedProxies != "" {
+		trustedProxies, err := network.ParseTrustedProxies(config.TrustedProxies)
+		if err != nil {
+			logger.FatalLog("failed to parse TRUSTED_PROXIES: " + err.Error())
+		}
+		err = server.SetTrustedProxies(trustedProxies)
+		if err != nil {
+			logger.FatalLog("failed to set trusted proxies: " + err.Error())
+		}
+		logger.SysLogf("only trusting forwarded headers from %s", config.TrustedProxies)
+	}
 	server.Use(gin.Recovery())
 	// This will cause SSE not to work!!!
 	//server.Use(gzip.Gzip(gzip.DefaultCompression))
@@ -108,7 +151,7 @@ func main() {
 	server.Use(middleware.Language())
 	middleware.SetUpLogger(server)
 	// Initialize session store
-	store := cookie.NewStore([]byte(config.SessionSecret))
+	store := middleware.NewSessionStore(config.SessionSecret)
 	server.Use(sessions.Sessions("session", store))
 
 	router.SetRouter(server, buildFS)
@@ -6,13 +6,15 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common/blacklist"
 	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/network"
 	"github.com/songquanpeng/one-api/model"
 	"net/http"
 	"strings"
 )
 
-func authHelper(c *gin.Context, minRole int) {
+// authenticate identifies the user by session or access token, it aborts the request if not allowed
+func authenticate(c *gin.Context) bool {
 	session := sessions.Default(c)
 	username := session.Get("username")
 	role := session.Get("role")
@@ -27,7 +29,7 @@ func authHelper(c *gin.Context, minRole int) {
 				"message": "Unauthorized operation. You're not logged in and no access token was provided.",
 			})
 			c.Abort()
-			return
+			return false
 		}
 		user := model.ValidateAccessToken(accessToken)
 		if user != nil && user.Username != "" {
@@ -42,7 +44,7 @@ func authHelper(c *gin.Context, minRole int) {
 				"message": "You're not authorized to do this. Invalid access token.",
 			})
 			c.Abort()
-			return
+			return false
 		}
 	}
 	if status.(int) == model.UserStatusDisabled || blacklist.IsUserBanned(id.(int)) {
@@ -54,9 +56,25 @@ func authHelper(c *gin.Context, minRole int) {
 		session.Clear()
 		_ = session.Save()
 		c.Abort()
+		return false
+	}
+	if !isUserIpAllowed(c, id.(int)) {
+		return false
+	}
+	if session.ID() != "" {
+		model.TouchUserSession(session.ID(), c.ClientIP(), false)
+	}
+	c.Set("username", username)
+	c.Set("role", role)
+	c.Set("id", id)
+	return true
+}
+
+func authHelper(c *gin.Context, minRole int) {
+	if !authenticate(c) {
 		return
 	}
-	if role.(int) < minRole {
+	if c.GetInt(ctxkey.Role) < minRole {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "Oops! Looks like you don't have permission to do that.",
@@ -64,12 +82,57 @@ func authHelper(c *gin.Context, minRole int) {
 		c.Abort()
 		return
 	}
-	c.Set("username", username)
-	c.Set("role", role)
-	c.Set("id", id)
 	c.Next()
 }
 
+func permissionAuthHelper(c *gin.Context, permissions []string) {
+	if !authenticate(c) {
+		return
+	}
+	userPermissions, err := model.CacheGetUserPermissions(c.GetInt(ctxkey.Id))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		c.Abort()
+		return
+	}
+	for _, permission := range permissions {
+		if model.HasPermission(userPermissions, permission) {
+			c.Next()
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": false,
+		"message": fmt.Sprintf("Oops! Looks like you don't have the permission %s to do that.", strings.Join(permissions, " or ")),
+	})
+	c.Abort()
+}
+
+// isUserIpAllowed checks the subnet restrictions of the user for dashboard access, it aborts the request if not allowed
+func isUserIpAllowed(c *gin.Context, userId int) bool {
+	subnets, err := model.CacheGetUserSubnets(userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		c.Abort()
+		return false
+	}
+	if !network.IsIpAllowed(c.Request.Context(), c.ClientIP(), subnets.Subnet, subnets.DenySubnet) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("You're not allowed to access from the current IP: %s", c.ClientIP()),
+		})
+		c.Abort()
+		return false
+	}
+	return true
+}
+
 func UserAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		authHelper(c, model.RoleCommonUser)
@@ -88,6 +151,32 @@ func RootAuth() func(c *gin.Context) {
 	}
 }
 
+// PermissionAuth lets in users whose role or custom role grants any of the permissions
+func PermissionAuth(permissions ...string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		permissionAuthHelper(c, permissions)
+	}
+}
+
+// TwoFactorSetupAuth also lets in users who have passed their password but must set up a second factor before logging in
+func TwoFactorSetupAuth() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		session := sessions.Default(c)
+		id, _ := session.Get("pending_2fa_id").(int)
+		setup, _ := session.Get("pending_2fa_setup").(bool)
+		startTime, _ := session.Get("pending_2fa_time").(int64)
+		if session.Get("username") == nil && id != 0 && setup && helper.GetTimestamp()-startTime <= 5*60 {
+			if !isUserIpAllowed(c, id) {
+				return
+			}
+			c.Set(ctxkey.Id, id)
+			c.Next()
+			return
+		}
+		authHelper(c, model.RoleCommonUser)
+	}
+}
+
 func TokenAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
@@ -107,6 +196,12 @@ func TokenAuth() func(c *gin.Context) {
 				return
 			}
 		}
+		if token.DenySubnet != nil && *token.DenySubnet != "" {
+			if network.IsIpInSubnets(ctx, c.ClientIP(), *token.DenySubnet) {
+				abortWithMessage(c, http.StatusForbidden, fmt.Sprintf("This token can't be used from the current IP: %s", c.ClientIP()))
+				return
+			}
+		}
 		userEnabled, err := model.CacheIsUserEnabled(token.UserId)
 		if err != nil {
 			abortWithMessage(c, http.StatusInternalServerError, err.Error())
@@ -116,6 +211,19 @@ func TokenAuth() func(c *gin.Context) {
 			abortWithMessage(c, http.StatusForbidden, "User has been banned.")
 			return
 		}
+		subnets, err := model.CacheGetUserSubnets(token.UserId)
+		if err != nil {
+			abortWithMessage(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !network.IsIpAllowed(ctx, c.ClientIP(), subnets.Subnet, subnets.DenySubnet) {
+			abortWithMessage(c, http.StatusForbidden, fmt.Sprintf("The user is not allowed to access from the current IP: %s", c.ClientIP()))
+			return
+		}
+		if scope := getRequestScope(c); !model.IsScopeInTokenScopes(scope, token.GetScopes()) {
+			abortWithMessage(c, http.StatusForbidden, fmt.Sprintf("This token doesn't have permission to access this endpoint: %s", c.Request.URL.Path))
+			return
+		}
 		requestModel, err := getRequestModel(c)
 		if err != nil && shouldCheckModel(c) {
 			abortWithMessage(c, http.StatusBadRequest, err.Error())
@@ -124,14 +232,20 @@ func TokenAuth() func(c *gin.Context) {
 		c.Set(ctxkey.RequestModel, requestModel)
 		if token.Models != nil && *token.Models != "" {
 			c.Set(ctxkey.AvailableModels, *token.Models)
-			if requestModel != "" && !isModelInList(requestModel, *token.Models) {
+			if requestModel != "" && !model.IsModelInTokenModels(requestModel, *token.Models) {
 				abortWithMessage(c, http.StatusForbidden, fmt.Sprintf("This token doesn't have permission to use model: %s", requestModel))
 				return
 			}
 		}
+		// the model quota cap is enforced when the quota is pre-consumed
+		if modelQuotaId := token.GetModelQuotaId(requestModel); modelQuotaId != 0 {
+			c.Set(ctxkey.TokenModelQuotaId, modelQuotaId)
+		}
 		c.Set(ctxkey.Id, token.UserId)
 		c.Set(ctxkey.TokenId, token.Id)
 		c.Set(ctxkey.TokenName, token.Name)
+		c.Set(ctxkey.AudioMaxDuration, token.AudioMaxDuration)
+		c.Set(ctxkey.AudioMaxFileSize, token.AudioMaxFileSize)
 		if len(parts) > 1 {
 			if model.IsAdmin(token.UserId) {
 				c.Set(ctxkey.SpecificChannelId, parts[1])
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// setupTestDB migrates a fresh sqlite database in a temporary directory
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	t.Setenv("SQL_DSN", "")
+	t.Setenv("LOG_SQL_DSN", "")
+	sqlitePath, redisEnabled := common.SQLitePath, common.RedisEnabled
+	common.SQLitePath = filepath.Join(t.TempDir(), "one-api.db")
+	common.RedisEnabled = false
+	model.InitDB()
+	model.InitLogDB()
+	gin.SetMode(gin.TestMode)
+	t.Cleanup(func() {
+		_ = model.CloseDB()
+		common.SQLitePath, common.RedisEnabled = sqlitePath, redisEnabled
+	})
+}
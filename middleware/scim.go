@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+// ScimAuth checks the bearer token of the identity provider, SCIM is disabled while no token is configured
+func ScimAuth() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
+		if config.SCIMToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(config.SCIMToken)) != 1 {
+			c.Header("Content-Type", "application/scim+json")
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"schemas": []string{"urn:ietf:params:scim:api:messages:2.0:Error"},
+				"status":  "401",
+				"detail":  "Invalid SCIM token.",
+			})
+			c.Abort()
+			return
+		}
+		// audit logs of provisioning changes are attributed to the identity provider
+		c.Set("username", "scim")
+		c.Next()
+	}
+}
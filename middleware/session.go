@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"net/http"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gorilla/securecookie"
+	gsessions "github.com/gorilla/sessions"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/model"
+)
+
+const sessionMaxAge = 86400 * 30
+
+// sessions which aren't logged in only carry oauth states and pending second factors
+const preLoginSessionMaxAge = 10 * 60
+
+// sessionStore keeps sessions in the database so that they can be listed and revoked,
+// the cookie only carries a signed random token
+type sessionStore struct {
+	codecs  []securecookie.Codec
+	options *gsessions.Options
+}
+
+func NewSessionStore(secret string) sessions.Store {
+	return &sessionStore{
+		codecs: securecookie.CodecsFromPairs([]byte(secret)),
+		options: &gsessions.Options{
+			Path:     "/",
+			MaxAge:   sessionMaxAge,
+			HttpOnly: true,
+		},
+	}
+}
+
+func (s *sessionStore) Options(options sessions.Options) {
+	s.options = options.ToGorillaOptions()
+}
+
+func (s *sessionStore) Get(r *http.Request, name string) (*gsessions.Session, error) {
+	return gsessions.GetRegistry(r).Get(s, name)
+}
+
+// New loads the session of the request, a new one is started if the cookie is missing, invalid or revoked
+func (s *sessionStore) New(r *http.Request, name string) (*gsessions.Session, error) {
+	session := gsessions.NewSession(s, name)
+	options := *s.options
+	session.Options = &options
+	session.IsNew = true
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	var token string
+	if err := securecookie.DecodeMulti(name, cookie.Value, &token, s.codecs...); err != nil {
+		return session, nil
+	}
+	userSession, err := model.GetUserSession(token)
+	if err != nil {
+		return session, nil
+	}
+	values, err := decodeSessionValues(userSession.Data)
+	if err != nil {
+		return session, nil
+	}
+	session.ID = token
+	session.Values = values
+	session.IsNew = false
+	return session, nil
+}
+
+// Save stores the session, sessions without values are deleted
+func (s *sessionStore) Save(r *http.Request, w http.ResponseWriter, session *gsessions.Session) error {
+	if session.Options.MaxAge < 0 || len(session.Values) == 0 {
+		if session.ID != "" {
+			if err := model.DeleteUserSession(session.ID); err != nil {
+				return err
+			}
+		}
+		options := *session.Options
+		options.MaxAge = -1
+		http.SetCookie(w, gsessions.NewCookie(session.Name(), "", &options))
+		return nil
+	}
+	userId := 0
+	if session.Values["username"] != nil {
+		userId, _ = session.Values["id"].(int)
+	}
+	if session.ID != "" && userId != 0 {
+		// a login gets a fresh token, a token planted in the browser before can't be used afterwards
+		if stored, err := model.GetUserSession(session.ID); err != nil || stored.UserId != userId {
+			if err := model.DeleteUserSession(session.ID); err != nil {
+				return err
+			}
+			session.ID = ""
+		}
+	}
+	if session.ID == "" {
+		session.ID = base64.RawURLEncoding.EncodeToString(securecookie.GenerateRandomKey(32))
+	}
+	options := *session.Options
+	if userId == 0 && options.MaxAge > preLoginSessionMaxAge {
+		options.MaxAge = preLoginSessionMaxAge
+	}
+	data, err := encodeSessionValues(session.Values)
+	if err != nil {
+		return err
+	}
+	userSession := &model.UserSession{
+		UserId:      userId,
+		Data:        data,
+		UserAgent:   r.UserAgent(),
+		ExpiresTime: helper.GetTimestamp() + int64(options.MaxAge),
+	}
+	if err := model.SaveUserSession(session.ID, userSession); err != nil {
+		return err
+	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, gsessions.NewCookie(session.Name(), encoded, &options))
+	return nil
+}
+
+func encodeSessionValues(values map[any]any) (string, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(values); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func decodeSessionValues(data string) (map[any]any, error) {
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[any]any)
+	err = gob.NewDecoder(bytes.NewReader(raw)).Decode(&values)
+	return values, err
+}
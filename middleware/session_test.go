@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/blacklist"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func newSessionServer(t *testing.T) *gin.Engine {
+	setupTestDB(t)
+	server := gin.New()
+	server.Use(sessions.Sessions("session", NewSessionStore("secret")))
+	server.GET("/state", func(c *gin.Context) {
+		session := sessions.Default(c)
+		session.Set("oauth_state", "state")
+		require.NoError(t, session.Save())
+	})
+	server.GET("/login", func(c *gin.Context) {
+		session := sessions.Default(c)
+		session.Set("id", 1)
+		session.Set("username", "alice")
+		require.NoError(t, session.Save())
+	})
+	server.GET("/self", func(c *gin.Context) {
+		session := sessions.Default(c)
+		c.JSON(http.StatusOK, gin.H{"username": session.Get("username"), "oauth_state": session.Get("oauth_state")})
+	})
+	server.GET("/logout", func(c *gin.Context) {
+		session := sessions.Default(c)
+		session.Clear()
+		require.NoError(t, session.Save())
+	})
+	return server
+}
+
+func doSessionRequest(server *gin.Engine, path string, cookie *http.Cookie) (*httptest.ResponseRecorder, *http.Cookie) {
+	req := httptest.NewRequest("GET", path, nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "session" {
+			return w, c
+		}
+	}
+	return w, nil
+}
+
+func countUserSessions(t *testing.T) int64 {
+	var count int64
+	require.NoError(t, model.DB.Model(&model.UserSession{}).Count(&count).Error)
+	return count
+}
+
+func TestSessionStore(t *testing.T) {
+	server := newSessionServer(t)
+
+	// a session which isn't logged in is short-lived
+	_, preLogin := doSessionRequest(server, "/state", nil)
+	require.NotNil(t, preLogin)
+	assert.Equal(t, preLoginSessionMaxAge, preLogin.MaxAge)
+	w, _ := doSessionRequest(server, "/self", preLogin)
+	assert.JSONEq(t, `{"username": null, "oauth_state": "state"}`, w.Body.String())
+	var stored model.UserSession
+	require.NoError(t, model.DB.First(&stored).Error)
+	assert.LessOrEqual(t, stored.ExpiresTime, helper.GetTimestamp()+preLoginSessionMaxAge)
+
+	// logging in issues a new token, the one known before the login is dropped
+	_, loggedIn := doSessionRequest(server, "/login", preLogin)
+	require.NotNil(t, loggedIn)
+	assert.NotEqual(t, preLogin.Value, loggedIn.Value)
+	assert.Equal(t, sessionMaxAge, loggedIn.MaxAge)
+	assert.Equal(t, int64(1), countUserSessions(t))
+	w, _ = doSessionRequest(server, "/self", preLogin)
+	assert.JSONEq(t, `{"username": null, "oauth_state": null}`, w.Body.String())
+	w, _ = doSessionRequest(server, "/self", loggedIn)
+	assert.JSONEq(t, `{"username": "alice", "oauth_state": "state"}`, w.Body.String())
+
+	// the token stays the same while the session is logged in
+	_, again := doSessionRequest(server, "/login", loggedIn)
+	assert.Equal(t, loggedIn.Value, again.Value)
+	sessions, err := model.GetUserSessions(1)
+	require.NoError(t, err)
+	assert.Len(t, sessions, 1)
+
+	_, cleared := doSessionRequest(server, "/logout", loggedIn)
+	require.NotNil(t, cleared)
+	assert.Less(t, cleared.MaxAge, 0)
+	assert.Equal(t, int64(0), countUserSessions(t))
+	w, _ = doSessionRequest(server, "/self", loggedIn)
+	assert.JSONEq(t, `{"username": null, "oauth_state": null}`, w.Body.String())
+}
+
+func TestSessionRevocation(t *testing.T) {
+	server := newSessionServer(t)
+	_, first := doSessionRequest(server, "/login", nil)
+	_, second := doSessionRequest(server, "/login", nil)
+	sessions, err := model.GetUserSessions(1)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+
+	// revoke every session but the one of the second cookie
+	token, err := decodeSessionToken(second)
+	require.NoError(t, err)
+	revoked, err := model.RevokeUserSessions(1, model.HashSessionToken(token))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), revoked)
+	w, _ := doSessionRequest(server, "/self", first)
+	assert.JSONEq(t, `{"username": null, "oauth_state": null}`, w.Body.String())
+	w, _ = doSessionRequest(server, "/self", second)
+	assert.JSONEq(t, `{"username": "alice", "oauth_state": null}`, w.Body.String())
+
+	// a tampered cookie is a new session
+	tampered := *second
+	tampered.Value = second.Value[:len(second.Value)-2] + "xx"
+	w, _ = doSessionRequest(server, "/self", &tampered)
+	assert.JSONEq(t, `{"username": null, "oauth_state": null}`, w.Body.String())
+}
+
+func decodeSessionToken(cookie *http.Cookie) (string, error) {
+	store := NewSessionStore("secret").(*sessionStore)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookie)
+	session, err := store.New(req, "session")
+	if err != nil {
+		return "", err
+	}
+	return session.ID, nil
+}
+
+func TestPersistentBanList(t *testing.T) {
+	server := newSessionServer(t)
+	model.InitBlacklist()
+	t.Cleanup(func() {
+		blacklist.UnbanUser(1)
+		blacklist.SetStore(nil)
+	})
+	_, loggedIn := doSessionRequest(server, "/login", nil)
+
+	// banning logs the user out everywhere
+	blacklist.BanUser(1)
+	assert.True(t, blacklist.IsUserBanned(1))
+	w, _ := doSessionRequest(server, "/self", loggedIn)
+	assert.JSONEq(t, `{"username": null, "oauth_state": null}`, w.Body.String())
+
+	// the ban survives a restart, and unbans of other nodes are picked up
+	var banned []int
+	require.NoError(t, model.DB.Model(&model.BannedUser{}).Pluck("user_id", &banned).Error)
+	assert.Equal(t, []int{1}, banned)
+	require.NoError(t, blacklist.Load())
+	assert.True(t, blacklist.IsUserBanned(1))
+	require.NoError(t, model.DB.Where("user_id = ?", 1).Delete(&model.BannedUser{}).Error)
+	require.NoError(t, blacklist.Load())
+	assert.False(t, blacklist.IsUserBanned(1))
+}
@@ -6,6 +6,8 @@ import (
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
 	"strings"
 )
 
@@ -36,7 +38,7 @@ func getRequestModel(c *gin.Context) (string, error) {
 			modelRequest.Model = c.Param("model")
 		}
 	}
-	if strings.HasPrefix(c.Request.URL.Path, "/v1/images/generations") {
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/images/") {
 		if modelRequest.Model == "" {
 			modelRequest.Model = "dall-e-2"
 		}
@@ -49,12 +51,30 @@ func getRequestModel(c *gin.Context) (string, error) {
 	return modelRequest.Model, nil
 }
 
-func isModelInList(modelName string, models string) bool {
-	modelList := strings.Split(models, ",")
-	for _, model := range modelList {
-		if modelName == model {
-			return true
-		}
+// getRequestScope returns the token scope required by the request path, empty means the path requires an unrestricted token
+func getRequestScope(c *gin.Context) string {
+	path := c.Request.URL.Path
+	switch relaymode.GetByPath(path) {
+	case relaymode.ChatCompletions, relaymode.Completions, relaymode.Edits:
+		return model.TokenScopeChat
+	case relaymode.Embeddings:
+		return model.TokenScopeEmbeddings
+	case relaymode.Moderations:
+		return model.TokenScopeModerations
+	case relaymode.ImagesGenerations, relaymode.ImagesEdits, relaymode.ImagesVariations:
+		return model.TokenScopeImages
+	case relaymode.AudioSpeech, relaymode.AudioTranscription, relaymode.AudioTranslation:
+		return model.TokenScopeAudio
+	case relaymode.Proxy:
+		return model.TokenScopeProxy
+	}
+	switch {
+	case strings.HasPrefix(path, "/v1/images/"):
+		return model.TokenScopeImages
+	case strings.HasPrefix(path, "/v1/models") && c.Request.Method == "GET":
+		return model.TokenScopeModels
+	case strings.HasPrefix(path, "/dashboard/billing"), strings.HasPrefix(path, "/v1/dashboard/billing"):
+		return model.TokenScopeBilling
 	}
-	return false
+	return ""
 }
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/model"
+)
+
+func TestGetRequestScope(t *testing.T) {
+	cases := []struct {
+		method  string
+		path    string
+		scope   string
+		scopes  string
+		allowed bool
+	}{
+		{"POST", "/v1/chat/completions", model.TokenScopeChat, "", true},
+		{"POST", "/v1/chat/completions", model.TokenScopeChat, "chat", true},
+		{"POST", "/v1/completions", model.TokenScopeChat, "embeddings", false},
+		{"POST", "/v1/edits", model.TokenScopeChat, "chat,images", true},
+		{"POST", "/v1/embeddings", model.TokenScopeEmbeddings, "chat", false},
+		{"POST", "/v1/engines/text-embedding-ada-002/embeddings", model.TokenScopeEmbeddings, "embeddings", true},
+		{"POST", "/v1/moderations", model.TokenScopeModerations, "moderations", true},
+		{"POST", "/v1/images/generations", model.TokenScopeImages, "images", true},
+		{"POST", "/v1/images/edits", model.TokenScopeImages, "chat", false},
+		{"POST", "/v1/images/variations", model.TokenScopeImages, "images", true},
+		{"POST", "/v1/audio/speech", model.TokenScopeAudio, "audio", true},
+		{"POST", "/v1/audio/transcriptions", model.TokenScopeAudio, "chat", false},
+		{"POST", "/v1/audio/translations", model.TokenScopeAudio, " audio , chat ", true},
+		{"GET", "/v1/oneapi/proxy/1/files", model.TokenScopeProxy, "proxy", true},
+		{"GET", "/v1/models", model.TokenScopeModels, "models", true},
+		{"GET", "/v1/models/gpt-4o", model.TokenScopeModels, "chat", false},
+		{"GET", "/dashboard/billing/usage", model.TokenScopeBilling, "billing", true},
+		{"GET", "/v1/dashboard/billing/subscription", model.TokenScopeBilling, "chat", false},
+		// endpoints without a scope need an unrestricted token
+		{"POST", "/v1/files", "", "chat,embeddings,moderations,images,audio,proxy,models,billing", false},
+		{"POST", "/v1/files", "", "", true},
+		{"DELETE", "/v1/models/gpt-4o", "", "models", false},
+	}
+	for _, tc := range cases {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(tc.method, tc.path, nil)
+		scope := getRequestScope(c)
+		assert.Equal(t, tc.scope, scope, "%s %s", tc.method, tc.path)
+		assert.Equal(t, tc.allowed, model.IsScopeInTokenScopes(scope, tc.scopes), "%s %s with scopes %q", tc.method, tc.path, tc.scopes)
+	}
+}
@@ -20,6 +20,11 @@ type Ability struct {
 }
 
 func GetRandomSatisfiedChannel(group string, model string, ignoreFirstPriority bool) (*Channel, error) {
+	return getRandomSatisfiedChannel(group, model, ignoreFirstPriority, nil)
+}
+
+// getRandomSatisfiedChannel picks among the channels of the given types, or among all channels if no type is given
+func getRandomSatisfiedChannel(group string, model string, ignoreFirstPriority bool, channelTypes []int) (*Channel, error) {
 	ability := Ability{}
 	groupCol := "`group`"
 	trueVal := "1"
@@ -34,8 +39,14 @@ func GetRandomSatisfiedChannel(group string, model string, ignoreFirstPriority b
 		channelQuery = DB.Where(groupCol+" = ? and model = ? and enabled = "+trueVal, group, model)
 	} else {
 		maxPrioritySubQuery := DB.Model(&Ability{}).Select("MAX(priority)").Where(groupCol+" = ? and model = ? and enabled = "+trueVal, group, model)
+		if len(channelTypes) > 0 {
+			maxPrioritySubQuery = maxPrioritySubQuery.Where("channel_id IN (?)", DB.Model(&Channel{}).Select("id").Where("type IN ?", channelTypes))
+		}
 		channelQuery = DB.Where(groupCol+" = ? and model = ? and enabled = "+trueVal+" and priority = (?)", group, model, maxPrioritySubQuery)
 	}
+	if len(channelTypes) > 0 {
+		channelQuery = channelQuery.Where("channel_id IN (?)", DB.Model(&Channel{}).Select("id").Where("type IN ?", channelTypes))
+	}
 	if common.UsingSQLite || common.UsingPostgreSQL {
 		err = channelQuery.Order("RANDOM()").First(&ability).Error
 	} else {
@@ -47,6 +58,10 @@ func GetRandomSatisfiedChannel(group string, model string, ignoreFirstPriority b
 	channel := Channel{}
 	channel.Id = ability.ChannelId
 	err = DB.First(&channel, "id = ?", ability.ChannelId).Error
+	if err != nil {
+		return &channel, err
+	}
+	err = channel.openSecrets()
 	return &channel, err
 }
 
@@ -0,0 +1,39 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestCacheGetRandomSatisfiedChannelOfTypes(t *testing.T) {
+	setupTestDB(t)
+	usingSQLite, memoryCacheEnabled := common.UsingSQLite, config.MemoryCacheEnabled
+	common.UsingSQLite = true
+	t.Cleanup(func() { common.UsingSQLite, config.MemoryCacheEnabled = usingSQLite, memoryCacheEnabled })
+
+	high, low := int64(10), int64(0)
+	// the channel of the other type has the higher priority, it must not win
+	other := &Channel{Type: 3, Name: "azure", Key: "key", Status: ChannelStatusEnabled, Models: "omni-moderation-latest", Group: "default", Priority: &high}
+	require.NoError(t, other.Insert())
+	openai := &Channel{Type: 1, Name: "openai", Key: "key", Status: ChannelStatusEnabled, Models: "omni-moderation-latest", Group: "default", Priority: &low}
+	require.NoError(t, openai.Insert())
+
+	for _, memoryCache := range []bool{false, true} {
+		config.MemoryCacheEnabled = memoryCache
+		if memoryCache {
+			InitChannelCache()
+		}
+		for i := 0; i < 5; i++ {
+			channel, err := CacheGetRandomSatisfiedChannelOfTypes("default", "omni-moderation-latest", []int{1})
+			require.NoError(t, err)
+			assert.Equal(t, openai.Id, channel.Id)
+		}
+		_, err := CacheGetRandomSatisfiedChannelOfTypes("default", "omni-moderation-latest", []int{8})
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,150 @@
+package model
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// AuditLog is a structured record of a configuration or management action done by an admin
+type AuditLog struct {
+	Id         int    `json:"id"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+	UserId     int    `json:"user_id" gorm:"index"` // the actor
+	Username   string `json:"username" gorm:"default:''"`
+	Action     string `json:"action" gorm:"type:varchar(64);index"`
+	TargetType string `json:"target_type" gorm:"type:varchar(32);index:idx_audit_target"`
+	TargetId   string `json:"target_id" gorm:"type:varchar(64);index:idx_audit_target"`
+	Diff       string `json:"diff" gorm:"type:text"` // json object of field -> {before, after}
+	Ip         string `json:"ip" gorm:"type:varchar(64);default:''"`
+	RequestId  string `json:"request_id" gorm:"type:varchar(64);default:''"`
+}
+
+type AuditChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+type AuditLogFilter struct {
+	UserId         int
+	Action         string
+	TargetType     string
+	TargetId       string
+	StartTimestamp int64
+	EndTimestamp   int64
+}
+
+// fields which are never written to the audit log in clear text
+var auditSecretFields = map[string]bool{
+	"key":            true,
+	"password":       true,
+	"access_token":   true,
+	"totp_secret":    true,
+	"recovery_codes": true,
+}
+
+func isAuditSecretField(field string) bool {
+	return auditSecretFields[field] || isSecretOption(field)
+}
+
+// maskAuditValue replaces a secret with a short fingerprint, so that changes are visible without leaking the value
+func maskAuditValue(value any) any {
+	s, ok := value.(string)
+	if !ok || s == "" {
+		return value
+	}
+	sum := sha256.Sum256([]byte(s))
+	return "****(sha256:" + hex.EncodeToString(sum[:4]) + ")"
+}
+
+func toAuditMap(v any) map[string]any {
+	res := make(map[string]any)
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return res
+	}
+	jsonBytes, err := json.Marshal(v)
+	if err != nil {
+		return res
+	}
+	_ = json.Unmarshal(jsonBytes, &res)
+	return res
+}
+
+// AuditDiff returns the changed fields between two states of an entity, either state can be nil
+func AuditDiff(before any, after any) map[string]AuditChange {
+	beforeMap := toAuditMap(before)
+	afterMap := toAuditMap(after)
+	diff := make(map[string]AuditChange)
+	for field, beforeValue := range beforeMap {
+		afterValue := afterMap[field]
+		if reflect.DeepEqual(beforeValue, afterValue) {
+			continue
+		}
+		diff[field] = AuditChange{Before: beforeValue, After: afterValue}
+	}
+	for field, afterValue := range afterMap {
+		if _, ok := beforeMap[field]; !ok && afterValue != nil {
+			diff[field] = AuditChange{Before: nil, After: afterValue}
+		}
+	}
+	for field, change := range diff {
+		if isAuditSecretField(field) {
+			diff[field] = AuditChange{Before: maskAuditValue(change.Before), After: maskAuditValue(change.After)}
+		} else if field == "config" {
+			diff[field] = AuditChange{Before: maskAuditConfig(change.Before), After: maskAuditConfig(change.After)}
+		}
+	}
+	return diff
+}
+
+func maskAuditConfig(value any) any {
+	config, ok := value.(string)
+	if !ok {
+		return value
+	}
+	masked, err := transformChannelConfig(config, func(s string) (string, error) {
+		return maskAuditValue(s).(string), nil
+	})
+	if err != nil {
+		return ""
+	}
+	return masked
+}
+
+func RecordAuditLog(ctx context.Context, log *AuditLog) {
+	log.CreatedAt = helper.GetTimestamp()
+	log.RequestId = helper.GetRequestID(ctx)
+	err := LOG_DB.Create(log).Error
+	if err != nil {
+		logger.Error(ctx, "failed to record audit log: "+err.Error())
+	}
+}
+
+func GetAuditLogs(filter AuditLogFilter, startIdx int, num int) (logs []*AuditLog, err error) {
+	tx := LOG_DB.Model(&AuditLog{})
+	if filter.UserId != 0 {
+		tx = tx.Where("user_id = ?", filter.UserId)
+	}
+	if filter.Action != "" {
+		tx = tx.Where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		tx = tx.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetId != "" {
+		tx = tx.Where("target_id = ?", filter.TargetId)
+	}
+	if filter.StartTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", filter.StartTimestamp)
+	}
+	if filter.EndTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", filter.EndTimestamp)
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&logs).Error
+	return logs, err
+}
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditDiff(t *testing.T) {
+	before := &Channel{Id: 1, Name: "gpt-4", Key: "sk-old", Config: `{"region":"us","ak":"old-ak"}`}
+	after := &Channel{Id: 1, Name: "gpt-4", Key: "sk-new", Config: `{"region":"eu","ak":"old-ak"}`}
+	diff := AuditDiff(before, after)
+	assert.NotContains(t, diff, "name")
+	assert.Contains(t, diff, "key")
+	assert.NotContains(t, diff["key"].Before, "sk-old")
+	assert.NotEqual(t, diff["key"].Before, diff["key"].After)
+	assert.Contains(t, diff["config"].After, `"region":"eu"`)
+	assert.NotContains(t, diff["config"].After, "old-ak")
+
+	diff = AuditDiff(nil, map[string]string{"SMTPToken": "secret"})
+	assert.Nil(t, diff["SMTPToken"].Before)
+	assert.NotEqual(t, "secret", diff["SMTPToken"].After)
+}
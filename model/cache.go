@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/common/random"
 	"math/rand"
@@ -25,19 +26,25 @@ var (
 	GroupModelsCacheSeconds   = config.SyncFrequency
 )
 
+// CacheGetTokenByKey looks the token up by the hash of its key, the key itself is neither stored nor cached
 func CacheGetTokenByKey(key string) (*Token, error) {
-	keyCol := "`key`"
-	if common.UsingPostgreSQL {
-		keyCol = `"key"`
-	}
+	keyHash := HashTokenKey(key)
 	var token Token
 	if !common.RedisEnabled {
-		err := DB.Where(keyCol+" = ?", key).First(&token).Error
+		err := tokenByKeyHashQuery(keyHash).First(&token).Error
+		if err != nil {
+			return &token, err
+		}
+		token.ModelQuotas, err = GetTokenModelQuotas(token.Id)
 		return &token, err
 	}
-	tokenObjectString, err := common.RedisGet(fmt.Sprintf("token:%s", key))
+	tokenObjectString, err := common.RedisGet(fmt.Sprintf("token:%s", keyHash))
 	if err != nil {
-		err := DB.Where(keyCol+" = ?", key).First(&token).Error
+		err := tokenByKeyHashQuery(keyHash).First(&token).Error
+		if err != nil {
+			return nil, err
+		}
+		token.ModelQuotas, err = GetTokenModelQuotas(token.Id)
 		if err != nil {
 			return nil, err
 		}
@@ -45,7 +52,19 @@ func CacheGetTokenByKey(key string) (*Token, error) {
 		if err != nil {
 			return nil, err
 		}
-		err = common.RedisSet(fmt.Sprintf("token:%s", key), string(jsonBytes), time.Duration(TokenCacheSeconds)*time.Second)
+		expiration := time.Duration(TokenCacheSeconds) * time.Second
+		if token.KeyHash != keyHash {
+			// the previous key of a rotated token must not outlive its grace period in the cache
+			left := time.Duration(token.PreviousKeyExpiredTime-helper.GetTimestamp()) * time.Second
+			if left <= 0 {
+				// a zero expiration would keep the entry forever
+				return &token, nil
+			}
+			if left < expiration {
+				expiration = left
+			}
+		}
+		err = common.RedisSet(fmt.Sprintf("token:%s", keyHash), string(jsonBytes), expiration)
 		if err != nil {
 			logger.SysError("Redis set token error: " + err.Error())
 		}
@@ -73,6 +92,30 @@ func CacheGetUserGroup(id int) (group string, err error) {
 	return group, err
 }
 
+func CacheGetUserSubnets(id int) (subnets UserSubnets, err error) {
+	if !common.RedisEnabled {
+		return GetUserSubnets(id)
+	}
+	subnetsString, err := common.RedisGet(fmt.Sprintf("user_subnets:%d", id))
+	if err == nil {
+		err = json.Unmarshal([]byte(subnetsString), &subnets)
+		return subnets, err
+	}
+	subnets, err = GetUserSubnets(id)
+	if err != nil {
+		return subnets, err
+	}
+	jsonBytes, err := json.Marshal(subnets)
+	if err != nil {
+		return subnets, err
+	}
+	err = common.RedisSet(fmt.Sprintf("user_subnets:%d", id), string(jsonBytes), time.Duration(UserId2StatusCacheSeconds)*time.Second)
+	if err != nil {
+		logger.SysError("Redis set user subnets error: " + err.Error())
+	}
+	return subnets, nil
+}
+
 func fetchAndUpdateUserQuota(ctx context.Context, id int) (quota int64, err error) {
 	quota, err = GetUserQuota(id)
 	if err != nil {
@@ -174,6 +217,7 @@ func InitChannelCache() {
 	newChannelId2channel := make(map[int]*Channel)
 	var channels []*Channel
 	DB.Where("status = ?", ChannelStatusEnabled).Find(&channels)
+	openChannelsSecrets(channels)
 	for _, channel := range channels {
 		newChannelId2channel[channel.Id] = channel
 	}
@@ -213,6 +257,7 @@ func InitChannelCache() {
 	channelSyncLock.Lock()
 	group2model2channels = newGroup2model2channels
 	channelSyncLock.Unlock()
+	loadChannelKeyStatuses()
 	logger.SysLog("channels synced from database")
 }
 
@@ -230,7 +275,30 @@ func CacheGetRandomSatisfiedChannel(group string, model string, ignoreFirstPrior
 	}
 	channelSyncLock.RLock()
 	defer channelSyncLock.RUnlock()
-	channels := group2model2channels[group][model]
+	return pickChannelByPriority(group2model2channels[group][model], ignoreFirstPriority)
+}
+
+// CacheGetRandomSatisfiedChannelOfTypes is like CacheGetRandomSatisfiedChannel, but only picks channels of the given types
+func CacheGetRandomSatisfiedChannelOfTypes(group string, model string, channelTypes []int) (*Channel, error) {
+	if !config.MemoryCacheEnabled {
+		return getRandomSatisfiedChannel(group, model, false, channelTypes)
+	}
+	channelSyncLock.RLock()
+	defer channelSyncLock.RUnlock()
+	var channels []*Channel
+	for _, channel := range group2model2channels[group][model] {
+		for _, channelType := range channelTypes {
+			if channel.Type == channelType {
+				channels = append(channels, channel)
+				break
+			}
+		}
+	}
+	return pickChannelByPriority(channels, false)
+}
+
+// pickChannelByPriority picks a random channel of the highest priority, or of the lower ones, among channels sorted by priority
+func pickChannelByPriority(channels []*Channel, ignoreFirstPriority bool) (*Channel, error) {
 	if len(channels) == 0 {
 		return nil, errors.New("channel not found")
 	}
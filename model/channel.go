@@ -38,6 +38,8 @@ type Channel struct {
 	Priority           *int64  `json:"priority" gorm:"bigint;default:0"`
 	Config             string  `json:"config"`
 	SystemPrompt       *string `json:"system_prompt" gorm:"type:text"`
+	ParamPolicy        *string `json:"param_policy" gorm:"type:text"`
+	KeyStrategy        *string `json:"key_strategy" gorm:"default:''"` // see KeyStrategyRoundRobin etc.
 }
 
 type ChannelConfig struct {
@@ -50,6 +52,19 @@ type ChannelConfig struct {
 	Plugin            string `json:"plugin,omitempty"`
 	VertexAIProjectID string `json:"vertex_ai_project_id,omitempty"`
 	VertexAIADC       string `json:"vertex_ai_adc,omitempty"`
+	// balance checking, a balance url overrides the checker of the channel type
+	BalanceURL          string  `json:"balance_url,omitempty"`
+	BalanceField        string  `json:"balance_field,omitempty"`         // dotted path of the balance in the response, e.g. data.balance
+	BalanceCurrency     string  `json:"balance_currency,omitempty"`      // currency of the balance url or Azure budget, USD by default
+	LowBalanceThreshold float64 `json:"low_balance_threshold,omitempty"` // in the currency of the channel balance
+	AzureTenantId       string  `json:"azure_tenant_id,omitempty"`
+	AzureClientId       string  `json:"azure_client_id,omitempty"`
+	AzureClientSecret   string  `json:"azure_client_secret,omitempty"`
+	AzureSubscriptionId string  `json:"azure_subscription_id,omitempty"`
+	AzureBudgetName     string  `json:"azure_budget_name,omitempty"`
+	// upstream cost, the prices take the place of the model ratios, other models are priced at model ratio × multiplier
+	CostMultiplier float64            `json:"cost_multiplier,omitempty"`
+	CostModelRatio map[string]float64 `json:"cost_model_ratio,omitempty"`
 }
 
 func GetAllChannels(startIdx int, num int, scope string) ([]*Channel, error) {
@@ -63,11 +78,13 @@ func GetAllChannels(startIdx int, num int, scope string) ([]*Channel, error) {
 	default:
 		err = DB.Order("id desc").Limit(num).Offset(startIdx).Omit("key").Find(&channels).Error
 	}
+	openChannelsSecrets(channels)
 	return channels, err
 }
 
 func SearchChannels(keyword string) (channels []*Channel, err error) {
 	err = DB.Omit("key").Where("id = ? or name LIKE ?", helper.String2Int(keyword), keyword+"%").Find(&channels).Error
+	openChannelsSecrets(channels)
 	return channels, err
 }
 
@@ -79,20 +96,32 @@ func GetChannelById(id int, selectAll bool) (*Channel, error) {
 	} else {
 		err = DB.Omit("key").First(&channel, "id = ?", id).Error
 	}
+	if err != nil {
+		return &channel, err
+	}
+	err = channel.openSecrets()
 	return &channel, err
 }
 
 func BatchInsertChannels(channels []Channel) error {
 	var err error
+	for i := range channels {
+		if err = channels[i].sealSecrets(); err != nil {
+			return err
+		}
+	}
 	err = DB.Create(&channels).Error
 	if err != nil {
 		return err
 	}
-	for _, channel_ := range channels {
-		err = channel_.AddAbilities()
+	for i := range channels {
+		err = channels[i].AddAbilities()
 		if err != nil {
 			return err
 		}
+		if err = channels[i].openSecrets(); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -124,23 +153,50 @@ func (channel *Channel) GetModelMapping() map[string]string {
 	return modelMapping
 }
 
+func (channel *Channel) GetParamPolicy() string {
+	if channel.ParamPolicy == nil {
+		return ""
+	}
+	return *channel.ParamPolicy
+}
+
 func (channel *Channel) Insert() error {
 	var err error
+	err = channel.sealSecrets()
+	if err != nil {
+		return err
+	}
 	err = DB.Create(channel).Error
 	if err != nil {
 		return err
 	}
+	err = channel.openSecrets()
+	if err != nil {
+		return err
+	}
 	err = channel.AddAbilities()
 	return err
 }
 
 func (channel *Channel) Update() error {
 	var err error
+	err = channel.sealSecrets()
+	if err != nil {
+		return err
+	}
 	err = DB.Model(channel).Updates(channel).Error
 	if err != nil {
 		return err
 	}
 	DB.Model(channel).First(channel, "id = ?", channel.Id)
+	err = channel.openSecrets()
+	if err != nil {
+		return err
+	}
+	err = deleteStaleChannelKeys(channel)
+	if err != nil {
+		return err
+	}
 	err = channel.UpdateAbilities()
 	return err
 }
@@ -171,6 +227,10 @@ func (channel *Channel) Delete() error {
 	if err != nil {
 		return err
 	}
+	err = DB.Where("channel_id = ?", channel.Id).Delete(&ChannelKey{}).Error
+	if err != nil {
+		return err
+	}
 	err = channel.DeleteAbilities()
 	return err
 }
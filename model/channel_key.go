@@ -0,0 +1,325 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// key strategies of a channel, an empty strategy means the whole Key field is a single key
+const (
+	KeyStrategyRoundRobin          = "round_robin"
+	KeyStrategyRandom              = "random"
+	KeyStrategyLeastRecentlyFailed = "least_recently_failed"
+)
+
+// ChannelKey tracks the health of one key of a multi-key channel, the key itself is only referenced by its hash
+type ChannelKey struct {
+	Id             int    `json:"id"`
+	ChannelId      int    `json:"channel_id" gorm:"uniqueIndex:idx_channel_key_hash"`
+	KeyHash        string `json:"key_hash" gorm:"type:varchar(32);uniqueIndex:idx_channel_key_hash"`
+	Status         int    `json:"status" gorm:"default:1"`
+	FailCount      int64  `json:"fail_count" gorm:"bigint;default:0"`
+	LastFailedTime int64  `json:"last_failed_time" gorm:"bigint;default:0"`
+	LastError      string `json:"last_error" gorm:"type:text"`
+}
+
+// ChannelKeyInfo is the status of a key shown to the admin
+type ChannelKeyInfo struct {
+	Index          int    `json:"index"`
+	Key            string `json:"key"` // masked
+	KeyHash        string `json:"key_hash"`
+	Status         int    `json:"status"`
+	FailCount      int64  `json:"fail_count"`
+	LastFailedTime int64  `json:"last_failed_time"`
+	LastError      string `json:"last_error"`
+}
+
+var channelKeyLock sync.RWMutex
+var channelId2keys = make(map[int]map[string]*ChannelKey)
+var channelKeyCursor = make(map[int]int)
+
+func IsValidKeyStrategy(strategy string) bool {
+	switch strategy {
+	case "", KeyStrategyRoundRobin, KeyStrategyRandom, KeyStrategyLeastRecentlyFailed:
+		return true
+	}
+	return false
+}
+
+func HashChannelKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+func maskChannelKey(key string) string {
+	if len(key) <= 8 {
+		return strings.Repeat("*", len(key))
+	}
+	return key[:4] + strings.Repeat("*", 4) + key[len(key)-4:]
+}
+
+func (channel *Channel) GetKeyStrategy() string {
+	if channel.KeyStrategy == nil {
+		return ""
+	}
+	return *channel.KeyStrategy
+}
+
+// GetKeys returns the keys of the channel, one per line when a key strategy is set
+func (channel *Channel) GetKeys() []string {
+	if channel.GetKeyStrategy() == "" {
+		return []string{channel.Key}
+	}
+	var keys []string
+	for _, key := range strings.Split(channel.Key, "\n") {
+		key = strings.TrimSpace(key)
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return []string{""}
+	}
+	return keys
+}
+
+func getChannelKeyStatuses(channelId int) map[string]*ChannelKey {
+	if config.MemoryCacheEnabled {
+		channelKeyLock.RLock()
+		defer channelKeyLock.RUnlock()
+		// copy the map, it is modified in place when a key fails
+		statuses := make(map[string]*ChannelKey, len(channelId2keys[channelId]))
+		for keyHash, channelKey := range channelId2keys[channelId] {
+			statuses[keyHash] = channelKey
+		}
+		return statuses
+	}
+	var channelKeys []*ChannelKey
+	err := DB.Where("channel_id = ?", channelId).Find(&channelKeys).Error
+	if err != nil {
+		logger.SysError("failed to get channel keys: " + err.Error())
+	}
+	statuses := make(map[string]*ChannelKey)
+	for _, channelKey := range channelKeys {
+		statuses[channelKey.KeyHash] = channelKey
+	}
+	return statuses
+}
+
+func loadChannelKeyStatuses() {
+	var channelKeys []*ChannelKey
+	err := DB.Find(&channelKeys).Error
+	if err != nil {
+		logger.SysError("failed to load channel keys: " + err.Error())
+		return
+	}
+	newChannelId2keys := make(map[int]map[string]*ChannelKey)
+	for _, channelKey := range channelKeys {
+		if _, ok := newChannelId2keys[channelKey.ChannelId]; !ok {
+			newChannelId2keys[channelKey.ChannelId] = make(map[string]*ChannelKey)
+		}
+		newChannelId2keys[channelKey.ChannelId][channelKey.KeyHash] = channelKey
+	}
+	channelKeyLock.Lock()
+	channelId2keys = newChannelId2keys
+	channelKeyLock.Unlock()
+}
+
+// SelectChannelKey picks a key of the channel according to its key strategy,
+// the returned hash is empty for single-key channels
+func SelectChannelKey(channel *Channel) (key string, keyHash string) {
+	keys := channel.GetKeys()
+	if len(keys) == 1 {
+		return keys[0], ""
+	}
+	statuses := getChannelKeyStatuses(channel.Id)
+	var candidates []string
+	for _, key := range keys {
+		status, ok := statuses[HashChannelKey(key)]
+		if !ok || status.Status == ChannelStatusEnabled {
+			candidates = append(candidates, key)
+		}
+	}
+	if len(candidates) == 0 {
+		logger.SysError(fmt.Sprintf("all keys of channel #%d are disabled, falling back to all keys", channel.Id))
+		candidates = keys
+	}
+	switch channel.GetKeyStrategy() {
+	case KeyStrategyRandom:
+		key = candidates[rand.Intn(len(candidates))]
+	case KeyStrategyLeastRecentlyFailed:
+		var best []string
+		var bestTime int64 = -1
+		for _, candidate := range candidates {
+			var lastFailedTime int64
+			if status, ok := statuses[HashChannelKey(candidate)]; ok {
+				lastFailedTime = status.LastFailedTime
+			}
+			if bestTime == -1 || lastFailedTime < bestTime {
+				best = []string{candidate}
+				bestTime = lastFailedTime
+			} else if lastFailedTime == bestTime {
+				best = append(best, candidate)
+			}
+		}
+		key = best[rand.Intn(len(best))]
+	default:
+		channelKeyLock.Lock()
+		cursor := channelKeyCursor[channel.Id]
+		channelKeyCursor[channel.Id] = cursor + 1
+		channelKeyLock.Unlock()
+		key = candidates[cursor%len(candidates)]
+	}
+	return key, HashChannelKey(key)
+}
+
+// RecordChannelKeyFailure counts a failure of a key, disable also disables the key
+func RecordChannelKeyFailure(channelId int, keyHash string, reason string, disable bool) {
+	if keyHash == "" {
+		return
+	}
+	now := helper.GetTimestamp()
+	channelKey := &ChannelKey{
+		ChannelId:      channelId,
+		KeyHash:        keyHash,
+		Status:         ChannelStatusEnabled,
+		FailCount:      1,
+		LastFailedTime: now,
+		LastError:      reason,
+	}
+	updates := map[string]any{
+		"fail_count":       gorm.Expr("fail_count + 1"),
+		"last_failed_time": now,
+		"last_error":       reason,
+	}
+	if disable {
+		channelKey.Status = ChannelStatusAutoDisabled
+		updates["status"] = ChannelStatusAutoDisabled
+	}
+	err := DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "channel_id"}, {Name: "key_hash"}},
+		DoUpdates: clause.Assignments(updates),
+	}).Create(channelKey).Error
+	if err != nil {
+		logger.SysError("failed to record channel key failure: " + err.Error())
+		return
+	}
+	channelKeyLock.Lock()
+	defer channelKeyLock.Unlock()
+	if _, ok := channelId2keys[channelId]; !ok {
+		channelId2keys[channelId] = make(map[string]*ChannelKey)
+	}
+	if cached, ok := channelId2keys[channelId][keyHash]; ok {
+		updated := *cached
+		updated.FailCount++
+		updated.LastFailedTime = now
+		updated.LastError = reason
+		if disable {
+			updated.Status = ChannelStatusAutoDisabled
+		}
+		channelKey = &updated
+	}
+	channelId2keys[channelId][keyHash] = channelKey
+}
+
+// UpdateChannelKeyStatus enables or disables a key of a channel
+func UpdateChannelKeyStatus(channelId int, keyHash string, status int) error {
+	channelKey := &ChannelKey{ChannelId: channelId, KeyHash: keyHash, Status: status}
+	err := DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "channel_id"}, {Name: "key_hash"}},
+		DoUpdates: clause.AssignmentColumns([]string{"status"}),
+	}).Create(channelKey).Error
+	if err != nil {
+		return err
+	}
+	channelKeyLock.Lock()
+	defer channelKeyLock.Unlock()
+	if _, ok := channelId2keys[channelId]; !ok {
+		channelId2keys[channelId] = make(map[string]*ChannelKey)
+	}
+	if cached, ok := channelId2keys[channelId][keyHash]; ok {
+		updated := *cached
+		updated.Status = status
+		channelKey = &updated
+	}
+	channelId2keys[channelId][keyHash] = channelKey
+	return nil
+}
+
+// GetEnabledChannelKeys returns the keys of the channel which are not disabled
+func GetEnabledChannelKeys(channel *Channel) []string {
+	statuses := getChannelKeyStatuses(channel.Id)
+	var keys []string
+	for _, key := range channel.GetKeys() {
+		status, ok := statuses[HashChannelKey(key)]
+		if !ok || status.Status == ChannelStatusEnabled {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// CountEnabledChannelKeys returns the number of keys of the channel which are not disabled
+func CountEnabledChannelKeys(channelId int) (int, error) {
+	channel, err := GetChannelById(channelId, true)
+	if err != nil {
+		return 0, err
+	}
+	return len(GetEnabledChannelKeys(channel)), nil
+}
+
+// GetChannelKeyInfos returns the status of every key of a channel
+func GetChannelKeyInfos(channel *Channel) ([]*ChannelKeyInfo, error) {
+	var channelKeys []*ChannelKey
+	err := DB.Where("channel_id = ?", channel.Id).Find(&channelKeys).Error
+	if err != nil {
+		return nil, err
+	}
+	statuses := make(map[string]*ChannelKey)
+	for _, channelKey := range channelKeys {
+		statuses[channelKey.KeyHash] = channelKey
+	}
+	var infos []*ChannelKeyInfo
+	for i, key := range channel.GetKeys() {
+		info := &ChannelKeyInfo{
+			Index:   i,
+			Key:     maskChannelKey(key),
+			KeyHash: HashChannelKey(key),
+			Status:  ChannelStatusEnabled,
+		}
+		if status, ok := statuses[info.KeyHash]; ok {
+			info.Status = status.Status
+			info.FailCount = status.FailCount
+			info.LastFailedTime = status.LastFailedTime
+			info.LastError = status.LastError
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// deleteStaleChannelKeys removes the statuses of the keys which are no longer part of the channel
+func deleteStaleChannelKeys(channel *Channel) error {
+	hashes := make([]string, 0)
+	if channel.GetKeyStrategy() != "" {
+		for _, key := range channel.GetKeys() {
+			hashes = append(hashes, HashChannelKey(key))
+		}
+	}
+	query := DB.Where("channel_id = ?", channel.Id)
+	if len(hashes) > 0 {
+		query = query.Where("key_hash NOT IN ?", hashes)
+	}
+	return query.Delete(&ChannelKey{}).Error
+}
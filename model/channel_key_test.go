@@ -0,0 +1,109 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMultiKeyChannel(id int, strategy string, key string) *Channel {
+	return &Channel{Id: id, Key: key, KeyStrategy: &strategy}
+}
+
+func TestGetKeys(t *testing.T) {
+	assert.Equal(t, []string{"a\nb"}, (&Channel{Key: "a\nb"}).GetKeys(), "a channel without strategy has a single key")
+	assert.Equal(t, []string{"a", "b"}, newMultiKeyChannel(1, KeyStrategyRandom, " a \n\nb\n").GetKeys())
+	assert.Equal(t, []string{""}, newMultiKeyChannel(1, KeyStrategyRandom, "\n").GetKeys())
+}
+
+func TestSelectChannelKey(t *testing.T) {
+	setupTestDB(t)
+	channel := newMultiKeyChannel(1, KeyStrategyRoundRobin, "a\nb\nc")
+
+	var selected []string
+	for i := 0; i < 3; i++ {
+		key, keyHash := SelectChannelKey(channel)
+		assert.Equal(t, HashChannelKey(key), keyHash)
+		selected = append(selected, key)
+	}
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, selected, "round robin uses every key")
+
+	// disabled keys are skipped
+	RecordChannelKeyFailure(channel.Id, HashChannelKey("a"), "invalid api key", true)
+	RecordChannelKeyFailure(channel.Id, HashChannelKey("c"), "invalid api key", true)
+	for i := 0; i < 3; i++ {
+		key, _ := SelectChannelKey(channel)
+		assert.Equal(t, "b", key)
+	}
+
+	// every key is used again when all of them are disabled
+	RecordChannelKeyFailure(channel.Id, HashChannelKey("b"), "invalid api key", true)
+	key, _ := SelectChannelKey(channel)
+	assert.Contains(t, []string{"a", "b", "c"}, key)
+
+	single := &Channel{Id: 2, Key: "sk-single"}
+	key, keyHash := SelectChannelKey(single)
+	assert.Equal(t, "sk-single", key)
+	assert.Empty(t, keyHash, "single-key channels are not tracked")
+}
+
+func TestSelectLeastRecentlyFailedKey(t *testing.T) {
+	setupTestDB(t)
+	channel := newMultiKeyChannel(1, KeyStrategyLeastRecentlyFailed, "a\nb")
+	RecordChannelKeyFailure(channel.Id, HashChannelKey("a"), "rate limited", false)
+	for i := 0; i < 5; i++ {
+		key, _ := SelectChannelKey(channel)
+		assert.Equal(t, "b", key, "the key which never failed is preferred")
+	}
+}
+
+func TestRecordChannelKeyFailure(t *testing.T) {
+	setupTestDB(t)
+	keyHash := HashChannelKey("a")
+	RecordChannelKeyFailure(1, "", "ignored", true)
+	RecordChannelKeyFailure(1, keyHash, "rate limited", false)
+	RecordChannelKeyFailure(1, keyHash, "invalid api key", true)
+
+	var channelKeys []*ChannelKey
+	require.NoError(t, DB.Find(&channelKeys).Error)
+	require.Len(t, channelKeys, 1)
+	assert.Equal(t, int64(2), channelKeys[0].FailCount)
+	assert.Equal(t, "invalid api key", channelKeys[0].LastError)
+	assert.Equal(t, ChannelStatusAutoDisabled, channelKeys[0].Status)
+
+	require.NoError(t, UpdateChannelKeyStatus(1, keyHash, ChannelStatusEnabled))
+	assert.Equal(t, ChannelStatusEnabled, getChannelKeyStatuses(1)[keyHash].Status)
+}
+
+func TestDeleteStaleChannelKeys(t *testing.T) {
+	setupTestDB(t)
+	for _, key := range []string{"a", "b", "c"} {
+		RecordChannelKeyFailure(1, HashChannelKey(key), "rate limited", false)
+	}
+	RecordChannelKeyFailure(2, HashChannelKey("a"), "rate limited", false)
+
+	require.NoError(t, deleteStaleChannelKeys(newMultiKeyChannel(1, KeyStrategyRandom, "a\nc\nd")))
+	assert.ElementsMatch(t, []string{HashChannelKey("a"), HashChannelKey("c")}, keyHashesOfChannel(t, 1))
+
+	// a channel back to a single key has no statuses left
+	require.NoError(t, deleteStaleChannelKeys(&Channel{Id: 1, Key: "a"}))
+	assert.Empty(t, keyHashesOfChannel(t, 1))
+	assert.Len(t, keyHashesOfChannel(t, 2), 1, "other channels are left alone")
+}
+
+func keyHashesOfChannel(t *testing.T, channelId int) []string {
+	var hashes []string
+	require.NoError(t, DB.Model(&ChannelKey{}).Where("channel_id = ?", channelId).Pluck("key_hash", &hashes).Error)
+	return hashes
+}
+
+func TestGetEnabledChannelKeys(t *testing.T) {
+	setupTestDB(t)
+	channel := newMultiKeyChannel(1, KeyStrategyRoundRobin, "a\nb\nc")
+	assert.Equal(t, []string{"a", "b", "c"}, GetEnabledChannelKeys(channel))
+
+	RecordChannelKeyFailure(channel.Id, HashChannelKey("b"), "invalid api key", true)
+	RecordChannelKeyFailure(channel.Id, HashChannelKey("c"), "rate limited", false)
+	assert.Equal(t, []string{"a", "c"}, GetEnabledChannelKeys(channel), "keys which failed without being disabled are still tested")
+}
@@ -13,22 +13,24 @@ import (
 )
 
 type Log struct {
-	Id                int    `json:"id"`
-	UserId            int    `json:"user_id" gorm:"index"`
-	CreatedAt         int64  `json:"created_at" gorm:"bigint;index:idx_created_at_type"`
-	Type              int    `json:"type" gorm:"index:idx_created_at_type"`
-	Content           string `json:"content"`
-	Username          string `json:"username" gorm:"index:index_username_model_name,priority:2;default:''"`
-	TokenName         string `json:"token_name" gorm:"index;default:''"`
-	ModelName         string `json:"model_name" gorm:"index;index:index_username_model_name,priority:1;default:''"`
-	Quota             int    `json:"quota" gorm:"default:0"`
-	PromptTokens      int    `json:"prompt_tokens" gorm:"default:0"`
-	CompletionTokens  int    `json:"completion_tokens" gorm:"default:0"`
-	ChannelId         int    `json:"channel" gorm:"index"`
-	RequestId         string `json:"request_id" gorm:"default:''"`
-	ElapsedTime       int64  `json:"elapsed_time" gorm:"default:0"` // unit is ms
-	IsStream          bool   `json:"is_stream" gorm:"default:false"`
-	SystemPromptReset bool   `json:"system_prompt_reset" gorm:"default:false"`
+	Id                int     `json:"id"`
+	UserId            int     `json:"user_id" gorm:"index"`
+	CreatedAt         int64   `json:"created_at" gorm:"bigint;index:idx_created_at_type"`
+	Type              int     `json:"type" gorm:"index:idx_created_at_type"`
+	Content           string  `json:"content"`
+	Username          string  `json:"username" gorm:"index:index_username_model_name,priority:2;default:''"`
+	TokenName         string  `json:"token_name" gorm:"index;default:''"`
+	ModelName         string  `json:"model_name" gorm:"index;index:index_username_model_name,priority:1;default:''"`
+	Quota             int     `json:"quota" gorm:"default:0"`
+	Cost              int     `json:"cost,omitempty" gorm:"default:0"` // upstream cost in quota, hidden from users
+	PromptTokens      int     `json:"prompt_tokens" gorm:"default:0"`
+	CompletionTokens  int     `json:"completion_tokens" gorm:"default:0"`
+	ChannelId         int     `json:"channel" gorm:"index"`
+	RequestId         string  `json:"request_id" gorm:"default:''"`
+	ElapsedTime       int64   `json:"elapsed_time" gorm:"default:0"` // unit is ms
+	IsStream          bool    `json:"is_stream" gorm:"default:false"`
+	SystemPromptReset bool    `json:"system_prompt_reset" gorm:"default:false"`
+	Duration          float64 `json:"duration,omitempty" gorm:"default:0"` // seconds of billed audio
 }
 
 const (
@@ -38,6 +40,7 @@ const (
 	LogTypeManage
 	LogTypeSystem
 	LogTypeTest
+	LogTypeGuardrail
 )
 
 func recordLogHelper(ctx context.Context, log *Log) {
@@ -87,6 +90,13 @@ func RecordConsumeLog(ctx context.Context, log *Log) {
 	recordLogHelper(ctx, log)
 }
 
+func RecordGuardrailLog(ctx context.Context, log *Log) {
+	log.Username = GetUsernameById(log.UserId)
+	log.CreatedAt = helper.GetTimestamp()
+	log.Type = LogTypeGuardrail
+	recordLogHelper(ctx, log)
+}
+
 func RecordTestLog(ctx context.Context, log *Log) {
 	log.CreatedAt = helper.GetTimestamp()
 	log.Type = LogTypeTest
@@ -141,7 +151,7 @@ func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int
 	if endTimestamp != 0 {
 		tx = tx.Where("created_at <= ?", endTimestamp)
 	}
-	err = tx.Order("id desc").Limit(num).Offset(startIdx).Omit("id").Find(&logs).Error
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Omit("id", "cost").Find(&logs).Error
 	return logs, err
 }
 
@@ -151,7 +161,7 @@ func SearchAllLogs(keyword string) (logs []*Log, err error) {
 }
 
 func SearchUserLogs(userId int, keyword string) (logs []*Log, err error) {
-	err = LOG_DB.Where("user_id = ? and type = ?", userId, keyword).Order("id desc").Limit(config.MaxRecentItems).Omit("id").Find(&logs).Error
+	err = LOG_DB.Where("user_id = ? and type = ?", userId, keyword).Order("id desc").Limit(config.MaxRecentItems).Omit("id", "cost").Find(&logs).Error
 	return logs, err
 }
 
@@ -249,3 +259,34 @@ func SearchLogsByDayAndModel(userId, start, end int) (LogStatistics []*LogStatis
 
 	return LogStatistics, err
 }
+
+type MarginStatistic struct {
+	ChannelId    int    `json:"channel" gorm:"column:channel_id"`
+	ModelName    string `json:"model_name" gorm:"column:model_name"`
+	RequestCount int    `json:"request_count" gorm:"column:request_count"`
+	Quota        int64  `json:"quota" gorm:"column:quota"`
+	Cost         int64  `json:"cost" gorm:"column:cost"`
+	Margin       int64  `json:"margin" gorm:"column:margin"`
+}
+
+// GetMarginReport sums the charged quota and the upstream cost of the consume logs per channel and model,
+// the ones losing money first, zero filters are ignored
+func GetMarginReport(startTimestamp int64, endTimestamp int64, channel int, modelName string) (statistics []*MarginStatistic, err error) {
+	tx := LOG_DB.Table("logs").
+		Select("channel_id, model_name, count(1) as request_count, sum(quota) as quota, sum(cost) as cost, sum(quota) - sum(cost) as margin").
+		Where("type = ?", LogTypeConsume)
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	if channel != 0 {
+		tx = tx.Where("channel_id = ?", channel)
+	}
+	if modelName != "" {
+		tx = tx.Where("model_name = ?", modelName)
+	}
+	err = tx.Group("channel_id, model_name").Order("margin, channel_id, model_name").Scan(&statistics).Error
+	return statistics, err
+}
@@ -58,7 +58,7 @@ func CreateRootAccountIfNeed() error {
 				RemainQuota:    500000000000000,
 				UnlimitedQuota: true,
 			}
-			DB.Create(&token)
+			_ = token.Insert()
 		}
 	}
 	return nil
@@ -119,6 +119,9 @@ func InitDB() {
 	sqlDB := setDBConns(DB)
 
 	if !config.IsMasterNode {
+		if err = initTokenHashSalt(); err != nil {
+			logger.FatalLog("failed to initialize the token hash salt: " + err.Error())
+		}
 		return
 	}
 
@@ -131,6 +134,14 @@ func InitDB() {
 		logger.FatalLog("failed to migrate database: " + err.Error())
 		return
 	}
+	if err = initTokenHashSalt(); err != nil {
+		logger.FatalLog("failed to initialize the token hash salt: " + err.Error())
+		return
+	}
+	if err = migrateTokenKeys(); err != nil {
+		logger.FatalLog("failed to migrate token keys: " + err.Error())
+		return
+	}
 	logger.SysLog("database migrated")
 }
 
@@ -139,24 +150,54 @@ func migrateDB() error {
 	if err = DB.AutoMigrate(&Channel{}); err != nil {
 		return err
 	}
+	if err = DB.AutoMigrate(&ChannelKey{}); err != nil {
+		return err
+	}
 	if err = DB.AutoMigrate(&Token{}); err != nil {
 		return err
 	}
+	if err = DB.AutoMigrate(&TokenModelQuota{}); err != nil {
+		return err
+	}
 	if err = DB.AutoMigrate(&User{}); err != nil {
 		return err
 	}
+	if err = DB.AutoMigrate(&WebAuthnCredential{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&CustomRole{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&UserSession{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&BannedUser{}); err != nil {
+		return err
+	}
 	if err = DB.AutoMigrate(&Option{}); err != nil {
 		return err
 	}
 	if err = DB.AutoMigrate(&Redemption{}); err != nil {
 		return err
 	}
+	if err = DB.AutoMigrate(&RedemptionRecord{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&Order{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&Statement{}); err != nil {
+		return err
+	}
 	if err = DB.AutoMigrate(&Ability{}); err != nil {
 		return err
 	}
 	if err = DB.AutoMigrate(&Log{}); err != nil {
 		return err
 	}
+	if err = DB.AutoMigrate(&AuditLog{}); err != nil {
+		return err
+	}
 	if err = DB.AutoMigrate(&Channel{}); err != nil {
 		return err
 	}
@@ -197,6 +238,9 @@ func migrateLOGDB() error {
 	if err = LOG_DB.AutoMigrate(&Log{}); err != nil {
 		return err
 	}
+	if err = LOG_DB.AutoMigrate(&AuditLog{}); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/songquanpeng/one-api/common"
+)
+
+// setupTestDB points DB and LOG_DB at a fresh in-memory database with all tables migrated
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared&_busy_timeout=5000", t.Name())
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	// a single connection serializes the writes, like sqlite does with a file
+	sqlDB.SetMaxOpenConns(1)
+	oldDB, oldLogDB, redisEnabled := DB, LOG_DB, common.RedisEnabled
+	DB, LOG_DB, common.RedisEnabled = db, db, false
+	t.Cleanup(func() {
+		_ = sqlDB.Close()
+		DB, LOG_DB, common.RedisEnabled = oldDB, oldLogDB, redisEnabled
+	})
+	require.NoError(t, migrateDB())
+	require.NoError(t, migrateLOGDB())
+}
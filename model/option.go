@@ -1,9 +1,14 @@
 package model
 
 import (
+	"fmt"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/payment"
+	"github.com/songquanpeng/one-api/common/saml"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/guardrail"
+	"github.com/songquanpeng/one-api/relay/parampolicy"
 	"strconv"
 	"strings"
 	"time"
@@ -29,6 +34,7 @@ func InitOptionMap() {
 	config.OptionMap["EmailVerificationEnabled"] = strconv.FormatBool(config.EmailVerificationEnabled)
 	config.OptionMap["GitHubOAuthEnabled"] = strconv.FormatBool(config.GitHubOAuthEnabled)
 	config.OptionMap["OidcEnabled"] = strconv.FormatBool(config.OidcEnabled)
+	config.OptionMap["SAMLEnabled"] = strconv.FormatBool(config.SAMLEnabled)
 	config.OptionMap["WeChatAuthEnabled"] = strconv.FormatBool(config.WeChatAuthEnabled)
 	config.OptionMap["TurnstileCheckEnabled"] = strconv.FormatBool(config.TurnstileCheckEnabled)
 	config.OptionMap["RegisterEnabled"] = strconv.FormatBool(config.RegisterEnabled)
@@ -39,7 +45,9 @@ func InitOptionMap() {
 	config.OptionMap["DisplayInCurrencyEnabled"] = strconv.FormatBool(config.DisplayInCurrencyEnabled)
 	config.OptionMap["DisplayTokenStatEnabled"] = strconv.FormatBool(config.DisplayTokenStatEnabled)
 	config.OptionMap["ChannelDisableThreshold"] = strconv.FormatFloat(config.ChannelDisableThreshold, 'f', -1, 64)
+	config.OptionMap["ChannelLowBalanceThreshold"] = strconv.FormatFloat(config.ChannelLowBalanceThreshold, 'f', -1, 64)
 	config.OptionMap["EmailDomainRestrictionEnabled"] = strconv.FormatBool(config.EmailDomainRestrictionEnabled)
+	config.OptionMap["TwoFactorEnforcementEnabled"] = strconv.FormatBool(config.TwoFactorEnforcementEnabled)
 	config.OptionMap["EmailDomainWhitelist"] = strings.Join(config.EmailDomainWhitelist, ",")
 	config.OptionMap["SMTPServer"] = ""
 	config.OptionMap["SMTPFrom"] = ""
@@ -62,6 +70,16 @@ func InitOptionMap() {
 	config.OptionMap["MessagePusherToken"] = ""
 	config.OptionMap["TurnstileSiteKey"] = ""
 	config.OptionMap["TurnstileSecretKey"] = ""
+	config.OptionMap["SAMLIdpEntityId"] = ""
+	config.OptionMap["SAMLIdpSsoUrl"] = ""
+	config.OptionMap["SAMLIdpCertificate"] = ""
+	config.OptionMap["SAMLSpEntityId"] = ""
+	config.OptionMap["SAMLUsernameAttribute"] = ""
+	config.OptionMap["SAMLEmailAttribute"] = ""
+	config.OptionMap["SAMLDisplayNameAttribute"] = ""
+	config.OptionMap["SAMLGroupAttribute"] = ""
+	config.OptionMap["SAMLGroupMapping"] = ""
+	config.OptionMap["SCIMToken"] = ""
 	config.OptionMap["QuotaForNewUser"] = strconv.FormatInt(config.QuotaForNewUser, 10)
 	config.OptionMap["QuotaForInviter"] = strconv.FormatInt(config.QuotaForInviter, 10)
 	config.OptionMap["QuotaForInvitee"] = strconv.FormatInt(config.QuotaForInvitee, 10)
@@ -70,10 +88,24 @@ func InitOptionMap() {
 	config.OptionMap["ModelRatio"] = billingratio.ModelRatio2JSONString()
 	config.OptionMap["GroupRatio"] = billingratio.GroupRatio2JSONString()
 	config.OptionMap["CompletionRatio"] = billingratio.CompletionRatio2JSONString()
+	config.OptionMap["ModelPrice"] = billingratio.ModelPrices2JSONString()
+	config.OptionMap["PricingRules"] = billingratio.PricingRules2JSONString()
+	config.OptionMap["PricingCatalogSource"] = config.PricingCatalogSource
+	config.OptionMap["PricingCatalogBaseline"] = ""
+	config.OptionMap["GroupParamPolicy"] = parampolicy.GroupParamPolicy2JSONString()
+	config.OptionMap["GuardrailConfig"] = guardrail.Config2JSONString()
 	config.OptionMap["TopUpLink"] = config.TopUpLink
+	config.OptionMap["PaymentProvider"] = config.PaymentProvider
+	config.OptionMap["PaymentCurrency"] = config.PaymentCurrency
+	config.OptionMap["StripeApiSecret"] = ""
+	config.OptionMap["PaymentWebhookSecret"] = ""
+	config.OptionMap["PaymentPriceTiers"] = payment.PriceTiers2JSONString()
 	config.OptionMap["ChatLink"] = config.ChatLink
 	config.OptionMap["QuotaPerUnit"] = strconv.FormatFloat(config.QuotaPerUnit, 'f', -1, 64)
 	config.OptionMap["RetryTimes"] = strconv.Itoa(config.RetryTimes)
+	config.OptionMap["TokenExpiryRemindDays"] = strconv.Itoa(config.TokenExpiryRemindDays)
+	config.OptionMap["TokenMaxLifetimeDays"] = strconv.Itoa(config.TokenMaxLifetimeDays)
+	config.OptionMap["TokenRotationGracePeriod"] = strconv.Itoa(config.TokenRotationGracePeriod)
 	config.OptionMap["Theme"] = config.Theme
 	config.OptionMapRWMutex.Unlock()
 	loadOptionsFromDatabase()
@@ -85,7 +117,12 @@ func loadOptionsFromDatabase() {
 		if option.Key == "ModelRatio" {
 			option.Value = billingratio.AddNewMissingRatio(option.Value)
 		}
-		err := updateOptionMap(option.Key, option.Value)
+		value, err := decryptOptionValue(option.Key, option.Value)
+		if err != nil {
+			logger.SysError(fmt.Sprintf("failed to decrypt option %s: %s", option.Key, err.Error()))
+			continue
+		}
+		err = updateOptionMap(option.Key, value)
 		if err != nil {
 			logger.SysError("failed to update option map: " + err.Error())
 		}
@@ -101,13 +138,17 @@ func SyncOptions(frequency int) {
 }
 
 func UpdateOption(key string, value string) error {
+	storedValue, err := encryptOptionValue(key, value)
+	if err != nil {
+		return err
+	}
 	// Save to database first
 	option := Option{
 		Key: key,
 	}
 	// https://gorm.io/docs/update.html#Save-All-Fields
 	DB.FirstOrCreate(&option, Option{Key: key})
-	option.Value = value
+	option.Value = storedValue
 	// Save is a combination function.
 	// If save value does not contain primary key, it will execute Create,
 	// otherwise it will execute Update (with all fields).
@@ -133,6 +174,8 @@ func updateOptionMap(key string, value string) (err error) {
 			config.GitHubOAuthEnabled = boolValue
 		case "OidcEnabled":
 			config.OidcEnabled = boolValue
+		case "SAMLEnabled":
+			config.SAMLEnabled = boolValue
 		case "WeChatAuthEnabled":
 			config.WeChatAuthEnabled = boolValue
 		case "TurnstileCheckEnabled":
@@ -141,6 +184,8 @@ func updateOptionMap(key string, value string) (err error) {
 			config.RegisterEnabled = boolValue
 		case "EmailDomainRestrictionEnabled":
 			config.EmailDomainRestrictionEnabled = boolValue
+		case "TwoFactorEnforcementEnabled":
+			config.TwoFactorEnforcementEnabled = boolValue
 		case "AutomaticDisableChannelEnabled":
 			config.AutomaticDisableChannelEnabled = boolValue
 		case "AutomaticEnableChannelEnabled":
@@ -191,6 +236,28 @@ func updateOptionMap(key string, value string) (err error) {
 		config.OidcTokenEndpoint = value
 	case "OidcUserinfoEndpoint":
 		config.OidcUserinfoEndpoint = value
+	case "SAMLIdpEntityId":
+		config.SAMLIdpEntityId = value
+	case "SAMLIdpSsoUrl":
+		config.SAMLIdpSsoUrl = value
+	case "SAMLIdpCertificate":
+		config.SAMLIdpCertificate = value
+	case "SAMLSpEntityId":
+		config.SAMLSpEntityId = value
+	case "SAMLUsernameAttribute":
+		config.SAMLUsernameAttribute = value
+	case "SAMLEmailAttribute":
+		config.SAMLEmailAttribute = value
+	case "SAMLDisplayNameAttribute":
+		config.SAMLDisplayNameAttribute = value
+	case "SAMLGroupAttribute":
+		config.SAMLGroupAttribute = value
+	case "SAMLGroupMapping":
+		if _, err = saml.ParseGroupMapping(value); err == nil {
+			config.SAMLGroupMapping = value
+		}
+	case "SCIMToken":
+		config.SCIMToken = value
 	case "Footer":
 		config.Footer = value
 	case "SystemName":
@@ -223,18 +290,46 @@ func updateOptionMap(key string, value string) (err error) {
 		config.PreConsumedQuota, _ = strconv.ParseInt(value, 10, 64)
 	case "RetryTimes":
 		config.RetryTimes, _ = strconv.Atoi(value)
+	case "TokenExpiryRemindDays":
+		config.TokenExpiryRemindDays, _ = strconv.Atoi(value)
+	case "TokenMaxLifetimeDays":
+		config.TokenMaxLifetimeDays, _ = strconv.Atoi(value)
+	case "TokenRotationGracePeriod":
+		config.TokenRotationGracePeriod, _ = strconv.Atoi(value)
 	case "ModelRatio":
 		err = billingratio.UpdateModelRatioByJSONString(value)
 	case "GroupRatio":
 		err = billingratio.UpdateGroupRatioByJSONString(value)
 	case "CompletionRatio":
 		err = billingratio.UpdateCompletionRatioByJSONString(value)
+	case "ModelPrice":
+		err = billingratio.UpdateModelPricesByJSONString(value)
+	case "PricingCatalogSource":
+		config.PricingCatalogSource = value
+	case "PricingRules":
+		err = billingratio.UpdatePricingRulesByJSONString(value)
+	case "GroupParamPolicy":
+		err = parampolicy.UpdateGroupParamPolicyByJSONString(value)
+	case "GuardrailConfig":
+		err = guardrail.UpdateConfigByJSONString(value)
 	case "TopUpLink":
 		config.TopUpLink = value
+	case "PaymentProvider":
+		config.PaymentProvider = value
+	case "PaymentCurrency":
+		config.PaymentCurrency = strings.ToLower(value)
+	case "StripeApiSecret":
+		config.StripeApiSecret = value
+	case "PaymentWebhookSecret":
+		config.PaymentWebhookSecret = value
+	case "PaymentPriceTiers":
+		err = payment.UpdatePriceTiersByJSONString(value)
 	case "ChatLink":
 		config.ChatLink = value
 	case "ChannelDisableThreshold":
 		config.ChannelDisableThreshold, _ = strconv.ParseFloat(value, 64)
+	case "ChannelLowBalanceThreshold":
+		config.ChannelLowBalanceThreshold, _ = strconv.ParseFloat(value, 64)
 	case "QuotaPerUnit":
 		config.QuotaPerUnit, _ = strconv.ParseFloat(value, 64)
 	case "Theme":
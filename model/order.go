@@ -0,0 +1,159 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/random"
+)
+
+const (
+	OrderStatusPending  = 1 // don't use 0, 0 is the default value!
+	OrderStatusPaid     = 2
+	OrderStatusFailed   = 3
+	OrderStatusRefunded = 4
+)
+
+// Order is an online top-up, the amount is in the minor unit of the currency
+type Order struct {
+	Id          int    `json:"id"`
+	OrderNo     string `json:"order_no" gorm:"type:varchar(64);uniqueIndex"`
+	UserId      int    `json:"user_id" gorm:"index"`
+	Provider    string `json:"provider" gorm:"type:varchar(32)"`
+	SessionId   string `json:"session_id" gorm:"type:varchar(255);index"`
+	PaymentId   string `json:"payment_id" gorm:"type:varchar(255);index"`
+	TierName    string `json:"tier_name"`
+	Amount      int64  `json:"amount" gorm:"bigint"`
+	Currency    string `json:"currency" gorm:"type:varchar(8)"`
+	Quota       int64  `json:"quota" gorm:"bigint"`
+	Status      int    `json:"status" gorm:"default:1;index"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	PaidTime    int64  `json:"paid_time" gorm:"bigint"`
+	UpdatedTime int64  `json:"updated_time" gorm:"bigint"`
+}
+
+func NewOrderNo() string {
+	return "ord_" + random.GetUUID()
+}
+
+func (order *Order) Insert() error {
+	now := helper.GetTimestamp()
+	order.CreatedTime = now
+	order.UpdatedTime = now
+	return DB.Create(order).Error
+}
+
+// SetOrderSession records the checkout session of an order
+func SetOrderSession(id int, sessionId string) error {
+	return DB.Model(&Order{}).Where("id = ?", id).Updates(map[string]any{
+		"session_id":   sessionId,
+		"updated_time": helper.GetTimestamp(),
+	}).Error
+}
+
+func GetOrderByNo(orderNo string) (*Order, error) {
+	if orderNo == "" {
+		return nil, errors.New("order number is empty")
+	}
+	order := Order{}
+	err := DB.Where("order_no = ?", orderNo).First(&order).Error
+	return &order, err
+}
+
+func GetUserOrders(userId int, startIdx int, num int) (orders []*Order, err error) {
+	err = DB.Where("user_id = ?", userId).Order("id desc").Limit(num).Offset(startIdx).Find(&orders).Error
+	return orders, err
+}
+
+// GetAllOrders lists the orders of all users, zero filters are ignored
+func GetAllOrders(userId int, status int, startIdx int, num int) (orders []*Order, err error) {
+	tx := DB.Order("id desc")
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if status != 0 {
+		tx = tx.Where("status = ?", status)
+	}
+	err = tx.Limit(num).Offset(startIdx).Find(&orders).Error
+	return orders, err
+}
+
+// CompleteOrder credits the quota of a paid order, it is idempotent so webhooks delivered twice credit once
+func CompleteOrder(ctx context.Context, orderNo string, paymentId string, amount int64, currency string) error {
+	order, err := GetOrderByNo(orderNo)
+	if err != nil {
+		return err
+	}
+	if order.Amount != amount || !strings.EqualFold(order.Currency, currency) {
+		return fmt.Errorf("paid %d %s doesn't match the %d %s of order %s", amount, currency, order.Amount, order.Currency, orderNo)
+	}
+	credited := false
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		now := helper.GetTimestamp()
+		// a failed order can still be paid late, e.g. after the session expired on our side
+		result := tx.Model(&Order{}).Where("id = ? and status in ?", order.Id, []int{OrderStatusPending, OrderStatusFailed}).Updates(map[string]any{
+			"status":       OrderStatusPaid,
+			"payment_id":   paymentId,
+			"paid_time":    now,
+			"updated_time": now,
+		})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		credited = true
+		return tx.Model(&User{}).Where("id = ?", order.UserId).Update("quota", gorm.Expr("quota + ?", order.Quota)).Error
+	})
+	if err != nil || !credited {
+		return err
+	}
+	RecordTopupLog(ctx, order.UserId, fmt.Sprintf("Top up %s online, order %s", common.LogQuota(order.Quota), order.OrderNo), int(order.Quota))
+	return nil
+}
+
+// FailOrder marks a pending order as failed, paid orders are left untouched
+func FailOrder(orderNo string) error {
+	return DB.Model(&Order{}).Where("order_no = ? and status = ?", orderNo, OrderStatusPending).Updates(map[string]any{
+		"status":       OrderStatusFailed,
+		"updated_time": helper.GetTimestamp(),
+	}).Error
+}
+
+// RefundOrder takes back the quota of a refunded order, the order is found by its number or payment id
+func RefundOrder(ctx context.Context, orderNo string, paymentId string) error {
+	order := Order{}
+	var err error
+	if orderNo != "" {
+		err = DB.Where("order_no = ?", orderNo).First(&order).Error
+	} else if paymentId != "" {
+		err = DB.Where("payment_id = ?", paymentId).First(&order).Error
+	} else {
+		return errors.New("order number and payment id are empty")
+	}
+	if err != nil {
+		return err
+	}
+	refunded := false
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Order{}).Where("id = ? and status = ?", order.Id, OrderStatusPaid).Updates(map[string]any{
+			"status":       OrderStatusRefunded,
+			"updated_time": helper.GetTimestamp(),
+		})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		refunded = true
+		// the quota may become negative if it has been used in the meantime
+		return tx.Model(&User{}).Where("id = ?", order.UserId).Update("quota", gorm.Expr("quota - ?", order.Quota)).Error
+	})
+	if err != nil || !refunded {
+		return err
+	}
+	RecordTopupLog(ctx, order.UserId, fmt.Sprintf("Order %s refunded, %s deducted", order.OrderNo, common.LogQuota(order.Quota)), -int(order.Quota))
+	return nil
+}
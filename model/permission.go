@@ -0,0 +1,205 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// permissions guard the admin operations of the dashboard
+const (
+	PermissionChannelsRead      = "channels:read"
+	PermissionChannelsWrite     = "channels:write"
+	PermissionUsersManage       = "users:manage"
+	PermissionLogsRead          = "logs:read"
+	PermissionLogsDelete        = "logs:delete"
+	PermissionRedemptionsManage = "redemptions:manage"
+	PermissionOptionsWrite      = "options:write"
+	PermissionBillingTopUp      = "billing:topup"
+	PermissionAuditRead         = "audit:read"
+	PermissionBillingStatements = "billing:statements"
+)
+
+var Permissions = []string{
+	PermissionChannelsRead,
+	PermissionChannelsWrite,
+	PermissionUsersManage,
+	PermissionLogsRead,
+	PermissionLogsDelete,
+	PermissionRedemptionsManage,
+	PermissionOptionsWrite,
+	PermissionBillingTopUp,
+	PermissionAuditRead,
+	PermissionBillingStatements,
+}
+
+// rolePermissions are the built-in presets of the legacy roles, root users always have every permission
+var rolePermissions = map[int][]string{
+	RoleCommonUser: {},
+	RoleAdminUser: {
+		PermissionChannelsRead,
+		PermissionChannelsWrite,
+		PermissionUsersManage,
+		PermissionLogsRead,
+		PermissionLogsDelete,
+		PermissionRedemptionsManage,
+		PermissionBillingTopUp,
+		PermissionBillingStatements,
+	},
+	RoleRootUser: Permissions,
+}
+
+// CustomRole is a named group of permissions, it replaces the preset of the user's role
+type CustomRole struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(32);uniqueIndex"`
+	Description string `json:"description" gorm:"type:varchar(255)"`
+	Permissions string `json:"permissions" gorm:"type:text"` // comma-separated
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+}
+
+func splitPermissions(permissions string) []string {
+	res := make([]string, 0)
+	for _, permission := range strings.Split(permissions, ",") {
+		permission = strings.TrimSpace(permission)
+		if permission != "" {
+			res = append(res, permission)
+		}
+	}
+	return res
+}
+
+func ValidatePermissions(permissions string) error {
+	for _, permission := range splitPermissions(permissions) {
+		if !HasPermission(Permissions, permission) {
+			return fmt.Errorf("unknown permission: %s", permission)
+		}
+	}
+	return nil
+}
+
+func HasPermission(permissions []string, permission string) bool {
+	for _, p := range permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func GetAllCustomRoles() ([]*CustomRole, error) {
+	var roles []*CustomRole
+	err := DB.Order("id asc").Find(&roles).Error
+	return roles, err
+}
+
+func GetCustomRoleById(id int) (*CustomRole, error) {
+	if id == 0 {
+		return nil, errors.New("ID is empty")
+	}
+	role := CustomRole{Id: id}
+	err := DB.First(&role, "id = ?", id).Error
+	return &role, err
+}
+
+func (role *CustomRole) Insert() error {
+	role.CreatedTime = helper.GetTimestamp()
+	return DB.Create(role).Error
+}
+
+func (role *CustomRole) Update() error {
+	err := DB.Model(role).Select("name", "description", "permissions").Updates(role).Error
+	if err == nil {
+		invalidateCustomRoleUsers(role.Id)
+	}
+	return err
+}
+
+// Delete removes the role, its users fall back to the preset of their role
+func (role *CustomRole) Delete() error {
+	invalidateCustomRoleUsers(role.Id)
+	err := DB.Model(&User{}).Where("custom_role_id = ?", role.Id).Update("custom_role_id", 0).Error
+	if err != nil {
+		return err
+	}
+	return DB.Delete(role).Error
+}
+
+func invalidateCustomRoleUsers(roleId int) {
+	if !common.RedisEnabled {
+		return
+	}
+	var userIds []int
+	DB.Model(&User{}).Where("custom_role_id = ?", roleId).Pluck("id", &userIds)
+	for _, userId := range userIds {
+		_ = common.RedisDel(fmt.Sprintf("user_permissions:%d", userId))
+	}
+}
+
+// SetUserCustomRole assigns a custom role to the user, 0 restores the preset of the user's role
+func SetUserCustomRole(userId int, roleId int) error {
+	if roleId != 0 {
+		if _, err := GetCustomRoleById(roleId); err != nil {
+			return err
+		}
+	}
+	err := DB.Model(&User{}).Where("id = ?", userId).Update("custom_role_id", roleId).Error
+	if err == nil && common.RedisEnabled {
+		_ = common.RedisDel(fmt.Sprintf("user_permissions:%d", userId))
+	}
+	return err
+}
+
+// GetUserPermissions returns the effective permissions of the user
+func GetUserPermissions(id int) ([]string, error) {
+	var user User
+	err := DB.Model(&User{}).Where("id = ?", id).Select("role", "custom_role_id").First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	if user.Role >= RoleRootUser {
+		return Permissions, nil
+	}
+	if user.CustomRoleId != 0 {
+		role, err := GetCustomRoleById(user.CustomRoleId)
+		if err == nil {
+			return splitPermissions(role.Permissions), nil
+		}
+		logger.SysError(fmt.Sprintf("custom role %d of user %d not found: %s", user.CustomRoleId, id, err.Error()))
+	}
+	permissions, ok := rolePermissions[user.Role]
+	if !ok {
+		return []string{}, nil
+	}
+	return permissions, nil
+}
+
+func CacheGetUserPermissions(id int) (permissions []string, err error) {
+	if !common.RedisEnabled {
+		return GetUserPermissions(id)
+	}
+	permissionsString, err := common.RedisGet(fmt.Sprintf("user_permissions:%d", id))
+	if err == nil {
+		err = json.Unmarshal([]byte(permissionsString), &permissions)
+		return permissions, err
+	}
+	permissions, err = GetUserPermissions(id)
+	if err != nil {
+		return nil, err
+	}
+	jsonBytes, err := json.Marshal(permissions)
+	if err != nil {
+		return nil, err
+	}
+	err = common.RedisSet(fmt.Sprintf("user_permissions:%d", id), string(jsonBytes), time.Duration(UserId2StatusCacheSeconds)*time.Second)
+	if err != nil {
+		logger.SysError("Redis set user permissions error: " + err.Error())
+	}
+	return permissions, nil
+}
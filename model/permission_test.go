@@ -0,0 +1,102 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetUserPermissions(t *testing.T) {
+	setupTestDB(t)
+	role := &CustomRole{Name: "auditor", Permissions: "logs:read, audit:read"}
+	require.NoError(t, role.Insert())
+	users := map[string]*User{
+		"common": {Username: "common", Role: RoleCommonUser},
+		"admin":  {Username: "admin", Role: RoleAdminUser},
+		"root":   {Username: "root", Role: RoleRootUser},
+		// a custom role replaces the preset of the role, it can both grant and revoke
+		"common-auditor": {Username: "common-auditor", Role: RoleCommonUser, CustomRoleId: role.Id},
+		"admin-auditor":  {Username: "admin-auditor", Role: RoleAdminUser, CustomRoleId: role.Id},
+		"root-auditor":   {Username: "root-auditor", Role: RoleRootUser, CustomRoleId: role.Id},
+	}
+	for _, user := range users {
+		user.AccessToken = user.Username
+		user.AffCode = user.Username
+		require.NoError(t, DB.Create(user).Error)
+	}
+
+	cases := []struct {
+		user       string
+		permission string
+		allowed    bool
+	}{
+		{"common", PermissionChannelsRead, false},
+		{"common", PermissionLogsRead, false},
+		{"admin", PermissionChannelsRead, true},
+		{"admin", PermissionChannelsWrite, true},
+		{"admin", PermissionUsersManage, true},
+		{"admin", PermissionLogsDelete, true},
+		{"admin", PermissionRedemptionsManage, true},
+		{"admin", PermissionBillingTopUp, true},
+		{"admin", PermissionBillingStatements, true},
+		{"admin", PermissionOptionsWrite, false},
+		{"admin", PermissionAuditRead, false},
+		{"root", PermissionOptionsWrite, true},
+		{"root", PermissionAuditRead, true},
+		{"common-auditor", PermissionLogsRead, true},
+		{"common-auditor", PermissionAuditRead, true},
+		{"common-auditor", PermissionLogsDelete, false},
+		{"admin-auditor", PermissionAuditRead, true},
+		{"admin-auditor", PermissionChannelsRead, false},
+		{"root-auditor", PermissionOptionsWrite, true},
+	}
+	for _, c := range cases {
+		permissions, err := GetUserPermissions(users[c.user].Id)
+		require.NoError(t, err)
+		assert.Equal(t, c.allowed, HasPermission(permissions, c.permission), "%s %s", c.user, c.permission)
+	}
+
+	// users fall back to the preset of their role when the custom role is gone
+	require.NoError(t, role.Delete())
+	permissions, err := GetUserPermissions(users["admin-auditor"].Id)
+	require.NoError(t, err)
+	assert.Equal(t, rolePermissions[RoleAdminUser], permissions)
+	permissions, err = GetUserPermissions(users["common-auditor"].Id)
+	require.NoError(t, err)
+	assert.Empty(t, permissions)
+
+	_, err = GetUserPermissions(12345)
+	assert.Error(t, err)
+}
+
+func TestSetUserCustomRole(t *testing.T) {
+	setupTestDB(t)
+	user := &User{Username: "user", AccessToken: "user", AffCode: "user", Role: RoleCommonUser}
+	require.NoError(t, DB.Create(user).Error)
+	role := &CustomRole{Name: "channels", Permissions: PermissionChannelsRead}
+	require.NoError(t, role.Insert())
+
+	assert.Error(t, SetUserCustomRole(user.Id, role.Id+1), "the role must exist")
+	require.NoError(t, SetUserCustomRole(user.Id, role.Id))
+	permissions, err := GetUserPermissions(user.Id)
+	require.NoError(t, err)
+	assert.Equal(t, []string{PermissionChannelsRead}, permissions)
+
+	role.Permissions = PermissionChannelsRead + "," + PermissionChannelsWrite
+	require.NoError(t, role.Update())
+	permissions, err = GetUserPermissions(user.Id)
+	require.NoError(t, err)
+	assert.Equal(t, []string{PermissionChannelsRead, PermissionChannelsWrite}, permissions)
+
+	require.NoError(t, SetUserCustomRole(user.Id, 0))
+	permissions, err = GetUserPermissions(user.Id)
+	require.NoError(t, err)
+	assert.Empty(t, permissions)
+}
+
+func TestValidatePermissions(t *testing.T) {
+	assert.NoError(t, ValidatePermissions(""))
+	assert.NoError(t, ValidatePermissions("channels:read, logs:read,"))
+	assert.Error(t, ValidatePermissions("channels:read,channels:delete"))
+}
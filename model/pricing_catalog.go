@@ -0,0 +1,282 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+)
+
+const maxPricingCatalogSize = 10 << 20
+
+// PricingCatalogEntry is the price of a model in a catalog, as ratios or as USD per 1M tokens
+type PricingCatalogEntry struct {
+	ModelRatio      *float64 `json:"model_ratio" yaml:"model_ratio"`
+	CompletionRatio *float64 `json:"completion_ratio" yaml:"completion_ratio"`
+	Input           *float64 `json:"input" yaml:"input"`
+	Output          *float64 `json:"output" yaml:"output"`
+}
+
+// PricingCatalog is the document served by the catalog source, in JSON or YAML
+type PricingCatalog struct {
+	Models map[string]PricingCatalogEntry `json:"models" yaml:"models"`
+}
+
+// pricingCatalogBaseline holds the ratios last applied by the sync,
+// a current ratio differing from it has been overridden by an admin
+type pricingCatalogBaseline struct {
+	ModelRatio      map[string]float64 `json:"model_ratio"`
+	CompletionRatio map[string]float64 `json:"completion_ratio"`
+}
+
+type PricingChange struct {
+	Model string   `json:"model"`
+	Field string   `json:"field"` // model_ratio or completion_ratio
+	Old   *float64 `json:"old"`   // nil for new models
+	New   float64  `json:"new"`
+	// Skipped changes are not applied because the ratio has been overridden
+	Skipped bool `json:"skipped"`
+}
+
+func (c *PricingChange) String() string {
+	old := "none"
+	if c.Old != nil {
+		old = fmt.Sprintf("%g", *c.Old)
+	}
+	return fmt.Sprintf("%s %s %s -> %g", c.Model, c.Field, old, c.New)
+}
+
+// ratios returns the model ratio and completion ratio of the entry, nil when not set
+func (e *PricingCatalogEntry) ratios() (modelRatio *float64, completionRatio *float64) {
+	modelRatio, completionRatio = e.ModelRatio, e.CompletionRatio
+	if modelRatio == nil && e.Input != nil {
+		// 1 === $0.002 / 1K tokens, i.e. $2 / 1M tokens
+		ratio := *e.Input / 2
+		modelRatio = &ratio
+	}
+	if completionRatio == nil && e.Input != nil && e.Output != nil && *e.Input > 0 {
+		ratio := *e.Output / *e.Input
+		completionRatio = &ratio
+	}
+	return modelRatio, completionRatio
+}
+
+func readPricingCatalogSource(ctx context.Context, source string) ([]byte, error) {
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		ctx, cancel := context.WithTimeout(ctx, time.Minute)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.HTTPClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("status code: %d", resp.StatusCode)
+		}
+		return io.ReadAll(io.LimitReader(resp.Body, maxPricingCatalogSize))
+	}
+	file, err := os.Open(strings.TrimPrefix(source, "file://"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(io.LimitReader(file, maxPricingCatalogSize))
+}
+
+// FetchPricingCatalog reads the catalog from an url or a local file, YAML being a superset of JSON both are accepted
+func FetchPricingCatalog(ctx context.Context, source string) (*PricingCatalog, error) {
+	data, err := readPricingCatalogSource(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	catalog := &PricingCatalog{}
+	if err = yaml.Unmarshal(data, catalog); err != nil {
+		return nil, errors.New("the pricing catalog is neither valid JSON nor YAML")
+	}
+	for name, entry := range catalog.Models {
+		modelRatio, completionRatio := entry.ratios()
+		if modelRatio != nil && *modelRatio < 0 || completionRatio != nil && *completionRatio < 0 {
+			return nil, fmt.Errorf("the price of %s in the pricing catalog is negative", name)
+		}
+	}
+	return catalog, nil
+}
+
+func getPricingCatalogBaseline() pricingCatalogBaseline {
+	config.OptionMapRWMutex.RLock()
+	value := config.OptionMap["PricingCatalogBaseline"]
+	config.OptionMapRWMutex.RUnlock()
+	baseline := pricingCatalogBaseline{}
+	if value != "" {
+		if err := json.Unmarshal([]byte(value), &baseline); err != nil {
+			logger.SysError("failed to parse the pricing catalog baseline: " + err.Error())
+		}
+	}
+	// before the first sync, the built-in ratios are the baseline
+	if baseline.ModelRatio == nil {
+		baseline.ModelRatio = billingratio.DefaultModelRatio
+	}
+	if baseline.CompletionRatio == nil {
+		baseline.CompletionRatio = billingratio.DefaultCompletionRatio
+	}
+	return baseline
+}
+
+// diffRatio compares the catalog ratio of a model to the current one, the baseline tells whether it's overridden
+func diffRatio(name string, field string, newRatio *float64, current map[string]float64, baseline map[string]float64) *PricingChange {
+	if newRatio == nil {
+		return nil
+	}
+	currentRatio, ok := current[name]
+	if ok && currentRatio == *newRatio {
+		return nil
+	}
+	change := &PricingChange{Model: name, Field: field, New: *newRatio}
+	if ok {
+		change.Old = &currentRatio
+		baseRatio, synced := baseline[name]
+		change.Skipped = !synced || baseRatio != currentRatio
+	}
+	return change
+}
+
+// SyncPricingCatalog applies the catalog of PricingCatalogSource to the ratios of the models which haven't been
+// overridden by an admin, and returns the changes. With dryRun the changes are only computed.
+func SyncPricingCatalog(ctx context.Context, dryRun bool) ([]*PricingChange, error) {
+	if config.PricingCatalogSource == "" {
+		return nil, errors.New("the pricing catalog source is not set")
+	}
+	catalog, err := FetchPricingCatalog(ctx, config.PricingCatalogSource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the pricing catalog: %w", err)
+	}
+	modelRatio := make(map[string]float64)
+	completionRatio := make(map[string]float64)
+	if err = json.Unmarshal([]byte(billingratio.ModelRatio2JSONString()), &modelRatio); err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal([]byte(billingratio.CompletionRatio2JSONString()), &completionRatio); err != nil {
+		return nil, err
+	}
+	baseline := getPricingCatalogBaseline()
+
+	names := make([]string, 0, len(catalog.Models))
+	for name := range catalog.Models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var changes []*PricingChange
+	for _, name := range names {
+		entry := catalog.Models[name]
+		newModelRatio, newCompletionRatio := entry.ratios()
+		if change := diffRatio(name, "model_ratio", newModelRatio, modelRatio, baseline.ModelRatio); change != nil {
+			changes = append(changes, change)
+			if !change.Skipped {
+				modelRatio[name] = change.New
+			}
+		}
+		if change := diffRatio(name, "completion_ratio", newCompletionRatio, completionRatio, baseline.CompletionRatio); change != nil {
+			changes = append(changes, change)
+			if !change.Skipped {
+				completionRatio[name] = change.New
+			}
+		}
+	}
+	if dryRun {
+		return changes, nil
+	}
+	// the applied ratios become the baseline, the ones of overridden models are kept so they stay overridden
+	newBaseline := pricingCatalogBaseline{
+		ModelRatio:      make(map[string]float64, len(baseline.ModelRatio)),
+		CompletionRatio: make(map[string]float64, len(baseline.CompletionRatio)),
+	}
+	for name, ratio := range baseline.ModelRatio {
+		newBaseline.ModelRatio[name] = ratio
+	}
+	for name, ratio := range baseline.CompletionRatio {
+		newBaseline.CompletionRatio[name] = ratio
+	}
+	applied := 0
+	for _, change := range changes {
+		if change.Skipped {
+			continue
+		}
+		applied++
+		if change.Field == "model_ratio" {
+			newBaseline.ModelRatio[change.Model] = change.New
+		} else {
+			newBaseline.CompletionRatio[change.Model] = change.New
+		}
+	}
+	if applied == 0 {
+		// overridden models are reported by every sync, nothing worth logging
+		return changes, nil
+	}
+	if err = updateRatioOption("ModelRatio", modelRatio); err != nil {
+		return nil, err
+	}
+	if err = updateRatioOption("CompletionRatio", completionRatio); err != nil {
+		return nil, err
+	}
+	baselineJSON, err := json.Marshal(newBaseline)
+	if err != nil {
+		return nil, err
+	}
+	if err = UpdateOption("PricingCatalogBaseline", string(baselineJSON)); err != nil {
+		return nil, err
+	}
+	recordPricingChanges(ctx, changes, applied)
+	return changes, nil
+}
+
+func updateRatioOption(key string, ratio map[string]float64) error {
+	jsonBytes, err := json.Marshal(ratio)
+	if err != nil {
+		return err
+	}
+	return UpdateOption(key, string(jsonBytes))
+}
+
+func recordPricingChanges(ctx context.Context, changes []*PricingChange, applied int) {
+	var lines []string
+	for _, change := range changes {
+		line := change.String()
+		if change.Skipped {
+			line += " (overridden, skipped)"
+		}
+		lines = append(lines, line)
+	}
+	content := fmt.Sprintf("Pricing catalog synced, %d changes applied, %d skipped: %s",
+		applied, len(changes)-applied, strings.Join(lines, "; "))
+	logger.SysLog(content)
+	RecordLog(ctx, 0, LogTypeSystem, content)
+}
+
+// AutomaticallySyncPricingCatalog syncs the pricing catalog when a source is set
+func AutomaticallySyncPricingCatalog(frequency int) {
+	for {
+		if config.PricingCatalogSource != "" {
+			if _, err := SyncPricingCatalog(context.Background(), false); err != nil {
+				logger.SysError("failed to sync the pricing catalog: " + err.Error())
+			}
+		}
+		time.Sleep(time.Duration(frequency) * time.Second)
+	}
+}
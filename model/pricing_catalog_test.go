@@ -0,0 +1,53 @@
+package model
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchPricingCatalog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.yaml")
+	err := os.WriteFile(path, []byte(`
+models:
+  gpt-4o:
+    input: 2.5
+    output: 10
+  deepseek-chat:
+    model_ratio: 0.135
+`), 0o600)
+	assert.NoError(t, err)
+	catalog, err := FetchPricingCatalog(context.Background(), "file://"+path)
+	assert.NoError(t, err)
+	entry := catalog.Models["gpt-4o"]
+	modelRatio, completionRatio := entry.ratios()
+	assert.Equal(t, 1.25, *modelRatio)
+	assert.Equal(t, 4.0, *completionRatio)
+	entry = catalog.Models["deepseek-chat"]
+	modelRatio, completionRatio = entry.ratios()
+	assert.Equal(t, 0.135, *modelRatio)
+	assert.Nil(t, completionRatio)
+}
+
+func TestDiffRatio(t *testing.T) {
+	current := map[string]float64{"a": 1, "b": 2, "c": 3}
+	baseline := map[string]float64{"a": 1, "b": 1}
+	ratio := 5.0
+	assert.Nil(t, diffRatio("a", "model_ratio", nil, current, baseline))
+	change := diffRatio("a", "model_ratio", &ratio, current, baseline)
+	assert.False(t, change.Skipped)
+	assert.Equal(t, 1.0, *change.Old)
+	// overridden by an admin
+	assert.True(t, diffRatio("b", "model_ratio", &ratio, current, baseline).Skipped)
+	// added by an admin
+	assert.True(t, diffRatio("c", "model_ratio", &ratio, current, baseline).Skipped)
+	// new model
+	change = diffRatio("d", "model_ratio", &ratio, current, baseline)
+	assert.False(t, change.Skipped)
+	assert.Nil(t, change.Old)
+	ratio = 3
+	assert.Nil(t, diffRatio("c", "model_ratio", &ratio, current, baseline))
+}
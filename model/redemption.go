@@ -4,8 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/helper"
@@ -18,15 +20,34 @@ const (
 )
 
 type Redemption struct {
+	Id             int    `json:"id"`
+	UserId         int    `json:"user_id"`
+	Key            string `json:"key" gorm:"type:char(32);uniqueIndex"`
+	Status         int    `json:"status" gorm:"default:1"`
+	Name           string `json:"name" gorm:"index"` // codes generated together share the name of their campaign
+	Quota          int64  `json:"quota" gorm:"bigint;default:100"`
+	CreatedTime    int64  `json:"created_time" gorm:"bigint"`
+	RedeemedTime   int64  `json:"redeemed_time" gorm:"bigint"`
+	MaxRedemptions int    `json:"max_redemptions" gorm:"default:1"` // 0 means unlimited
+	RedeemedCount  int    `json:"redeemed_count" gorm:"default:0"`
+	PerUserLimit   int    `json:"per_user_limit" gorm:"default:1"` // 0 means unlimited
+	StartTime      int64  `json:"start_time" gorm:"bigint;default:0"`
+	EndTime        int64  `json:"end_time" gorm:"bigint;default:0"`                   // 0 means never expired
+	NewUserDays    int    `json:"new_user_days" gorm:"default:0"`                     // only users registered within these days can redeem, 0 means all users
+	AllowedGroups  string `json:"allowed_groups" gorm:"type:varchar(255);default:''"` // comma-separated, empty means all groups
+	UpgradeGroup   string `json:"upgrade_group" gorm:"type:varchar(32);default:''"`   // group the user is moved to on redemption
+	Count          int    `json:"count" gorm:"-:all"`                                 // only for api request
+}
+
+// RedemptionRecord is an entry of the redemption history of a code
+type RedemptionRecord struct {
 	Id           int    `json:"id"`
-	UserId       int    `json:"user_id"`
-	Key          string `json:"key" gorm:"type:char(32);uniqueIndex"`
-	Status       int    `json:"status" gorm:"default:1"`
-	Name         string `json:"name" gorm:"index"`
-	Quota        int64  `json:"quota" gorm:"bigint;default:100"`
+	RedemptionId int    `json:"redemption_id" gorm:"index"`
+	UserId       int    `json:"user_id" gorm:"index"`
+	Username     string `json:"username"`
+	Quota        int64  `json:"quota" gorm:"bigint"`
+	Group        string `json:"group" gorm:"type:varchar(32)"` // the group the user was upgraded to, if any
 	CreatedTime  int64  `json:"created_time" gorm:"bigint"`
-	RedeemedTime int64  `json:"redeemed_time" gorm:"bigint"`
-	Count        int    `json:"count" gorm:"-:all"` // only for api request
 }
 
 func GetAllRedemptions(startIdx int, num int) ([]*Redemption, error) {
@@ -51,6 +72,34 @@ func GetRedemptionById(id int) (*Redemption, error) {
 	return &redemption, err
 }
 
+// checkEligibility tells whether the user may redeem the code at the given time
+func (redemption *Redemption) checkEligibility(user *User, now int64) error {
+	if redemption.StartTime != 0 && now < redemption.StartTime {
+		return errors.New("this redemption code is not active yet")
+	}
+	if redemption.EndTime != 0 && now >= redemption.EndTime {
+		return errors.New("this redemption code has expired")
+	}
+	if redemption.NewUserDays > 0 {
+		if user.CreatedTime == 0 || now-user.CreatedTime > int64(redemption.NewUserDays)*secondsPerDay {
+			return errors.New("this redemption code is only available to new users")
+		}
+	}
+	if redemption.AllowedGroups != "" {
+		allowed := false
+		for _, group := range strings.Split(redemption.AllowedGroups, ",") {
+			if strings.TrimSpace(group) == user.Group {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return errors.New("this redemption code isn't available to your group")
+		}
+	}
+	return nil
+}
+
 func Redeem(ctx context.Context, key string, userId int) (quota int64, err error) {
 	if key == "" {
 		return 0, errors.New("redemption code not provided")
@@ -66,33 +115,94 @@ func Redeem(ctx context.Context, key string, userId int) (quota int64, err error
 	}
 
 	err = DB.Transaction(func(tx *gorm.DB) error {
-		err := tx.Set("gorm:query_option", "FOR UPDATE").Where(keyCol+" = ?", key).First(redemption).Error
+		// the row lock serializes the redemptions of a code, sqlite locks the whole database on write instead
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(keyCol+" = ?", key).First(redemption).Error
 		if err != nil {
 			return errors.New("invalid redemption code")
 		}
 		if redemption.Status != RedemptionCodeStatusEnabled {
 			return errors.New("this redemption code has already been used")
 		}
+		now := helper.GetTimestamp()
+		user := &User{}
+		err = tx.Select("id", "username", "group", "created_time").Where("id = ?", userId).First(user).Error
+		if err != nil {
+			return err
+		}
+		if err = redemption.checkEligibility(user, now); err != nil {
+			return err
+		}
+		// the condition keeps concurrent redemptions from exceeding the max redemptions
+		result := tx.Model(&Redemption{}).
+			Where("id = ? and status = ? and (max_redemptions = 0 or redeemed_count < max_redemptions)", redemption.Id, RedemptionCodeStatusEnabled).
+			Updates(map[string]any{
+				"redeemed_count": gorm.Expr("redeemed_count + 1"),
+				"redeemed_time":  now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("this redemption code has already been used")
+		}
+		// counted after the write above, so that a concurrent redemption of the same code has to wait for this one
+		if redemption.PerUserLimit > 0 {
+			var count int64
+			err = tx.Model(&RedemptionRecord{}).Where("redemption_id = ? and user_id = ?", redemption.Id, userId).Count(&count).Error
+			if err != nil {
+				return err
+			}
+			if count >= int64(redemption.PerUserLimit) {
+				return errors.New("you have already redeemed this code")
+			}
+		}
+		err = tx.Model(&Redemption{}).Where("id = ? and max_redemptions > 0 and redeemed_count >= max_redemptions", redemption.Id).
+			Update("status", RedemptionCodeStatusUsed).Error
+		if err != nil {
+			return err
+		}
 		err = tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", redemption.Quota)).Error
 		if err != nil {
 			return err
 		}
-		redemption.RedeemedTime = helper.GetTimestamp()
-		redemption.Status = RedemptionCodeStatusUsed
-		err = tx.Save(redemption).Error
-		return err
+		if redemption.UpgradeGroup != "" && redemption.UpgradeGroup != user.Group {
+			err = tx.Model(&User{}).Where("id = ?", userId).Update("group", redemption.UpgradeGroup).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Create(&RedemptionRecord{
+			RedemptionId: redemption.Id,
+			UserId:       userId,
+			Username:     user.Username,
+			Quota:        redemption.Quota,
+			Group:        redemption.UpgradeGroup,
+			CreatedTime:  now,
+		}).Error
 	})
 	if err != nil {
 		return 0, errors.New("Exchange failed. " + err.Error())
 	}
+	if redemption.UpgradeGroup != "" && common.RedisEnabled {
+		_ = common.RedisDel(fmt.Sprintf("user_group:%d", userId))
+	}
 	RecordLog(ctx, userId, LogTypeTopup, fmt.Sprintf("Redeem %s with a gift code!", common.LogQuota(redemption.Quota)))
+	if redemption.UpgradeGroup != "" {
+		RecordLog(ctx, userId, LogTypeSystem, fmt.Sprintf("Moved to group %s by the redemption code %s", redemption.UpgradeGroup, redemption.Name))
+	}
 	return redemption.Quota, nil
 }
 
 func (redemption *Redemption) Insert() error {
-	var err error
-	err = DB.Create(redemption).Error
-	return err
+	// create replaces zero values by the column defaults, while 0 means unlimited here
+	maxRedemptions, perUserLimit := redemption.MaxRedemptions, redemption.PerUserLimit
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(redemption).Error; err != nil {
+			return err
+		}
+		redemption.MaxRedemptions, redemption.PerUserLimit = maxRedemptions, perUserLimit
+		return tx.Model(redemption).Select("max_redemptions", "per_user_limit").Updates(redemption).Error
+	})
 }
 
 func (redemption *Redemption) SelectUpdate() error {
@@ -103,14 +213,29 @@ func (redemption *Redemption) SelectUpdate() error {
 // Update Make sure your token's fields is completed, because this will update non-zero values
 func (redemption *Redemption) Update() error {
 	var err error
-	err = DB.Model(redemption).Select("name", "status", "quota", "redeemed_time").Updates(redemption).Error
+	err = DB.Model(redemption).Select("name", "status", "quota", "redeemed_time", "max_redemptions", "per_user_limit",
+		"start_time", "end_time", "new_user_days", "allowed_groups", "upgrade_group").Updates(redemption).Error
 	return err
 }
 
 func (redemption *Redemption) Delete() error {
 	var err error
 	err = DB.Delete(redemption).Error
-	return err
+	if err != nil {
+		return err
+	}
+	return DB.Where("redemption_id = ?", redemption.Id).Delete(&RedemptionRecord{}).Error
+}
+
+// GetRedemptionsByName returns the codes of a campaign
+func GetRedemptionsByName(name string) (redemptions []*Redemption, err error) {
+	err = DB.Where("name = ?", name).Order("id").Find(&redemptions).Error
+	return redemptions, err
+}
+
+func GetRedemptionRecords(redemptionId int, startIdx int, num int) (records []*RedemptionRecord, err error) {
+	err = DB.Where("redemption_id = ?", redemptionId).Order("id desc").Limit(num).Offset(startIdx).Find(&records).Error
+	return records, err
 }
 
 func DeleteRedemptionById(id int) (err error) {
@@ -0,0 +1,188 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/random"
+)
+
+func insertTestRedemption(t *testing.T, redemption *Redemption) string {
+	t.Helper()
+	redemption.Key = random.GetUUID()
+	redemption.CreatedTime = helper.GetTimestamp()
+	require.NoError(t, redemption.Insert())
+	return redemption.Key
+}
+
+func insertTestUser(t *testing.T, name string, group string, createdTime int64) *User {
+	t.Helper()
+	user := &User{Username: name, AccessToken: name, AffCode: name, Group: group, Status: UserStatusEnabled, Role: RoleCommonUser, CreatedTime: createdTime}
+	require.NoError(t, DB.Create(user).Error)
+	return user
+}
+
+func getTestUserQuota(t *testing.T, id int) int64 {
+	t.Helper()
+	quota, err := GetUserQuota(id)
+	require.NoError(t, err)
+	return quota
+}
+
+func TestRedemptionCheckEligibility(t *testing.T) {
+	const now = int64(100 * secondsPerDay)
+	user := &User{Group: "default", CreatedTime: now - 2*secondsPerDay}
+	cases := []struct {
+		name       string
+		redemption Redemption
+		user       *User
+		ok         bool
+	}{
+		{"no restriction", Redemption{}, user, true},
+		{"not started", Redemption{StartTime: now + 1}, user, false},
+		{"started", Redemption{StartTime: now}, user, true},
+		{"ended", Redemption{EndTime: now}, user, false},
+		{"before end", Redemption{EndTime: now + 1}, user, true},
+		{"new user", Redemption{NewUserDays: 3}, user, true},
+		{"old user", Redemption{NewUserDays: 1}, user, false},
+		{"unknown registration time", Redemption{NewUserDays: 3}, &User{Group: "default"}, false},
+		{"allowed group", Redemption{AllowedGroups: "vip, default"}, user, true},
+		{"other group", Redemption{AllowedGroups: "vip,svip"}, user, false},
+	}
+	for _, c := range cases {
+		err := c.redemption.checkEligibility(c.user, now)
+		assert.Equal(t, c.ok, err == nil, c.name)
+	}
+}
+
+func TestRedeem(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	now := helper.GetTimestamp()
+	alice := insertTestUser(t, "alice", "default", now)
+	bob := insertTestUser(t, "bob", "default", now)
+	carol := insertTestUser(t, "carol", "default", now)
+
+	_, err := Redeem(ctx, "", alice.Id)
+	assert.Error(t, err)
+	_, err = Redeem(ctx, "unknown", alice.Id)
+	assert.Error(t, err)
+
+	// a single use code
+	key := insertTestRedemption(t, &Redemption{Name: "single", Quota: 100, MaxRedemptions: 1, PerUserLimit: 1})
+	quota, err := Redeem(ctx, key, alice.Id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), quota)
+	assert.Equal(t, int64(100), getTestUserQuota(t, alice.Id))
+	_, err = Redeem(ctx, key, bob.Id)
+	assert.Error(t, err)
+	redemptions, err := GetRedemptionsByName("single")
+	require.NoError(t, err)
+	assert.Equal(t, RedemptionCodeStatusUsed, redemptions[0].Status)
+	assert.Equal(t, 1, redemptions[0].RedeemedCount)
+
+	// a shared code, once per user
+	key = insertTestRedemption(t, &Redemption{Name: "shared", Quota: 10, MaxRedemptions: 2, PerUserLimit: 1})
+	_, err = Redeem(ctx, key, alice.Id)
+	require.NoError(t, err)
+	_, err = Redeem(ctx, key, alice.Id)
+	assert.Error(t, err)
+	_, err = Redeem(ctx, key, bob.Id)
+	require.NoError(t, err)
+	_, err = Redeem(ctx, key, carol.Id)
+	assert.Error(t, err)
+	assert.Equal(t, int64(110), getTestUserQuota(t, alice.Id))
+	assert.Equal(t, int64(10), getTestUserQuota(t, bob.Id))
+	assert.Equal(t, int64(0), getTestUserQuota(t, carol.Id))
+
+	// unlimited redemptions and redemptions per user
+	redemption := &Redemption{Name: "unlimited", Quota: 1, MaxRedemptions: 0, PerUserLimit: 0}
+	key = insertTestRedemption(t, redemption)
+	for i := 0; i < 3; i++ {
+		_, err = Redeem(ctx, key, carol.Id)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int64(3), getTestUserQuota(t, carol.Id))
+	records, err := GetRedemptionRecords(redemption.Id, 0, 10)
+	require.NoError(t, err)
+	assert.Len(t, records, 3)
+	assert.Equal(t, "carol", records[0].Username)
+
+	// disabled and expired codes
+	key = insertTestRedemption(t, &Redemption{Name: "disabled", Quota: 1, Status: RedemptionCodeStatusDisabled})
+	_, err = Redeem(ctx, key, carol.Id)
+	assert.Error(t, err)
+	key = insertTestRedemption(t, &Redemption{Name: "expired", Quota: 1, EndTime: now - 1})
+	_, err = Redeem(ctx, key, carol.Id)
+	assert.Error(t, err)
+	assert.Equal(t, int64(3), getTestUserQuota(t, carol.Id))
+}
+
+func TestRedeemUpgradeGroup(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	now := helper.GetTimestamp()
+	user := insertTestUser(t, "user", "default", now)
+	old := insertTestUser(t, "old", "default", now-30*secondsPerDay)
+
+	key := insertTestRedemption(t, &Redemption{Name: "upgrade", Quota: 5, MaxRedemptions: 0, AllowedGroups: "default", UpgradeGroup: "vip", NewUserDays: 7})
+	_, err := Redeem(ctx, key, old.Id)
+	assert.Error(t, err)
+	_, err = Redeem(ctx, key, user.Id)
+	require.NoError(t, err)
+	group, err := GetUserGroup(user.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "vip", group)
+	var record RedemptionRecord
+	require.NoError(t, DB.Where("user_id = ?", user.Id).First(&record).Error)
+	assert.Equal(t, "vip", record.Group)
+	assert.Equal(t, int64(5), record.Quota)
+
+	// the upgraded user is no longer in the allowed groups
+	another := insertTestRedemption(t, &Redemption{Name: "again", Quota: 5, AllowedGroups: "default", UpgradeGroup: "vip"})
+	_, err = Redeem(ctx, another, user.Id)
+	assert.Error(t, err)
+	assert.Equal(t, int64(5), getTestUserQuota(t, user.Id))
+}
+
+func TestRedeemConcurrently(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	now := helper.GetTimestamp()
+	var users []*User
+	for i := 0; i < 5; i++ {
+		users = append(users, insertTestUser(t, fmt.Sprintf("user%d", i), "default", now))
+	}
+	key := insertTestRedemption(t, &Redemption{Name: "race", Quota: 1, MaxRedemptions: 3, PerUserLimit: 1})
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	succeeded := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(user *User) {
+			defer wg.Done()
+			if _, err := Redeem(ctx, key, user.Id); err == nil {
+				mutex.Lock()
+				succeeded++
+				mutex.Unlock()
+			}
+		}(users[i%len(users)])
+	}
+	wg.Wait()
+
+	assert.Equal(t, 3, succeeded)
+	var total int64
+	for _, user := range users {
+		quota := getTestUserQuota(t, user.Id)
+		assert.LessOrEqual(t, quota, int64(1))
+		total += quota
+	}
+	assert.Equal(t, int64(3), total)
+}
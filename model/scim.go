@@ -0,0 +1,102 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/blacklist"
+)
+
+// GetScimUserName returns the userName of a user as seen by the identity provider
+func (user *User) GetScimUserName() string {
+	if user.ScimUserName != "" {
+		return user.ScimUserName
+	}
+	return user.Username
+}
+
+func scimUserQuery(attribute string, value string) (*gorm.DB, error) {
+	tx := DB.Model(&User{}).Where("status != ?", UserStatusDeleted)
+	switch attribute {
+	case "":
+	case "id":
+		tx = tx.Where("id = ?", value)
+	case "userName":
+		tx = tx.Where("scim_user_name = ? or (scim_user_name = '' and username = ?)", value, value)
+	case "externalId":
+		tx = tx.Where("scim_external_id = ?", value)
+	case "emails", "emails.value":
+		tx = tx.Where("email = ?", value)
+	default:
+		return nil, fmt.Errorf("filtering by %s is not supported", attribute)
+	}
+	return tx, nil
+}
+
+// GetScimUsers lists the users which aren't deleted, optionally filtered by an attribute of the SCIM user schema
+func GetScimUsers(attribute string, value string, startIdx int, num int) (users []*User, total int64, err error) {
+	tx, err := scimUserQuery(attribute, value)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	tx, _ = scimUserQuery(attribute, value)
+	err = tx.Order("id").Limit(num).Offset(startIdx).Omit("password").Find(&users).Error
+	return users, total, err
+}
+
+func GetScimUserById(id int) (*User, error) {
+	if id == 0 {
+		return nil, errors.New("ID is empty")
+	}
+	user := User{}
+	err := DB.Omit("password").Where("id = ? and status != ?", id, UserStatusDeleted).First(&user).Error
+	return &user, err
+}
+
+// IsScimUserNameTaken reports whether another user already has the userName
+func IsScimUserNameTaken(userName string, exceptId int) bool {
+	var count int64
+	DB.Model(&User{}).Where("id != ? and status != ?", exceptId, UserStatusDeleted).
+		Where("scim_user_name = ? or (scim_user_name = '' and username = ?)", userName, userName).Count(&count)
+	return count > 0
+}
+
+// UpdateScimAttributes saves the attributes managed by the identity provider, empty values included
+func (user *User) UpdateScimAttributes() error {
+	if user.Status == UserStatusDisabled {
+		blacklist.BanUser(user.Id)
+	} else if user.Status == UserStatusEnabled {
+		blacklist.UnbanUser(user.Id)
+	}
+	err := DB.Model(user).Select("display_name", "email", "status", "scim_user_name", "scim_external_id").Updates(user).Error
+	if err == nil && common.RedisEnabled {
+		_ = common.RedisDel(fmt.Sprintf("user_enabled:%d", user.Id))
+	}
+	return err
+}
+
+// GetGroupMembers returns the users of a group which aren't deleted
+func GetGroupMembers(group string) (users []*User, err error) {
+	err = DB.Select("id", "username", "scim_user_name").Where(&User{Group: group}).Where("status != ?", UserStatusDeleted).Order("id").Find(&users).Error
+	return users, err
+}
+
+// SetUsersGroup moves users to a group
+func SetUsersGroup(ids []int, group string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	err := DB.Model(&User{}).Where("id in ? and status != ?", ids, UserStatusDeleted).Update("group", group).Error
+	if err == nil && common.RedisEnabled {
+		for _, id := range ids {
+			_ = common.RedisDel(fmt.Sprintf("user_group:%d", id))
+		}
+	}
+	return err
+}
@@ -0,0 +1,179 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/secret"
+)
+
+// secret fields of ChannelConfig
+var channelConfigSecretFields = []string{"sk", "ak", "vertex_ai_adc", "azure_client_secret"}
+
+func isSecretOption(key string) bool {
+	return strings.HasSuffix(key, "Token") || strings.HasSuffix(key, "Secret") || strings.HasSuffix(key, "SecretKey")
+}
+
+// transformChannelConfig applies fn to the secret fields of a channel config, other fields are kept as they are
+func transformChannelConfig(config string, fn func(string) (string, error)) (string, error) {
+	if config == "" {
+		return config, nil
+	}
+	var cfg map[string]any
+	if err := json.Unmarshal([]byte(config), &cfg); err != nil {
+		// not a json config, nothing to do
+		return config, nil
+	}
+	changed := false
+	for _, field := range channelConfigSecretFields {
+		value, ok := cfg[field].(string)
+		if !ok || value == "" {
+			continue
+		}
+		newValue, err := fn(value)
+		if err != nil {
+			return "", fmt.Errorf("config field %s: %w", field, err)
+		}
+		if newValue != value {
+			cfg[field] = newValue
+			changed = true
+		}
+	}
+	if !changed {
+		return config, nil
+	}
+	jsonBytes, err := json.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// sealSecrets encrypts the key and the config secrets of the channel in place
+func (channel *Channel) sealSecrets() error {
+	key, err := secret.Encrypt(channel.Key)
+	if err != nil {
+		return err
+	}
+	cfg, err := transformChannelConfig(channel.Config, secret.Encrypt)
+	if err != nil {
+		return err
+	}
+	channel.Key = key
+	channel.Config = cfg
+	return nil
+}
+
+// openSecrets decrypts the key and the config secrets of the channel in place
+func (channel *Channel) openSecrets() error {
+	key, err := secret.Decrypt(channel.Key)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt key of channel %d: %w", channel.Id, err)
+	}
+	cfg, err := transformChannelConfig(channel.Config, secret.Decrypt)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt config of channel %d: %w", channel.Id, err)
+	}
+	channel.Key = key
+	channel.Config = cfg
+	return nil
+}
+
+func openChannelsSecrets(channels []*Channel) {
+	for _, channel := range channels {
+		if err := channel.openSecrets(); err != nil {
+			logger.SysError(err.Error())
+		}
+	}
+}
+
+func encryptOptionValue(key string, value string) (string, error) {
+	if !isSecretOption(key) {
+		return value, nil
+	}
+	return secret.Encrypt(value)
+}
+
+func decryptOptionValue(key string, value string) (string, error) {
+	if !isSecretOption(key) {
+		return value, nil
+	}
+	return secret.Decrypt(value)
+}
+
+func isSealedWithCurrentKey(value string) bool {
+	return value == "" || secret.IsCurrent(value)
+}
+
+func isChannelSealedWithCurrentKey(channel *Channel) bool {
+	if !isSealedWithCurrentKey(channel.Key) {
+		return false
+	}
+	sealed := true
+	_, _ = transformChannelConfig(channel.Config, func(value string) (string, error) {
+		if !isSealedWithCurrentKey(value) {
+			sealed = false
+		}
+		return value, nil
+	})
+	return sealed
+}
+
+// EncryptSecrets encrypts the channel keys and the secret options stored in plaintext or with an old master key
+func EncryptSecrets() error {
+	if !secret.Enabled() {
+		return fmt.Errorf("no encryption key is configured, please set ENCRYPTION_KEY or ENCRYPTION_KEY_FILE")
+	}
+	var channels []*Channel
+	err := DB.Find(&channels).Error
+	if err != nil {
+		return err
+	}
+	channelCount := 0
+	for _, channel := range channels {
+		if isChannelSealedWithCurrentKey(channel) {
+			continue
+		}
+		if err = channel.openSecrets(); err != nil {
+			return err
+		}
+		if err = channel.sealSecrets(); err != nil {
+			return err
+		}
+		err = DB.Model(&Channel{}).Where("id = ?", channel.Id).Updates(map[string]any{
+			"key":    channel.Key,
+			"config": channel.Config,
+		}).Error
+		if err != nil {
+			return err
+		}
+		channelCount++
+	}
+	options, err := AllOption()
+	if err != nil {
+		return err
+	}
+	optionCount := 0
+	for _, option := range options {
+		if !isSecretOption(option.Key) || isSealedWithCurrentKey(option.Value) {
+			continue
+		}
+		value, err := secret.Decrypt(option.Value)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt option %s: %w", option.Key, err)
+		}
+		value, err = secret.Encrypt(value)
+		if err != nil {
+			return err
+		}
+		err = DB.Model(&Option{Key: option.Key}).Update("value", value).Error
+		if err != nil {
+			return err
+		}
+		optionCount++
+	}
+	logger.SysLogf("encrypted secrets of %d channels and %d options", channelCount, optionCount)
+	return nil
+}
@@ -0,0 +1,219 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"gorm.io/gorm/clause"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/blacklist"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// the last seen time of a session is updated at most once in this interval
+const sessionTouchInterval = 60
+
+// UserSession is a dashboard session, the cookie only holds the session token
+type UserSession struct {
+	Id           string `json:"id" gorm:"type:char(64);primaryKey"` // sha256 of the session token, the token itself is never stored
+	UserId       int    `json:"user_id" gorm:"index"`               // 0 until the session is logged in
+	Data         string `json:"-" gorm:"type:text"`
+	Ip           string `json:"ip" gorm:"type:varchar(64);default:''"`
+	UserAgent    string `json:"user_agent" gorm:"type:varchar(255);default:''"`
+	CreatedTime  int64  `json:"created_time" gorm:"bigint"`
+	LastSeenTime int64  `json:"last_seen_time" gorm:"bigint"`
+	ExpiresTime  int64  `json:"expires_time" gorm:"bigint;index"`
+	Current      bool   `json:"current" gorm:"-:all"`
+}
+
+func HashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func userSessionCacheKey(id string) string {
+	return fmt.Sprintf("user_session:%s", id)
+}
+
+func deleteUserSessionCache(ids ...string) {
+	if !common.RedisEnabled {
+		return
+	}
+	for _, id := range ids {
+		_ = common.RedisDel(userSessionCacheKey(id))
+	}
+}
+
+// GetUserSession returns the session of a token if it hasn't expired or been revoked
+func GetUserSession(token string) (*UserSession, error) {
+	id := HashSessionToken(token)
+	session := UserSession{}
+	if common.RedisEnabled {
+		if value, err := common.RedisGet(userSessionCacheKey(id)); err == nil && json.Unmarshal([]byte(value), &session) == nil {
+			if session.ExpiresTime > helper.GetTimestamp() {
+				return &session, nil
+			}
+		}
+	}
+	err := DB.Where("id = ? and expires_time > ?", id, helper.GetTimestamp()).First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	if common.RedisEnabled {
+		data, _ := json.Marshal(session)
+		_ = common.RedisSet(userSessionCacheKey(id), string(data), time.Duration(TokenCacheSeconds)*time.Second)
+	}
+	return &session, nil
+}
+
+// SaveUserSession stores the data of the session of a token, the session is created if needed
+func SaveUserSession(token string, session *UserSession) error {
+	now := helper.GetTimestamp()
+	session.Id = HashSessionToken(token)
+	if len(session.UserAgent) > 255 {
+		session.UserAgent = session.UserAgent[:255]
+	}
+	result := DB.Model(&UserSession{}).Where("id = ?", session.Id).Updates(map[string]any{
+		"user_id":      session.UserId,
+		"data":         session.Data,
+		"user_agent":   session.UserAgent,
+		"expires_time": session.ExpiresTime,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		session.CreatedTime = now
+		session.LastSeenTime = now
+		if err := DB.Create(session).Error; err != nil {
+			return err
+		}
+	}
+	deleteUserSessionCache(session.Id)
+	return nil
+}
+
+func DeleteUserSession(token string) error {
+	id := HashSessionToken(token)
+	err := DB.Where("id = ?", id).Delete(&UserSession{}).Error
+	deleteUserSessionCache(id)
+	return err
+}
+
+var sessionTouches sync.Map
+
+// TouchUserSession records the address and last seen time of the session of a token
+func TouchUserSession(token string, ip string, force bool) {
+	id := HashSessionToken(token)
+	now := helper.GetTimestamp()
+	if last, ok := sessionTouches.Load(id); ok && !force && now-last.(int64) < sessionTouchInterval {
+		return
+	}
+	sessionTouches.Store(id, now)
+	err := DB.Model(&UserSession{}).Where("id = ?", id).Updates(map[string]any{
+		"ip":             ip,
+		"last_seen_time": now,
+	}).Error
+	if err != nil {
+		logger.SysError("failed to update session: " + err.Error())
+	}
+}
+
+// GetUserSessions returns the active sessions of a user, the most recently used first
+func GetUserSessions(userId int) (sessions []*UserSession, err error) {
+	err = DB.Omit("data").Where("user_id = ? and expires_time > ?", userId, helper.GetTimestamp()).
+		Order("last_seen_time desc").Find(&sessions).Error
+	return sessions, err
+}
+
+// RevokeUserSession logs a session of a user out
+func RevokeUserSession(userId int, id string) error {
+	result := DB.Where("id = ? and user_id = ?", id, userId).Delete(&UserSession{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("session not found")
+	}
+	deleteUserSessionCache(id)
+	return nil
+}
+
+// RevokeUserSessions logs all sessions of a user out, except the one with exceptId
+func RevokeUserSessions(userId int, exceptId string) (int64, error) {
+	var ids []string
+	err := DB.Model(&UserSession{}).Where("user_id = ? and id != ?", userId, exceptId).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	result := DB.Where("id in ?", ids).Delete(&UserSession{})
+	deleteUserSessionCache(ids...)
+	return result.RowsAffected, result.Error
+}
+
+func CleanExpiredUserSessions(frequency int) {
+	for {
+		result := DB.Where("expires_time <= ?", helper.GetTimestamp()).Delete(&UserSession{})
+		if result.Error != nil {
+			logger.SysError("failed to clean expired sessions: " + result.Error.Error())
+		} else if result.RowsAffected > 0 {
+			logger.SysLog(fmt.Sprintf("cleaned %d expired sessions", result.RowsAffected))
+		}
+		sessionTouches.Range(func(key, value any) bool {
+			if helper.GetTimestamp()-value.(int64) > sessionTouchInterval {
+				sessionTouches.Delete(key)
+			}
+			return true
+		})
+		time.Sleep(time.Duration(frequency) * time.Second)
+	}
+}
+
+// BannedUser persists the ban list, see the blacklist package
+type BannedUser struct {
+	UserId      int   `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	CreatedTime int64 `json:"created_time" gorm:"bigint"`
+}
+
+type banStore struct{}
+
+// Ban also logs the user out everywhere, the sessions of banned users must not outlive the ban
+func (banStore) Ban(id int) error {
+	err := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&BannedUser{UserId: id, CreatedTime: helper.GetTimestamp()}).Error
+	if err != nil {
+		return err
+	}
+	_, err = RevokeUserSessions(id, "")
+	return err
+}
+
+func (banStore) Unban(id int) error {
+	return DB.Where("user_id = ?", id).Delete(&BannedUser{}).Error
+}
+
+func (banStore) List() (ids []int, err error) {
+	err = DB.Model(&BannedUser{}).Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+func InitBlacklist() {
+	blacklist.SetStore(banStore{})
+	if err := blacklist.Load(); err != nil {
+		logger.SysError("failed to load the ban list: " + err.Error())
+	}
+}
+
+func SyncBlacklist(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		if err := blacklist.Load(); err != nil {
+			logger.SysError("failed to sync the ban list: " + err.Error())
+		}
+	}
+}
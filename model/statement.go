@@ -0,0 +1,260 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// StatementPeriodLayout is the format of statement periods, statements cover calendar months in the server time zone
+const StatementPeriodLayout = "2006-01"
+
+// Statement summarizes the billing of a user, or of the members of a group, over a month.
+// It is generated once the month is over and never changed afterwards.
+type Statement struct {
+	Id               int     `json:"id"`
+	UserId           int     `json:"user_id" gorm:"uniqueIndex:idx_statement_scope"` // 0 for group statements
+	Username         string  `json:"username"`
+	Group            string  `json:"group" gorm:"type:varchar(32);uniqueIndex:idx_statement_scope;default:''"` // only set for group statements
+	Period           string  `json:"period" gorm:"type:varchar(7);uniqueIndex:idx_statement_scope"`
+	StartTime        int64   `json:"start_time" gorm:"bigint"`
+	EndTime          int64   `json:"end_time" gorm:"bigint"`
+	QuotaPerUnit     float64 `json:"quota_per_unit"` // rate used to convert quota to currency at generation time
+	RequestCount     int64   `json:"request_count" gorm:"bigint"`
+	PromptTokens     int64   `json:"prompt_tokens" gorm:"bigint"`
+	CompletionTokens int64   `json:"completion_tokens" gorm:"bigint"`
+	UsedQuota        int64   `json:"used_quota" gorm:"bigint"`
+	TopUpQuota       int64   `json:"top_up_quota" gorm:"bigint"` // all top-ups, refunds are deducted
+	RedemptionCount  int64   `json:"redemption_count" gorm:"bigint"`
+	RedemptionQuota  int64   `json:"redemption_quota" gorm:"bigint"`
+	Details          string  `json:"-" gorm:"type:text"`
+	CreatedTime      int64   `json:"created_time" gorm:"bigint"`
+
+	Detail *StatementDetail `json:"detail,omitempty" gorm:"-:all"`
+}
+
+type StatementModelUsage struct {
+	ModelName        string `json:"model_name"`
+	RequestCount     int64  `json:"request_count"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	Quota            int64  `json:"quota"`
+}
+
+type StatementPayment struct {
+	Currency string `json:"currency"`
+	Count    int64  `json:"count"`
+	Amount   int64  `json:"amount"` // in the minor unit of the currency
+}
+
+type StatementDetail struct {
+	Models   []StatementModelUsage `json:"models"`
+	Payments []StatementPayment    `json:"payments"`
+}
+
+// QuotaToCurrency converts quota to currency with the rate of the statement
+func (s *Statement) QuotaToCurrency(quota int64) float64 {
+	if s.QuotaPerUnit == 0 {
+		return 0
+	}
+	return float64(quota) / s.QuotaPerUnit
+}
+
+// LoadDetail parses the stored details of the statement
+func (s *Statement) LoadDetail() error {
+	s.Detail = &StatementDetail{}
+	if s.Details == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(s.Details), s.Detail)
+}
+
+// StatementPeriodRange returns the start and end timestamp of a period, the end is excluded
+func StatementPeriodRange(period string) (start int64, end int64, err error) {
+	month, err := time.ParseInLocation(StatementPeriodLayout, period, time.Local)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid period %s, expected yyyy-mm", period)
+	}
+	return month.Unix(), month.AddDate(0, 1, 0).Unix(), nil
+}
+
+// GenerateStatement returns the statement of a user, or of a group when userId is 0, for a finished month.
+// An existing statement is returned as is.
+func GenerateStatement(userId int, group string, period string) (*Statement, error) {
+	if userId != 0 {
+		group = ""
+	} else if group == "" {
+		return nil, errors.New("either a user or a group is required")
+	}
+	start, end, err := StatementPeriodRange(period)
+	if err != nil {
+		return nil, err
+	}
+	if end > helper.GetTimestamp() {
+		return nil, fmt.Errorf("the period %s isn't over yet", period)
+	}
+	existing := &Statement{}
+	err = DB.Where(map[string]any{"user_id": userId, "group": group, "period": period}).First(existing).Error
+	if err == nil {
+		return existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	statement := &Statement{
+		UserId:       userId,
+		Group:        group,
+		Period:       period,
+		StartTime:    start,
+		EndTime:      end,
+		QuotaPerUnit: config.QuotaPerUnit,
+		CreatedTime:  helper.GetTimestamp(),
+	}
+	var userIds []int
+	if userId != 0 {
+		statement.Username = GetUsernameById(userId)
+		userIds = []int{userId}
+	} else {
+		// the members of the group at generation time
+		members, err := GetGroupMembers(group)
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			userIds = append(userIds, member.Id)
+		}
+	}
+	detail := StatementDetail{Models: []StatementModelUsage{}, Payments: []StatementPayment{}}
+	if len(userIds) > 0 {
+		err = LOG_DB.Model(&Log{}).
+			Select("model_name, count(1) as request_count, sum(prompt_tokens) as prompt_tokens, sum(completion_tokens) as completion_tokens, sum(quota) as quota").
+			Where("type = ? and created_at >= ? and created_at < ? and user_id in ?", LogTypeConsume, start, end, userIds).
+			Group("model_name").Order("model_name").
+			Scan(&detail.Models).Error
+		if err != nil {
+			return nil, err
+		}
+		err = LOG_DB.Model(&Log{}).Select("coalesce(sum(quota), 0)").
+			Where("type = ? and created_at >= ? and created_at < ? and user_id in ?", LogTypeTopup, start, end, userIds).
+			Scan(&statement.TopUpQuota).Error
+		if err != nil {
+			return nil, err
+		}
+		err = DB.Model(&RedemptionRecord{}).Select("count(1), coalesce(sum(quota), 0)").
+			Where("created_time >= ? and created_time < ? and user_id in ?", start, end, userIds).
+			Row().Scan(&statement.RedemptionCount, &statement.RedemptionQuota)
+		if err != nil {
+			return nil, err
+		}
+		err = DB.Model(&Order{}).Select("currency, count(1) as count, sum(amount) as amount").
+			Where("status = ? and paid_time >= ? and paid_time < ? and user_id in ?", OrderStatusPaid, start, end, userIds).
+			Group("currency").Order("currency").
+			Scan(&detail.Payments).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, usage := range detail.Models {
+		statement.RequestCount += usage.RequestCount
+		statement.PromptTokens += usage.PromptTokens
+		statement.CompletionTokens += usage.CompletionTokens
+		statement.UsedQuota += usage.Quota
+	}
+	details, err := json.Marshal(detail)
+	if err != nil {
+		return nil, err
+	}
+	statement.Details = string(details)
+	// another node may have generated it concurrently, the unique index keeps the first one
+	err = DB.Clauses(clause.OnConflict{DoNothing: true}).Create(statement).Error
+	if err != nil {
+		return nil, err
+	}
+	if statement.Id == 0 {
+		err = DB.Where(map[string]any{"user_id": userId, "group": group, "period": period}).First(statement).Error
+		return statement, err
+	}
+	statement.Detail = &detail
+	return statement, nil
+}
+
+func GetStatementById(id int) (*Statement, error) {
+	statement := &Statement{}
+	err := DB.First(statement, "id = ?", id).Error
+	return statement, err
+}
+
+// GetStatements lists statements, zero filters are ignored
+func GetStatements(userId int, group string, period string, startIdx int, num int) (statements []*Statement, err error) {
+	tx := DB.Order("period desc, id desc")
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if group != "" {
+		tx = tx.Where(map[string]any{"group": group})
+	}
+	if period != "" {
+		tx = tx.Where("period = ?", period)
+	}
+	err = tx.Limit(num).Offset(startIdx).Find(&statements).Error
+	return statements, err
+}
+
+// generateMonthlyStatements creates the statements of the last month for the users who had any activity
+func generateMonthlyStatements() error {
+	period := time.Now().AddDate(0, 0, -time.Now().Day()).Format(StatementPeriodLayout)
+	start, end, err := StatementPeriodRange(period)
+	if err != nil {
+		return err
+	}
+	var userIds []int
+	err = LOG_DB.Model(&Log{}).Distinct("user_id").
+		Where("type in ? and created_at >= ? and created_at < ?", []int{LogTypeConsume, LogTypeTopup}, start, end).
+		Pluck("user_id", &userIds).Error
+	if err != nil {
+		return err
+	}
+	var generatedIds []int
+	err = DB.Model(&Statement{}).Where("period = ? and user_id != 0", period).Pluck("user_id", &generatedIds).Error
+	if err != nil {
+		return err
+	}
+	generated := make(map[int]bool, len(generatedIds))
+	for _, id := range generatedIds {
+		generated[id] = true
+	}
+	count := 0
+	for _, userId := range userIds {
+		if userId == 0 || generated[userId] {
+			continue
+		}
+		if _, err = GenerateStatement(userId, "", period); err != nil {
+			logger.SysError(fmt.Sprintf("failed to generate the %s statement of user %d: %s", period, userId, err.Error()))
+			continue
+		}
+		count++
+	}
+	if count > 0 {
+		logger.SysLog(fmt.Sprintf("generated %d statements for %s", count, period))
+	}
+	return nil
+}
+
+// AutomaticallyGenerateStatements generates the statements of the last month once it is over
+func AutomaticallyGenerateStatements(frequency int) {
+	for {
+		if err := generateMonthlyStatements(); err != nil {
+			logger.SysError("failed to generate monthly statements: " + err.Error())
+		}
+		time.Sleep(time.Duration(frequency) * time.Second)
+	}
+}
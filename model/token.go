@@ -23,7 +23,9 @@ const (
 type Token struct {
 	Id             int     `json:"id"`
 	UserId         int     `json:"user_id"`
-	Key            string  `json:"key" gorm:"type:char(48);uniqueIndex"`
+	Key            string  `json:"key,omitempty" gorm:"-:all"`                    // only known when the token is created, it is never stored
+	KeyHash        string  `json:"-" gorm:"type:char(64);uniqueIndex"`            // salted hash of the key, see HashTokenKey
+	KeyPrefix      string  `json:"key_prefix" gorm:"type:varchar(16);default:''"` // start of the key to tell tokens apart
 	Status         int     `json:"status" gorm:"default:1"`
 	Name           string  `json:"name" gorm:"index" `
 	CreatedTime    int64   `json:"created_time" gorm:"bigint"`
@@ -34,6 +36,18 @@ type Token struct {
 	UsedQuota      int64   `json:"used_quota" gorm:"bigint;default:0"` // used quota
 	Models         *string `json:"models" gorm:"type:text"`            // allowed models
 	Subnet         *string `json:"subnet" gorm:"default:''"`           // allowed subnet
+	DenySubnet     *string `json:"deny_subnet" gorm:"default:''"`      // denied subnet, takes precedence over subnet
+	Scopes         *string `json:"scopes" gorm:"default:''"`           // allowed endpoint scopes, empty means all
+
+	AudioMaxDuration int   `json:"audio_max_duration" gorm:"default:0"`         // max seconds of uploaded audio, 0 means unlimited
+	AudioMaxFileSize int64 `json:"audio_max_file_size" gorm:"bigint;default:0"` // max bytes of uploaded audio, 0 means unlimited
+
+	PreviousKeyHash        string `json:"-" gorm:"type:char(64);index"`                      // hash of the key replaced by the last rotation
+	PreviousKeyExpiredTime int64  `json:"previous_key_expired_time" gorm:"bigint;default:0"` // the previous key works until then
+	RotatedTime            int64  `json:"rotated_time" gorm:"bigint;default:0"`
+	ExpiryRemindedTime     int64  `json:"-" gorm:"bigint;default:0"` // expired time the owner has been reminded of
+
+	ModelQuotas []*TokenModelQuota `json:"model_quotas,omitempty" gorm:"-:all"` // per-model quota caps
 }
 
 func GetAllUserTokens(userId int, startIdx int, num int, order string) ([]*Token, error) {
@@ -103,6 +117,11 @@ func ValidateUserToken(key string) (token *Token, err error) {
 	return token, nil
 }
 
+// tokenByKeyHashQuery matches the current key of a token and the previous one during its grace period
+func tokenByKeyHashQuery(keyHash string) *gorm.DB {
+	return DB.Where("key_hash = ? or (previous_key_hash = ? and previous_key_expired_time > ?)", keyHash, keyHash, helper.GetTimestamp())
+}
+
 func GetTokenByIds(id int, userId int) (*Token, error) {
 	if id == 0 || userId == 0 {
 		return nil, errors.New("ID or User ID is empty")
@@ -125,6 +144,10 @@ func GetTokenById(id int) (*Token, error) {
 
 func (t *Token) Insert() error {
 	var err error
+	if t.Key != "" {
+		t.KeyHash = HashTokenKey(t.Key)
+		t.KeyPrefix = tokenKeyPrefix(t.Key)
+	}
 	err = DB.Create(t).Error
 	return err
 }
@@ -132,7 +155,7 @@ func (t *Token) Insert() error {
 // Update Make sure your token's fields is completed, because this will update non-zero values
 func (t *Token) Update() error {
 	var err error
-	err = DB.Model(t).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota", "models", "subnet").Updates(t).Error
+	err = DB.Model(t).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota", "models", "subnet", "deny_subnet", "scopes", "audio_max_duration", "audio_max_file_size").Updates(t).Error
 	return err
 }
 
@@ -144,7 +167,10 @@ func (t *Token) SelectUpdate() error {
 func (t *Token) Delete() error {
 	var err error
 	err = DB.Delete(t).Error
-	return err
+	if err != nil {
+		return err
+	}
+	return DeleteTokenModelQuotas(t.Id)
 }
 
 func (t *Token) GetModels() string {
@@ -157,6 +183,18 @@ func (t *Token) GetModels() string {
 	return *t.Models
 }
 
+// GetModelQuotaId returns the id of the model quota cap applying to the model, 0 means no cap
+func (t *Token) GetModelQuotaId(modelName string) int {
+	if t == nil || modelName == "" {
+		return 0
+	}
+	quota := findTokenModelQuota(t.ModelQuotas, modelName)
+	if quota == nil {
+		return 0
+	}
+	return quota.Id
+}
+
 func DeleteTokenById(id int, userId int) (err error) {
 	// Why we need userId here? In case user want to delete other's token.
 	if id == 0 || userId == 0 {
@@ -170,6 +208,25 @@ func DeleteTokenById(id int, userId int) (err error) {
 	return token.Delete()
 }
 
+// DisableUserTokens disables all enabled tokens of a user and drops them from the cache
+func DisableUserTokens(userId int) error {
+	var keyHashes []string
+	err := DB.Model(&Token{}).Where("user_id = ? and status = ?", userId, TokenStatusEnabled).Pluck("key_hash", &keyHashes).Error
+	if err != nil {
+		return err
+	}
+	err = DB.Model(&Token{}).Where("user_id = ? and status = ?", userId, TokenStatusEnabled).Update("status", TokenStatusDisabled).Error
+	if err != nil {
+		return err
+	}
+	if common.RedisEnabled {
+		for _, keyHash := range keyHashes {
+			_ = common.RedisDel(fmt.Sprintf("token:%s", keyHash))
+		}
+	}
+	return nil
+}
+
 func IncreaseTokenQuota(id int, quota int64) (err error) {
 	if quota < 0 {
 		return errors.New("quota cannot be negative")
@@ -0,0 +1,247 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/message"
+	"github.com/songquanpeng/one-api/common/random"
+)
+
+const secondsPerDay = 24 * 60 * 60
+
+// MaxTokenRotationGracePeriod caps how long the old key of a rotated token can stay valid
+const MaxTokenRotationGracePeriod = 7 * secondsPerDay
+
+// IssuedTime returns when the current key of the token was issued
+func (t *Token) IssuedTime() int64 {
+	if t.RotatedTime > t.CreatedTime {
+		return t.RotatedTime
+	}
+	return t.CreatedTime
+}
+
+// ValidateTokenLifetime checks the expired time of a token issued at issuedTime against the max lifetime policy
+func ValidateTokenLifetime(expiredTime int64, issuedTime int64) error {
+	if config.TokenMaxLifetimeDays <= 0 {
+		return nil
+	}
+	if expiredTime == -1 || expiredTime > issuedTime+int64(config.TokenMaxLifetimeDays)*secondsPerDay {
+		return fmt.Errorf("tokens must expire within %d days", config.TokenMaxLifetimeDays)
+	}
+	return nil
+}
+
+// clampTokenLifetime shortens an expired time exceeding the max lifetime policy
+func clampTokenLifetime(expiredTime int64, issuedTime int64) int64 {
+	if config.TokenMaxLifetimeDays <= 0 {
+		return expiredTime
+	}
+	limit := issuedTime + int64(config.TokenMaxLifetimeDays)*secondsPerDay
+	if expiredTime == -1 || expiredTime > limit {
+		return limit
+	}
+	return expiredTime
+}
+
+// Rotate issues a new key with the same settings, the old key keeps working for gracePeriod seconds
+func (t *Token) Rotate(gracePeriod int64) (key string, err error) {
+	if gracePeriod < 0 || gracePeriod > MaxTokenRotationGracePeriod {
+		return "", fmt.Errorf("the grace period must be between 0 and %d seconds", MaxTokenRotationGracePeriod)
+	}
+	now := helper.GetTimestamp()
+	expiredTime := t.ExpiredTime
+	if expiredTime != -1 {
+		// keep the lifetime of the token, counted from now
+		lifetime := expiredTime - t.IssuedTime()
+		if lifetime <= 0 {
+			return "", errors.New("the token has no lifetime left to renew")
+		}
+		expiredTime = now + lifetime
+	}
+	expiredTime = clampTokenLifetime(expiredTime, now)
+	status := t.Status
+	if status == TokenStatusExpired {
+		status = TokenStatusEnabled
+	}
+	previousKeyHash := t.KeyHash
+	previousKeyExpiredTime := now + gracePeriod
+	if gracePeriod == 0 {
+		previousKeyHash = ""
+		previousKeyExpiredTime = 0
+	}
+	key = random.GenerateKey()
+	updates := map[string]any{
+		"key_hash":                  HashTokenKey(key),
+		"key_prefix":                tokenKeyPrefix(key),
+		"previous_key_hash":         previousKeyHash,
+		"previous_key_expired_time": previousKeyExpiredTime,
+		"rotated_time":              now,
+		"expired_time":              expiredTime,
+		"expiry_reminded_time":      0,
+		"status":                    status,
+	}
+	// the key hash condition makes concurrent rotations of the same token fail instead of both succeeding
+	result := DB.Model(&Token{}).Where("id = ? and key_hash = ?", t.Id, t.KeyHash).Updates(updates)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return "", errors.New("the token has been rotated concurrently, please try again")
+	}
+	if common.RedisEnabled {
+		// the cached entry of the old key holds the old settings, it is rebuilt on the next request
+		_ = common.RedisDel(fmt.Sprintf("token:%s", t.KeyHash))
+	}
+	t.KeyHash = HashTokenKey(key)
+	t.KeyPrefix = tokenKeyPrefix(key)
+	t.PreviousKeyHash = previousKeyHash
+	t.PreviousKeyExpiredTime = previousKeyExpiredTime
+	t.RotatedTime = now
+	t.ExpiredTime = expiredTime
+	t.ExpiryRemindedTime = 0
+	t.Status = status
+	t.Key = key
+	return key, nil
+}
+
+// enforceTokenMaxLifetime shortens the tokens exceeding the max lifetime policy,
+// their owners get at least the reminder period to replace them
+func enforceTokenMaxLifetime() error {
+	if config.TokenMaxLifetimeDays <= 0 {
+		return nil
+	}
+	now := helper.GetTimestamp()
+	maxLifetime := int64(config.TokenMaxLifetimeDays) * secondsPerDay
+	var tokens []*Token
+	err := DB.Select("id", "key_hash", "previous_key_hash", "created_time", "rotated_time", "expired_time").
+		Where("status = ?", TokenStatusEnabled).
+		Where("expired_time = -1 or expired_time > created_time + ? and expired_time > rotated_time + ?", maxLifetime, maxLifetime).
+		Find(&tokens).Error
+	if err != nil {
+		return err
+	}
+	notice := now + int64(config.TokenExpiryRemindDays)*secondsPerDay
+	count := 0
+	for _, token := range tokens {
+		expiredTime := clampTokenLifetime(token.ExpiredTime, token.IssuedTime())
+		if expiredTime == token.ExpiredTime {
+			continue
+		}
+		if expiredTime < notice {
+			expiredTime = notice
+		}
+		if token.ExpiredTime != -1 && expiredTime >= token.ExpiredTime {
+			continue
+		}
+		err = DB.Model(&Token{}).Where("id = ?", token.Id).Update("expired_time", expiredTime).Error
+		if err != nil {
+			return err
+		}
+		if common.RedisEnabled {
+			// the cached entries hold the old expired time
+			_ = common.RedisDel(fmt.Sprintf("token:%s", token.KeyHash))
+			if token.PreviousKeyHash != "" {
+				_ = common.RedisDel(fmt.Sprintf("token:%s", token.PreviousKeyHash))
+			}
+		}
+		count++
+	}
+	if count > 0 {
+		logger.SysLog(fmt.Sprintf("shortened the lifetime of %d tokens to %d days", count, config.TokenMaxLifetimeDays))
+	}
+	return nil
+}
+
+// remindExpiringTokens emails the owners of tokens expiring within TokenExpiryRemindDays, once per expired time
+func remindExpiringTokens() error {
+	if config.TokenExpiryRemindDays <= 0 {
+		return nil
+	}
+	now := helper.GetTimestamp()
+	var tokens []*Token
+	err := DB.Select("id", "user_id", "name", "key_prefix", "expired_time").
+		Where("status = ? and expired_time > ? and expired_time <= ?", TokenStatusEnabled, now, now+int64(config.TokenExpiryRemindDays)*secondsPerDay).
+		Where("expiry_reminded_time <> expired_time").
+		Order("user_id, expired_time").
+		Find(&tokens).Error
+	if err != nil {
+		return err
+	}
+	tokensByUser := make(map[int][]*Token)
+	var userIds []int
+	for _, token := range tokens {
+		if _, ok := tokensByUser[token.UserId]; !ok {
+			userIds = append(userIds, token.UserId)
+		}
+		tokensByUser[token.UserId] = append(tokensByUser[token.UserId], token)
+	}
+	for _, userId := range userIds {
+		userTokens := tokensByUser[userId]
+		email, err := GetUserEmail(userId)
+		if err != nil {
+			logger.SysError("failed to fetch user email: " + err.Error())
+			continue
+		}
+		if email != "" {
+			if err = sendTokenExpiryReminder(email, userTokens); err != nil {
+				logger.SysError("failed to send token expiry reminder: " + err.Error())
+				continue
+			}
+		}
+		// users without email are marked too, otherwise they would be checked over and over
+		for _, token := range userTokens {
+			err = DB.Model(&Token{}).Where("id = ?", token.Id).Update("expiry_reminded_time", token.ExpiredTime).Error
+			if err != nil {
+				logger.SysError("failed to mark token expiry reminder: " + err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+func sendTokenExpiryReminder(email string, tokens []*Token) error {
+	subject := "Token Expiry Reminder"
+	var rows strings.Builder
+	for _, token := range tokens {
+		rows.WriteString(fmt.Sprintf(`<li><strong>%s</strong> (%s...) expires at %s</li>`,
+			html.EscapeString(token.Name), html.EscapeString(token.KeyPrefix),
+			time.Unix(token.ExpiredTime, 0).Format("2006-01-02 15:04:05 MST")))
+	}
+	tokenLink := fmt.Sprintf("%s/token", config.ServerAddress)
+	content := message.EmailTemplate(
+		subject,
+		fmt.Sprintf(`
+			<p>Hello!</p>
+			<p>The following tokens of your %s account will expire soon:</p>
+			<ul>%s</ul>
+			<p>Rotate or renew them in time to avoid affecting your use.</p>
+			<p style="text-align: center; margin: 30px 0;">
+				<a href="%s" style="background-color: #007bff; color: white; padding: 12px 24px; text-decoration: none; border-radius: 4px; display: inline-block;">Manage tokens</a>
+			</p>
+			<p style="color: #666;">If the button isn't working, copy and paste this link into your browser:</p>
+			<p style="background-color: #f8f8f8; padding: 10px; border-radius: 4px; word-break: break-all;">%s</p>
+		`, config.SystemName, rows.String(), tokenLink, tokenLink),
+	)
+	return message.SendEmail(subject, email, content)
+}
+
+// AutomaticallyCheckTokenExpiry enforces the max lifetime policy and reminds owners of expiring tokens
+func AutomaticallyCheckTokenExpiry(frequency int) {
+	for {
+		if err := enforceTokenMaxLifetime(); err != nil {
+			logger.SysError("failed to enforce token max lifetime: " + err.Error())
+		}
+		if err := remindExpiringTokens(); err != nil {
+			logger.SysError("failed to remind expiring tokens: " + err.Error())
+		}
+		time.Sleep(time.Duration(frequency) * time.Second)
+	}
+}
@@ -0,0 +1,175 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/random"
+)
+
+func TestValidateTokenLifetime(t *testing.T) {
+	maxLifetimeDays := config.TokenMaxLifetimeDays
+	defer func() { config.TokenMaxLifetimeDays = maxLifetimeDays }()
+
+	config.TokenMaxLifetimeDays = 0
+	assert.NoError(t, ValidateTokenLifetime(-1, 1000))
+
+	config.TokenMaxLifetimeDays = 30
+	assert.Error(t, ValidateTokenLifetime(-1, 1000))
+	assert.NoError(t, ValidateTokenLifetime(1000+30*secondsPerDay, 1000))
+	assert.Error(t, ValidateTokenLifetime(1000+30*secondsPerDay+1, 1000))
+	assert.Equal(t, int64(1000+30*secondsPerDay), clampTokenLifetime(-1, 1000))
+	assert.Equal(t, int64(2000), clampTokenLifetime(2000, 1000))
+}
+
+func insertTestToken(t *testing.T, token *Token) string {
+	t.Helper()
+	key := random.GenerateKey()
+	token.Key = key
+	token.UnlimitedQuota = true
+	if token.Status == 0 {
+		token.Status = TokenStatusEnabled
+	}
+	require.NoError(t, token.Insert())
+	return key
+}
+
+func TestTokenRotate(t *testing.T) {
+	setupTestDB(t)
+	setTestTokenHashSalt(t, []byte("salt"))
+	now := helper.GetTimestamp()
+
+	token := &Token{UserId: 1, Name: "expired", CreatedTime: now - 100, ExpiredTime: now - 10, Status: TokenStatusExpired, ExpiryRemindedTime: now - 10}
+	oldKey := insertTestToken(t, token)
+	stale := *token
+
+	_, err := token.Rotate(-1)
+	assert.Error(t, err)
+	_, err = token.Rotate(MaxTokenRotationGracePeriod + 1)
+	assert.Error(t, err)
+
+	newKey, err := token.Rotate(60)
+	require.NoError(t, err)
+	assert.NotEqual(t, oldKey, newKey)
+	var stored Token
+	require.NoError(t, DB.First(&stored, token.Id).Error)
+	assert.Equal(t, HashTokenKey(newKey), stored.KeyHash)
+	assert.Equal(t, HashTokenKey(oldKey), stored.PreviousKeyHash)
+	assert.InDelta(t, now+60, stored.PreviousKeyExpiredTime, 1)
+	// the expired token is renewed with its original lifetime and reminded again
+	assert.Equal(t, TokenStatusEnabled, stored.Status)
+	assert.InDelta(t, now+90, stored.ExpiredTime, 1)
+	assert.Equal(t, int64(0), stored.ExpiryRemindedTime)
+	for _, key := range []string{oldKey, newKey} {
+		found, err := ValidateUserToken(key)
+		require.NoError(t, err)
+		assert.Equal(t, token.Id, found.Id)
+	}
+
+	// a rotation based on the key before the last rotation fails
+	_, err = stale.Rotate(60)
+	assert.Error(t, err)
+
+	// without grace period the replaced key stops working at once
+	lastKey, err := token.Rotate(0)
+	require.NoError(t, err)
+	_, err = ValidateUserToken(newKey)
+	assert.Error(t, err)
+	_, err = ValidateUserToken(oldKey)
+	assert.Error(t, err)
+	_, err = ValidateUserToken(lastKey)
+	assert.NoError(t, err)
+
+	// a token without lifetime left can't be renewed
+	used := &Token{UserId: 1, Name: "used", CreatedTime: now, ExpiredTime: now, Status: TokenStatusExpired}
+	insertTestToken(t, used)
+	_, err = used.Rotate(60)
+	assert.Error(t, err)
+}
+
+func TestEnforceTokenMaxLifetime(t *testing.T) {
+	setupTestDB(t)
+	setTestTokenHashSalt(t, []byte("salt"))
+	maxLifetimeDays, remindDays := config.TokenMaxLifetimeDays, config.TokenExpiryRemindDays
+	defer func() { config.TokenMaxLifetimeDays, config.TokenExpiryRemindDays = maxLifetimeDays, remindDays }()
+	config.TokenMaxLifetimeDays = 30
+	config.TokenExpiryRemindDays = 7
+	now := helper.GetTimestamp()
+	day := int64(secondsPerDay)
+
+	unlimited := &Token{UserId: 1, CreatedTime: now, ExpiredTime: -1}
+	old := &Token{UserId: 1, CreatedTime: now - 40*day, ExpiredTime: -1}
+	rotated := &Token{UserId: 1, CreatedTime: now - 40*day, RotatedTime: now - day, ExpiredTime: now + 60*day}
+	expiring := &Token{UserId: 1, CreatedTime: now - 40*day, ExpiredTime: now + 2*day}
+	compliant := &Token{UserId: 1, CreatedTime: now, ExpiredTime: now + 10*day}
+	disabled := &Token{UserId: 1, CreatedTime: now, ExpiredTime: -1, Status: TokenStatusDisabled}
+	for _, token := range []*Token{unlimited, old, rotated, expiring, compliant, disabled} {
+		insertTestToken(t, token)
+	}
+
+	require.NoError(t, enforceTokenMaxLifetime())
+	expected := map[*Token]int64{
+		unlimited: now + 30*day,
+		// tokens past the limit get the reminder period to be replaced
+		old:       now + 7*day,
+		rotated:   now + 29*day,
+		expiring:  now + 2*day,
+		compliant: now + 10*day,
+		disabled:  -1,
+	}
+	for token, expiredTime := range expected {
+		var stored Token
+		require.NoError(t, DB.First(&stored, token.Id).Error)
+		// the reminder period is counted from the time of the check
+		assert.InDelta(t, expiredTime, stored.ExpiredTime, 1, "token %d", token.Id)
+	}
+}
+
+func TestRemindExpiringTokens(t *testing.T) {
+	setupTestDB(t)
+	setTestTokenHashSalt(t, []byte("salt"))
+	remindDays := config.TokenExpiryRemindDays
+	defer func() { config.TokenExpiryRemindDays = remindDays }()
+	config.TokenExpiryRemindDays = 7
+	now := helper.GetTimestamp()
+	day := int64(secondsPerDay)
+
+	// the owner has no email, the tokens are marked without sending anything
+	expiring := &Token{UserId: 1, CreatedTime: now, ExpiredTime: now + 2*day}
+	later := &Token{UserId: 1, CreatedTime: now, ExpiredTime: now + 20*day}
+	expired := &Token{UserId: 1, CreatedTime: now - day, ExpiredTime: now - 1}
+	disabled := &Token{UserId: 1, CreatedTime: now, ExpiredTime: now + 2*day, Status: TokenStatusDisabled}
+	for _, token := range []*Token{expiring, later, expired, disabled} {
+		insertTestToken(t, token)
+	}
+
+	require.NoError(t, remindExpiringTokens())
+	expected := map[*Token]int64{
+		expiring: now + 2*day,
+		later:    0,
+		expired:  0,
+		disabled: 0,
+	}
+	for token, remindedTime := range expected {
+		var stored Token
+		require.NoError(t, DB.First(&stored, token.Id).Error)
+		assert.Equal(t, remindedTime, stored.ExpiryRemindedTime, "token %d", token.Id)
+	}
+
+	// a new expired time is reminded again
+	require.NoError(t, DB.Model(&Token{}).Where("id = ?", expiring.Id).Update("expired_time", now+3*day).Error)
+	require.NoError(t, remindExpiringTokens())
+	var stored Token
+	require.NoError(t, DB.First(&stored, expiring.Id).Error)
+	assert.Equal(t, now+3*day, stored.ExpiryRemindedTime)
+
+	config.TokenExpiryRemindDays = 0
+	require.NoError(t, DB.Model(&Token{}).Where("id = ?", expiring.Id).Update("expired_time", now+4*day).Error)
+	require.NoError(t, remindExpiringTokens())
+	require.NoError(t, DB.First(&stored, expiring.Id).Error)
+	assert.Equal(t, now+3*day, stored.ExpiryRemindedTime)
+}
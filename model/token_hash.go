@@ -0,0 +1,108 @@
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"gorm.io/gorm/clause"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// TokenHashSaltOption is the option holding the salt of token key hashes, it is generated once and can't be changed
+const TokenHashSaltOption = "TokenHashSecret"
+
+// length of the key prefix kept to tell tokens apart
+const tokenKeyPrefixLength = 8
+
+var tokenHashSalt []byte
+
+// HashTokenKey returns the salted hash under which a token key is stored
+func HashTokenKey(key string) string {
+	mac := hmac.New(sha256.New, tokenHashSalt)
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func tokenKeyPrefix(key string) string {
+	if len(key) > tokenKeyPrefixLength {
+		return key[:tokenKeyPrefixLength]
+	}
+	return key
+}
+
+// initTokenHashSalt loads the salt shared by all nodes, the first node to start generates it
+func initTokenHashSalt() error {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	value, err := encryptOptionValue(TokenHashSaltOption, hex.EncodeToString(salt))
+	if err != nil {
+		return err
+	}
+	err = DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&Option{Key: TokenHashSaltOption, Value: value}).Error
+	if err != nil {
+		return err
+	}
+	option := Option{}
+	if err = DB.Where(&Option{Key: TokenHashSaltOption}).First(&option).Error; err != nil {
+		return err
+	}
+	value, err = decryptOptionValue(TokenHashSaltOption, option.Value)
+	if err != nil {
+		return err
+	}
+	tokenHashSalt, err = hex.DecodeString(value)
+	return err
+}
+
+// legacyToken reads the plaintext keys stored before keys were hashed
+type legacyToken struct {
+	Id  int
+	Key string
+}
+
+func (legacyToken) TableName() string {
+	return "tokens"
+}
+
+// migrateTokenKeys replaces the plaintext keys of existing tokens by their hash, the keys keep working
+func migrateTokenKeys() error {
+	// HasColumn of sqlite matches "key" in any part of the table definition, such as "PRIMARY KEY"
+	columnTypes, err := DB.Migrator().ColumnTypes(&legacyToken{})
+	if err != nil {
+		return err
+	}
+	hasKeyColumn := false
+	for _, columnType := range columnTypes {
+		if columnType.Name() == "key" {
+			hasKeyColumn = true
+		}
+	}
+	if !hasKeyColumn {
+		return nil
+	}
+	var tokens []legacyToken
+	err = DB.Where("key_hash = '' or key_hash is null").Where(clause.Neq{Column: clause.Column{Name: "key"}, Value: ""}).Find(&tokens).Error
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		err = DB.Model(&legacyToken{}).Where("id = ?", token.Id).Updates(map[string]any{
+			"key_hash":   HashTokenKey(token.Key),
+			"key_prefix": tokenKeyPrefix(token.Key),
+			"key":        nil,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("failed to hash the key of token %d: %w", token.Id, err)
+		}
+	}
+	if len(tokens) > 0 {
+		logger.SysLog(fmt.Sprintf("hashed the keys of %d tokens", len(tokens)))
+	}
+	return nil
+}
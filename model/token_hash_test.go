@@ -0,0 +1,117 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/random"
+)
+
+func setTestTokenHashSalt(t *testing.T, salt []byte) {
+	t.Helper()
+	oldSalt := tokenHashSalt
+	tokenHashSalt = salt
+	t.Cleanup(func() { tokenHashSalt = oldSalt })
+}
+
+func TestHashTokenKey(t *testing.T) {
+	setTestTokenHashSalt(t, []byte("salt"))
+	hash := HashTokenKey("key")
+	assert.Len(t, hash, 64)
+	assert.Equal(t, hash, HashTokenKey("key"))
+	assert.NotEqual(t, hash, HashTokenKey("key2"))
+
+	tokenHashSalt = []byte("other salt")
+	assert.NotEqual(t, hash, HashTokenKey("key"))
+
+	assert.Equal(t, "abcdefgh", tokenKeyPrefix("abcdefghijkl"))
+	assert.Equal(t, "abc", tokenKeyPrefix("abc"))
+}
+
+func TestInitTokenHashSalt(t *testing.T) {
+	setupTestDB(t)
+	setTestTokenHashSalt(t, nil)
+
+	require.NoError(t, initTokenHashSalt())
+	salt := tokenHashSalt
+	assert.Len(t, salt, 32)
+
+	// another node, or a restart, picks up the stored salt instead of its own
+	tokenHashSalt = nil
+	require.NoError(t, initTokenHashSalt())
+	assert.Equal(t, salt, tokenHashSalt)
+
+	var count int64
+	require.NoError(t, DB.Model(&Option{}).Where(&Option{Key: TokenHashSaltOption}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestMigrateTokenKeys(t *testing.T) {
+	setupTestDB(t)
+	setTestTokenHashSalt(t, []byte("salt"))
+
+	// without the legacy column there is nothing to do
+	require.NoError(t, migrateTokenKeys())
+
+	require.NoError(t, DB.Exec("ALTER TABLE tokens ADD COLUMN `key` char(48)").Error)
+	now := helper.GetTimestamp()
+	legacyKey := random.GenerateKey()
+	legacy := Token{UserId: 1, Name: "legacy", Status: TokenStatusEnabled, CreatedTime: now, ExpiredTime: -1, UnlimitedQuota: true}
+	require.NoError(t, legacy.Insert())
+	require.NoError(t, DB.Exec("UPDATE tokens SET `key` = ? WHERE id = ?", legacyKey, legacy.Id).Error)
+	hashedKey := random.GenerateKey()
+	hashed := Token{UserId: 1, Name: "hashed", Key: hashedKey, Status: TokenStatusEnabled, CreatedTime: now, ExpiredTime: -1, UnlimitedQuota: true}
+	require.NoError(t, hashed.Insert())
+
+	require.NoError(t, migrateTokenKeys())
+	var migrated Token
+	require.NoError(t, DB.First(&migrated, legacy.Id).Error)
+	assert.Equal(t, HashTokenKey(legacyKey), migrated.KeyHash)
+	assert.Equal(t, legacyKey[:tokenKeyPrefixLength], migrated.KeyPrefix)
+	var stored *string
+	require.NoError(t, DB.Raw("SELECT `key` FROM tokens WHERE id = ?", legacy.Id).Scan(&stored).Error)
+	assert.Nil(t, stored)
+
+	// the legacy key keeps working, the other token is untouched
+	token, err := ValidateUserToken(legacyKey)
+	require.NoError(t, err)
+	assert.Equal(t, legacy.Id, token.Id)
+	token, err = ValidateUserToken(hashedKey)
+	require.NoError(t, err)
+	assert.Equal(t, hashed.Id, token.Id)
+
+	// running the migration again changes nothing
+	require.NoError(t, migrateTokenKeys())
+	var rerun Token
+	require.NoError(t, DB.First(&rerun, legacy.Id).Error)
+	assert.Equal(t, migrated.KeyHash, rerun.KeyHash)
+	assert.Equal(t, migrated.KeyPrefix, rerun.KeyPrefix)
+}
+
+func TestCacheGetTokenByPreviousKey(t *testing.T) {
+	setupTestDB(t)
+	setTestTokenHashSalt(t, []byte("salt"))
+
+	now := helper.GetTimestamp()
+	oldKey := random.GenerateKey()
+	token := Token{UserId: 1, Name: "rotated", Key: oldKey, Status: TokenStatusEnabled, CreatedTime: now, ExpiredTime: -1, UnlimitedQuota: true}
+	require.NoError(t, token.Insert())
+	newKey, err := token.Rotate(60)
+	require.NoError(t, err)
+
+	for _, key := range []string{oldKey, newKey} {
+		found, err := CacheGetTokenByKey(key)
+		require.NoError(t, err)
+		assert.Equal(t, token.Id, found.Id)
+	}
+
+	// once the grace period is over only the new key works
+	require.NoError(t, DB.Model(&Token{}).Where("id = ?", token.Id).Update("previous_key_expired_time", now-1).Error)
+	_, err = CacheGetTokenByKey(oldKey)
+	assert.Error(t, err)
+	_, err = CacheGetTokenByKey(newKey)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,247 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// TokenModelQuota caps the quota a token can spend on the models matching Model
+type TokenModelQuota struct {
+	Id        int    `json:"id"`
+	TokenId   int    `json:"token_id" gorm:"uniqueIndex:idx_token_model"`
+	Model     string `json:"model" gorm:"type:varchar(128);uniqueIndex:idx_token_model"` // exact model name or glob pattern
+	Quota     int64  `json:"quota" gorm:"bigint;default:0"`
+	UsedQuota int64  `json:"used_quota" gorm:"bigint;default:0"`
+	Remain    int64  `json:"remain_quota" gorm:"-:all"` // only for api response
+}
+
+func (q *TokenModelQuota) RemainQuota() int64 {
+	return q.Quota - q.UsedQuota
+}
+
+// matchModelPattern matches a model name against an exact name or a glob pattern using "*" as wildcard
+func matchModelPattern(pattern string, modelName string) bool {
+	if !strings.Contains(pattern, "*") {
+		return pattern == modelName
+	}
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(modelName, parts[0]) {
+		return false
+	}
+	modelName = modelName[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		idx := strings.Index(modelName, part)
+		if idx < 0 {
+			return false
+		}
+		modelName = modelName[idx+len(part):]
+	}
+	return len(modelName) >= len(last) && strings.HasSuffix(modelName, last)
+}
+
+// IsModelInTokenModels checks a model against a comma-separated token model list.
+// Entries may be glob patterns, entries prefixed with "!" deny the matching models and take precedence.
+// A list that only contains deny rules allows every other model.
+func IsModelInTokenModels(modelName string, models string) bool {
+	hasAllowRule := false
+	allowed := false
+	for _, entry := range strings.Split(models, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.HasPrefix(entry, "!") {
+			if matchModelPattern(strings.TrimPrefix(entry, "!"), modelName) {
+				return false
+			}
+			continue
+		}
+		hasAllowRule = true
+		if matchModelPattern(entry, modelName) {
+			allowed = true
+		}
+	}
+	return allowed || !hasAllowRule
+}
+
+// FilterModelsByTokenModels returns the models a token can use out of the available models,
+// exact entries of the token model list are always kept for backward compatibility
+func FilterModelsByTokenModels(availableModels []string, models string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(models, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "!") || strings.Contains(entry, "*") {
+			continue
+		}
+		if IsModelInTokenModels(entry, models) && !seen[entry] {
+			seen[entry] = true
+			result = append(result, entry)
+		}
+	}
+	for _, modelName := range availableModels {
+		if IsModelInTokenModels(modelName, models) && !seen[modelName] {
+			seen[modelName] = true
+			result = append(result, modelName)
+		}
+	}
+	return result
+}
+
+// findTokenModelQuota prefers an exact match over a pattern match
+func findTokenModelQuota(quotas []*TokenModelQuota, modelName string) *TokenModelQuota {
+	var matched *TokenModelQuota
+	for _, quota := range quotas {
+		if quota.Model == modelName {
+			return quota
+		}
+		if matched == nil && matchModelPattern(quota.Model, modelName) {
+			matched = quota
+		}
+	}
+	return matched
+}
+
+func GetTokenModelQuotas(tokenId int) ([]*TokenModelQuota, error) {
+	var quotas []*TokenModelQuota
+	err := DB.Where("token_id = ?", tokenId).Order("id asc").Find(&quotas).Error
+	for _, quota := range quotas {
+		quota.Remain = quota.RemainQuota()
+	}
+	return quotas, err
+}
+
+// LoadTokenModelQuotas fills the model quotas of the tokens with a single query
+func LoadTokenModelQuotas(tokens []*Token) error {
+	if len(tokens) == 0 {
+		return nil
+	}
+	ids := make([]int, 0, len(tokens))
+	for _, token := range tokens {
+		ids = append(ids, token.Id)
+	}
+	var quotas []*TokenModelQuota
+	err := DB.Where("token_id IN ?", ids).Order("id asc").Find(&quotas).Error
+	if err != nil {
+		return err
+	}
+	tokenId2quotas := make(map[int][]*TokenModelQuota)
+	for _, quota := range quotas {
+		quota.Remain = quota.RemainQuota()
+		tokenId2quotas[quota.TokenId] = append(tokenId2quotas[quota.TokenId], quota)
+	}
+	for _, token := range tokens {
+		token.ModelQuotas = tokenId2quotas[token.Id]
+	}
+	return nil
+}
+
+// UpdateTokenModelQuotas replaces the model quota caps of a token.
+// Existing rows are updated in place, so the used quota and the ids referenced by cached tokens are kept.
+func UpdateTokenModelQuotas(tokenId int, quotas []*TokenModelQuota) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var oldQuotas []*TokenModelQuota
+		err := tx.Where("token_id = ?", tokenId).Find(&oldQuotas).Error
+		if err != nil {
+			return err
+		}
+		model2quota := make(map[string]*TokenModelQuota)
+		for _, quota := range oldQuotas {
+			model2quota[quota.Model] = quota
+		}
+		for _, quota := range quotas {
+			oldQuota, ok := model2quota[quota.Model]
+			if ok {
+				delete(model2quota, quota.Model)
+				err = tx.Model(oldQuota).Update("quota", quota.Quota).Error
+			} else {
+				err = tx.Create(&TokenModelQuota{TokenId: tokenId, Model: quota.Model, Quota: quota.Quota}).Error
+			}
+			if err != nil {
+				return err
+			}
+		}
+		for _, quota := range model2quota {
+			err = tx.Delete(quota).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func ValidateTokenModelQuotas(quotas []*TokenModelQuota) error {
+	seen := make(map[string]bool)
+	for _, quota := range quotas {
+		quota.Model = strings.TrimSpace(quota.Model)
+		if quota.Model == "" {
+			return errors.New("model of model quota is empty")
+		}
+		if len(quota.Model) > 128 {
+			return fmt.Errorf("model of model quota is too long: %s", quota.Model)
+		}
+		if quota.Quota < 0 {
+			return fmt.Errorf("quota of model %s cannot be negative", quota.Model)
+		}
+		if seen[quota.Model] {
+			return fmt.Errorf("duplicated model quota: %s", quota.Model)
+		}
+		seen[quota.Model] = true
+	}
+	return nil
+}
+
+func DeleteTokenModelQuotas(tokenId int) error {
+	return DB.Where("token_id = ?", tokenId).Delete(&TokenModelQuota{}).Error
+}
+
+// PreConsumeTokenModelQuota reserves quota against the model quota cap, id 0 means no cap.
+// the check and the reservation are a single update, so concurrent requests cannot overspend the cap
+func PreConsumeTokenModelQuota(id int, quota int64) error {
+	if id == 0 {
+		return nil
+	}
+	if quota < 0 {
+		return errors.New("quota cannot be negative")
+	}
+	result := DB.Model(&TokenModelQuota{}).
+		Where("id = ? AND quota - used_quota > 0 AND quota - used_quota >= ?", id, quota).
+		Update("used_quota", gorm.Expr("used_quota + ?", quota))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != 0 {
+		return nil
+	}
+	var modelQuota TokenModelQuota
+	err := DB.First(&modelQuota, "id = ?", id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// the cap has been removed in the meantime
+			return nil
+		}
+		return err
+	}
+	// mysql reports no affected rows when the value is unchanged, i.e. for a reservation of 0
+	if quota == 0 && modelQuota.RemainQuota() > 0 {
+		return nil
+	}
+	return fmt.Errorf("token quota for model %s is not enough", modelQuota.Model)
+}
+
+func IncreaseTokenModelUsedQuota(id int, quota int64) {
+	if id == 0 || quota == 0 {
+		return
+	}
+	err := DB.Model(&TokenModelQuota{}).Where("id = ?", id).Update("used_quota", gorm.Expr("used_quota + ?", quota)).Error
+	if err != nil {
+		logger.SysError("failed to update token model used quota: " + err.Error())
+	}
+}
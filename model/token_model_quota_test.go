@@ -0,0 +1,72 @@
+package model
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsModelInTokenModels(t *testing.T) {
+	assert.True(t, IsModelInTokenModels("gpt-4o", "gpt-4o,claude-3"))
+	assert.False(t, IsModelInTokenModels("gpt-4o-mini", "gpt-4o,claude-3"))
+	assert.True(t, IsModelInTokenModels("gpt-4o-mini", "gpt-4o*"))
+	assert.True(t, IsModelInTokenModels("claude-3-5-sonnet", "gpt-4o*,claude-*"))
+	assert.False(t, IsModelInTokenModels("gpt-4o-realtime", "gpt-4o*,!gpt-4o-realtime*"))
+	assert.True(t, IsModelInTokenModels("gpt-3.5-turbo", "!o1*"))
+	assert.False(t, IsModelInTokenModels("o1-mini", "!o1*"))
+	assert.True(t, IsModelInTokenModels("qwen/qwen-2-72b", "qwen/*-72b"))
+}
+
+func TestFindTokenModelQuota(t *testing.T) {
+	quotas := []*TokenModelQuota{
+		{Id: 1, Model: "o1*"},
+		{Id: 2, Model: "o1-mini"},
+	}
+	assert.Equal(t, 2, findTokenModelQuota(quotas, "o1-mini").Id)
+	assert.Equal(t, 1, findTokenModelQuota(quotas, "o1-preview").Id)
+	assert.Nil(t, findTokenModelQuota(quotas, "gpt-4o"))
+}
+
+func TestPreConsumeTokenModelQuota(t *testing.T) {
+	setupTestDB(t)
+	quota := &TokenModelQuota{TokenId: 1, Model: "o1*", Quota: 1000}
+	require.NoError(t, DB.Create(quota).Error)
+
+	assert.NoError(t, PreConsumeTokenModelQuota(0, 1<<40), "id 0 means no cap")
+	assert.NoError(t, PreConsumeTokenModelQuota(quota.Id, 600))
+	assert.Error(t, PreConsumeTokenModelQuota(quota.Id, 600), "the first reservation holds the cap")
+	assert.NoError(t, PreConsumeTokenModelQuota(quota.Id, 0))
+
+	// the actual usage was lower than the reservation
+	IncreaseTokenModelUsedQuota(quota.Id, 400-600)
+	assert.NoError(t, PreConsumeTokenModelQuota(quota.Id, 600))
+	assert.Error(t, PreConsumeTokenModelQuota(quota.Id, 0), "the cap is exhausted")
+
+	require.NoError(t, DB.Delete(quota).Error)
+	assert.NoError(t, PreConsumeTokenModelQuota(quota.Id, 600), "the cap has been removed")
+}
+
+func TestPreConsumeTokenModelQuotaConcurrently(t *testing.T) {
+	setupTestDB(t)
+	quota := &TokenModelQuota{TokenId: 1, Model: "gpt-4o", Quota: 1000}
+	require.NoError(t, DB.Create(quota).Error)
+
+	var wg sync.WaitGroup
+	var reserved atomic.Int64
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if PreConsumeTokenModelQuota(quota.Id, 100) == nil {
+				reserved.Add(100)
+			}
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, DB.First(quota, quota.Id).Error)
+	assert.Equal(t, int64(1000), reserved.Load())
+	assert.Equal(t, int64(1000), quota.UsedQuota)
+}
@@ -0,0 +1,77 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// token scopes limit the endpoints a token can call, a token without scopes can call every endpoint
+const (
+	TokenScopeChat        = "chat"
+	TokenScopeEmbeddings  = "embeddings"
+	TokenScopeModerations = "moderations"
+	TokenScopeImages      = "images"
+	TokenScopeAudio       = "audio"
+	TokenScopeProxy       = "proxy"
+	TokenScopeModels      = "models"  // read-only model list
+	TokenScopeBilling     = "billing" // read-only billing info
+)
+
+var TokenScopes = []string{
+	TokenScopeChat,
+	TokenScopeEmbeddings,
+	TokenScopeModerations,
+	TokenScopeImages,
+	TokenScopeAudio,
+	TokenScopeProxy,
+	TokenScopeModels,
+	TokenScopeBilling,
+}
+
+func splitTokenScopes(scopes string) []string {
+	var res []string
+	for _, scope := range strings.Split(scopes, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope != "" {
+			res = append(res, scope)
+		}
+	}
+	return res
+}
+
+func ValidateTokenScopes(scopes string) error {
+	for _, scope := range splitTokenScopes(scopes) {
+		valid := false
+		for _, tokenScope := range TokenScopes {
+			if scope == tokenScope {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("unknown token scope: %s", scope)
+		}
+	}
+	return nil
+}
+
+// IsScopeInTokenScopes reports whether a comma-separated scope list grants scope, an empty list grants everything
+func IsScopeInTokenScopes(scope string, scopes string) bool {
+	list := splitTokenScopes(scopes)
+	if len(list) == 0 {
+		return true
+	}
+	for _, s := range list {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Token) GetScopes() string {
+	if t == nil || t.Scopes == nil {
+		return ""
+	}
+	return *t.Scopes
+}
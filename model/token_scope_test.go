@@ -0,0 +1,14 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTokenScopes(t *testing.T) {
+	assert.NoError(t, ValidateTokenScopes(""))
+	assert.NoError(t, ValidateTokenScopes("chat, images,"))
+	assert.Error(t, ValidateTokenScopes("chat,admin"))
+	assert.Error(t, ValidateTokenScopes("Chat"))
+}
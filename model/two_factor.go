@@ -0,0 +1,251 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/secret"
+	"github.com/songquanpeng/one-api/common/totp"
+)
+
+const recoveryCodeCount = 10
+
+const (
+	maxTotpFailures = 5       // failed second factor logins before totp login is locked
+	totpLockSeconds = 15 * 60 // how long totp login stays locked
+)
+
+// WebAuthnCredential is a passkey registered by a user as second factor
+type WebAuthnCredential struct {
+	Id           int    `json:"id"`
+	UserId       int    `json:"user_id" gorm:"index"`
+	Name         string `json:"name" gorm:"type:varchar(64)"`
+	CredentialId string `json:"credential_id" gorm:"type:varchar(255);uniqueIndex"` // base64url encoded
+	PublicKey    string `json:"-" gorm:"type:text"`                                 // base64url encoded COSE key
+	SignCount    uint32 `json:"-" gorm:"default:0"`
+	CreatedTime  int64  `json:"created_time" gorm:"bigint"`
+	LastUsedTime int64  `json:"last_used_time" gorm:"bigint"`
+}
+
+func GetUserWebAuthnCredentials(userId int) ([]*WebAuthnCredential, error) {
+	var credentials []*WebAuthnCredential
+	err := DB.Where("user_id = ?", userId).Order("id asc").Find(&credentials).Error
+	return credentials, err
+}
+
+func GetWebAuthnCredential(userId int, credentialId string) (*WebAuthnCredential, error) {
+	var credential WebAuthnCredential
+	err := DB.Where("user_id = ? and credential_id = ?", userId, credentialId).First(&credential).Error
+	return &credential, err
+}
+
+func (credential *WebAuthnCredential) Insert() error {
+	credential.CreatedTime = helper.GetTimestamp()
+	return DB.Create(credential).Error
+}
+
+func UpdateWebAuthnCredentialUsage(id int, signCount uint32) error {
+	return DB.Model(&WebAuthnCredential{}).Where("id = ?", id).Updates(map[string]any{
+		"sign_count":     signCount,
+		"last_used_time": helper.GetTimestamp(),
+	}).Error
+}
+
+func DeleteWebAuthnCredential(id int, userId int) error {
+	result := DB.Where("id = ? and user_id = ?", id, userId).Delete(&WebAuthnCredential{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("credential not found")
+	}
+	return nil
+}
+
+func countWebAuthnCredentials(userId int) int64 {
+	var count int64
+	DB.Model(&WebAuthnCredential{}).Where("user_id = ?", userId).Count(&count)
+	return count
+}
+
+// HasTwoFactor reports whether the user has enabled any second factor
+func (user *User) HasTwoFactor() bool {
+	return user.TotpEnabled || countWebAuthnCredentials(user.Id) > 0
+}
+
+func (user *User) TwoFactorMethods() []string {
+	methods := make([]string, 0)
+	if user.TotpEnabled {
+		methods = append(methods, "totp")
+	}
+	if countWebAuthnCredentials(user.Id) > 0 {
+		methods = append(methods, "webauthn")
+	}
+	if user.RecoveryCodes != "" {
+		methods = append(methods, "recovery_code")
+	}
+	return methods
+}
+
+func (user *User) RecoveryCodesLeft() int {
+	if user.RecoveryCodes == "" {
+		return 0
+	}
+	return len(strings.Split(user.RecoveryCodes, ","))
+}
+
+// SetPendingTotpSecret saves a new secret which only takes effect after it has been verified once
+func SetPendingTotpSecret(userId int, totpSecret string) error {
+	encrypted, err := secret.Encrypt(totpSecret)
+	if err != nil {
+		return err
+	}
+	return DB.Model(&User{}).Where("id = ? and totp_enabled = ?", userId, false).Updates(map[string]any{
+		"totp_secret":    encrypted,
+		"totp_last_step": 0,
+	}).Error
+}
+
+// VerifyTotp checks a code against the totp secret of the user, a code can only be used once
+func (user *User) VerifyTotp(code string) bool {
+	if user.TotpSecret == "" {
+		return false
+	}
+	totpSecret, err := secret.Decrypt(user.TotpSecret)
+	if err != nil {
+		return false
+	}
+	step, ok := totp.Validate(totpSecret, code, time.Now(), user.TotpLastStep)
+	if !ok {
+		return false
+	}
+	// the condition makes concurrent requests with the same code fail
+	result := DB.Model(&User{}).Where("id = ? and totp_last_step < ?", user.Id, step).Update("totp_last_step", step)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+	user.TotpLastStep = step
+	return true
+}
+
+// TotpLocked reports whether totp login is locked after too many failed attempts
+func (user *User) TotpLocked(now int64) bool {
+	return user.TotpLockedUntil > now
+}
+
+// RecordTwoFactorFailure counts a failed second factor login of the user,
+// and locks totp login once there have been too many, it returns whether totp login is locked now
+func RecordTwoFactorFailure(userId int) (bool, error) {
+	err := DB.Model(&User{}).Where("id = ?", userId).Update("totp_failures", gorm.Expr("totp_failures + 1")).Error
+	if err != nil {
+		return false, err
+	}
+	// the condition makes a single one of concurrent failures lock the login
+	result := DB.Model(&User{}).Where("id = ? and totp_failures >= ?", userId, maxTotpFailures).Updates(map[string]any{
+		"totp_failures":     0,
+		"totp_locked_until": helper.GetTimestamp() + totpLockSeconds,
+	})
+	return result.RowsAffected > 0, result.Error
+}
+
+func ResetTwoFactorFailures(userId int) error {
+	return DB.Model(&User{}).Where("id = ? and totp_failures > 0", userId).Update("totp_failures", 0).Error
+}
+
+func EnableTotp(userId int) error {
+	return DB.Model(&User{}).Where("id = ?", userId).Update("totp_enabled", true).Error
+}
+
+func DisableTotp(userId int) error {
+	return DB.Model(&User{}).Where("id = ?", userId).Updates(map[string]any{
+		"totp_secret":    "",
+		"totp_enabled":   false,
+		"totp_last_step": 0,
+	}).Error
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateRecoveryCodes replaces the recovery codes of the user, only the hashes are stored
+func GenerateRecoveryCodes(userId int) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(buf))
+		code = code[:4] + "-" + code[4:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	err := DB.Model(&User{}).Where("id = ?", userId).Update("recovery_codes", strings.Join(hashes, ",")).Error
+	return codes, err
+}
+
+// UseRecoveryCode consumes a recovery code of the user
+func (user *User) UseRecoveryCode(code string) bool {
+	if user.RecoveryCodes == "" || strings.TrimSpace(code) == "" {
+		return false
+	}
+	hash := hashRecoveryCode(code)
+	hashes := strings.Split(user.RecoveryCodes, ",")
+	remaining := make([]string, 0, len(hashes))
+	found := false
+	for _, h := range hashes {
+		if !found && h == hash {
+			found = true
+			continue
+		}
+		remaining = append(remaining, h)
+	}
+	if !found {
+		return false
+	}
+	// the condition makes concurrent requests with the same code fail
+	result := DB.Model(&User{}).Where("id = ? and recovery_codes = ?", user.Id, user.RecoveryCodes).Update("recovery_codes", strings.Join(remaining, ","))
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+	user.RecoveryCodes = strings.Join(remaining, ",")
+	return true
+}
+
+// ClearRecoveryCodesIfUnused removes the recovery codes once the user has no second factor left
+func ClearRecoveryCodesIfUnused(userId int) error {
+	user, err := GetUserById(userId, false)
+	if err != nil {
+		return err
+	}
+	if user.HasTwoFactor() {
+		return nil
+	}
+	return DB.Model(&User{}).Where("id = ?", userId).Update("recovery_codes", "").Error
+}
+
+// ResetTwoFactor removes every second factor of the user, it is used by admins when a user is locked out
+func ResetTwoFactor(userId int) error {
+	err := DB.Where("user_id = ?", userId).Delete(&WebAuthnCredential{}).Error
+	if err != nil {
+		return err
+	}
+	return DB.Model(&User{}).Where("id = ?", userId).Updates(map[string]any{
+		"totp_secret":    "",
+		"totp_enabled":   false,
+		"totp_last_step": 0,
+		"recovery_codes": "",
+	}).Error
+}
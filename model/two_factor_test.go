@@ -0,0 +1,38 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+func TestRecordTwoFactorFailure(t *testing.T) {
+	setupTestDB(t)
+	user := insertTestUser(t, "alice", "default", 0)
+
+	for i := 1; i < maxTotpFailures; i++ {
+		locked, err := RecordTwoFactorFailure(user.Id)
+		require.NoError(t, err)
+		assert.False(t, locked)
+	}
+	// a success starts the count over
+	require.NoError(t, ResetTwoFactorFailures(user.Id))
+	for i := 1; i < maxTotpFailures; i++ {
+		locked, err := RecordTwoFactorFailure(user.Id)
+		require.NoError(t, err)
+		assert.False(t, locked)
+	}
+	locked, err := RecordTwoFactorFailure(user.Id)
+	require.NoError(t, err)
+	assert.True(t, locked)
+
+	now := helper.GetTimestamp()
+	stored, err := GetUserById(user.Id, false)
+	require.NoError(t, err)
+	assert.True(t, stored.TotpLocked(now))
+	assert.False(t, stored.TotpLocked(now+totpLockSeconds+1))
+	assert.Equal(t, 0, stored.TotpFailures)
+}
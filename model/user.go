@@ -32,25 +32,39 @@ const (
 // User if you add sensitive fields, don't forget to clean them in setupLogin function.
 // Otherwise, the sensitive information will be saved on local storage in plain text!
 type User struct {
-	Id               int    `json:"id"`
-	Username         string `json:"username" gorm:"unique;index" validate:"max=12"`
-	Password         string `json:"password" gorm:"not null;" validate:"min=8,max=20"`
-	DisplayName      string `json:"display_name" gorm:"index" validate:"max=20"`
-	Role             int    `json:"role" gorm:"type:int;default:1"`   // admin, util
-	Status           int    `json:"status" gorm:"type:int;default:1"` // enabled, disabled
-	Email            string `json:"email" gorm:"index" validate:"max=50"`
-	GitHubId         string `json:"github_id" gorm:"column:github_id;index"`
-	WeChatId         string `json:"wechat_id" gorm:"column:wechat_id;index"`
-	LarkId           string `json:"lark_id" gorm:"column:lark_id;index"`
-	OidcId           string `json:"oidc_id" gorm:"column:oidc_id;index"`
-	VerificationCode string `json:"verification_code" gorm:"-:all"`                                    // this field is only for Email verification, don't save it to database!
-	AccessToken      string `json:"access_token" gorm:"type:char(32);column:access_token;uniqueIndex"` // this token is for system management
-	Quota            int64  `json:"quota" gorm:"bigint;default:0"`
-	UsedQuota        int64  `json:"used_quota" gorm:"bigint;default:0;column:used_quota"` // used quota
-	RequestCount     int    `json:"request_count" gorm:"type:int;default:0;"`             // request number
-	Group            string `json:"group" gorm:"type:varchar(32);default:'default'"`
-	AffCode          string `json:"aff_code" gorm:"type:varchar(32);column:aff_code;uniqueIndex"`
-	InviterId        int    `json:"inviter_id" gorm:"type:int;column:inviter_id;index"`
+	Id               int      `json:"id"`
+	Username         string   `json:"username" gorm:"unique;index" validate:"max=12"`
+	Password         string   `json:"password" gorm:"not null;" validate:"min=8,max=20"`
+	DisplayName      string   `json:"display_name" gorm:"index" validate:"max=20"`
+	Role             int      `json:"role" gorm:"type:int;default:1"`   // admin, util
+	Status           int      `json:"status" gorm:"type:int;default:1"` // enabled, disabled
+	Email            string   `json:"email" gorm:"index" validate:"max=50"`
+	GitHubId         string   `json:"github_id" gorm:"column:github_id;index"`
+	WeChatId         string   `json:"wechat_id" gorm:"column:wechat_id;index"`
+	LarkId           string   `json:"lark_id" gorm:"column:lark_id;index"`
+	OidcId           string   `json:"oidc_id" gorm:"column:oidc_id;index"`
+	SamlId           string   `json:"saml_id" gorm:"column:saml_id;index"`
+	ScimUserName     string   `json:"scim_user_name" gorm:"column:scim_user_name;index"` // userName of the identity provider, if it provisioned the user
+	ScimExternalId   string   `json:"scim_external_id" gorm:"column:scim_external_id;index"`
+	VerificationCode string   `json:"verification_code" gorm:"-:all"`                                    // this field is only for Email verification, don't save it to database!
+	AccessToken      string   `json:"access_token" gorm:"type:char(32);column:access_token;uniqueIndex"` // this token is for system management
+	Quota            int64    `json:"quota" gorm:"bigint;default:0"`
+	UsedQuota        int64    `json:"used_quota" gorm:"bigint;default:0;column:used_quota"` // used quota
+	RequestCount     int      `json:"request_count" gorm:"type:int;default:0;"`             // request number
+	Group            string   `json:"group" gorm:"type:varchar(32);default:'default'"`
+	AffCode          string   `json:"aff_code" gorm:"type:varchar(32);column:aff_code;uniqueIndex"`
+	InviterId        int      `json:"inviter_id" gorm:"type:int;column:inviter_id;index"`
+	Subnet           *string  `json:"subnet" gorm:"default:''"`      // allowed subnet for dashboard & api access
+	DenySubnet       *string  `json:"deny_subnet" gorm:"default:''"` // denied subnet, takes precedence over subnet
+	TotpSecret       string   `json:"-" gorm:"type:text"`            // encrypted when an encryption key is set
+	TotpEnabled      bool     `json:"-" gorm:"default:false"`
+	TotpLastStep     int64    `json:"-" gorm:"bigint;default:0"` // the last accepted totp step, codes can't be replayed
+	RecoveryCodes    string   `json:"-" gorm:"type:text"`        // comma-separated hashes of the unused recovery codes
+	TotpFailures     int      `json:"-" gorm:"default:0"`        // failed second factor logins since the last lock or success
+	TotpLockedUntil  int64    `json:"-" gorm:"bigint;default:0"` // totp codes aren't accepted on login until then
+	CustomRoleId     int      `json:"custom_role_id" gorm:"type:int;default:0;index"`
+	CreatedTime      int64    `json:"created_time" gorm:"bigint;default:0"` // 0 for users registered before it was recorded
+	Permissions      []string `json:"permissions,omitempty" gorm:"-:all"`   // effective permissions, only filled for the user's own info
 }
 
 func GetMaxUserId() int {
@@ -128,6 +142,7 @@ func (user *User) Insert(ctx context.Context, inviterId int) error {
 	user.Quota = config.QuotaForNewUser
 	user.AccessToken = random.GetUUID()
 	user.AffCode = random.GetRandomString(4)
+	user.CreatedTime = helper.GetTimestamp()
 	result := DB.Create(user)
 	if result.Error != nil {
 		return result.Error
@@ -145,14 +160,15 @@ func (user *User) Insert(ctx context.Context, inviterId int) error {
 			RecordLog(ctx, inviterId, LogTypeSystem, fmt.Sprintf("Invite users to gift %s", common.LogQuota(config.QuotaForInviter)))
 		}
 	}
-	// create default token
+	// create default token, only its hash is stored, the user can rotate it to get a key
+	now := helper.GetTimestamp()
 	cleanToken := Token{
 		UserId:         user.Id,
 		Name:           "default",
 		Key:            random.GenerateKey(),
-		CreatedTime:    helper.GetTimestamp(),
-		AccessedTime:   helper.GetTimestamp(),
-		ExpiredTime:    -1,
+		CreatedTime:    now,
+		AccessedTime:   now,
+		ExpiredTime:    clampTokenLifetime(-1, now),
 		RemainQuota:    -1,
 		UnlimitedQuota: true,
 	}
@@ -177,7 +193,17 @@ func (user *User) Update(updatePassword bool) error {
 	} else if user.Status == UserStatusEnabled {
 		blacklist.UnbanUser(user.Id)
 	}
-	err = DB.Model(user).Updates(user).Error
+	// the second factor and the custom role are only changed through their own functions
+	err = DB.Model(user).Omit("totp_secret", "totp_enabled", "totp_last_step", "recovery_codes", "custom_role_id").Updates(user).Error
+	if err == nil && common.RedisEnabled && (user.Subnet != nil || user.DenySubnet != nil) {
+		_ = common.RedisDel(fmt.Sprintf("user_subnets:%d", user.Id))
+	}
+	if err == nil && common.RedisEnabled && user.Role != 0 {
+		_ = common.RedisDel(fmt.Sprintf("user_permissions:%d", user.Id))
+	}
+	if err == nil && common.RedisEnabled && user.Status != 0 {
+		_ = common.RedisDel(fmt.Sprintf("user_enabled:%d", user.Id))
+	}
 	return err
 }
 
@@ -189,6 +215,9 @@ func (user *User) Delete() error {
 	user.Username = fmt.Sprintf("deleted_%s", random.GetUUID())
 	user.Status = UserStatusDeleted
 	err := DB.Model(user).Updates(user).Error
+	if err == nil && common.RedisEnabled {
+		_ = common.RedisDel(fmt.Sprintf("user_enabled:%d", user.Id))
+	}
 	return err
 }
 
@@ -257,6 +286,14 @@ func (user *User) FillUserByOidcId() error {
 	return nil
 }
 
+func (user *User) FillUserBySamlId() error {
+	if user.SamlId == "" {
+		return errors.New("SAML ID is empty")
+	}
+	DB.Where(User{SamlId: user.SamlId}).First(user)
+	return nil
+}
+
 func (user *User) FillUserByWeChatId() error {
 	if user.WeChatId == "" {
 		return errors.New("weChat ID is empty")
@@ -293,6 +330,10 @@ func IsOidcIdAlreadyTaken(oidcId string) bool {
 	return DB.Where("oidc_id = ?", oidcId).Find(&User{}).RowsAffected == 1
 }
 
+func IsSamlIdAlreadyTaken(samlId string) bool {
+	return DB.Where("saml_id = ?", samlId).Find(&User{}).RowsAffected == 1
+}
+
 func IsUsernameAlreadyTaken(username string) bool {
 	return DB.Where("username = ?", username).Find(&User{}).RowsAffected == 1
 }
@@ -371,6 +412,23 @@ func GetUserGroup(id int) (group string, err error) {
 	return group, err
 }
 
+type UserSubnets struct {
+	Subnet     string `json:"subnet"`
+	DenySubnet string `json:"deny_subnet"`
+}
+
+func GetUserSubnets(id int) (subnets UserSubnets, err error) {
+	var user User
+	err = DB.Model(&User{}).Where("id = ?", id).Select("subnet", "deny_subnet").First(&user).Error
+	if user.Subnet != nil {
+		subnets.Subnet = *user.Subnet
+	}
+	if user.DenySubnet != nil {
+		subnets.DenySubnet = *user.DenySubnet
+	}
+	return subnets, err
+}
+
 func IncreaseUserQuota(id int, quota int64) (err error) {
 	if quota < 0 {
 		return errors.New("quota cannot be negative")
@@ -451,3 +509,16 @@ func GetUsernameById(id int) (username string) {
 	DB.Model(&User{}).Where("id = ?", id).Select("username").Find(&username)
 	return username
 }
+
+// UpdateUserGroupAndRole applies the group and role given by an identity provider
+func UpdateUserGroupAndRole(id int, group string, role int) error {
+	err := DB.Model(&User{}).Where("id = ?", id).Updates(map[string]any{
+		"group": group,
+		"role":  role,
+	}).Error
+	if err == nil && common.RedisEnabled {
+		_ = common.RedisDel(fmt.Sprintf("user_group:%d", id))
+		_ = common.RedisDel(fmt.Sprintf("user_permissions:%d", id))
+	}
+	return err
+}
@@ -0,0 +1,73 @@
+package balance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/songquanpeng/one-api/model"
+)
+
+// Azure OpenAI keys can't read billing data, the balance is the remaining amount of a Cost Management budget
+// read with a service principal holding the Cost Management Reader role on the subscription
+
+var (
+	azureLoginURL      = "https://login.microsoftonline.com"
+	azureManagementURL = "https://management.azure.com"
+)
+
+type azureTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+type azureBudgetResponse struct {
+	Properties struct {
+		Amount       float64 `json:"amount"`
+		CurrentSpend struct {
+			Amount float64 `json:"amount"`
+		} `json:"currentSpend"`
+	} `json:"properties"`
+}
+
+func getAzureAccessToken(ctx context.Context, cfg *model.ChannelConfig) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", cfg.AzureClientId)
+	form.Set("client_secret", cfg.AzureClientSecret)
+	form.Set("scope", azureManagementURL+"/.default")
+	headers := http.Header{}
+	headers.Set("Content-Type", "application/x-www-form-urlencoded")
+	response := azureTokenResponse{}
+	tokenURL := fmt.Sprintf("%s/%s/oauth2/v2.0/token", azureLoginURL, url.PathEscape(cfg.AzureTenantId))
+	err := getJSON(ctx, http.MethodPost, tokenURL, headers, strings.NewReader(form.Encode()), &response)
+	if err != nil {
+		return "", err
+	}
+	if response.AccessToken == "" {
+		return "", fmt.Errorf("%s: %s", response.Error, response.ErrorDescription)
+	}
+	return response.AccessToken, nil
+}
+
+func checkAzureBudget(ctx context.Context, channel *model.Channel, cfg *model.ChannelConfig) (float64, error) {
+	if cfg.AzureTenantId == "" || cfg.AzureClientId == "" || cfg.AzureClientSecret == "" || cfg.AzureBudgetName == "" {
+		return 0, errors.New("azure_tenant_id, azure_client_id, azure_client_secret and azure_budget_name are required")
+	}
+	token, err := getAzureAccessToken(ctx, cfg)
+	if err != nil {
+		return 0, err
+	}
+	budgetURL := fmt.Sprintf("%s/subscriptions/%s/providers/Microsoft.Consumption/budgets/%s?api-version=2023-05-01",
+		azureManagementURL, url.PathEscape(cfg.AzureSubscriptionId), url.PathEscape(cfg.AzureBudgetName))
+	response := azureBudgetResponse{}
+	err = getJSON(ctx, http.MethodGet, budgetURL, bearer(token), nil, &response)
+	if err != nil {
+		return 0, err
+	}
+	return response.Properties.Amount - response.Properties.CurrentSpend.Amount, nil
+}
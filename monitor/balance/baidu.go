@@ -0,0 +1,79 @@
+package balance
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/songquanpeng/one-api/model"
+)
+
+// the keys of Baidu channels only authorize the model apis, the balance is the cash balance of the Baidu Cloud account
+// read from the billing api with an IAM access key pair, set as ak and sk in the channel config
+
+var baiduBillingURL = "https://billing.baidubce.com"
+
+// requests signed with bce-auth-v1 stay valid for this many seconds
+const baiduSignatureExpiration = 1800
+
+type baiduCashBalanceResponse struct {
+	CashBalance *float64 `json:"cashBalance"`
+	Code        string   `json:"code"`
+	Message     string   `json:"message"`
+}
+
+// baiduEncode escapes a string as required by bce-auth-v1, everything but the unreserved characters is escaped
+func baiduEncode(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func hmacSHA256Hex(key string, data string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(data))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signBaiduRequest returns the headers authorizing a request without query with bce-auth-v1, signing its host and date
+func signBaiduRequest(method string, requestURL *url.URL, ak string, sk string, now time.Time) http.Header {
+	timestamp := now.UTC().Format("2006-01-02T15:04:05Z")
+	authPrefix := fmt.Sprintf("bce-auth-v1/%s/%s/%d", ak, timestamp, baiduSignatureExpiration)
+	signingKey := hmacSHA256Hex(sk, authPrefix)
+	segments := strings.Split(requestURL.EscapedPath(), "/")
+	for i, segment := range segments {
+		unescaped, err := url.PathUnescape(segment)
+		if err == nil {
+			segment = unescaped
+		}
+		segments[i] = baiduEncode(segment)
+	}
+	canonicalHeaders := fmt.Sprintf("host:%s\nx-bce-date:%s", baiduEncode(requestURL.Host), baiduEncode(timestamp))
+	canonicalRequest := strings.Join([]string{method, strings.Join(segments, "/"), "", canonicalHeaders}, "\n")
+	headers := http.Header{}
+	headers.Set("Content-Type", "application/json")
+	headers.Set("x-bce-date", timestamp)
+	headers.Set("Authorization", fmt.Sprintf("%s/host;x-bce-date/%s", authPrefix, hmacSHA256Hex(signingKey, canonicalRequest)))
+	return headers
+}
+
+func checkBaiduCash(ctx context.Context, channel *model.Channel, cfg *model.ChannelConfig) (float64, error) {
+	requestURL, err := url.Parse(baiduBillingURL + "/v1/finance/cash/balance")
+	if err != nil {
+		return 0, err
+	}
+	headers := signBaiduRequest(http.MethodPost, requestURL, cfg.AK, cfg.SK, time.Now())
+	response := baiduCashBalanceResponse{}
+	err = getJSON(ctx, http.MethodPost, requestURL.String(), headers, strings.NewReader("{}"), &response)
+	if err != nil {
+		return 0, err
+	}
+	if response.CashBalance == nil {
+		return 0, fmt.Errorf("code: %s, message: %s", response.Code, response.Message)
+	}
+	return *response.CashBalance, nil
+}
@@ -0,0 +1,149 @@
+// Package balance fetches the remaining balance of channel accounts from their providers
+package balance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+)
+
+// Checker returns the balance of the account behind a channel, in the currency reported by the provider
+type Checker interface {
+	Check(ctx context.Context, channel *model.Channel, cfg *model.ChannelConfig) (float64, error)
+}
+
+type CheckerFunc func(ctx context.Context, channel *model.Channel, cfg *model.ChannelConfig) (float64, error)
+
+func (f CheckerFunc) Check(ctx context.Context, channel *model.Channel, cfg *model.ChannelConfig) (float64, error) {
+	return f(ctx, channel, cfg)
+}
+
+var ErrNotSupported = errors.New("the provider of this channel doesn't expose its balance")
+
+// currencies of the balances, the other balances are in units of their provider, such as points
+const (
+	CurrencyUSD = "USD"
+	CurrencyCNY = "CNY"
+)
+
+var checkers = map[int]Checker{}
+
+var currencies = map[int]string{}
+
+// Register sets the checker of a channel type and the currency of its balances, empty for provider units
+func Register(channelType int, currency string, checker Checker) {
+	checkers[channelType] = checker
+	currencies[channelType] = currency
+}
+
+func getChecker(channel *model.Channel, cfg *model.ChannelConfig) Checker {
+	if cfg.BalanceURL != "" {
+		return CheckerFunc(checkCustomEndpoint)
+	}
+	if channel.Type == channeltype.Azure && cfg.AzureSubscriptionId != "" {
+		return CheckerFunc(checkAzureBudget)
+	}
+	if (channel.Type == channeltype.Baidu || channel.Type == channeltype.BaiduV2) && cfg.AK != "" && cfg.SK != "" {
+		return CheckerFunc(checkBaiduCash)
+	}
+	return checkers[channel.Type]
+}
+
+// Currency returns the currency of the balance of a channel, empty if it's in units of the provider
+func Currency(channel *model.Channel) string {
+	cfg, err := channel.LoadConfig()
+	if err != nil {
+		return ""
+	}
+	if cfg.BalanceURL != "" || (channel.Type == channeltype.Azure && cfg.AzureSubscriptionId != "") {
+		if cfg.BalanceCurrency != "" {
+			return strings.ToUpper(cfg.BalanceCurrency)
+		}
+		return CurrencyUSD
+	}
+	if channel.Type == channeltype.Baidu || channel.Type == channeltype.BaiduV2 {
+		return CurrencyCNY
+	}
+	return currencies[channel.Type]
+}
+
+// FromUSD converts an amount in dollars to the currency, false if the currency is unknown
+func FromUSD(amount float64, currency string) (float64, bool) {
+	switch currency {
+	case CurrencyUSD:
+		return amount, true
+	case CurrencyCNY:
+		return amount * ratio.USD2RMB, true
+	}
+	return 0, false
+}
+
+// IsSupported tells whether the balance of the channel can be fetched
+func IsSupported(channel *model.Channel) bool {
+	cfg, err := channel.LoadConfig()
+	if err != nil {
+		return false
+	}
+	return getChecker(channel, &cfg) != nil
+}
+
+// Check fetches the balance of a channel
+func Check(ctx context.Context, channel *model.Channel) (float64, error) {
+	cfg, err := channel.LoadConfig()
+	if err != nil {
+		return 0, err
+	}
+	checker := getChecker(channel, &cfg)
+	if checker == nil {
+		return 0, ErrNotSupported
+	}
+	localChannel := *channel
+	if keys := channel.GetKeys(); len(keys) > 1 {
+		// the keys of a multi-key channel belong to the same account, so the first one is enough
+		localChannel.Key = keys[0]
+	}
+	if localChannel.GetBaseURL() == "" {
+		baseURL := channeltype.ChannelBaseURLs[channel.Type]
+		localChannel.BaseURL = &baseURL
+	}
+	return checker.Check(ctx, &localChannel, &cfg)
+}
+
+func bearer(key string) http.Header {
+	h := http.Header{}
+	h.Set("Authorization", fmt.Sprintf("Bearer %s", key))
+	return h
+}
+
+// getJSON requests a balance endpoint and decodes its response into v
+func getJSON(ctx context.Context, method string, url string, headers http.Header, body io.Reader, v any) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	for k := range headers {
+		req.Header.Set(k, headers.Get(k))
+	}
+	res, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("status code: %d", res.StatusCode)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+func trimBaseURL(channel *model.Channel) string {
+	return strings.TrimSuffix(channel.GetBaseURL(), "/")
+}
@@ -0,0 +1,113 @@
+package balance
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+)
+
+func TestCheck(t *testing.T) {
+	client.Init()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer sk-first", r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/v1/users/me/balance":
+			_, _ = w.Write([]byte(`{"code":0,"status":true,"data":{"available_balance":12.5}}`))
+		case "/custom":
+			_, _ = w.Write([]byte(`{"data":{"accounts":[{"balance":"3.25"}]}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	baseURL := server.URL
+	channel := &model.Channel{Type: channeltype.Moonshot, Key: "sk-first", BaseURL: &baseURL}
+	balance, err := Check(context.Background(), channel)
+	assert.NoError(t, err)
+	assert.Equal(t, 12.5, balance)
+
+	channel = &model.Channel{Type: channeltype.Zhipu, Key: "sk-first", BaseURL: &baseURL}
+	assert.False(t, IsSupported(channel))
+	_, err = Check(context.Background(), channel)
+	assert.ErrorIs(t, err, ErrNotSupported)
+
+	channel.Config = `{"balance_url":"` + server.URL + `/custom","balance_field":"data.accounts.0.balance"}`
+	assert.True(t, IsSupported(channel))
+	balance, err = Check(context.Background(), channel)
+	assert.NoError(t, err)
+	assert.Equal(t, 3.25, balance)
+
+	channel.Config = `{"balance_url":"` + server.URL + `/custom","balance_field":"data.missing"}`
+	_, err = Check(context.Background(), channel)
+	assert.Error(t, err)
+}
+
+func TestCurrency(t *testing.T) {
+	assert.Equal(t, CurrencyUSD, Currency(&model.Channel{Type: channeltype.OpenAI}))
+	assert.Equal(t, CurrencyCNY, Currency(&model.Channel{Type: channeltype.DeepSeek}))
+	assert.Equal(t, CurrencyCNY, Currency(&model.Channel{Type: channeltype.Baidu}))
+	assert.Equal(t, "", Currency(&model.Channel{Type: channeltype.AIProxy}))
+	assert.Equal(t, CurrencyUSD, Currency(&model.Channel{Type: channeltype.Zhipu, Config: `{"balance_url":"http://localhost"}`}))
+	assert.Equal(t, CurrencyCNY, Currency(&model.Channel{Type: channeltype.Zhipu, Config: `{"balance_url":"http://localhost","balance_currency":"cny"}`}))
+
+	amount, ok := FromUSD(10, CurrencyUSD)
+	assert.True(t, ok)
+	assert.Equal(t, 10.0, amount)
+	amount, ok = FromUSD(10, CurrencyCNY)
+	assert.True(t, ok)
+	assert.Equal(t, 70.0, amount)
+	_, ok = FromUSD(10, "")
+	assert.False(t, ok)
+}
+
+func TestCheckBaiduCash(t *testing.T) {
+	client.Init()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/v1/finance/cash/balance", r.URL.Path)
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "bce-auth-v1/ak/"+r.Header.Get("x-bce-date")+"/1800/host;x-bce-date/"))
+		_, _ = w.Write([]byte(`{"cashBalance":8.5}`))
+	}))
+	defer server.Close()
+	billingURL := baiduBillingURL
+	baiduBillingURL = server.URL
+	defer func() { baiduBillingURL = billingURL }()
+
+	// the keys of the channel can't read the balance
+	channel := &model.Channel{Type: channeltype.Baidu, Key: "client_id|client_secret"}
+	assert.False(t, IsSupported(channel))
+
+	channel.Config = `{"ak":"ak","sk":"sk"}`
+	assert.True(t, IsSupported(channel))
+	balance, err := Check(context.Background(), channel)
+	assert.NoError(t, err)
+	assert.Equal(t, 8.5, balance)
+}
+
+func TestSignBaiduRequest(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	requestURL, _ := url.Parse("https://billing.baidubce.com/v1/finance/cash/balance")
+	headers := signBaiduRequest(http.MethodPost, requestURL, "ak", "sk", now)
+	assert.Equal(t, "2024-01-02T03:04:05Z", headers.Get("x-bce-date"))
+
+	authPrefix := "bce-auth-v1/ak/2024-01-02T03:04:05Z/1800"
+	canonicalRequest := "POST\n/v1/finance/cash/balance\n\nhost:billing.baidubce.com\nx-bce-date:2024-01-02T03%3A04%3A05Z"
+	signature := hmacSHA256Hex(hmacSHA256Hex("sk", authPrefix), canonicalRequest)
+	assert.Equal(t, authPrefix+"/host;x-bce-date/"+signature, headers.Get("Authorization"))
+
+	// the signature covers the host and the secret key
+	otherURL, _ := url.Parse("https://other.baidubce.com/v1/finance/cash/balance")
+	assert.NotEqual(t, headers.Get("Authorization"), signBaiduRequest(http.MethodPost, otherURL, "ak", "sk", now).Get("Authorization"))
+	assert.NotEqual(t, headers.Get("Authorization"), signBaiduRequest(http.MethodPost, requestURL, "ak", "sk2", now).Get("Authorization"))
+}
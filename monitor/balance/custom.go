@@ -0,0 +1,51 @@
+package balance
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/songquanpeng/one-api/model"
+)
+
+// checkCustomEndpoint reads the balance from the balance url of the channel config with the key of the channel,
+// for providers like Zhipu whose balance isn't readable with an api key, the url can point to a proxy
+func checkCustomEndpoint(ctx context.Context, channel *model.Channel, cfg *model.ChannelConfig) (float64, error) {
+	var response any
+	err := getJSON(ctx, http.MethodGet, cfg.BalanceURL, bearer(channel.Key), nil, &response)
+	if err != nil {
+		return 0, err
+	}
+	field := cfg.BalanceField
+	if field == "" {
+		field = "balance"
+	}
+	return lookupNumber(response, field)
+}
+
+// lookupNumber returns the number at a dotted path of a decoded json value, array elements are addressed by index
+func lookupNumber(value any, path string) (float64, error) {
+	for _, part := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]any:
+			value = v[part]
+		case []any:
+			index, err := strconv.Atoi(part)
+			if err != nil || index < 0 || index >= len(v) {
+				return 0, fmt.Errorf("invalid index %s of the balance field %s", part, path)
+			}
+			value = v[index]
+		default:
+			return 0, fmt.Errorf("balance field %s not found", path)
+		}
+	}
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, fmt.Errorf("balance field %s isn't a number", path)
+}
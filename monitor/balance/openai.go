@@ -0,0 +1,126 @@
+package balance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+)
+
+// https://github.com/songquanpeng/one-api/issues/79
+
+type openAISubscriptionResponse struct {
+	HasPaymentMethod bool    `json:"has_payment_method"`
+	HardLimitUSD     float64 `json:"hard_limit_usd"`
+}
+
+type openAIUsageResponse struct {
+	TotalUsage float64 `json:"total_usage"` // unit: 0.01 dollar
+}
+
+type openAICreditGrants struct {
+	TotalGranted   float64 `json:"total_granted"`
+	TotalUsed      float64 `json:"total_used"`
+	TotalAvailable float64 `json:"total_available"`
+	TotalRemaining float64 `json:"total_remaining"`
+}
+
+type openAISBUsageResponse struct {
+	Msg  string `json:"msg"`
+	Data *struct {
+		Credit string `json:"credit"`
+	} `json:"data"`
+}
+
+type aiProxyUserOverviewResponse struct {
+	Success   bool   `json:"success"`
+	Message   string `json:"message"`
+	ErrorCode int    `json:"error_code"`
+	Data      struct {
+		TotalPoints float64 `json:"totalPoints"`
+	} `json:"data"`
+}
+
+func init() {
+	// the subscription endpoints are also served by one-api compatible relays
+	Register(channeltype.OpenAI, CurrencyUSD, CheckerFunc(checkOpenAISubscription))
+	Register(channeltype.Custom, CurrencyUSD, CheckerFunc(checkOpenAISubscription))
+	Register(channeltype.CloseAI, CurrencyCNY, creditGrantsChecker(""))
+	Register(channeltype.API2GPT, CurrencyCNY, creditGrantsChecker("https://api.api2gpt.com"))
+	Register(channeltype.AIGC2D, "", creditGrantsChecker("https://api.aigc2d.com"))
+	Register(channeltype.OpenAISB, "", CheckerFunc(checkOpenAISB))
+	Register(channeltype.AIProxy, "", CheckerFunc(checkAIProxy))
+}
+
+func checkOpenAISubscription(ctx context.Context, channel *model.Channel, cfg *model.ChannelConfig) (float64, error) {
+	baseURL := trimBaseURL(channel)
+	subscription := openAISubscriptionResponse{}
+	err := getJSON(ctx, http.MethodGet, baseURL+"/v1/dashboard/billing/subscription", bearer(channel.Key), nil, &subscription)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	startDate := fmt.Sprintf("%s-01", now.Format("2006-01"))
+	endDate := now.Format("2006-01-02")
+	if !subscription.HasPaymentMethod {
+		startDate = now.AddDate(0, 0, -100).Format("2006-01-02")
+	}
+	usage := openAIUsageResponse{}
+	url := fmt.Sprintf("%s/v1/dashboard/billing/usage?start_date=%s&end_date=%s", baseURL, startDate, endDate)
+	err = getJSON(ctx, http.MethodGet, url, bearer(channel.Key), nil, &usage)
+	if err != nil {
+		return 0, err
+	}
+	return subscription.HardLimitUSD - usage.TotalUsage/100, nil
+}
+
+// creditGrantsChecker reads the credit grants endpoint of the base url, or of the channel if it's empty
+func creditGrantsChecker(baseURL string) Checker {
+	return CheckerFunc(func(ctx context.Context, channel *model.Channel, cfg *model.ChannelConfig) (float64, error) {
+		url := baseURL
+		if url == "" {
+			url = trimBaseURL(channel)
+		}
+		response := openAICreditGrants{}
+		err := getJSON(ctx, http.MethodGet, url+"/dashboard/billing/credit_grants", bearer(channel.Key), nil, &response)
+		if err != nil {
+			return 0, err
+		}
+		if response.TotalRemaining != 0 {
+			return response.TotalRemaining, nil
+		}
+		return response.TotalAvailable, nil
+	})
+}
+
+func checkOpenAISB(ctx context.Context, channel *model.Channel, cfg *model.ChannelConfig) (float64, error) {
+	url := fmt.Sprintf("https://api.openai-sb.com/sb-api/user/status?api_key=%s", channel.Key)
+	response := openAISBUsageResponse{}
+	err := getJSON(ctx, http.MethodGet, url, bearer(channel.Key), nil, &response)
+	if err != nil {
+		return 0, err
+	}
+	if response.Data == nil {
+		return 0, errors.New(response.Msg)
+	}
+	return strconv.ParseFloat(response.Data.Credit, 64)
+}
+
+func checkAIProxy(ctx context.Context, channel *model.Channel, cfg *model.ChannelConfig) (float64, error) {
+	headers := http.Header{}
+	headers.Set("Api-Key", channel.Key)
+	response := aiProxyUserOverviewResponse{}
+	err := getJSON(ctx, http.MethodGet, "https://aiproxy.io/api/report/getUserOverview", headers, nil, &response)
+	if err != nil {
+		return 0, err
+	}
+	if !response.Success {
+		return 0, fmt.Errorf("code: %d, message: %s", response.ErrorCode, response.Message)
+	}
+	return response.Data.TotalPoints, nil
+}
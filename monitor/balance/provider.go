@@ -0,0 +1,99 @@
+package balance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+)
+
+type siliconFlowUsageResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		TotalBalance string `json:"totalBalance"`
+	} `json:"data"`
+}
+
+type deepSeekUsageResponse struct {
+	BalanceInfos []struct {
+		Currency     string `json:"currency"`
+		TotalBalance string `json:"total_balance"`
+	} `json:"balance_infos"`
+}
+
+type openRouterResponse struct {
+	Data struct {
+		TotalCredits float64 `json:"total_credits"`
+		TotalUsage   float64 `json:"total_usage"`
+	} `json:"data"`
+}
+
+type moonshotBalanceResponse struct {
+	Code   int    `json:"code"`
+	Status bool   `json:"status"`
+	Scode  string `json:"scode"`
+	Data   struct {
+		AvailableBalance float64 `json:"available_balance"`
+	} `json:"data"`
+}
+
+// Zhipu has no balance api for api keys, its balance can only be read through the balance url of the channel config
+func init() {
+	Register(channeltype.SiliconFlow, CurrencyCNY, CheckerFunc(checkSiliconFlow))
+	Register(channeltype.DeepSeek, CurrencyCNY, CheckerFunc(checkDeepSeek))
+	Register(channeltype.OpenRouter, CurrencyUSD, CheckerFunc(checkOpenRouter))
+	Register(channeltype.Moonshot, CurrencyCNY, CheckerFunc(checkMoonshot))
+}
+
+func checkSiliconFlow(ctx context.Context, channel *model.Channel, cfg *model.ChannelConfig) (float64, error) {
+	response := siliconFlowUsageResponse{}
+	err := getJSON(ctx, http.MethodGet, "https://api.siliconflow.cn/v1/user/info", bearer(channel.Key), nil, &response)
+	if err != nil {
+		return 0, err
+	}
+	if response.Code != 20000 {
+		return 0, fmt.Errorf("code: %d, message: %s", response.Code, response.Message)
+	}
+	return strconv.ParseFloat(response.Data.TotalBalance, 64)
+}
+
+func checkDeepSeek(ctx context.Context, channel *model.Channel, cfg *model.ChannelConfig) (float64, error) {
+	response := deepSeekUsageResponse{}
+	err := getJSON(ctx, http.MethodGet, "https://api.deepseek.com/user/balance", bearer(channel.Key), nil, &response)
+	if err != nil {
+		return 0, err
+	}
+	for _, balanceInfo := range response.BalanceInfos {
+		if balanceInfo.Currency == "CNY" {
+			return strconv.ParseFloat(balanceInfo.TotalBalance, 64)
+		}
+	}
+	return 0, errors.New("currency CNY not found")
+}
+
+func checkOpenRouter(ctx context.Context, channel *model.Channel, cfg *model.ChannelConfig) (float64, error) {
+	response := openRouterResponse{}
+	err := getJSON(ctx, http.MethodGet, "https://openrouter.ai/api/v1/credits", bearer(channel.Key), nil, &response)
+	if err != nil {
+		return 0, err
+	}
+	return response.Data.TotalCredits - response.Data.TotalUsage, nil
+}
+
+// https://platform.moonshot.cn/docs/api/balance
+func checkMoonshot(ctx context.Context, channel *model.Channel, cfg *model.ChannelConfig) (float64, error) {
+	response := moonshotBalanceResponse{}
+	err := getJSON(ctx, http.MethodGet, trimBaseURL(channel)+"/v1/users/me/balance", bearer(channel.Key), nil, &response)
+	if err != nil {
+		return 0, err
+	}
+	if response.Code != 0 || !response.Status {
+		return 0, fmt.Errorf("code: %d, scode: %s", response.Code, response.Scode)
+	}
+	return response.Data.AvailableBalance, nil
+}
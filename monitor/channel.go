@@ -2,11 +2,13 @@ package monitor
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/common/message"
 	"github.com/songquanpeng/one-api/model"
+	balancechecker "github.com/songquanpeng/one-api/monitor/balance"
 )
 
 func notifyRootUser(subject string, content string) {
@@ -44,6 +46,32 @@ func DisableChannel(channelId int, channelName string, reason string) {
 	notifyRootUser(subject, content)
 }
 
+// DisableChannelKey disables one key of a multi-key channel, the channel itself is disabled once all of its keys are
+func DisableChannelKey(channelId int, channelName string, keyHash string, reason string) {
+	model.RecordChannelKeyFailure(channelId, keyHash, reason, true)
+	logger.SysLog(fmt.Sprintf("key %s of channel #%d has been disabled: %s", keyHash, channelId, reason))
+	enabledCount, err := model.CountEnabledChannelKeys(channelId)
+	if err != nil {
+		logger.SysError(fmt.Sprintf("failed to count enabled keys of channel #%d: %s", channelId, err.Error()))
+		return
+	}
+	if enabledCount == 0 {
+		DisableChannel(channelId, channelName, "all keys have been disabled, last error: "+reason)
+		return
+	}
+	subject := fmt.Sprintf("Channel key status change alert!")
+	content := message.EmailTemplate(
+		subject,
+		fmt.Sprintf(`
+			<p>Hello!</p>
+			A key (%s) of the channel "<strong>%s</strong>" (#%d) has been disabled, %d keys are still enabled.
+			Reason for ban:
+			<p style="background-color: #f8f8f8; padding: 10px; border-radius: 4px;">%s</p>
+		`, keyHash, channelName, channelId, enabledCount, reason),
+	)
+	notifyRootUser(subject, content)
+}
+
 func MetricDisableChannel(channelId int, successRate float64) {
 	model.UpdateChannelStatusById(channelId, model.ChannelStatusAutoDisabled)
 	logger.SysLog(fmt.Sprintf("channel #%d has been disabled due to low success rate: %.2f", channelId, successRate*100))
@@ -75,3 +103,34 @@ func EnableChannel(channelId int, channelName string) {
 	)
 	notifyRootUser(subject, content)
 }
+
+// channels whose low balance has been notified, so the alert is sent once until the balance recovers
+var lowBalanceNotified sync.Map
+
+// CheckChannelBalance alerts the root user when the balance of a channel falls below its threshold,
+// before it runs out and gets disabled. The threshold of the channel is in the currency of its balance,
+// the global one is in dollars and is skipped for balances in units of the provider
+func CheckChannelBalance(channel *model.Channel, balance float64, currency string) {
+	threshold, _ := balancechecker.FromUSD(config.ChannelLowBalanceThreshold, currency)
+	if cfg, err := channel.LoadConfig(); err == nil && cfg.LowBalanceThreshold > 0 {
+		threshold = cfg.LowBalanceThreshold
+	}
+	if threshold <= 0 || balance >= threshold {
+		lowBalanceNotified.Delete(channel.Id)
+		return
+	}
+	if _, notified := lowBalanceNotified.LoadOrStore(channel.Id, true); notified {
+		return
+	}
+	logger.SysLog(fmt.Sprintf("channel #%d balance %.2f %s is below %.2f", channel.Id, balance, currency, threshold))
+	subject := fmt.Sprintf("Channel low balance alert!")
+	content := message.EmailTemplate(
+		subject,
+		fmt.Sprintf(`
+			<p>Hello!</p>
+			<p>The balance of the channel "<strong>%s</strong>" (#%d) is <strong>%.2f %s</strong>, below the threshold %.2f.</p>
+			<p>Top up the account in time, the channel will be disabled once the balance is used up.</p>
+		`, channel.Name, channel.Id, balance, currency, threshold),
+	)
+	notifyRootUser(subject, content)
+}
@@ -74,6 +74,17 @@ func ConvertImageRequest(request model.ImageRequest) *ImageRequest {
 	imageRequest.Parameters.Size = strings.Replace(request.Size, "x", "*", -1)
 	imageRequest.Parameters.N = request.N
 	imageRequest.ResponseFormat = request.ResponseFormat
+	if len(request.Image) != 0 {
+		// https://help.aliyun.com/zh/model-studio/developer-reference/wanx-image-edit-api-reference
+		imageRequest.Input.Function = "description_edit"
+		imageRequest.Input.BaseImageURL = request.Image[0].DataURL()
+		if request.Mask != nil {
+			imageRequest.Input.Function = "description_edit_with_mask"
+			imageRequest.Input.MaskImageURL = request.Mask.DataURL()
+		}
+		// the edited image keeps the size of the base image
+		imageRequest.Parameters.Size = ""
+	}
 
 	return &imageRequest
 }
@@ -38,6 +38,10 @@ type ImageRequest struct {
 	Input struct {
 		Prompt         string `json:"prompt"`
 		NegativePrompt string `json:"negative_prompt,omitempty"`
+		// image to image
+		Function     string `json:"function,omitempty"`
+		BaseImageURL string `json:"base_image_url,omitempty"`
+		MaskImageURL string `json:"mask_image_url,omitempty"`
 	} `json:"input"`
 	Parameters struct {
 		Size  string `json:"size,omitempty"`
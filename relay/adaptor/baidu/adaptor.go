@@ -113,6 +113,9 @@ func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error)
 	if request == nil {
 		return nil, errors.New("request is nil")
 	}
+	if len(request.Image) != 0 {
+		return nil, errors.New("image edits and variations are not supported by baidu")
+	}
 	return request, nil
 }
 
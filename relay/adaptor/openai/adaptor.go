@@ -33,10 +33,12 @@ func (a *Adaptor) Init(meta *meta.Meta) {
 func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
 	switch meta.ChannelType {
 	case channeltype.Azure:
-		if meta.Mode == relaymode.ImagesGenerations {
+		switch meta.Mode {
+		case relaymode.ImagesGenerations, relaymode.ImagesEdits, relaymode.ImagesVariations:
 			// https://learn.microsoft.com/en-us/azure/ai-services/openai/dall-e-quickstart?tabs=dalle3%2Ccommand-line&pivots=rest-api
 			// https://{resource_name}.openai.azure.com/openai/deployments/dall-e-3/images/generations?api-version=2024-03-01-preview
-			fullRequestURL := fmt.Sprintf("%s/openai/deployments/%s/images/generations?api-version=%s", meta.BaseURL, meta.ActualModelName, meta.Config.APIVersion)
+			task := strings.TrimPrefix(strings.Split(meta.RequestURLPath, "?")[0], "/v1/")
+			fullRequestURL := fmt.Sprintf("%s/openai/deployments/%s/%s?api-version=%s", meta.BaseURL, meta.ActualModelName, task, meta.Config.APIVersion)
 			return fullRequestURL, nil
 		}
 
@@ -119,7 +121,7 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Met
 		}
 	} else {
 		switch meta.Mode {
-		case relaymode.ImagesGenerations:
+		case relaymode.ImagesGenerations, relaymode.ImagesEdits, relaymode.ImagesVariations:
 			err, _ = ImageHandler(c, resp)
 		default:
 			err, usage = Handler(c, resp, meta.PromptTokens, meta.ActualModelName)
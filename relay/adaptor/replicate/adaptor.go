@@ -23,20 +23,51 @@ type Adaptor struct {
 }
 
 // ConvertImageRequest implements adaptor.Adaptor.
-func (*Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error) {
-	return DrawImageRequest{
-		Input: ImageInput{
-			Steps:           25,
-			Prompt:          request.Prompt,
-			Guidance:        3,
-			Seed:            int(time.Now().UnixNano()),
-			SafetyTolerance: 5,
-			NImages:         1, // replicate will always return 1 image
-			Width:           1440,
-			Height:          1440,
-			AspectRatio:     "1:1",
-		},
-	}, nil
+func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error) {
+	input := ImageInput{
+		Steps:           25,
+		Prompt:          request.Prompt,
+		Guidance:        3,
+		Seed:            int(time.Now().UnixNano()),
+		SafetyTolerance: 5,
+		NImages:         1, // replicate will always return 1 image
+		Width:           1440,
+		Height:          1440,
+		AspectRatio:     "1:1",
+	}
+	if len(request.Image) == 0 {
+		return DrawImageRequest{Input: input}, nil
+	}
+
+	// edits and variations, replicate takes the images as data urls
+	image := request.Image[0].DataURL()
+	switch {
+	case strings.HasPrefix(a.meta.OriginModelName, "black-forest-labs/flux-fill-"):
+		if request.Mask == nil {
+			return nil, errors.Errorf("model %s requires a mask", a.meta.OriginModelName)
+		}
+		outputFormat := "png"
+		if request.OutputFormat == "jpeg" {
+			outputFormat = "jpg"
+		}
+		return InpaintingImageByFlusReplicateRequest{
+			Input: FluxInpaintingInput{
+				Mask:            request.Mask.DataURL(),
+				Image:           image,
+				Seed:            input.Seed,
+				Steps:           input.Steps,
+				Prompt:          request.Prompt,
+				Guidance:        input.Guidance,
+				OutputFormat:    outputFormat,
+				SafetyTolerance: input.SafetyTolerance,
+			},
+		}, nil
+	case strings.HasPrefix(a.meta.OriginModelName, "black-forest-labs/flux-redux-"):
+		input.ReduxImage = image
+	default:
+		input.ImagePrompt = image
+	}
+	return DrawImageRequest{Input: input}, nil
 }
 
 func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.GeneralOpenAIRequest) (any, error) {
@@ -116,7 +147,7 @@ func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Read
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
 	switch meta.Mode {
-	case relaymode.ImagesGenerations:
+	case relaymode.ImagesGenerations, relaymode.ImagesEdits, relaymode.ImagesVariations:
 		err, usage = ImageHandler(c, resp)
 	case relaymode.ChatCompletions:
 		err, usage = ChatHandler(c, resp)
@@ -84,6 +84,10 @@ func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error)
 	if request == nil {
 		return nil, errors.New("request is nil")
 	}
+	if len(request.Image) != 0 {
+		// cogview only generates images from text
+		return nil, errors.New("image edits and variations are not supported by zhipu")
+	}
 	newRequest := ImageRequest{
 		Model:  request.Model,
 		Prompt: request.Prompt,
@@ -20,7 +20,14 @@ func ReturnPreConsumedQuota(ctx context.Context, preConsumedQuota int64, tokenId
 	}
 }
 
-func PostConsumeQuota(ctx context.Context, tokenId int, quotaDelta int64, totalQuota int64, userId int, channelId int, modelRatio float64, groupRatio float64, modelName string, tokenName string) {
+// ReturnTokenModelQuota releases the quota reserved against a model quota cap
+func ReturnTokenModelQuota(modelQuotaId int, reservedQuota int64) {
+	if reservedQuota != 0 {
+		go model.IncreaseTokenModelUsedQuota(modelQuotaId, -reservedQuota)
+	}
+}
+
+func PostConsumeQuota(ctx context.Context, tokenId int, quotaDelta int64, totalQuota int64, cost int64, userId int, channelId int, modelRatio float64, groupRatio float64, modelName string, tokenName string, duration float64) {
 	// quotaDelta is remaining quota to be consumed
 	err := model.PostConsumeTokenQuota(tokenId, quotaDelta)
 	if err != nil {
@@ -33,6 +40,9 @@ func PostConsumeQuota(ctx context.Context, tokenId int, quotaDelta int64, totalQ
 	// totalQuota is total quota consumed
 	if totalQuota != 0 {
 		logContent := fmt.Sprintf("Multiplier: %.2f × %.2f", modelRatio, groupRatio)
+		if duration > 0 {
+			logContent += fmt.Sprintf(", audio duration: %.2fs", duration)
+		}
 		model.RecordConsumeLog(ctx, &model.Log{
 			UserId:           userId,
 			ChannelId:        channelId,
@@ -41,7 +51,9 @@ func PostConsumeQuota(ctx context.Context, tokenId int, quotaDelta int64, totalQ
 			ModelName:        modelName,
 			TokenName:        tokenName,
 			Quota:            int(totalQuota),
+			Cost:             int(cost),
 			Content:          logContent,
+			Duration:         duration,
 		})
 		model.UpdateUserUsedQuotaAndRequestCount(userId, totalQuota)
 		model.UpdateChannelUsedQuota(channelId, totalQuota)
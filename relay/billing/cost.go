@@ -0,0 +1,18 @@
+package billing
+
+import (
+	"github.com/songquanpeng/one-api/model"
+)
+
+// CostRatio returns the upstream price ratio of a model on a channel, it takes the place of model ratio × group ratio
+// when computing what the request costs us instead of what the user is charged
+func CostRatio(cfg *model.ChannelConfig, modelName string, modelRatio float64) float64 {
+	if ratio, ok := cfg.CostModelRatio[modelName]; ok {
+		return ratio
+	}
+	if cfg.CostMultiplier > 0 {
+		return modelRatio * cfg.CostMultiplier
+	}
+	// no discount, we pay the list price
+	return modelRatio
+}
@@ -0,0 +1,19 @@
+package billing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/model"
+)
+
+func TestCostRatio(t *testing.T) {
+	cfg := &model.ChannelConfig{}
+	assert.Equal(t, 15.0, CostRatio(cfg, "gpt-4", 15))
+	cfg.CostMultiplier = 0.5
+	assert.Equal(t, 7.5, CostRatio(cfg, "gpt-4", 15))
+	cfg.CostModelRatio = map[string]float64{"gpt-4": 10}
+	assert.Equal(t, 10.0, CostRatio(cfg, "gpt-4", 15))
+	assert.Equal(t, 1.0, CostRatio(cfg, "gpt-3.5-turbo", 2))
+}
@@ -11,6 +11,12 @@ var ImageSizeRatios = map[string]map[string]float64{
 		"1024x1792": 2,
 		"1792x1024": 2,
 	},
+	"gpt-image-1": {
+		"1024x1024": 1,
+		"1024x1536": 1.5,
+		"1536x1024": 1.5,
+		"auto":      1.5, // the size is only known from the response, charge the larger one
+	},
 	"ali-stable-diffusion-xl": {
 		"512x1024":  1,
 		"1024x768":  1,
@@ -43,6 +49,7 @@ var ImageSizeRatios = map[string]map[string]float64{
 var ImageGenerationAmounts = map[string][2]int{
 	"dall-e-2":                  {1, 10},
 	"dall-e-3":                  {1, 1}, // OpenAI allows n=1 currently.
+	"gpt-image-1":               {1, 10},
 	"ali-stable-diffusion-xl":   {1, 4}, // Ali
 	"ali-stable-diffusion-v1.5": {1, 4}, // Ali
 	"wanx-v1":                   {1, 4}, // Ali
@@ -53,6 +60,7 @@ var ImageGenerationAmounts = map[string][2]int{
 var ImagePromptLengthLimitations = map[string]int{
 	"dall-e-2":                  1000,
 	"dall-e-3":                  4000,
+	"gpt-image-1":               32000,
 	"ali-stable-diffusion-xl":   4000,
 	"ali-stable-diffusion-v1.5": 4000,
 	"wanx-v1":                   4000,
@@ -64,3 +72,13 @@ var ImageOriginModelName = map[string]string{
 	"ali-stable-diffusion-xl":   "stable-diffusion-xl",
 	"ali-stable-diffusion-v1.5": "stable-diffusion-v1.5",
 }
+
+// ImageQualityRatios scale the price of the models with quality levels, relative to the medium quality
+var ImageQualityRatios = map[string]map[string]float64{
+	"gpt-image-1": {
+		"low":    0.25,
+		"medium": 1,
+		"high":   4,
+		"auto":   4, // the quality is picked by the model, charge the highest one
+	},
+}
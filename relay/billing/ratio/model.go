@@ -85,8 +85,9 @@ var ModelRatio = map[string]float64{
 	"text-search-ada-doc-001": 10,
 	"text-moderation-stable":  0.1,
 	"text-moderation-latest":  0.1,
-	"dall-e-2":                0.02 * USD, // $0.016 - $0.020 / image
-	"dall-e-3":                0.04 * USD, // $0.040 - $0.120 / image
+	"dall-e-2":                0.02 * USD,  // $0.016 - $0.020 / image
+	"dall-e-3":                0.04 * USD,  // $0.040 - $0.120 / image
+	"gpt-image-1":             0.042 * USD, // $0.011 - $0.250 / image, the medium quality square image
 	// https://docs.anthropic.com/en/docs/about-claude/models
 	"claude-instant-1.2":         0.8 / 1000 * USD,
 	"claude-2.0":                 8.0 / 1000 * USD,
@@ -684,6 +685,9 @@ func UpdateModelRatioByJSONString(jsonStr string) error {
 }
 
 func GetModelRatio(name string, channelType int) float64 {
+	if price := GetModelPrice(name, channelType); price != nil {
+		return price.modelRatio()
+	}
 	modelRatioLock.RLock()
 	defer modelRatioLock.RUnlock()
 	if strings.HasPrefix(name, "qwen-") && strings.HasSuffix(name, "-internet") {
@@ -723,6 +727,9 @@ func UpdateCompletionRatioByJSONString(jsonStr string) error {
 }
 
 func GetCompletionRatio(name string, channelType int) float64 {
+	if price := GetModelPrice(name, channelType); price != nil && price.Input > 0 {
+		return price.Output / price.Input
+	}
 	if strings.HasPrefix(name, "qwen-") && strings.HasSuffix(name, "-internet") {
 		name = strings.TrimSuffix(name, "-internet")
 	}
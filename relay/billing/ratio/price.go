@@ -0,0 +1,113 @@
+package ratio
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// ModelPrice is the price of a model in USD, it takes precedence over the model ratio and the completion ratio.
+// Token prices are per 1M tokens, the other prices are added per request, per image or per second of audio.
+type ModelPrice struct {
+	Input      float64 `json:"input,omitempty"`
+	Output     float64 `json:"output,omitempty"`
+	PerRequest float64 `json:"per_request,omitempty"`
+	PerImage   float64 `json:"per_image,omitempty"`
+	PerSecond  float64 `json:"per_second,omitempty"`
+}
+
+var modelPriceLock sync.RWMutex
+
+// ModelPrices is keyed by model name, or by model(channel type) for the price on a channel type
+var ModelPrices = map[string]*ModelPrice{
+	// $0.006 / minute, https://openai.com/api/pricing/
+	"whisper-1": {PerSecond: 0.006 / 60},
+}
+
+func ModelPrices2JSONString() string {
+	modelPriceLock.RLock()
+	defer modelPriceLock.RUnlock()
+	jsonBytes, err := json.Marshal(ModelPrices)
+	if err != nil {
+		logger.SysError("error marshalling model price: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateModelPricesByJSONString(jsonStr string) error {
+	prices := make(map[string]*ModelPrice)
+	if jsonStr != "" {
+		if err := json.Unmarshal([]byte(jsonStr), &prices); err != nil {
+			return err
+		}
+	}
+	for name, price := range prices {
+		if err := price.validate(); err != nil {
+			return fmt.Errorf("price of %s: %w", name, err)
+		}
+	}
+	modelPriceLock.Lock()
+	defer modelPriceLock.Unlock()
+	ModelPrices = prices
+	return nil
+}
+
+func (p *ModelPrice) validate() error {
+	if p == nil {
+		return errors.New("price is empty")
+	}
+	if p.Input < 0 || p.Output < 0 || p.PerRequest < 0 || p.PerImage < 0 || p.PerSecond < 0 {
+		return errors.New("prices can't be negative")
+	}
+	if p.Output > 0 && p.Input == 0 {
+		// the completion ratio is relative to the input price
+		return errors.New("an output price requires an input price")
+	}
+	return nil
+}
+
+// GetModelPrice returns the price of a model, nil if it's priced by ratio
+func GetModelPrice(name string, channelType int) *ModelPrice {
+	modelPriceLock.RLock()
+	defer modelPriceLock.RUnlock()
+	if strings.HasPrefix(name, "qwen-") && strings.HasSuffix(name, "-internet") {
+		name = strings.TrimSuffix(name, "-internet")
+	}
+	if price, ok := ModelPrices[fmt.Sprintf("%s(%d)", name, channelType)]; ok {
+		return price
+	}
+	return ModelPrices[name]
+}
+
+// USD2Quota converts an amount in USD to quota
+func USD2Quota(usd float64) float64 {
+	return usd * config.QuotaPerUnit
+}
+
+// modelRatio converts the price to a model ratio, which is the quota per prompt token,
+// or the quota per 1000 images as the image helper counts
+func (p *ModelPrice) modelRatio() float64 {
+	if p.Input > 0 {
+		return USD2Quota(p.Input) / 1000000
+	}
+	if p.PerImage > 0 {
+		return USD2Quota(p.PerImage) / 1000
+	}
+	// only priced per request or per second
+	return 0
+}
+
+// RequestQuota returns the quota charged per request
+func (p *ModelPrice) RequestQuota() float64 {
+	return USD2Quota(p.PerRequest)
+}
+
+// DurationQuota returns the quota charged for the given seconds of audio
+func (p *ModelPrice) DurationQuota(seconds float64) float64 {
+	return USD2Quota(p.PerSecond) * seconds
+}
@@ -0,0 +1,34 @@
+package ratio
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelPrice(t *testing.T) {
+	err := UpdateModelPricesByJSONString(`{
+		"gpt-4o": {"input": 2.5, "output": 10},
+		"gpt-4o(3)": {"input": 5, "output": 15},
+		"dall-e-3": {"per_image": 0.04},
+		"search-pro": {"per_request": 0.01}
+	}`)
+	assert.NoError(t, err)
+	defer func() { _ = UpdateModelPricesByJSONString("{}") }()
+
+	// $2.5 / 1M tokens is the ratio 1.25 of $0.002 / 1K tokens
+	assert.InDelta(t, 1.25, GetModelRatio("gpt-4o", 1), 1e-9)
+	assert.InDelta(t, 4, GetCompletionRatio("gpt-4o", 1), 1e-9)
+	assert.InDelta(t, 2.5, GetModelRatio("gpt-4o", 3), 1e-9)
+	assert.InDelta(t, 3, GetCompletionRatio("gpt-4o", 3), 1e-9)
+	// the existing image ratio of dall-e-3 is 0.04 * USD
+	assert.InDelta(t, 0.04*USD, GetModelRatio("dall-e-3", 1), 1e-9)
+	assert.Equal(t, 0.0, GetModelRatio("search-pro", 1))
+	assert.InDelta(t, 5000, GetModelPrice("search-pro", 1).RequestQuota(), 1e-9)
+	// models without a price keep their ratio
+	assert.Equal(t, 15.0, GetModelRatio("gpt-4", 1))
+
+	assert.Error(t, UpdateModelPricesByJSONString(`{"a": {"output": 1}}`))
+	assert.Error(t, UpdateModelPricesByJSONString(`{"a": {"input": -1}}`))
+	assert.NotNil(t, GetModelPrice("gpt-4o", 1), "invalid prices must not replace the current ones")
+}
@@ -0,0 +1,182 @@
+package ratio
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// PricingRule adjusts the ratios of the requests it matches, e.g. a higher price for long prompts
+// or an off-peak discount. Conditions left empty match everything, the first matching rule applies.
+type PricingRule struct {
+	Name string `json:"name"`
+	// Models are model names, a trailing * matches a prefix
+	Models []string `json:"models,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+	// the prompt tokens tier, MinPromptTokens < prompt tokens <= MaxPromptTokens, 0 means no bound
+	MinPromptTokens int `json:"min_prompt_tokens,omitempty"`
+	MaxPromptTokens int `json:"max_prompt_tokens,omitempty"`
+	// the daily window in HH:MM, it may cross midnight, e.g. 22:00 to 06:00
+	StartTime string `json:"start_time,omitempty"`
+	EndTime   string `json:"end_time,omitempty"`
+	// TimeZone of the window, an IANA name, the server time zone by default
+	TimeZone string `json:"time_zone,omitempty"`
+
+	// ModelRatio and CompletionRatio replace the ratios of the model, GroupRatio the ratio of the group
+	ModelRatio      *float64 `json:"model_ratio,omitempty"`
+	CompletionRatio *float64 `json:"completion_ratio,omitempty"`
+	GroupRatio      *float64 `json:"group_ratio,omitempty"`
+	// Multiplier scales the model ratio, e.g. 0.5 for half price
+	Multiplier float64 `json:"multiplier,omitempty"`
+
+	start    int // minutes since midnight
+	end      int
+	location *time.Location
+}
+
+var pricingRulesLock sync.RWMutex
+var PricingRules = []*PricingRule{}
+
+func PricingRules2JSONString() string {
+	pricingRulesLock.RLock()
+	defer pricingRulesLock.RUnlock()
+	jsonBytes, err := json.Marshal(PricingRules)
+	if err != nil {
+		logger.SysError("error marshalling pricing rules: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdatePricingRulesByJSONString(jsonStr string) error {
+	var rules []*PricingRule
+	if jsonStr != "" {
+		if err := json.Unmarshal([]byte(jsonStr), &rules); err != nil {
+			return err
+		}
+	}
+	for i, rule := range rules {
+		if err := rule.init(); err != nil {
+			return fmt.Errorf("pricing rule %d (%s): %w", i+1, rule.Name, err)
+		}
+	}
+	pricingRulesLock.Lock()
+	defer pricingRulesLock.Unlock()
+	PricingRules = rules
+	return nil
+}
+
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %s, expected HH:MM", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (r *PricingRule) init() error {
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+	if r.ModelRatio == nil && r.CompletionRatio == nil && r.GroupRatio == nil && r.Multiplier == 0 {
+		return errors.New("the rule doesn't change any ratio")
+	}
+	if r.Multiplier < 0 || r.ModelRatio != nil && *r.ModelRatio < 0 ||
+		r.CompletionRatio != nil && *r.CompletionRatio < 0 || r.GroupRatio != nil && *r.GroupRatio < 0 {
+		return errors.New("ratios can't be negative")
+	}
+	if r.MaxPromptTokens != 0 && r.MaxPromptTokens <= r.MinPromptTokens {
+		return errors.New("max_prompt_tokens must be greater than min_prompt_tokens")
+	}
+	if (r.StartTime == "") != (r.EndTime == "") {
+		return errors.New("start_time and end_time must be set together")
+	}
+	var err error
+	if r.StartTime != "" {
+		if r.start, err = parseClock(r.StartTime); err != nil {
+			return err
+		}
+		if r.end, err = parseClock(r.EndTime); err != nil {
+			return err
+		}
+	}
+	r.location = time.Local
+	if r.TimeZone != "" {
+		if r.location, err = time.LoadLocation(r.TimeZone); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func matchName(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if pattern == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *PricingRule) match(modelName string, group string, promptTokens int, at time.Time) bool {
+	if !matchName(r.Models, modelName) || !matchName(r.Groups, group) {
+		return false
+	}
+	if r.MinPromptTokens != 0 && promptTokens <= r.MinPromptTokens || r.MaxPromptTokens != 0 && promptTokens > r.MaxPromptTokens {
+		return false
+	}
+	if r.StartTime != "" {
+		local := at.In(r.location)
+		minute := local.Hour()*60 + local.Minute()
+		if r.start <= r.end {
+			return minute >= r.start && minute < r.end
+		}
+		return minute >= r.start || minute < r.end
+	}
+	return true
+}
+
+// GetPricingRule returns the first rule matching a request started at the given time, nil if none does
+func GetPricingRule(modelName string, group string, promptTokens int, at time.Time) *PricingRule {
+	pricingRulesLock.RLock()
+	defer pricingRulesLock.RUnlock()
+	for _, rule := range PricingRules {
+		if rule.match(modelName, group, promptTokens, at) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// IsPromptTier tells whether the rule only prices the prompt size of some models, like the tiers of upstream list prices
+func (r *PricingRule) IsPromptTier() bool {
+	return (r.MinPromptTokens != 0 || r.MaxPromptTokens != 0) && len(r.Groups) == 0 && r.StartTime == ""
+}
+
+// Apply returns the ratios adjusted by the rule
+func (r *PricingRule) Apply(modelRatio float64, completionRatio float64, groupRatio float64) (float64, float64, float64) {
+	if r.ModelRatio != nil {
+		modelRatio = *r.ModelRatio
+	}
+	if r.Multiplier != 0 {
+		modelRatio *= r.Multiplier
+	}
+	if r.CompletionRatio != nil {
+		completionRatio = *r.CompletionRatio
+	}
+	if r.GroupRatio != nil {
+		groupRatio = *r.GroupRatio
+	}
+	return modelRatio, completionRatio, groupRatio
+}
@@ -0,0 +1,40 @@
+package ratio
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetPricingRule(t *testing.T) {
+	err := UpdatePricingRulesByJSONString(`[
+		{"name": "gemini long context", "models": ["gemini-1.5-pro*"], "min_prompt_tokens": 128000, "multiplier": 2},
+		{"name": "deepseek off-peak", "models": ["deepseek-chat"], "start_time": "16:30", "end_time": "00:30", "time_zone": "UTC", "multiplier": 0.5},
+		{"name": "vip", "groups": ["vip"], "group_ratio": 0.8}
+	]`)
+	assert.NoError(t, err)
+	defer func() { _ = UpdatePricingRulesByJSONString("[]") }()
+
+	noon := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	assert.Nil(t, GetPricingRule("gemini-1.5-pro-002", "default", 128000, noon))
+	rule := GetPricingRule("gemini-1.5-pro-002", "default", 128001, noon)
+	assert.Equal(t, "gemini long context", rule.Name)
+	modelRatio, completionRatio, groupRatio := rule.Apply(1.25, 4, 1)
+	assert.Equal(t, []float64{2.5, 4, 1}, []float64{modelRatio, completionRatio, groupRatio})
+
+	assert.Nil(t, GetPricingRule("deepseek-chat", "default", 10, noon))
+	assert.NotNil(t, GetPricingRule("deepseek-chat", "default", 10, time.Date(2024, 1, 1, 23, 59, 0, 0, time.UTC)))
+	assert.NotNil(t, GetPricingRule("deepseek-chat", "default", 10, time.Date(2024, 1, 2, 0, 10, 0, 0, time.UTC)))
+	assert.Nil(t, GetPricingRule("deepseek-chat", "default", 10, time.Date(2024, 1, 2, 0, 30, 0, 0, time.UTC)))
+
+	rule = GetPricingRule("gpt-4o", "vip", 10, noon)
+	assert.Equal(t, "vip", rule.Name)
+	assert.False(t, rule.IsPromptTier())
+	assert.True(t, GetPricingRule("gemini-1.5-pro-002", "default", 128001, noon).IsPromptTier())
+	assert.False(t, GetPricingRule("deepseek-chat", "default", 10, time.Date(2024, 1, 1, 23, 59, 0, 0, time.UTC)).IsPromptTier())
+
+	assert.Error(t, UpdatePricingRulesByJSONString(`[{"name": "noop"}]`))
+	assert.Error(t, UpdatePricingRulesByJSONString(`[{"name": "bad", "start_time": "25:00", "end_time": "01:00", "multiplier": 2}]`))
+	assert.NotNil(t, GetPricingRule("gpt-4o", "vip", 10, noon), "invalid rules must not replace the current ones")
+}
@@ -8,11 +8,16 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/audio"
 	"github.com/songquanpeng/one-api/common/client"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/ctxkey"
@@ -53,8 +58,21 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 			return openai.ErrorWrapper(errors.New("input is too long (over 4096 characters)"), "text_too_long", http.StatusBadRequest)
 		}
 	}
+	var duration float64          // seconds of the uploaded audio, 0 when unknown
+	var estimatedDuration float64 // seconds estimated from the size of the uploaded audio
+	if relayMode != relaymode.AudioSpeech {
+		if requestModel := c.GetString(ctxkey.RequestModel); requestModel != "" {
+			audioModel = requestModel
+		}
+		var bizErr *relaymodel.ErrorWithStatusCode
+		duration, estimatedDuration, bizErr = getAudioDuration(c)
+		if bizErr != nil {
+			return bizErr
+		}
+	}
 
 	modelRatio := billingratio.GetModelRatio(audioModel, channelType)
+	price := billingratio.GetModelPrice(audioModel, channelType)
 	groupRatio := billingratio.GetGroupRatio(group)
 	ratio := modelRatio * groupRatio
 	var quota int64
@@ -65,6 +83,10 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		quota = preConsumedQuota
 	default:
 		preConsumedQuota = int64(float64(config.PreConsumedQuota) * ratio)
+		if price != nil && price.PerSecond > 0 {
+			// models priced per second have no model ratio, files which can't be decoded are pre-consumed by their size
+			preConsumedQuota = int64(price.DurationQuota(billedAudioDuration(duration, 0, estimatedDuration)) * groupRatio)
+		}
 	}
 	userQuota, err := model.CacheGetUserQuota(ctx, userId)
 	if err != nil {
@@ -75,8 +97,14 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	if userQuota-preConsumedQuota < 0 {
 		return openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
 	}
+	err = model.PreConsumeTokenModelQuota(meta.TokenModelQuotaId, preConsumedQuota)
+	if err != nil {
+		return openai.ErrorWrapper(err, "insufficient_token_model_quota", http.StatusForbidden)
+	}
+	meta.TokenModelPreConsumedQuota = preConsumedQuota
 	err = model.CacheDecreaseUserQuota(userId, preConsumedQuota)
 	if err != nil {
+		billing.ReturnTokenModelQuota(meta.TokenModelQuotaId, meta.TokenModelPreConsumedQuota)
 		return openai.ErrorWrapper(err, "decrease_user_quota_failed", http.StatusInternalServerError)
 	}
 	if userQuota > 100*preConsumedQuota {
@@ -87,6 +115,7 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	if preConsumedQuota > 0 {
 		err := model.PreConsumeTokenQuota(tokenId, preConsumedQuota)
 		if err != nil {
+			billing.ReturnTokenModelQuota(meta.TokenModelQuotaId, meta.TokenModelPreConsumedQuota)
 			return openai.ErrorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
 		}
 	}
@@ -95,6 +124,7 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		if succeed {
 			return
 		}
+		billing.ReturnTokenModelQuota(meta.TokenModelQuotaId, meta.TokenModelPreConsumedQuota)
 		if preConsumedQuota > 0 {
 			// we need to roll back the pre-consumed quota
 			defer func(ctx context.Context) {
@@ -140,6 +170,18 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	}
 	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody.Bytes()))
 	responseFormat := c.DefaultPostForm("response_format", "json")
+	upstreamFormat := responseFormat
+	contentType := c.Request.Header.Get("Content-Type")
+	if relayMode != relaymode.AudioSpeech && price != nil && price.PerSecond > 0 &&
+		(responseFormat == "json" || responseFormat == "text") && strings.HasPrefix(audioModel, "whisper") {
+		// only verbose_json reports the duration billed by the upstream, the response is converted back below
+		body, err := setMultipartField(requestBody.Bytes(), contentType, "response_format", "verbose_json")
+		if err != nil {
+			return openai.ErrorWrapper(err, "new_request_body_failed", http.StatusInternalServerError)
+		}
+		requestBody = bytes.NewBuffer(body)
+		upstreamFormat = "verbose_json"
+	}
 
 	req, err := http.NewRequest(c.Request.Method, fullRequestURL, requestBody)
 	if err != nil {
@@ -151,11 +193,11 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		apiKey := c.Request.Header.Get("Authorization")
 		apiKey = strings.TrimPrefix(apiKey, "Bearer ")
 		req.Header.Set("api-key", apiKey)
-		req.ContentLength = c.Request.ContentLength
+		req.ContentLength = int64(requestBody.Len())
 	} else {
 		req.Header.Set("Authorization", c.Request.Header.Get("Authorization"))
 	}
-	req.Header.Set("Content-Type", c.Request.Header.Get("Content-Type"))
+	req.Header.Set("Content-Type", contentType)
 	req.Header.Set("Accept", c.Request.Header.Get("Accept"))
 
 	resp, err := client.HTTPClient.Do(req)
@@ -190,17 +232,20 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		}
 
 		var text string
-		switch responseFormat {
+		var responseDuration float64 // seconds reported by the upstream, 0 when unknown
+		switch upstreamFormat {
 		case "json":
 			text, err = getTextFromJSON(responseBody)
 		case "text":
 			text, err = getTextFromText(responseBody)
 		case "srt":
 			text, err = getTextFromSRT(responseBody)
+			responseDuration = getDurationFromSRT(responseBody)
 		case "verbose_json":
-			text, err = getTextFromVerboseJSON(responseBody)
+			text, responseDuration, err = getTextFromVerboseJSON(responseBody)
 		case "vtt":
 			text, err = getTextFromVTT(responseBody)
+			responseDuration = getDurationFromSRT(responseBody)
 		default:
 			return openai.ErrorWrapper(errors.New("unexpected_response_format"), "unexpected_response_format", http.StatusInternalServerError)
 		}
@@ -208,15 +253,44 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 			return openai.ErrorWrapper(err, "get_text_from_body_err", http.StatusInternalServerError)
 		}
 		quota = int64(openai.CountTokenText(text, audioModel))
+		// the upstream may bill more than what could be decoded, e.g. the streams a decoder skips
+		duration = billedAudioDuration(duration, responseDuration, estimatedDuration)
+		if upstreamFormat != responseFormat && resp.StatusCode == http.StatusOK {
+			responseBody, err = formatTranscription(text, responseFormat)
+			if err != nil {
+				return openai.ErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError)
+			}
+			resp.Header.Del("Content-Length")
+			resp.Header.Set("Content-Type", "application/json")
+			if responseFormat == "text" {
+				resp.Header.Set("Content-Type", "text/plain; charset=utf-8")
+			}
+		}
 		resp.Body = io.NopCloser(bytes.NewBuffer(responseBody))
 	}
 	if resp.StatusCode != http.StatusOK {
 		return RelayErrorHandler(resp)
 	}
 	succeed = true
+	// transcriptions are charged by the tokens of the text, speeches by the characters of the input
+	costRatio := billing.CostRatio(&meta.Config, audioModel, modelRatio)
+	cost := int64(float64(quota) * costRatio)
+	if relayMode == relaymode.AudioSpeech {
+		cost = int64(float64(len(ttsRequest.Input)) * costRatio)
+	}
+	// models priced in USD are charged per second of audio when the duration is known, and per request
+	if price != nil {
+		if price.PerSecond > 0 && duration > 0 {
+			quota = int64(price.DurationQuota(duration) * groupRatio)
+			cost = int64(price.DurationQuota(duration))
+		}
+		quota += int64(price.RequestQuota() * groupRatio)
+		cost += int64(price.RequestQuota())
+	}
 	quotaDelta := quota - preConsumedQuota
 	defer func(ctx context.Context) {
-		go billing.PostConsumeQuota(ctx, tokenId, quotaDelta, quota, userId, channelId, modelRatio, groupRatio, audioModel, tokenName)
+		go billing.PostConsumeQuota(ctx, tokenId, quotaDelta, quota, cost, userId, channelId, modelRatio, groupRatio, audioModel, tokenName, duration)
+		go model.IncreaseTokenModelUsedQuota(meta.TokenModelQuotaId, quota-meta.TokenModelPreConsumedQuota)
 	}(c.Request.Context())
 
 	for k, v := range resp.Header {
@@ -235,16 +309,164 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	return nil
 }
 
+// getAudioFile returns the file of a multipart transcription or translation request
+func getAudioFile(c *gin.Context) ([]byte, error) {
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return nil, err
+	}
+	_, params, err := mime.ParseMediaType(c.Request.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	reader := multipart.NewReader(bytes.NewReader(requestBody), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, errors.New("file is required")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "file" {
+			return io.ReadAll(part)
+		}
+	}
+}
+
+// audio which can't be decoded is assumed to be encoded at this rate, a low one for speech so that its duration isn't underestimated
+const estimatedAudioBytesPerSecond = 4000 // 32 kbps
+
+// getAudioDuration decodes the duration of the uploaded audio and enforces the limits of the token,
+// it also returns the duration estimated from the file size
+func getAudioDuration(c *gin.Context) (float64, float64, *relaymodel.ErrorWithStatusCode) {
+	file, err := getAudioFile(c)
+	if err != nil {
+		return 0, 0, openai.ErrorWrapper(err, "invalid_audio_file", http.StatusBadRequest)
+	}
+	if maxFileSize := c.GetInt64(ctxkey.AudioMaxFileSize); maxFileSize > 0 && int64(len(file)) > maxFileSize {
+		return 0, 0, openai.ErrorWrapper(fmt.Errorf("audio file is too large (over %d bytes)", maxFileSize), "audio_file_too_large", http.StatusBadRequest)
+	}
+	estimatedDuration := float64(len(file)) / estimatedAudioBytesPerSecond
+	maxDuration := c.GetInt(ctxkey.AudioMaxDuration)
+	duration, err := audio.Duration(file)
+	if err != nil {
+		if maxDuration > 0 {
+			// the limit can't be enforced on files which can't be decoded
+			return 0, 0, openai.ErrorWrapper(fmt.Errorf("failed to get the audio duration: %w", err), "invalid_audio_file", http.StatusBadRequest)
+		}
+		logger.Warnf(c.Request.Context(), "failed to get the audio duration: %s", err.Error())
+		return 0, estimatedDuration, nil
+	}
+	if maxDuration > 0 && duration > float64(maxDuration) {
+		return 0, 0, openai.ErrorWrapper(fmt.Errorf("audio is too long (over %d seconds)", maxDuration), "audio_too_long", http.StatusBadRequest)
+	}
+	return duration, estimatedDuration, nil
+}
+
+// billedAudioDuration returns the longer of the decoded and the upstream durations,
+// and the estimate when neither is known
+func billedAudioDuration(duration float64, responseDuration float64, estimatedDuration float64) float64 {
+	if duration = math.Max(duration, responseDuration); duration > 0 {
+		return duration
+	}
+	return estimatedDuration
+}
+
+// setMultipartField replaces the value of a field of a multipart body, or adds the field, keeping the boundary
+func setMultipartField(body []byte, contentType string, name string, value string) ([]byte, error) {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, err
+	}
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	buffer := &bytes.Buffer{}
+	writer := multipart.NewWriter(buffer)
+	if err = writer.SetBoundary(params["boundary"]); err != nil {
+		return nil, err
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == name {
+			continue
+		}
+		partWriter, err := writer.CreatePart(part.Header)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = io.Copy(partWriter, part); err != nil {
+			return nil, err
+		}
+	}
+	if err = writer.WriteField(name, value); err != nil {
+		return nil, err
+	}
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// formatTranscription renders a transcription in the json or text response format
+func formatTranscription(text string, responseFormat string) ([]byte, error) {
+	if responseFormat == "text" {
+		return []byte(text + "\n"), nil
+	}
+	return json.Marshal(openai.WhisperJSONResponse{Text: text})
+}
+
+// getDurationFromSRT returns the end of the last cue of a srt or vtt transcription
+func getDurationFromSRT(body []byte) float64 {
+	var duration float64
+	for _, line := range strings.Split(string(body), "\n") {
+		_, end, found := strings.Cut(line, "-->")
+		if !found {
+			continue
+		}
+		fields := strings.Fields(end)
+		if len(fields) == 0 {
+			continue
+		}
+		if seconds, ok := parseCueTime(fields[0]); ok && seconds > duration {
+			duration = seconds
+		}
+	}
+	return duration
+}
+
+// parseCueTime parses a cue timestamp such as 00:01:02,500 (srt) or 01:02.500 (vtt)
+func parseCueTime(timestamp string) (float64, bool) {
+	parts := strings.Split(strings.Replace(timestamp, ",", ".", 1), ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, false
+	}
+	var seconds float64
+	for _, part := range parts {
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil || value < 0 {
+			return 0, false
+		}
+		seconds = seconds*60 + value
+	}
+	return seconds, true
+}
+
 func getTextFromVTT(body []byte) (string, error) {
 	return getTextFromSRT(body)
 }
 
-func getTextFromVerboseJSON(body []byte) (string, error) {
+func getTextFromVerboseJSON(body []byte) (string, float64, error) {
 	var whisperResponse openai.WhisperVerboseJSONResponse
 	if err := json.Unmarshal(body, &whisperResponse); err != nil {
-		return "", fmt.Errorf("unmarshal_response_body_failed err :%w", err)
+		return "", 0, fmt.Errorf("unmarshal_response_body_failed err :%w", err)
 	}
-	return whisperResponse.Text, nil
+	return whisperResponse.Text, whisperResponse.Duration, nil
 }
 
 func getTextFromSRT(body []byte) (string, error) {
@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBilledAudioDuration(t *testing.T) {
+	assert.Equal(t, 12.5, billedAudioDuration(10, 12.5, 30))
+	assert.Equal(t, 10.0, billedAudioDuration(10, 0, 30))
+	assert.Equal(t, 8.0, billedAudioDuration(0, 8, 30))
+	assert.Equal(t, 30.0, billedAudioDuration(0, 0, 30))
+}
+
+func TestSetMultipartField(t *testing.T) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	fileWriter, err := writer.CreateFormFile("file", "speech.mp3")
+	require.NoError(t, err)
+	_, err = fileWriter.Write([]byte("audio"))
+	require.NoError(t, err)
+	require.NoError(t, writer.WriteField("response_format", "json"))
+	require.NoError(t, writer.WriteField("model", "whisper-1"))
+	require.NoError(t, writer.Close())
+
+	rewritten, err := setMultipartField(body.Bytes(), writer.FormDataContentType(), "response_format", "verbose_json")
+	require.NoError(t, err)
+
+	// the content type of the request still applies to the rewritten body
+	form, err := multipart.NewReader(bytes.NewReader(rewritten), writer.Boundary()).ReadForm(1 << 20)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"verbose_json"}, form.Value["response_format"])
+	assert.Equal(t, []string{"whisper-1"}, form.Value["model"])
+	require.Len(t, form.File["file"], 1)
+	file, err := form.File["file"][0].Open()
+	require.NoError(t, err)
+	content, err := io.ReadAll(file)
+	require.NoError(t, err)
+	assert.Equal(t, "audio", string(content))
+}
+
+func TestGetDurationFromSRT(t *testing.T) {
+	srt := "1\n00:00:00,000 --> 00:00:02,500\nHello\n\n2\n00:00:02,500 --> 00:01:05,250\nworld\n"
+	assert.Equal(t, 65.25, getDurationFromSRT([]byte(srt)))
+
+	vtt := "WEBVTT\n\n00:00.000 --> 00:03.500\nHello\n\n01:00:03.500 --> 01:00:04.000 align:start\nworld\n"
+	assert.Equal(t, 3604.0, getDurationFromSRT([]byte(vtt)))
+
+	assert.Equal(t, 0.0, getDurationFromSRT([]byte("no cues")))
+}
+
+func TestFormatTranscription(t *testing.T) {
+	body, err := formatTranscription("Hello world", "json")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"text": "Hello world"}`, string(body))
+
+	body, err = formatTranscription("Hello world", "text")
+	require.NoError(t, err)
+	assert.Equal(t, "Hello world\n", string(body))
+}
@@ -0,0 +1,226 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/logger"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/guardrail"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+type moderationRequest struct {
+	Model string `json:"model"`
+	Input string `json:"input"`
+}
+
+type moderationResponse struct {
+	Results []struct {
+		Flagged    bool            `json:"flagged"`
+		Categories map[string]bool `json:"categories"`
+	} `json:"results"`
+	Error *relaymodel.Error `json:"error,omitempty"`
+}
+
+// moderationChannelTypes serve the OpenAI moderation api as is, Azure and the other providers don't
+var moderationChannelTypes = []int{
+	channeltype.OpenAI,
+	channeltype.API2D,
+	channeltype.CloseAI,
+	channeltype.OpenAISB,
+	channeltype.OpenAIMax,
+	channeltype.OhMyGPT,
+	channeltype.Custom,
+	channeltype.AIProxy,
+	channeltype.API2GPT,
+	channeltype.AIGC2D,
+	channeltype.OpenAICompatible,
+}
+
+// moderate sends text to the moderation model through a channel of the user's group
+func moderate(ctx context.Context, group string, modelName string, text string) (bool, []string, error) {
+	channel, err := dbmodel.CacheGetRandomSatisfiedChannelOfTypes(group, modelName, moderationChannelTypes)
+	if err != nil {
+		return false, nil, fmt.Errorf("no channel available for moderation model %s: %w", modelName, err)
+	}
+	baseURL := channel.GetBaseURL()
+	if baseURL == "" {
+		baseURL = channeltype.ChannelBaseURLs[channel.Type]
+	}
+	jsonData, err := json.Marshal(moderationRequest{Model: modelName, Input: text})
+	if err != nil {
+		return false, nil, err
+	}
+	fullRequestURL := openai.GetFullRequestURL(baseURL, "/v1/moderations", channel.Type)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fullRequestURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return false, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// multi-key channels keep one key per line, the key is picked like for relayed requests
+	key, _ := dbmodel.SelectChannelKey(channel)
+	req.Header.Set("Authorization", "Bearer "+key)
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return false, nil, err
+	}
+	defer resp.Body.Close()
+	var moderationResp moderationResponse
+	err = json.NewDecoder(resp.Body).Decode(&moderationResp)
+	if err != nil {
+		return false, nil, err
+	}
+	if moderationResp.Error != nil {
+		return false, nil, fmt.Errorf("moderation request failed: %s", moderationResp.Error.Message)
+	}
+	var categories []string
+	flagged := false
+	for _, result := range moderationResp.Results {
+		if !result.Flagged {
+			continue
+		}
+		flagged = true
+		for category, hit := range result.Categories {
+			if hit {
+				categories = append(categories, category)
+			}
+		}
+	}
+	sort.Strings(categories)
+	return flagged, categories, nil
+}
+
+func recordGuardrailLog(ctx context.Context, meta *meta.Meta, stage string, result *guardrail.Result) {
+	logger.Warnf(ctx, "guardrail violation on %s: %s", stage, result.String())
+	dbmodel.RecordGuardrailLog(ctx, &dbmodel.Log{
+		UserId:    meta.UserId,
+		ChannelId: meta.ChannelId,
+		ModelName: meta.ActualModelName,
+		TokenName: meta.TokenName,
+		Content:   fmt.Sprintf("Guardrail %s, blocked: %t, violations: %s", stage, result.Blocked, result.String()),
+	})
+}
+
+func blockedError(stage string, result *guardrail.Result) *relaymodel.ErrorWithStatusCode {
+	rules := make([]string, 0, len(result.Violations))
+	for _, violation := range result.Violations {
+		if violation.Action == guardrail.ActionBlock {
+			rules = append(rules, violation.Rule)
+		}
+	}
+	err := fmt.Errorf("the %s was blocked by the content policy: %s", stage, strings.Join(rules, ", "))
+	return openai.ErrorWrapper(err, guardrail.ErrorCode, http.StatusBadRequest)
+}
+
+// checkRequestGuardrail runs the configured checks on the request before it is relayed
+func checkRequestGuardrail(ctx context.Context, meta *meta.Meta, textRequest *relaymodel.GeneralOpenAIRequest) *relaymodel.ErrorWithStatusCode {
+	if !guardrail.IsEnabled() {
+		return nil
+	}
+	result := guardrail.CheckRequest(textRequest)
+	cfg := guardrail.GetConfig()
+	if !result.Blocked && cfg.ModerationModel != "" {
+		flagged, categories, err := moderate(ctx, meta.Group, cfg.ModerationModel, guardrail.ExtractText(textRequest))
+		if err != nil {
+			logger.Errorf(ctx, "guardrail moderation failed: %s", err.Error())
+			if cfg.FailClosed {
+				result.Violations = append(result.Violations, guardrail.Violation{Rule: "moderation", Action: guardrail.ActionBlock, Detail: "moderation unavailable"})
+				result.Blocked = true
+			}
+		} else if flagged {
+			result.Violations = append(result.Violations, guardrail.Violation{Rule: "moderation", Action: guardrail.ActionBlock, Detail: strings.Join(categories, ",")})
+			result.Blocked = true
+		}
+	}
+	if !result.HasViolation() {
+		return nil
+	}
+	recordGuardrailLog(ctx, meta, "request", result)
+	if result.Blocked {
+		return blockedError("request", result)
+	}
+	meta.GuardrailRedacted = true
+	return nil
+}
+
+// responseBuffer holds the response written by the adaptor so that it can be checked before being sent
+type responseBuffer struct {
+	gin.ResponseWriter
+	body       bytes.Buffer
+	statusCode int
+}
+
+func (w *responseBuffer) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+}
+
+func (w *responseBuffer) WriteHeaderNow() {}
+
+func (w *responseBuffer) Flush() {}
+
+func (w *responseBuffer) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *responseBuffer) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *responseBuffer) Status() int {
+	return w.statusCode
+}
+
+func (w *responseBuffer) Size() int {
+	return w.body.Len()
+}
+
+func (w *responseBuffer) Written() bool {
+	return w.body.Len() != 0
+}
+
+func shouldCheckResponse(meta *meta.Meta) bool {
+	return !meta.IsStream && guardrail.IsEnabled() && guardrail.GetConfig().CheckResponse
+}
+
+func bufferResponse(c *gin.Context) *responseBuffer {
+	buffer := &responseBuffer{ResponseWriter: c.Writer, statusCode: http.StatusOK}
+	c.Writer = buffer
+	return buffer
+}
+
+// flushResponseWithGuardrail checks the buffered response and writes it to the client if allowed
+func flushResponseWithGuardrail(c *gin.Context, meta *meta.Meta, buffer *responseBuffer) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	c.Writer = buffer.ResponseWriter
+	body := buffer.body.Bytes()
+	result, newBody, err := guardrail.CheckResponse(body)
+	if err != nil {
+		logger.Errorf(ctx, "guardrail check response failed: %s", err.Error())
+	}
+	if result.HasViolation() {
+		recordGuardrailLog(ctx, meta, "response", result)
+		if result.Blocked {
+			return blockedError("response", result)
+		}
+		body = newBody
+		c.Writer.Header().Del("Content-Length")
+	}
+	c.Writer.WriteHeader(buffer.statusCode)
+	_, err = c.Writer.Write(body)
+	if err != nil {
+		logger.Errorf(ctx, "failed to write response: %s", err.Error())
+	}
+	return nil
+}
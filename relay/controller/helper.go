@@ -2,6 +2,7 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
@@ -18,11 +19,13 @@ import (
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/billing"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/controller/validator"
 	"github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/parampolicy"
 	"github.com/songquanpeng/one-api/relay/relaymode"
 )
 
@@ -67,16 +70,28 @@ func getPreConsumedQuota(textRequest *relaymodel.GeneralOpenAIRequest, promptTok
 
 func preConsumeQuota(ctx context.Context, textRequest *relaymodel.GeneralOpenAIRequest, promptTokens int, ratio float64, meta *meta.Meta) (int64, *relaymodel.ErrorWithStatusCode) {
 	preConsumedQuota := getPreConsumedQuota(textRequest, promptTokens, ratio)
+	if price := billingratio.GetModelPrice(textRequest.Model, meta.ChannelType); price != nil {
+		preConsumedQuota += int64(price.RequestQuota() * billingratio.GetGroupRatio(meta.Group))
+	}
+	// the model quota cap is always reserved, even for the users trusted below
+	err := model.PreConsumeTokenModelQuota(meta.TokenModelQuotaId, preConsumedQuota)
+	if err != nil {
+		return preConsumedQuota, openai.ErrorWrapper(err, "insufficient_token_model_quota", http.StatusForbidden)
+	}
+	meta.TokenModelPreConsumedQuota = preConsumedQuota
 
 	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
 	if err != nil {
+		billing.ReturnTokenModelQuota(meta.TokenModelQuotaId, meta.TokenModelPreConsumedQuota)
 		return preConsumedQuota, openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
 	}
 	if userQuota-preConsumedQuota < 0 {
+		billing.ReturnTokenModelQuota(meta.TokenModelQuotaId, meta.TokenModelPreConsumedQuota)
 		return preConsumedQuota, openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
 	}
 	err = model.CacheDecreaseUserQuota(meta.UserId, preConsumedQuota)
 	if err != nil {
+		billing.ReturnTokenModelQuota(meta.TokenModelQuotaId, meta.TokenModelPreConsumedQuota)
 		return preConsumedQuota, openai.ErrorWrapper(err, "decrease_user_quota_failed", http.StatusInternalServerError)
 	}
 	if userQuota > 100*preConsumedQuota {
@@ -88,6 +103,7 @@ func preConsumeQuota(ctx context.Context, textRequest *relaymodel.GeneralOpenAIR
 	if preConsumedQuota > 0 {
 		err := model.PreConsumeTokenQuota(meta.TokenId, preConsumedQuota)
 		if err != nil {
+			billing.ReturnTokenModelQuota(meta.TokenModelQuotaId, meta.TokenModelPreConsumedQuota)
 			return preConsumedQuota, openai.ErrorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
 		}
 	}
@@ -103,7 +119,20 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 	completionRatio := billingratio.GetCompletionRatio(textRequest.Model, meta.ChannelType)
 	promptTokens := usage.PromptTokens
 	completionTokens := usage.CompletionTokens
-	quota = int64(math.Ceil((float64(promptTokens) + float64(completionTokens)*completionRatio) * ratio))
+	// tiered and time of day prices depend on the actual prompt size and the time the request started
+	pricingRule := billingratio.GetPricingRule(textRequest.Model, meta.Group, promptTokens, meta.StartTime)
+	// models priced per request are charged on top of their tokens
+	var requestQuota float64
+	price := billingratio.GetModelPrice(textRequest.Model, meta.ChannelType)
+	if price != nil {
+		requestQuota = price.RequestQuota()
+	}
+	cost := getTextCost(meta, pricingRule, modelRatio, completionRatio, promptTokens, completionTokens, requestQuota)
+	if pricingRule != nil {
+		modelRatio, completionRatio, groupRatio = pricingRule.Apply(modelRatio, completionRatio, groupRatio)
+		ratio = modelRatio * groupRatio
+	}
+	quota = int64(math.Ceil((float64(promptTokens)+float64(completionTokens)*completionRatio)*ratio + requestQuota*groupRatio))
 	if ratio != 0 && quota <= 0 {
 		quota = 1
 	}
@@ -112,6 +141,7 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 		// in this case, must be some error happened
 		// we cannot just return, because we may have to return the pre-consumed quota
 		quota = 0
+		cost = 0
 	}
 	quotaDelta := quota - preConsumedQuota
 	err := model.PostConsumeTokenQuota(meta.TokenId, quotaDelta)
@@ -123,6 +153,15 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 		logger.Error(ctx, "error update user quota cache: "+err.Error())
 	}
 	logContent := fmt.Sprintf("Multiplier: %.2f × %.2f × %.2f", modelRatio, groupRatio, completionRatio)
+	if requestQuota != 0 {
+		logContent += fmt.Sprintf(", per request: $%g", price.PerRequest)
+	}
+	if pricingRule != nil {
+		logContent += fmt.Sprintf(", pricing rule: %s", pricingRule.Name)
+	}
+	if len(meta.ParamPolicyChanges) != 0 {
+		logContent += fmt.Sprintf(", param policy: %s", strings.Join(meta.ParamPolicyChanges, "; "))
+	}
 	model.RecordConsumeLog(ctx, &model.Log{
 		UserId:            meta.UserId,
 		ChannelId:         meta.ChannelId,
@@ -131,6 +170,7 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 		ModelName:         textRequest.Model,
 		TokenName:         meta.TokenName,
 		Quota:             int(quota),
+		Cost:              int(cost),
 		Content:           logContent,
 		IsStream:          meta.IsStream,
 		ElapsedTime:       helper.CalcElapsedTime(meta.StartTime),
@@ -138,6 +178,17 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 	})
 	model.UpdateUserUsedQuotaAndRequestCount(meta.UserId, quota)
 	model.UpdateChannelUsedQuota(meta.ChannelId, quota)
+	model.IncreaseTokenModelUsedQuota(meta.TokenModelQuotaId, quota-meta.TokenModelPreConsumedQuota)
+}
+
+// getTextCost returns what the upstream charges us for a request, in quota. Pricing rules only change what users
+// are charged, except prompt tiers which follow the list prices of the upstream
+func getTextCost(meta *meta.Meta, pricingRule *billingratio.PricingRule, modelRatio float64, completionRatio float64, promptTokens int, completionTokens int, requestQuota float64) int64 {
+	if pricingRule != nil && pricingRule.IsPromptTier() {
+		modelRatio, completionRatio, _ = pricingRule.Apply(modelRatio, completionRatio, 1)
+	}
+	costRatio := billing.CostRatio(&meta.Config, meta.ActualModelName, modelRatio)
+	return int64(math.Ceil((float64(promptTokens)+float64(completionTokens)*completionRatio)*costRatio + requestQuota))
 }
 
 func getMappedModelName(modelName string, mapping map[string]string) (string, bool) {
@@ -196,3 +247,48 @@ func setSystemPrompt(ctx context.Context, request *relaymodel.GeneralOpenAIReque
 	logger.Infof(ctx, "add system prompt")
 	return true
 }
+
+// applyParamPolicy applies the policy to the raw fields of the request, the typed request is updated from them.
+// The fields are returned when the policy changed the request, so the fields unknown to the typed request are kept.
+func applyParamPolicy(c *gin.Context, request *relaymodel.GeneralOpenAIRequest, meta *meta.Meta) (*parampolicy.Policy, map[string]any, error) {
+	policy, err := parampolicy.Resolve(meta.Group, meta.ParamPolicy)
+	if err != nil {
+		return nil, nil, err
+	}
+	if policy.IsEmpty() {
+		return nil, nil, nil
+	}
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	fields := make(map[string]any)
+	if err = json.Unmarshal(requestBody, &fields); err != nil {
+		return nil, nil, err
+	}
+	// the typed request carries the mapped model and the system prompt
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = json.Unmarshal(jsonData, &fields); err != nil {
+		return nil, nil, err
+	}
+	changes := policy.Apply(fields)
+	if len(changes) == 0 {
+		return policy, nil, nil
+	}
+	jsonData, err = json.Marshal(fields)
+	if err != nil {
+		return nil, nil, err
+	}
+	newRequest := relaymodel.GeneralOpenAIRequest{}
+	if err = json.Unmarshal(jsonData, &newRequest); err != nil {
+		return nil, nil, fmt.Errorf("failed to apply param policy: %w", err)
+	}
+	*request = newRequest
+	logger.Infof(c.Request.Context(), "param policy applied: %s", strings.Join(changes, "; "))
+	meta.ParamPolicyChanges = changes
+	meta.IsStream = request.Stream
+	return policy, fields, nil
+}
@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestApplyParamPolicy(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{
+		"model": "gpt-4o",
+		"max_tokens": 4096,
+		"messages": [{"role": "user", "content": "hi"}],
+		"prediction": {"type": "content"}
+	}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	textRequest := &relaymodel.GeneralOpenAIRequest{}
+	require.NoError(t, common.UnmarshalBodyReusable(c, textRequest))
+	textRequest.Model = "gpt-4o-mapped"
+	m := &meta.Meta{
+		APIType:     apitype.OpenAI,
+		ParamPolicy: `{"set": {"service_tier": "flex"}, "max": {"max_tokens": 1000}, "remove": ["prediction"]}`,
+	}
+
+	policy, fields, err := applyParamPolicy(c, textRequest, m)
+	require.NoError(t, err)
+	assert.Equal(t, 1000, textRequest.MaxTokens)
+	assert.Equal(t, "gpt-4o-mapped", textRequest.Model)
+	assert.Len(t, m.ParamPolicyChanges, 3)
+
+	adaptor := &openai.Adaptor{}
+	adaptor.Init(m)
+	requestBody, err := getRequestBody(c, m, textRequest, adaptor, policy, fields)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(requestBody)
+	// service_tier is unknown to GeneralOpenAIRequest, it must reach the upstream anyway
+	assert.Contains(t, string(body), `"service_tier":"flex"`)
+	assert.Contains(t, string(body), `"model":"gpt-4o-mapped"`)
+	assert.NotContains(t, string(body), "prediction")
+}
+
+func TestGetTextCost(t *testing.T) {
+	require.NoError(t, billingratio.UpdatePricingRulesByJSONString(`[
+		{"name": "long context", "models": ["gemini-1.5-pro*"], "min_prompt_tokens": 1000, "multiplier": 2},
+		{"name": "off-peak", "models": ["deepseek-chat"], "start_time": "00:00", "end_time": "23:59", "multiplier": 0.5},
+		{"name": "vip", "groups": ["vip"], "model_ratio": 0.1, "completion_ratio": 1}
+	]`))
+	defer func() { _ = billingratio.UpdatePricingRulesByJSONString("[]") }()
+	now := time.Now()
+	m := &meta.Meta{ActualModelName: "gemini-1.5-pro-002"}
+
+	// the prompt tier is the upstream price of long prompts
+	rule := billingratio.GetPricingRule("gemini-1.5-pro-002", "default", 2000, now)
+	require.NotNil(t, rule)
+	assert.Equal(t, int64((2000+100*4)*2), getTextCost(m, rule, 1, 4, 2000, 100, 0))
+
+	// discounts and group prices only change what the user is charged
+	m.ActualModelName = "deepseek-chat"
+	rule = billingratio.GetPricingRule("deepseek-chat", "default", 10, time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local))
+	require.NotNil(t, rule)
+	assert.Equal(t, int64(10+20*2), getTextCost(m, rule, 1, 2, 10, 20, 0))
+	m.ActualModelName = "gpt-4o"
+	rule = billingratio.GetPricingRule("gpt-4o", "vip", 10, now)
+	require.NotNil(t, rule)
+	assert.Equal(t, int64((10+20*4)*2+5), getTextCost(m, rule, 2, 4, 10, 20, 5))
+
+	// the channel cost settings apply on top
+	m.Config.CostMultiplier = 0.5
+	assert.Equal(t, int64(10+20*4), getTextCost(m, rule, 2, 4, 10, 20, 0))
+	assert.Equal(t, int64(10+20*4), getTextCost(m, nil, 2, 4, 10, 20, 0))
+}
@@ -7,7 +7,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 
@@ -17,15 +22,27 @@ import (
 	"github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/relay"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/billing"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
 )
 
-func getImageRequest(c *gin.Context, _ int) (*relaymodel.ImageRequest, error) {
+// isImageUploadMode tells whether the relay mode takes images uploaded as multipart/form-data
+func isImageUploadMode(relayMode int) bool {
+	return relayMode == relaymode.ImagesEdits || relayMode == relaymode.ImagesVariations
+}
+
+func getImageRequest(c *gin.Context, relayMode int) (*relaymodel.ImageRequest, error) {
 	imageRequest := &relaymodel.ImageRequest{}
-	err := common.UnmarshalBodyReusable(c, imageRequest)
+	var err error
+	if isImageUploadMode(relayMode) {
+		err = parseMultipartImageRequest(c, imageRequest)
+	} else {
+		err = common.UnmarshalBodyReusable(c, imageRequest)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -41,6 +58,140 @@ func getImageRequest(c *gin.Context, _ int) (*relaymodel.ImageRequest, error) {
 	return imageRequest, nil
 }
 
+// parseMultipartImageRequest reads the fields and the files of an edits or variations request
+func parseMultipartImageRequest(c *gin.Context, imageRequest *relaymodel.ImageRequest) error {
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return err
+	}
+	mediaType, params, err := mime.ParseMediaType(c.Request.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		return errors.New("the request must be multipart/form-data")
+	}
+	// the body is forwarded as is when the request doesn't need to be encoded again
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	reader := multipart.NewReader(bytes.NewReader(requestBody), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return err
+		}
+		value := string(data)
+		switch part.FormName() {
+		case "image", "image[]":
+			imageRequest.Image = append(imageRequest.Image, newImageFile(part, data))
+		case "mask":
+			imageRequest.Mask = newImageFile(part, data)
+		case "model":
+			imageRequest.Model = value
+		case "prompt":
+			imageRequest.Prompt = value
+		case "n":
+			if imageRequest.N, err = strconv.Atoi(value); err != nil {
+				return fmt.Errorf("invalid n: %s", value)
+			}
+		case "size":
+			imageRequest.Size = value
+		case "quality":
+			imageRequest.Quality = value
+		case "response_format":
+			imageRequest.ResponseFormat = value
+		case "user":
+			imageRequest.User = value
+		case "background":
+			imageRequest.Background = value
+		case "output_format":
+			imageRequest.OutputFormat = value
+		case "output_compression":
+			compression, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid output_compression: %s", value)
+			}
+			imageRequest.OutputCompression = &compression
+		}
+	}
+}
+
+func newImageFile(part *multipart.Part, data []byte) *relaymodel.ImageFile {
+	return &relaymodel.ImageFile{
+		Filename:    part.FileName(),
+		ContentType: part.Header.Get("Content-Type"),
+		Data:        data,
+	}
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func writeImageFile(writer *multipart.Writer, fieldName string, file *relaymodel.ImageFile) error {
+	filename := file.Filename
+	if filename == "" {
+		filename = fieldName
+	}
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, fieldName, quoteEscaper.Replace(filename)))
+	// upstreams check the type of the images, it can't be left as application/octet-stream
+	header.Set("Content-Type", file.MimeType())
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	_, err = part.Write(file.Data)
+	return err
+}
+
+// imageMultipartBody encodes an edits or variations request for the upstream, it returns the body and its content type
+func imageMultipartBody(imageRequest *relaymodel.ImageRequest) (io.Reader, string, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	fields := [][2]string{
+		{"model", imageRequest.Model},
+		{"prompt", imageRequest.Prompt},
+		{"n", strconv.Itoa(imageRequest.N)},
+		{"size", imageRequest.Size},
+		{"quality", imageRequest.Quality},
+		{"response_format", imageRequest.ResponseFormat},
+		{"user", imageRequest.User},
+		{"background", imageRequest.Background},
+		{"output_format", imageRequest.OutputFormat},
+	}
+	if imageRequest.OutputCompression != nil {
+		fields = append(fields, [2]string{"output_compression", strconv.Itoa(*imageRequest.OutputCompression)})
+	}
+	for _, field := range fields {
+		if field[1] == "" {
+			continue
+		}
+		if err := writer.WriteField(field[0], field[1]); err != nil {
+			return nil, "", err
+		}
+	}
+	imageField := "image"
+	if len(imageRequest.Image) > 1 {
+		imageField = "image[]"
+	}
+	for _, image := range imageRequest.Image {
+		if err := writeImageFile(writer, imageField, image); err != nil {
+			return nil, "", err
+		}
+	}
+	if imageRequest.Mask != nil {
+		if err := writeImageFile(writer, "mask", imageRequest.Mask); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+	return body, writer.FormDataContentType(), nil
+}
+
 func isValidImageSize(model string, size string) bool {
 	if model == "cogview-3" || billingratio.ImageSizeRatios[model] == nil {
 		return true
@@ -66,9 +217,21 @@ func getImageSizeRatio(model string, size string) float64 {
 	return 1
 }
 
-func validateImageRequest(imageRequest *relaymodel.ImageRequest, _ *meta.Meta) *relaymodel.ErrorWithStatusCode {
-	// check prompt length
-	if imageRequest.Prompt == "" {
+func isValidImageQuality(model string, quality string) bool {
+	qualityRatios, ok := billingratio.ImageQualityRatios[model]
+	if !ok || quality == "" {
+		return true
+	}
+	_, ok = qualityRatios[quality]
+	return ok
+}
+
+func validateImageRequest(imageRequest *relaymodel.ImageRequest, meta *meta.Meta) *relaymodel.ErrorWithStatusCode {
+	if isImageUploadMode(meta.Mode) && len(imageRequest.Image) == 0 {
+		return openai.ErrorWrapper(errors.New("image is required"), "image_missing", http.StatusBadRequest)
+	}
+	// check prompt length, variations don't take a prompt
+	if imageRequest.Prompt == "" && meta.Mode != relaymode.ImagesVariations {
 		return openai.ErrorWrapper(errors.New("prompt is required"), "prompt_missing", http.StatusBadRequest)
 	}
 
@@ -85,6 +248,27 @@ func validateImageRequest(imageRequest *relaymodel.ImageRequest, _ *meta.Meta) *
 	if !isWithinRange(imageRequest.Model, imageRequest.N) {
 		return openai.ErrorWrapper(errors.New("invalid value of n"), "n_not_within_range", http.StatusBadRequest)
 	}
+
+	if !isValidImageQuality(imageRequest.Model, imageRequest.Quality) {
+		return openai.ErrorWrapper(errors.New("quality not supported for this image model"), "quality_not_supported", http.StatusBadRequest)
+	}
+	switch imageRequest.Background {
+	case "", "auto", "opaque", "transparent":
+	default:
+		return openai.ErrorWrapper(errors.New("background must be transparent, opaque or auto"), "invalid_background", http.StatusBadRequest)
+	}
+	switch imageRequest.OutputFormat {
+	case "", "png", "webp":
+	case "jpeg":
+		if imageRequest.Background == "transparent" {
+			return openai.ErrorWrapper(errors.New("a transparent background requires the png or webp output format"), "invalid_output_format", http.StatusBadRequest)
+		}
+	default:
+		return openai.ErrorWrapper(errors.New("output_format must be png, jpeg or webp"), "invalid_output_format", http.StatusBadRequest)
+	}
+	if compression := imageRequest.OutputCompression; compression != nil && (*compression < 0 || *compression > 100) {
+		return openai.ErrorWrapper(errors.New("output_compression must be between 0 and 100"), "invalid_output_compression", http.StatusBadRequest)
+	}
 	return nil
 }
 
@@ -100,6 +284,13 @@ func getImageCostRatio(imageRequest *relaymodel.ImageRequest) (float64, error) {
 			imageCostRatio *= 1.5
 		}
 	}
+	if qualityRatios, ok := billingratio.ImageQualityRatios[imageRequest.Model]; ok {
+		quality := imageRequest.Quality
+		if quality == "" {
+			quality = "auto"
+		}
+		imageCostRatio *= qualityRatios[quality]
+	}
 	return imageCostRatio, nil
 }
 
@@ -135,12 +326,20 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	c.Set("response_format", imageRequest.ResponseFormat)
 
 	var requestBody io.Reader
+	contentType := c.Request.Header.Get("Content-Type")
 	if isModelMapped || meta.ChannelType == channeltype.Azure { // make Azure channel request body
-		jsonStr, err := json.Marshal(imageRequest)
-		if err != nil {
-			return openai.ErrorWrapper(err, "marshal_image_request_failed", http.StatusInternalServerError)
+		if isImageUploadMode(meta.Mode) {
+			requestBody, contentType, err = imageMultipartBody(imageRequest)
+			if err != nil {
+				return openai.ErrorWrapper(err, "encode_image_request_failed", http.StatusInternalServerError)
+			}
+		} else {
+			jsonStr, err := json.Marshal(imageRequest)
+			if err != nil {
+				return openai.ErrorWrapper(err, "marshal_image_request_failed", http.StatusInternalServerError)
+			}
+			requestBody = bytes.NewBuffer(jsonStr)
 		}
-		requestBody = bytes.NewBuffer(jsonStr)
 	} else {
 		requestBody = c.Request.Body
 	}
@@ -166,6 +365,12 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 			return openai.ErrorWrapper(err, "marshal_image_request_failed", http.StatusInternalServerError)
 		}
 		requestBody = bytes.NewBuffer(jsonStr)
+		contentType = "application/json"
+	}
+	if originalContentType := c.Request.Header.Get("Content-Type"); contentType != originalContentType {
+		// the adaptors send the content type of the client request, it's restored for the retries
+		c.Request.Header.Set("Content-Type", contentType)
+		defer c.Request.Header.Set("Content-Type", originalContentType)
 	}
 
 	modelRatio := billingratio.GetModelRatio(imageModel, meta.ChannelType)
@@ -173,22 +378,33 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	ratio := modelRatio * groupRatio
 	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
 
-	var quota int64
+	costRatio := billing.CostRatio(&meta.Config, imageModel, modelRatio)
+
+	var quota, cost int64
 	switch meta.ChannelType {
 	case channeltype.Replicate:
 		// replicate always return 1 image
 		quota = int64(ratio * imageCostRatio * 1000)
+		cost = int64(costRatio * imageCostRatio * 1000)
 	default:
 		quota = int64(ratio*imageCostRatio*1000) * int64(imageRequest.N)
+		cost = int64(costRatio*imageCostRatio*1000) * int64(imageRequest.N)
 	}
 
 	if userQuota-quota < 0 {
 		return openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
 	}
+	// the price of an image is known upfront, so the reservation is the final charge
+	err = model.PreConsumeTokenModelQuota(meta.TokenModelQuotaId, quota)
+	if err != nil {
+		return openai.ErrorWrapper(err, "insufficient_token_model_quota", http.StatusForbidden)
+	}
+	meta.TokenModelPreConsumedQuota = quota
 
 	// do request
 	resp, err := adaptor.DoRequest(c, meta, requestBody)
 	if err != nil {
+		billing.ReturnTokenModelQuota(meta.TokenModelQuotaId, meta.TokenModelPreConsumedQuota)
 		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
 		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
 	}
@@ -197,6 +413,7 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		if resp != nil &&
 			resp.StatusCode != http.StatusCreated && // replicate returns 201
 			resp.StatusCode != http.StatusOK {
+			billing.ReturnTokenModelQuota(meta.TokenModelQuotaId, meta.TokenModelPreConsumedQuota)
 			return
 		}
 
@@ -219,6 +436,7 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 				ModelName:        imageRequest.Model,
 				TokenName:        tokenName,
 				Quota:            int(quota),
+				Cost:             int(cost),
 				Content:          logContent,
 			})
 			model.UpdateUserUsedQuotaAndRequestCount(meta.UserId, quota)
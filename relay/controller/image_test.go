@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n")
+
+func newImageContext(body io.Reader, contentType string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/v1/images/edits", body)
+	c.Request.Header.Set("Content-Type", contentType)
+	return c
+}
+
+func TestMultipartImageRequest(t *testing.T) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	_ = writer.WriteField("model", "gpt-image-1")
+	_ = writer.WriteField("prompt", "add a hat")
+	_ = writer.WriteField("n", "2")
+	_ = writer.WriteField("quality", "low")
+	_ = writer.WriteField("output_compression", "80")
+	for _, name := range []string{"cat.png", "dog.png"} {
+		part, _ := writer.CreateFormFile("image[]", name) // sent as application/octet-stream
+		_, _ = part.Write(append(pngHeader, name...))
+	}
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="mask"; filename="mask.png"`)
+	header.Set("Content-Type", "image/png")
+	part, _ := writer.CreatePart(header)
+	_, _ = part.Write(pngHeader)
+	require.NoError(t, writer.Close())
+
+	imageRequest, err := getImageRequest(newImageContext(body, writer.FormDataContentType()), relaymode.ImagesEdits)
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-image-1", imageRequest.Model)
+	assert.Equal(t, "add a hat", imageRequest.Prompt)
+	assert.Equal(t, 2, imageRequest.N)
+	assert.Equal(t, "1024x1024", imageRequest.Size)
+	assert.Equal(t, 80, *imageRequest.OutputCompression)
+	require.Len(t, imageRequest.Image, 2)
+	assert.Equal(t, "dog.png", imageRequest.Image[1].Filename)
+	assert.Equal(t, "image/png", imageRequest.Image[0].MimeType())
+	require.NotNil(t, imageRequest.Mask)
+
+	// the body sent upstream carries the same request, with the sniffed types
+	imageRequest.Model = "gpt-image-1-mapped"
+	upstreamBody, contentType, err := imageMultipartBody(imageRequest)
+	require.NoError(t, err)
+	upstreamRequest, err := getImageRequest(newImageContext(upstreamBody, contentType), relaymode.ImagesEdits)
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-image-1-mapped", upstreamRequest.Model)
+	assert.Equal(t, "low", upstreamRequest.Quality)
+	require.Len(t, upstreamRequest.Image, 2)
+	assert.Equal(t, "image/png", upstreamRequest.Image[0].ContentType)
+	assert.Equal(t, imageRequest.Image[1].Data, upstreamRequest.Image[1].Data)
+	assert.Equal(t, imageRequest.Mask.Data, upstreamRequest.Mask.Data)
+
+	_, err = getImageRequest(newImageContext(bytes.NewBufferString(`{"prompt": "a cat"}`), "application/json"), relaymode.ImagesEdits)
+	assert.Error(t, err)
+}
+
+func TestGetImageCostRatio(t *testing.T) {
+	cases := []struct {
+		request relaymodel.ImageRequest
+		ratio   float64
+	}{
+		{relaymodel.ImageRequest{Model: "dall-e-2", Size: "512x512"}, 1.125},
+		{relaymodel.ImageRequest{Model: "dall-e-3", Size: "1024x1792", Quality: "hd"}, 3},
+		{relaymodel.ImageRequest{Model: "gpt-image-1", Size: "1024x1024", Quality: "medium"}, 1},
+		{relaymodel.ImageRequest{Model: "gpt-image-1", Size: "1536x1024", Quality: "low"}, 0.375},
+		{relaymodel.ImageRequest{Model: "gpt-image-1", Size: "1024x1024"}, 4},
+	}
+	for _, c := range cases {
+		ratio, err := getImageCostRatio(&c.request)
+		require.NoError(t, err)
+		assert.InDelta(t, c.ratio, ratio, 1e-9, "%+v", c.request)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/parampolicy"
 )
 
 func RelayTextHelper(c *gin.Context) *model.ErrorWithStatusCode {
@@ -39,6 +40,16 @@ func RelayTextHelper(c *gin.Context) *model.ErrorWithStatusCode {
 	meta.ActualModelName = textRequest.Model
 	// set system prompt if not empty
 	systemPromptReset := setSystemPrompt(ctx, textRequest, meta.ForcedSystemPrompt)
+	// apply parameter policies of group & channel
+	paramPolicy, policyFields, err := applyParamPolicy(c, textRequest, meta)
+	if err != nil {
+		logger.Errorf(ctx, "applyParamPolicy failed: %s", err.Error())
+		return openai.ErrorWrapper(err, "apply_param_policy_failed", http.StatusInternalServerError)
+	}
+	// run guardrail checks before anything is sent upstream
+	if bizErr := checkRequestGuardrail(ctx, meta, textRequest); bizErr != nil {
+		return bizErr
+	}
 	// get model ratio & group ratio
 	modelRatio := billingratio.GetModelRatio(textRequest.Model, meta.ChannelType)
 	groupRatio := billingratio.GetGroupRatio(meta.Group)
@@ -54,45 +65,66 @@ func RelayTextHelper(c *gin.Context) *model.ErrorWithStatusCode {
 
 	adaptor := relay.GetAdaptor(meta.APIType)
 	if adaptor == nil {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		billing.ReturnTokenModelQuota(meta.TokenModelQuotaId, meta.TokenModelPreConsumedQuota)
 		return openai.ErrorWrapper(fmt.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
 	}
 	adaptor.Init(meta)
 
 	// get request body
-	requestBody, err := getRequestBody(c, meta, textRequest, adaptor)
+	requestBody, err := getRequestBody(c, meta, textRequest, adaptor, paramPolicy, policyFields)
 	if err != nil {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		billing.ReturnTokenModelQuota(meta.TokenModelQuotaId, meta.TokenModelPreConsumedQuota)
 		return openai.ErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
 	}
 
 	// do request
 	resp, err := adaptor.DoRequest(c, meta, requestBody)
 	if err != nil {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		billing.ReturnTokenModelQuota(meta.TokenModelQuotaId, meta.TokenModelPreConsumedQuota)
 		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
 		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
 	}
 	if isErrorHappened(meta, resp) {
 		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		billing.ReturnTokenModelQuota(meta.TokenModelQuotaId, meta.TokenModelPreConsumedQuota)
 		return RelayErrorHandler(resp)
 	}
 
 	// do response
+	var buffer *responseBuffer
+	if shouldCheckResponse(meta) {
+		buffer = bufferResponse(c)
+	}
 	usage, respErr := adaptor.DoResponse(c, resp, meta)
 	if respErr != nil {
+		if buffer != nil {
+			c.Writer = buffer.ResponseWriter
+		}
 		logger.Errorf(ctx, "respErr is not nil: %+v", respErr)
 		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		billing.ReturnTokenModelQuota(meta.TokenModelQuotaId, meta.TokenModelPreConsumedQuota)
 		return respErr
 	}
 	// post-consume quota
 	go postConsumeQuota(ctx, usage, meta, textRequest, ratio, preConsumedQuota, modelRatio, groupRatio, systemPromptReset)
+	if buffer != nil {
+		// the upstream has been paid for, so the quota is consumed even if the response is blocked
+		return flushResponseWithGuardrail(c, meta, buffer)
+	}
 	return nil
 }
 
-func getRequestBody(c *gin.Context, meta *meta.Meta, textRequest *model.GeneralOpenAIRequest, adaptor adaptor.Adaptor) (io.Reader, error) {
+func getRequestBody(c *gin.Context, meta *meta.Meta, textRequest *model.GeneralOpenAIRequest, adaptor adaptor.Adaptor, paramPolicy *parampolicy.Policy, policyFields map[string]any) (io.Reader, error) {
 	if !config.EnforceIncludeUsage &&
 		meta.APIType == apitype.OpenAI &&
 		meta.OriginModelName == meta.ActualModelName &&
 		meta.ChannelType != channeltype.Baichuan &&
-		meta.ForcedSystemPrompt == "" {
+		meta.ForcedSystemPrompt == "" &&
+		!meta.GuardrailRedacted &&
+		paramPolicy.IsEmpty() {
 		// no need to convert request for openai
 		return c.Request.Body, nil
 	}
@@ -109,6 +141,18 @@ func getRequestBody(c *gin.Context, meta *meta.Meta, textRequest *model.GeneralO
 		logger.Debugf(c.Request.Context(), "converted request json_marshal_failed: %s\n", err.Error())
 		return nil, err
 	}
+	if meta.APIType == apitype.OpenAI {
+		// forward the fields of the policy unknown to the typed request
+		jsonData, err = parampolicy.MergeFields(jsonData, policyFields)
+		if err != nil {
+			return nil, err
+		}
+	}
+	jsonData, err = paramPolicy.MergeExtra(jsonData)
+	if err != nil {
+		logger.Debugf(c.Request.Context(), "converted request merge_extra_failed: %s\n", err.Error())
+		return nil, err
+	}
 	logger.Debugf(c.Request.Context(), "converted request: \n%s", string(jsonData))
 	requestBody = bytes.NewBuffer(jsonData)
 	return requestBody, nil
@@ -0,0 +1,170 @@
+package guardrail
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+type Violation struct {
+	Rule   string `json:"rule"`
+	Action string `json:"action"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func (v Violation) String() string {
+	if v.Detail == "" {
+		return fmt.Sprintf("%s(%s)", v.Rule, v.Action)
+	}
+	return fmt.Sprintf("%s(%s): %s", v.Rule, v.Action, v.Detail)
+}
+
+type Result struct {
+	Violations []Violation
+	Blocked    bool
+	Redacted   bool
+}
+
+func (r *Result) add(violation Violation) {
+	r.Violations = append(r.Violations, violation)
+	switch violation.Action {
+	case ActionBlock:
+		r.Blocked = true
+	case ActionRedact:
+		r.Redacted = true
+	}
+}
+
+func (r *Result) HasViolation() bool {
+	return len(r.Violations) != 0
+}
+
+func (r *Result) String() string {
+	violations := make([]string, 0, len(r.Violations))
+	for _, violation := range r.Violations {
+		violations = append(violations, violation.String())
+	}
+	return strings.Join(violations, "; ")
+}
+
+// checkText runs the deny lists & pii detectors on text and returns the (possibly redacted) text
+func checkText(cfg *compiledConfig, text string, result *Result) string {
+	if text == "" {
+		return text
+	}
+	lowerText := strings.ToLower(text)
+	for _, keyword := range cfg.denyKeywords {
+		if strings.Contains(lowerText, keyword) {
+			result.add(Violation{Rule: "deny_keyword", Action: ActionBlock, Detail: keyword})
+		}
+	}
+	for _, pattern := range cfg.denyPatterns {
+		if pattern.MatchString(text) {
+			result.add(Violation{Rule: "deny_pattern", Action: ActionBlock, Detail: pattern.String()})
+		}
+	}
+	names := make([]string, 0, len(cfg.PII))
+	for name := range cfg.PII {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		action := cfg.PII[name]
+		count, redacted := findPII(piiDetectors[name], text)
+		if count == 0 {
+			continue
+		}
+		result.add(Violation{Rule: "pii_" + name, Action: action, Detail: fmt.Sprintf("%d match(es)", count)})
+		if action == ActionRedact {
+			text = redacted
+		}
+	}
+	return text
+}
+
+func checkAny(cfg *compiledConfig, value any, result *Result) any {
+	switch v := value.(type) {
+	case string:
+		return checkText(cfg, v, result)
+	case []any:
+		for i, item := range v {
+			v[i] = checkAny(cfg, item, result)
+		}
+		return v
+	case map[string]any:
+		// content parts like {"type": "text", "text": "..."}
+		if text, ok := v["text"].(string); ok {
+			v["text"] = checkText(cfg, text, result)
+		}
+		return v
+	}
+	return value
+}
+
+// CheckRequest checks the messages, prompt and input of the request, redacting in place when configured
+func CheckRequest(request *relaymodel.GeneralOpenAIRequest) *Result {
+	result := &Result{}
+	cfg := getCompiled()
+	if !cfg.Enabled {
+		return result
+	}
+	for i := range request.Messages {
+		request.Messages[i].Content = checkAny(cfg, request.Messages[i].Content, result)
+	}
+	request.Prompt = checkAny(cfg, request.Prompt, result)
+	request.Input = checkAny(cfg, request.Input, result)
+	return result
+}
+
+// CheckResponse checks the choices of an OpenAI-format response body and returns the (possibly redacted) body
+func CheckResponse(body []byte) (*Result, []byte, error) {
+	result := &Result{}
+	cfg := getCompiled()
+	if !cfg.Enabled || !cfg.CheckResponse {
+		return result, body, nil
+	}
+	var response map[string]any
+	err := json.Unmarshal(body, &response)
+	if err != nil {
+		return result, body, err
+	}
+	choices, ok := response["choices"].([]any)
+	if !ok {
+		return result, body, nil
+	}
+	for _, choice := range choices {
+		choiceMap, ok := choice.(map[string]any)
+		if !ok {
+			continue
+		}
+		if message, ok := choiceMap["message"].(map[string]any); ok {
+			message["content"] = checkAny(cfg, message["content"], result)
+		}
+		if text, ok := choiceMap["text"].(string); ok {
+			choiceMap["text"] = checkText(cfg, text, result)
+		}
+	}
+	if !result.Redacted {
+		return result, body, nil
+	}
+	body, err = json.Marshal(response)
+	return result, body, err
+}
+
+// ExtractText concatenates the text of the request, it is sent to the moderation model
+func ExtractText(request *relaymodel.GeneralOpenAIRequest) string {
+	var texts []string
+	for _, message := range request.Messages {
+		if content := message.StringContent(); content != "" {
+			texts = append(texts, content)
+		}
+	}
+	if prompt, ok := request.Prompt.(string); ok && prompt != "" {
+		texts = append(texts, prompt)
+	}
+	texts = append(texts, request.ParseInput()...)
+	return strings.Join(texts, "\n")
+}
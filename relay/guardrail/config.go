@@ -0,0 +1,114 @@
+package guardrail
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+const (
+	ActionBlock  = "block"
+	ActionRedact = "redact"
+)
+
+// ErrorCode is returned to the client when a request or response is blocked
+const ErrorCode = "content_policy_violation"
+
+type Config struct {
+	Enabled bool `json:"enabled"`
+	// DenyKeywords are matched case-insensitively, a match always blocks the request
+	DenyKeywords []string `json:"deny_keywords,omitempty"`
+	// DenyPatterns are regular expressions, a match always blocks the request
+	DenyPatterns []string `json:"deny_patterns,omitempty"`
+	// PII maps a detector name (email, card_number, id_number) to an action (block or redact)
+	PII map[string]string `json:"pii,omitempty"`
+	// ModerationModel is requested through an existing channel of the user's group, empty means disabled
+	ModerationModel string `json:"moderation_model,omitempty"`
+	// FailClosed blocks the request when the moderation model can't be reached
+	FailClosed bool `json:"fail_closed,omitempty"`
+	// CheckResponse also runs the checks on non-streaming responses
+	CheckResponse bool `json:"check_response,omitempty"`
+}
+
+type compiledConfig struct {
+	Config
+	denyKeywords []string
+	denyPatterns []*regexp.Regexp
+}
+
+var configLock sync.RWMutex
+var current = &compiledConfig{}
+
+func compile(cfg Config) (*compiledConfig, error) {
+	compiled := &compiledConfig{Config: cfg}
+	for _, keyword := range cfg.DenyKeywords {
+		keyword = strings.TrimSpace(keyword)
+		if keyword != "" {
+			compiled.denyKeywords = append(compiled.denyKeywords, strings.ToLower(keyword))
+		}
+	}
+	for _, pattern := range cfg.DenyPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deny pattern %q: %w", pattern, err)
+		}
+		compiled.denyPatterns = append(compiled.denyPatterns, re)
+	}
+	for name, action := range cfg.PII {
+		if _, ok := piiDetectors[name]; !ok {
+			return nil, fmt.Errorf("unknown pii detector: %s", name)
+		}
+		if action != ActionBlock && action != ActionRedact {
+			return nil, fmt.Errorf("invalid action for pii detector %s: %s", name, action)
+		}
+	}
+	return compiled, nil
+}
+
+func Config2JSONString() string {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	jsonBytes, err := json.Marshal(current.Config)
+	if err != nil {
+		logger.SysError("error marshalling guardrail config: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateConfigByJSONString(jsonStr string) error {
+	var cfg Config
+	err := json.Unmarshal([]byte(jsonStr), &cfg)
+	if err != nil {
+		return err
+	}
+	compiled, err := compile(cfg)
+	if err != nil {
+		return err
+	}
+	configLock.Lock()
+	defer configLock.Unlock()
+	current = compiled
+	return nil
+}
+
+func GetConfig() Config {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return current.Config
+}
+
+func IsEnabled() bool {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return current.Enabled
+}
+
+func getCompiled() *compiledConfig {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return current
+}
@@ -0,0 +1,49 @@
+package guardrail
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestCheckRequest(t *testing.T) {
+	err := UpdateConfigByJSONString(`{"enabled":true,"deny_keywords":["Secret Project"],"pii":{"email":"redact","card_number":"block"}}`)
+	assert.NoError(t, err)
+	defer func() {
+		_ = UpdateConfigByJSONString(`{}`)
+	}()
+
+	request := &relaymodel.GeneralOpenAIRequest{
+		Messages: []relaymodel.Message{{Role: "user", Content: "mail me at foo@example.com"}},
+	}
+	result := CheckRequest(request)
+	assert.False(t, result.Blocked)
+	assert.True(t, result.Redacted)
+	assert.Equal(t, "mail me at [REDACTED_EMAIL]", request.Messages[0].Content)
+
+	request = &relaymodel.GeneralOpenAIRequest{
+		Messages: []relaymodel.Message{{Role: "user", Content: "tell me about the secret project"}},
+	}
+	assert.True(t, CheckRequest(request).Blocked)
+
+	request = &relaymodel.GeneralOpenAIRequest{
+		Messages: []relaymodel.Message{{Role: "user", Content: []any{
+			map[string]any{"type": "text", "text": "my card is 4111 1111 1111 1111"},
+		}}},
+	}
+	assert.True(t, CheckRequest(request).Blocked)
+}
+
+func TestIsValidCardNumber(t *testing.T) {
+	assert.True(t, isValidCardNumber("4111-1111-1111-1111"))
+	assert.False(t, isValidCardNumber("4111-1111-1111-1112"))
+	assert.False(t, isValidCardNumber("1234"))
+}
+
+func TestUpdateConfigByJSONString(t *testing.T) {
+	assert.Error(t, UpdateConfigByJSONString(`{"pii":{"phone":"block"}}`))
+	assert.Error(t, UpdateConfigByJSONString(`{"pii":{"email":"drop"}}`))
+	assert.Error(t, UpdateConfigByJSONString(`{"deny_patterns":["("]}`))
+}
@@ -0,0 +1,64 @@
+package guardrail
+
+import (
+	"regexp"
+	"strings"
+)
+
+type piiDetector struct {
+	pattern     *regexp.Regexp
+	validate    func(match string) bool
+	replacement string
+}
+
+var piiDetectors = map[string]piiDetector{
+	"email": {
+		pattern:     regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+		replacement: "[REDACTED_EMAIL]",
+	},
+	"card_number": {
+		pattern:     regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`),
+		validate:    isValidCardNumber,
+		replacement: "[REDACTED_CARD_NUMBER]",
+	},
+	"id_number": {
+		// mainland China resident identity card & US social security number
+		pattern:     regexp.MustCompile(`\b\d{17}[\dXx]\b|\b\d{3}-\d{2}-\d{4}\b`),
+		replacement: "[REDACTED_ID_NUMBER]",
+	},
+}
+
+// isValidCardNumber checks the digits with the Luhn algorithm to reduce false positives
+func isValidCardNumber(match string) bool {
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(match)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		digit := int(digits[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// findPII returns the matches of the detector in text and the text with these matches replaced
+func findPII(detector piiDetector, text string) (int, string) {
+	count := 0
+	redacted := detector.pattern.ReplaceAllStringFunc(text, func(match string) string {
+		if detector.validate != nil && !detector.validate(match) {
+			return match
+		}
+		count++
+		return detector.replacement
+	})
+	return count, redacted
+}
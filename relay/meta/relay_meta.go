@@ -13,14 +13,18 @@ import (
 )
 
 type Meta struct {
-	Mode         int
-	ChannelType  int
-	ChannelId    int
-	TokenId      int
-	TokenName    string
-	UserId       int
-	Group        string
-	ModelMapping map[string]string
+	Mode        int
+	ChannelType int
+	ChannelId   int
+	TokenId     int
+	TokenName   string
+	// TokenModelQuotaId is the id of the token's quota cap for the requested model, 0 means no cap
+	TokenModelQuotaId int
+	// TokenModelPreConsumedQuota is the quota reserved against the model quota cap
+	TokenModelPreConsumedQuota int64
+	UserId                     int
+	Group                      string
+	ModelMapping               map[string]string
 	// BaseURL is the proxy url set in the channel config
 	BaseURL  string
 	APIKey   string
@@ -34,7 +38,13 @@ type Meta struct {
 	RequestURLPath     string
 	PromptTokens       int // only for DoResponse
 	ForcedSystemPrompt string
-	StartTime          time.Time
+	// ParamPolicy is the raw parameter policy set in the channel
+	ParamPolicy string
+	// ParamPolicyChanges records the changes applied by the parameter policies, for logging
+	ParamPolicyChanges []string
+	// GuardrailRedacted is set when the guardrail rewrote the request, so it can't be passed through as is
+	GuardrailRedacted bool
+	StartTime         time.Time
 }
 
 func GetByContext(c *gin.Context) *Meta {
@@ -44,6 +54,7 @@ func GetByContext(c *gin.Context) *Meta {
 		ChannelId:          c.GetInt(ctxkey.ChannelId),
 		TokenId:            c.GetInt(ctxkey.TokenId),
 		TokenName:          c.GetString(ctxkey.TokenName),
+		TokenModelQuotaId:  c.GetInt(ctxkey.TokenModelQuotaId),
 		UserId:             c.GetInt(ctxkey.Id),
 		Group:              c.GetString(ctxkey.Group),
 		ModelMapping:       c.GetStringMapString(ctxkey.ModelMapping),
@@ -52,6 +63,7 @@ func GetByContext(c *gin.Context) *Meta {
 		APIKey:             strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer "),
 		RequestURLPath:     c.Request.URL.String(),
 		ForcedSystemPrompt: c.GetString(ctxkey.SystemPrompt),
+		ParamPolicy:        c.GetString(ctxkey.ParamPolicy),
 		StartTime:          time.Now(),
 	}
 	cfg, ok := c.Get(ctxkey.Config)
@@ -1,12 +1,44 @@
 package model
 
+import (
+	"encoding/base64"
+	"net/http"
+)
+
 type ImageRequest struct {
-	Model          string `json:"model"`
-	Prompt         string `json:"prompt" binding:"required"`
-	N              int    `json:"n,omitempty"`
-	Size           string `json:"size,omitempty"`
-	Quality        string `json:"quality,omitempty"`
-	ResponseFormat string `json:"response_format,omitempty"`
-	Style          string `json:"style,omitempty"`
-	User           string `json:"user,omitempty"`
+	Model             string `json:"model"`
+	Prompt            string `json:"prompt" binding:"required"`
+	N                 int    `json:"n,omitempty"`
+	Size              string `json:"size,omitempty"`
+	Quality           string `json:"quality,omitempty"`
+	ResponseFormat    string `json:"response_format,omitempty"`
+	Style             string `json:"style,omitempty"`
+	User              string `json:"user,omitempty"`
+	Background        string `json:"background,omitempty"`
+	OutputFormat      string `json:"output_format,omitempty"`
+	OutputCompression *int   `json:"output_compression,omitempty"`
+	Moderation        string `json:"moderation,omitempty"`
+
+	// Image and Mask are the files uploaded to the edits and variations endpoints
+	Image []*ImageFile `json:"-"`
+	Mask  *ImageFile   `json:"-"`
+}
+
+type ImageFile struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// MimeType returns the content type of the upload, sniffed from the data when the client didn't send one
+func (f *ImageFile) MimeType() string {
+	if f.ContentType == "" || f.ContentType == "application/octet-stream" {
+		return http.DetectContentType(f.Data)
+	}
+	return f.ContentType
+}
+
+// DataURL returns the file as a data URL, for the upstreams taking images inline
+func (f *ImageFile) DataURL() string {
+	return "data:" + f.MimeType() + ";base64," + base64.StdEncoding.EncodeToString(f.Data)
 }
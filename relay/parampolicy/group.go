@@ -0,0 +1,48 @@
+package parampolicy
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+var groupPolicyLock sync.RWMutex
+var GroupParamPolicy = map[string]*Policy{}
+
+func GroupParamPolicy2JSONString() string {
+	groupPolicyLock.RLock()
+	defer groupPolicyLock.RUnlock()
+	jsonBytes, err := json.Marshal(GroupParamPolicy)
+	if err != nil {
+		logger.SysError("error marshalling group param policy: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateGroupParamPolicyByJSONString(jsonStr string) error {
+	newPolicy := make(map[string]*Policy)
+	err := json.Unmarshal([]byte(jsonStr), &newPolicy)
+	if err != nil {
+		return err
+	}
+	groupPolicyLock.Lock()
+	defer groupPolicyLock.Unlock()
+	GroupParamPolicy = newPolicy
+	return nil
+}
+
+func GetGroupParamPolicy(group string) *Policy {
+	groupPolicyLock.RLock()
+	defer groupPolicyLock.RUnlock()
+	return GroupParamPolicy[group]
+}
+
+// Resolve returns the effective policy for a request, the channel policy takes precedence over the group policy
+func Resolve(group string, channelPolicy string) (*Policy, error) {
+	policy, err := Parse(channelPolicy)
+	if err != nil {
+		return nil, err
+	}
+	return GetGroupParamPolicy(group).Merge(policy), nil
+}
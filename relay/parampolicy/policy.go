@@ -0,0 +1,220 @@
+package parampolicy
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Policy declares how request parameters are rewritten before being sent upstream.
+// Field names are the json names of the request, nested fields are separated by dots,
+// e.g. "stream_options.include_usage".
+type Policy struct {
+	// Set forces the field to the given value
+	Set map[string]any `json:"set,omitempty"`
+	// Default sets the field if the client didn't send it
+	Default map[string]any `json:"default,omitempty"`
+	// Max clamps a numeric field to an upper bound, only if it is present: an absent max_tokens
+	// stays unbounded unless Default sets it too, e.g. {"default": {"max_tokens": 4096}, "max": {"max_tokens": 4096}}
+	Max map[string]float64 `json:"max,omitempty"`
+	// Min clamps a numeric field to a lower bound, only if it is present
+	Min map[string]float64 `json:"min,omitempty"`
+	// Remove strips the field from the request
+	Remove []string `json:"remove,omitempty"`
+	// Extra is merged into the final upstream request body, after ConvertRequest
+	Extra map[string]any `json:"extra,omitempty"`
+}
+
+func Parse(jsonStr string) (*Policy, error) {
+	jsonStr = strings.TrimSpace(jsonStr)
+	if jsonStr == "" || jsonStr == "{}" {
+		return nil, nil
+	}
+	policy := &Policy{}
+	err := json.Unmarshal([]byte(jsonStr), policy)
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func (p *Policy) IsEmpty() bool {
+	return p == nil || (len(p.Set) == 0 && len(p.Default) == 0 && len(p.Max) == 0 && len(p.Min) == 0 && len(p.Remove) == 0 && len(p.Extra) == 0)
+}
+
+// Merge returns a new policy with the rules of other applied on top of p
+func (p *Policy) Merge(other *Policy) *Policy {
+	if p.IsEmpty() {
+		return other
+	}
+	if other.IsEmpty() {
+		return p
+	}
+	merged := &Policy{
+		Set:     mergeMap(p.Set, other.Set),
+		Default: mergeMap(p.Default, other.Default),
+		Max:     mergeMap(p.Max, other.Max),
+		Min:     mergeMap(p.Min, other.Min),
+		Remove:  append(append([]string{}, p.Remove...), other.Remove...),
+		Extra:   mergeMap(p.Extra, other.Extra),
+	}
+	return merged
+}
+
+// Apply rewrites the fields of a request in place and returns a human-readable description of every change.
+// The fields are the raw JSON of the request, so fields unknown to GeneralOpenAIRequest can be set too.
+func (p *Policy) Apply(fields map[string]any) []string {
+	if p.IsEmpty() {
+		return nil
+	}
+	var changes []string
+	for _, path := range p.Remove {
+		if _, ok := getField(fields, path); ok {
+			deleteField(fields, path)
+			changes = append(changes, fmt.Sprintf("removed %s", path))
+		}
+	}
+	for _, path := range sortedKeys(p.Set) {
+		value := p.Set[path]
+		old, ok := getField(fields, path)
+		if ok && fmt.Sprint(old) == fmt.Sprint(value) {
+			continue
+		}
+		setField(fields, path, value)
+		changes = append(changes, fmt.Sprintf("set %s=%v", path, value))
+	}
+	for _, path := range sortedKeys(p.Default) {
+		if _, ok := getField(fields, path); ok {
+			continue
+		}
+		setField(fields, path, p.Default[path])
+		changes = append(changes, fmt.Sprintf("defaulted %s=%v", path, p.Default[path]))
+	}
+	for _, path := range sortedKeys(p.Max) {
+		if value, ok := getNumber(fields, path); ok && value > p.Max[path] {
+			setField(fields, path, p.Max[path])
+			changes = append(changes, fmt.Sprintf("clamped %s %v->%v", path, value, p.Max[path]))
+		}
+	}
+	for _, path := range sortedKeys(p.Min) {
+		if value, ok := getNumber(fields, path); ok && value < p.Min[path] {
+			setField(fields, path, p.Min[path])
+			changes = append(changes, fmt.Sprintf("clamped %s %v->%v", path, value, p.Min[path]))
+		}
+	}
+	return changes
+}
+
+// MergeFields adds the fields missing from the converted request body, it keeps the fields the policy set
+// on an OpenAI compatible request which GeneralOpenAIRequest doesn't know
+func MergeFields(jsonData []byte, fields map[string]any) ([]byte, error) {
+	if len(fields) == 0 {
+		return jsonData, nil
+	}
+	converted := make(map[string]any)
+	err := json.Unmarshal(jsonData, &converted)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range fields {
+		if _, ok := converted[key]; !ok {
+			converted[key] = value
+		}
+	}
+	return json.Marshal(converted)
+}
+
+// MergeExtra adds the extra fields into the converted request body
+func (p *Policy) MergeExtra(jsonData []byte) ([]byte, error) {
+	if p == nil || len(p.Extra) == 0 {
+		return jsonData, nil
+	}
+	fields := make(map[string]any)
+	err := json.Unmarshal(jsonData, &fields)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range sortedKeys(p.Extra) {
+		setField(fields, path, p.Extra[path])
+	}
+	return json.Marshal(fields)
+}
+
+func mergeMap[V any](base map[string]V, override map[string]V) map[string]V {
+	if len(base) == 0 && len(override) == 0 {
+		return nil
+	}
+	merged := make(map[string]V, len(base)+len(override))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		merged[k] = v
+	}
+	return merged
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func getField(fields map[string]any, path string) (any, bool) {
+	parts := strings.Split(path, ".")
+	current := fields
+	for i, part := range parts {
+		value, ok := current[part]
+		if !ok {
+			return nil, false
+		}
+		if i == len(parts)-1 {
+			return value, true
+		}
+		current, ok = value.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+func getNumber(fields map[string]any, path string) (float64, bool) {
+	value, ok := getField(fields, path)
+	if !ok {
+		return 0, false
+	}
+	number, ok := value.(float64)
+	return number, ok
+}
+
+func setField(fields map[string]any, path string, value any) {
+	parts := strings.Split(path, ".")
+	current := fields
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			current[part] = next
+		}
+		current = next
+	}
+	current[parts[len(parts)-1]] = value
+}
+
+func deleteField(fields map[string]any, path string) {
+	parts := strings.Split(path, ".")
+	current := fields
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]any)
+		if !ok {
+			return
+		}
+		current = next
+	}
+	delete(current, parts[len(parts)-1])
+}
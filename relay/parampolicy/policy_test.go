@@ -0,0 +1,97 @@
+package parampolicy
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApply(t *testing.T) {
+	policy, err := Parse(`{
+		"set": {"stream_options.include_usage": true, "reasoning_effort": "low", "service_tier": "flex"},
+		"max": {"max_tokens": 1000, "temperature": 1},
+		"min": {"top_p": 0.5},
+		"remove": ["logit_bias", "metadata.user"]
+	}`)
+	require.NoError(t, err)
+	fields := make(map[string]any)
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"model": "gpt-4o",
+		"max_tokens": 4096,
+		"temperature": 0.7,
+		"top_p": 0.1,
+		"service_tier": "flex",
+		"logit_bias": {"1": 2},
+		"metadata": {"user": "u", "team": "t"}
+	}`), &fields))
+
+	changes := policy.Apply(fields)
+	assert.Equal(t, []string{
+		"removed logit_bias",
+		"removed metadata.user",
+		"set reasoning_effort=low",
+		"set stream_options.include_usage=true",
+		"clamped max_tokens 4096->1000",
+		"clamped top_p 0.1->0.5",
+	}, changes)
+	// fields unknown to GeneralOpenAIRequest are set too
+	assert.Equal(t, "low", fields["reasoning_effort"])
+	assert.Equal(t, map[string]any{"include_usage": true}, fields["stream_options"])
+	assert.Equal(t, map[string]any{"team": "t"}, fields["metadata"])
+	assert.NotContains(t, fields, "logit_bias")
+	assert.Equal(t, 0.7, fields["temperature"])
+
+	assert.Empty(t, policy.Apply(fields), "applying a policy twice changes nothing")
+	assert.Nil(t, (*Policy)(nil).Apply(fields))
+}
+
+func TestMergeFields(t *testing.T) {
+	jsonData, err := MergeFields([]byte(`{"model": "gpt-4o", "stream": true}`), map[string]any{
+		"model":            "gpt-4",
+		"reasoning_effort": "low",
+	})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"model": "gpt-4o", "stream": true, "reasoning_effort": "low"}`, string(jsonData))
+}
+
+func TestMergeAndExtra(t *testing.T) {
+	group, err := Parse(`{"set": {"temperature": 0}, "max": {"max_tokens": 100}, "extra": {"safe_mode": true}}`)
+	require.NoError(t, err)
+	channel, err := Parse(`{"set": {"temperature": 1}}`)
+	require.NoError(t, err)
+	merged := group.Merge(channel)
+	assert.Equal(t, 1.0, merged.Set["temperature"], "the channel policy takes precedence")
+	assert.Equal(t, 100.0, merged.Max["max_tokens"])
+
+	jsonData, err := merged.MergeExtra([]byte(`{"model": "m"}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"model": "m", "safe_mode": true}`, string(jsonData))
+
+	empty, err := Parse(" {} ")
+	require.NoError(t, err)
+	assert.True(t, empty.IsEmpty())
+	_, err = Parse(`{"set": []}`)
+	assert.Error(t, err)
+}
+
+func TestApplyAbsentFields(t *testing.T) {
+	policy, err := Parse(`{"max": {"max_tokens": 1000, "temperature": 1}, "min": {"top_p": 0.5}}`)
+	require.NoError(t, err)
+	fields := map[string]any{"model": "gpt-4o"}
+	// bounds only clamp the fields the client sent, the defaults of the upstream apply to the others
+	assert.Empty(t, policy.Apply(fields))
+	assert.Equal(t, map[string]any{"model": "gpt-4o"}, fields)
+
+	// a default bounds the requests which omit the field
+	policy, err = Parse(`{"default": {"max_tokens": 1000}, "max": {"max_tokens": 1000}}`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"defaulted max_tokens=1000"}, policy.Apply(fields))
+	assert.Equal(t, float64(1000), fields["max_tokens"])
+
+	fields = map[string]any{"max_tokens": float64(4096)}
+	assert.Equal(t, []string{"clamped max_tokens 4096->1000"}, policy.Apply(fields))
+	fields = map[string]any{"max_tokens": float64(10)}
+	assert.Empty(t, policy.Apply(fields), "a default doesn't override the value of the client")
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/songquanpeng/one-api/controller"
 	"github.com/songquanpeng/one-api/controller/auth"
 	"github.com/songquanpeng/one-api/middleware"
+	"github.com/songquanpeng/one-api/model"
 
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-gonic/gin"
@@ -25,18 +26,35 @@ func SetApiRouter(router *gin.Engine) {
 		apiRouter.GET("/oauth/github", middleware.CriticalRateLimit(), auth.GitHubOAuth)
 		apiRouter.GET("/oauth/oidc", middleware.CriticalRateLimit(), auth.OidcAuth)
 		apiRouter.GET("/oauth/lark", middleware.CriticalRateLimit(), auth.LarkOAuth)
+		apiRouter.GET("/oauth/saml", middleware.CriticalRateLimit(), auth.SAMLAuth)
+		apiRouter.GET("/oauth/saml/login", middleware.CriticalRateLimit(), auth.SAMLStart)
+		apiRouter.POST("/oauth/saml/acs", middleware.CriticalRateLimit(), auth.SAMLAcs)
+		apiRouter.GET("/oauth/saml/metadata", auth.SAMLMetadata)
 		apiRouter.GET("/oauth/state", middleware.CriticalRateLimit(), auth.GenerateOAuthCode)
 		apiRouter.GET("/oauth/wechat", middleware.CriticalRateLimit(), auth.WeChatAuth)
 		apiRouter.GET("/oauth/wechat/bind", middleware.CriticalRateLimit(), middleware.UserAuth(), auth.WeChatBind)
 		apiRouter.GET("/oauth/email/bind", middleware.CriticalRateLimit(), middleware.UserAuth(), controller.EmailBind)
-		apiRouter.POST("/topup", middleware.AdminAuth(), controller.AdminTopUp)
+		apiRouter.POST("/topup", middleware.PermissionAuth(model.PermissionBillingTopUp), controller.AdminTopUp)
 
 		userRoute := apiRouter.Group("/user")
 		{
 			userRoute.POST("/register", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.Register)
 			userRoute.POST("/login", middleware.CriticalRateLimit(), controller.Login)
+			userRoute.POST("/login/2fa", middleware.CriticalRateLimit(), controller.LoginTwoFactor)
+			userRoute.POST("/login/webauthn/begin", middleware.CriticalRateLimit(), controller.BeginWebAuthnLogin)
+			userRoute.POST("/login/webauthn/finish", middleware.CriticalRateLimit(), controller.FinishWebAuthnLogin)
 			userRoute.GET("/logout", controller.Logout)
 
+			twoFactorSetupRoute := userRoute.Group("/2fa")
+			twoFactorSetupRoute.Use(middleware.CriticalRateLimit(), middleware.TwoFactorSetupAuth())
+			{
+				twoFactorSetupRoute.GET("", controller.GetTwoFactorStatus)
+				twoFactorSetupRoute.POST("/totp/setup", controller.SetupTotp)
+				twoFactorSetupRoute.POST("/totp/enable", controller.EnableTotp)
+				twoFactorSetupRoute.POST("/webauthn/register/begin", controller.BeginWebAuthnRegistration)
+				twoFactorSetupRoute.POST("/webauthn/register/finish", controller.FinishWebAuthnRegistration)
+			}
+
 			selfRoute := userRoute.Group("/")
 			selfRoute.Use(middleware.UserAuth())
 			{
@@ -48,10 +66,16 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.GET("/aff", controller.GetAffCode)
 				selfRoute.POST("/topup", controller.TopUp)
 				selfRoute.GET("/available_models", controller.GetUserAvailableModels)
+				selfRoute.POST("/2fa/totp/disable", middleware.CriticalRateLimit(), controller.DisableTotp)
+				selfRoute.POST("/2fa/recovery_codes", middleware.CriticalRateLimit(), controller.RegenerateRecoveryCodes)
+				selfRoute.DELETE("/2fa/webauthn/:id", controller.DeleteWebAuthnCredential)
+				selfRoute.GET("/sessions", controller.GetSelfSessions)
+				selfRoute.DELETE("/sessions", controller.RevokeOtherSelfSessions)
+				selfRoute.DELETE("/sessions/:session_id", controller.RevokeSelfSession)
 			}
 
 			adminRoute := userRoute.Group("/")
-			adminRoute.Use(middleware.AdminAuth())
+			adminRoute.Use(middleware.PermissionAuth(model.PermissionUsersManage))
 			{
 				adminRoute.GET("/", controller.GetAllUsers)
 				adminRoute.GET("/search", controller.SearchUsers)
@@ -60,29 +84,42 @@ func SetApiRouter(router *gin.Engine) {
 				adminRoute.POST("/manage", controller.ManageUser)
 				adminRoute.PUT("/", controller.UpdateUser)
 				adminRoute.DELETE("/:id", controller.DeleteUser)
+				adminRoute.GET("/:id/sessions", controller.GetUserSessions)
+				adminRoute.DELETE("/:id/sessions", controller.RevokeUserSessions)
+				adminRoute.DELETE("/:id/sessions/:session_id", controller.RevokeUserSession)
 			}
 		}
 		optionRoute := apiRouter.Group("/option")
-		optionRoute.Use(middleware.RootAuth())
+		optionRoute.Use(middleware.PermissionAuth(model.PermissionOptionsWrite))
 		{
 			optionRoute.GET("/", controller.GetOptions)
 			optionRoute.PUT("/", controller.UpdateOption)
+			optionRoute.POST("/pricing_catalog/sync", controller.SyncPricingCatalog)
 		}
 		channelRoute := apiRouter.Group("/channel")
-		channelRoute.Use(middleware.AdminAuth())
 		{
-			channelRoute.GET("/", controller.GetAllChannels)
-			channelRoute.GET("/search", controller.SearchChannels)
-			channelRoute.GET("/models", controller.ListAllModels)
-			channelRoute.GET("/:id", controller.GetChannel)
-			channelRoute.GET("/test", controller.TestChannels)
-			channelRoute.GET("/test/:id", controller.TestChannel)
-			channelRoute.GET("/update_balance", controller.UpdateAllChannelsBalance)
-			channelRoute.GET("/update_balance/:id", controller.UpdateChannelBalance)
-			channelRoute.POST("/", controller.AddChannel)
-			channelRoute.PUT("/", controller.UpdateChannel)
-			channelRoute.DELETE("/disabled", controller.DeleteDisabledChannel)
-			channelRoute.DELETE("/:id", controller.DeleteChannel)
+			channelReadRoute := channelRoute.Group("/")
+			channelReadRoute.Use(middleware.PermissionAuth(model.PermissionChannelsRead))
+			{
+				channelReadRoute.GET("/", controller.GetAllChannels)
+				channelReadRoute.GET("/search", controller.SearchChannels)
+				channelReadRoute.GET("/models", controller.ListAllModels)
+				channelReadRoute.GET("/:id", controller.GetChannel)
+				channelReadRoute.GET("/keys/:id", controller.GetChannelKeys)
+			}
+			channelWriteRoute := channelRoute.Group("/")
+			channelWriteRoute.Use(middleware.PermissionAuth(model.PermissionChannelsWrite))
+			{
+				channelWriteRoute.GET("/test", controller.TestChannels)
+				channelWriteRoute.GET("/test/:id", controller.TestChannel)
+				channelWriteRoute.GET("/update_balance", controller.UpdateAllChannelsBalance)
+				channelWriteRoute.GET("/update_balance/:id", controller.UpdateChannelBalance)
+				channelWriteRoute.PUT("/keys/:id", controller.UpdateChannelKeyStatus)
+				channelWriteRoute.POST("/", controller.AddChannel)
+				channelWriteRoute.PUT("/", controller.UpdateChannel)
+				channelWriteRoute.DELETE("/disabled", controller.DeleteDisabledChannel)
+				channelWriteRoute.DELETE("/:id", controller.DeleteChannel)
+			}
 		}
 		tokenRoute := apiRouter.Group("/token")
 		tokenRoute.Use(middleware.UserAuth())
@@ -92,28 +129,71 @@ func SetApiRouter(router *gin.Engine) {
 			tokenRoute.GET("/:id", controller.GetToken)
 			tokenRoute.POST("/", controller.AddToken)
 			tokenRoute.PUT("/", controller.UpdateToken)
+			tokenRoute.POST("/:id/rotate", controller.RotateToken)
 			tokenRoute.DELETE("/:id", controller.DeleteToken)
 		}
 		redemptionRoute := apiRouter.Group("/redemption")
-		redemptionRoute.Use(middleware.AdminAuth())
+		redemptionRoute.Use(middleware.PermissionAuth(model.PermissionRedemptionsManage))
 		{
 			redemptionRoute.GET("/", controller.GetAllRedemptions)
 			redemptionRoute.GET("/search", controller.SearchRedemptions)
+			redemptionRoute.GET("/export", controller.ExportRedemptions)
 			redemptionRoute.GET("/:id", controller.GetRedemption)
+			redemptionRoute.GET("/:id/records", controller.GetRedemptionRecords)
 			redemptionRoute.POST("/", controller.AddRedemption)
 			redemptionRoute.PUT("/", controller.UpdateRedemption)
 			redemptionRoute.DELETE("/:id", controller.DeleteRedemption)
 		}
+		paymentRoute := apiRouter.Group("/payment")
+		{
+			paymentRoute.POST("/webhook/:provider", controller.PaymentWebhook)
+			paymentRoute.GET("/tiers", middleware.UserAuth(), controller.GetPriceTiers)
+			paymentRoute.POST("/checkout", middleware.CriticalRateLimit(), middleware.UserAuth(), controller.CreateCheckout)
+			paymentRoute.GET("/order/self", middleware.UserAuth(), controller.GetSelfOrders)
+			paymentRoute.GET("/order", middleware.PermissionAuth(model.PermissionBillingTopUp), controller.GetAllOrders)
+		}
+		statementRoute := apiRouter.Group("/statement")
+		{
+			statementRoute.GET("/self", middleware.UserAuth(), controller.GetSelfStatements)
+			statementRoute.GET("/self/:id", middleware.UserAuth(), controller.GetSelfStatement)
+			statementRoute.GET("/self/:id/download", middleware.UserAuth(), controller.DownloadSelfStatement)
+			statementAdminRoute := statementRoute.Group("/")
+			statementAdminRoute.Use(middleware.PermissionAuth(model.PermissionBillingStatements))
+			{
+				statementAdminRoute.GET("/", controller.GetAllStatements)
+				statementAdminRoute.POST("/", controller.GenerateStatement)
+				statementAdminRoute.GET("/:id", controller.GetStatement)
+				statementAdminRoute.GET("/:id/download", controller.DownloadStatement)
+			}
+		}
 		logRoute := apiRouter.Group("/log")
-		logRoute.GET("/", middleware.AdminAuth(), controller.GetAllLogs)
-		logRoute.DELETE("/", middleware.AdminAuth(), controller.DeleteHistoryLogs)
-		logRoute.GET("/stat", middleware.AdminAuth(), controller.GetLogsStat)
+		logRoute.GET("/", middleware.PermissionAuth(model.PermissionLogsRead), controller.GetAllLogs)
+		logRoute.DELETE("/", middleware.PermissionAuth(model.PermissionLogsDelete), controller.DeleteHistoryLogs)
+		logRoute.GET("/stat", middleware.PermissionAuth(model.PermissionLogsRead), controller.GetLogsStat)
 		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
-		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
+		logRoute.GET("/margin", middleware.PermissionAuth(model.PermissionLogsRead), controller.GetMarginReport)
+		logRoute.GET("/search", middleware.PermissionAuth(model.PermissionLogsRead), controller.SearchAllLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), controller.SearchUserLogs)
+		roleRoute := apiRouter.Group("/role")
+		roleRoute.Use(middleware.RootAuth())
+		{
+			roleRoute.GET("/permissions", controller.GetPermissions)
+			roleRoute.GET("/", controller.GetAllCustomRoles)
+			roleRoute.POST("/", controller.AddCustomRole)
+			roleRoute.PUT("/", controller.UpdateCustomRole)
+			roleRoute.DELETE("/:id", controller.DeleteCustomRole)
+			roleRoute.POST("/assign", controller.AssignCustomRole)
+		}
+		auditRoute := apiRouter.Group("/audit")
+		auditRoute.Use(middleware.PermissionAuth(model.PermissionAuditRead))
+		{
+			auditRoute.GET("/", controller.GetAuditLogs)
+			auditRoute.GET("/export", controller.ExportAuditLogs)
+		}
 		groupRoute := apiRouter.Group("/group")
-		groupRoute.Use(middleware.AdminAuth())
+		// the group names are picked when editing channels and users
+		groupRoute.Use(middleware.PermissionAuth(model.PermissionChannelsRead, model.PermissionChannelsWrite, model.PermissionUsersManage))
 		{
 			groupRoute.GET("/", controller.GetGroups)
 		}
@@ -0,0 +1,90 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/middleware"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func TestApiRouterPermissions(t *testing.T) {
+	t.Setenv("SQL_DSN", "")
+	t.Setenv("LOG_SQL_DSN", "")
+	common.SQLitePath = filepath.Join(t.TempDir(), "one-api.db")
+	common.RedisEnabled = false
+	model.InitDB()
+	model.InitLogDB()
+	t.Cleanup(func() { _ = model.CloseDB() })
+
+	channelsRole := &model.CustomRole{Name: "channels", Permissions: model.PermissionChannelsWrite}
+	require.NoError(t, channelsRole.Insert())
+	logsRole := &model.CustomRole{Name: "logs", Permissions: model.PermissionLogsRead + "," + model.PermissionOptionsWrite}
+	require.NoError(t, logsRole.Insert())
+	users := []*model.User{
+		{Username: "common", Role: model.RoleCommonUser},
+		{Username: "admin", Role: model.RoleAdminUser},
+		{Username: "root", Role: model.RoleRootUser},
+		{Username: "channels", Role: model.RoleCommonUser, CustomRoleId: channelsRole.Id},
+		{Username: "logs", Role: model.RoleAdminUser, CustomRoleId: logsRole.Id},
+	}
+	for _, user := range users {
+		user.AccessToken = user.Username
+		user.AffCode = user.Username
+		user.Status = model.UserStatusEnabled
+		require.NoError(t, model.DB.Create(user).Error)
+	}
+
+	gin.SetMode(gin.TestMode)
+	server := gin.New()
+	server.Use(sessions.Sessions("session", middleware.NewSessionStore("secret")))
+	SetApiRouter(server)
+
+	// the users allowed to call each endpoint, the others are denied
+	cases := []struct {
+		method  string
+		path    string
+		allowed []string
+	}{
+		{"GET", "/api/channel/", []string{"admin", "root"}},
+		{"GET", "/api/channel/update_balance/0", []string{"admin", "root", "channels"}},
+		{"GET", "/api/user/", []string{"admin", "root"}},
+		{"GET", "/api/option/", []string{"root", "logs"}},
+		{"GET", "/api/log/", []string{"admin", "root", "logs"}},
+		{"GET", "/api/log/margin", []string{"admin", "root", "logs"}},
+		{"GET", "/api/redemption/", []string{"admin", "root"}},
+		{"GET", "/api/statement/", []string{"admin", "root"}},
+		{"GET", "/api/payment/order", []string{"admin", "root"}},
+		{"GET", "/api/audit/", []string{"root"}},
+		{"GET", "/api/role/", []string{"root"}},
+		{"GET", "/api/group/", []string{"admin", "root", "channels"}},
+		{"GET", "/api/token/", []string{"common", "admin", "root", "channels", "logs"}},
+	}
+	for _, c := range cases {
+		for _, user := range users {
+			req := httptest.NewRequest(c.method, c.path, nil)
+			req.Header.Set("Authorization", user.AccessToken)
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+			var resp struct {
+				Message string `json:"message"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp), "%s %s as %s: %s", c.method, c.path, user.Username, w.Body.String())
+			denied := strings.Contains(resp.Message, "don't have")
+			allowed := false
+			for _, username := range c.allowed {
+				allowed = allowed || username == user.Username
+			}
+			assert.Equal(t, allowed, !denied, "%s %s as %s: %s", c.method, c.path, user.Username, resp.Message)
+		}
+	}
+}
@@ -139,64 +139,23 @@ const TokensTable = () => {
         <div>
           <Popover
             content={
-              'sk-' + record.key
+              'sk-' + record.key_prefix + '…'
             }
             style={{ padding: 20 }}
             position="top"
           >
             <Button theme="light" type="tertiary" style={{ marginRight: 1 }}>查看</Button>
           </Popover>
-          <Button theme="light" type="secondary" style={{ marginRight: 1 }}
-                  onClick={async (text) => {
-                    await copyText('sk-' + record.key);
-                  }}
-          >复制</Button>
-          <SplitButtonGroup style={{ marginRight: 1 }} aria-label="项目操作按钮组">
-            <Button theme="light" style={{ color: 'rgba(var(--semi-teal-7), 1)' }} onClick={() => {
-              onOpenLink('next', record.key);
-            }}>聊天</Button>
-            <Dropdown trigger="click" position="bottomRight" menu={
-              [
-                {
-                  node: 'item',
-                  key: 'next',
-                  disabled: !localStorage.getItem('chat_link'),
-                  name: 'ChatGPT Next Web',
-                  onClick: () => {
-                    onOpenLink('next', record.key);
-                  }
-                },
-                {
-                  node: 'item',
-                  key: 'next-mj',
-                  disabled: !localStorage.getItem('chat_link2'),
-                  name: 'ChatGPT Web & Midjourney',
-                  onClick: () => {
-                    onOpenLink('next-mj', record.key);
-                  }
-                },
-                {
-                  node: 'item', key: 'ama', name: 'AMA 问天（BotGem）', onClick: () => {
-                    onOpenLink('ama', record.key);
-                  }
-                },
-                {
-                  node: 'item', key: 'opencat', name: 'OpenCat', onClick: () => {
-                    onOpenLink('opencat', record.key);
-                  }
-                },
-                {
-                  node: 'item', key: 'lobechat', name: 'LobeChat', onClick: () => {
-                    onOpenLink('lobechat');
-                  }
-                }
-              ]
-            }
-            >
-              <Button style={{ padding: '8px 4px', color: 'rgba(var(--semi-teal-7), 1)' }} type="primary"
-                      icon={<IconTreeTriangleDown />}></Button>
-            </Dropdown>
-          </SplitButtonGroup>
+          <Popconfirm
+            title="确定要轮换此令牌的密钥吗？"
+            content="将生成新的密钥，旧密钥在宽限期后失效"
+            position={'left'}
+            onConfirm={() => {
+              rotateToken(record);
+            }}
+          >
+            <Button theme="light" type="secondary" style={{ marginRight: 1 }}>轮换</Button>
+          </Popconfirm>
           <Popconfirm
             title="确定是否要删除此令牌？"
             content="此修改将不可逆"
@@ -205,7 +164,7 @@ const TokensTable = () => {
             onConfirm={() => {
               manageToken(record.id, 'delete', record).then(
                 () => {
-                  removeRecord(record.key);
+                  removeRecord(record.id);
                 }
               );
             }}
@@ -247,7 +206,7 @@ const TokensTable = () => {
   const [pageSize, setPageSize] = useState(ITEMS_PER_PAGE);
   const [showEdit, setShowEdit] = useState(false);
   const [tokens, setTokens] = useState([]);
-  const [selectedKeys, setSelectedKeys] = useState([]);
+  const [newKeys, setNewKeys] = useState([]);
   const [tokenCount, setTokenCount] = useState(pageSize);
   const [loading, setLoading] = useState(true);
   const [activePage, setActivePage] = useState(1);
@@ -313,49 +272,6 @@ const TokensTable = () => {
     await loadTokens(activePage - 1);
   };
 
-  const onCopy = async (type, key) => {
-    let status = localStorage.getItem('status');
-    let serverAddress = '';
-    if (status) {
-      status = JSON.parse(status);
-      serverAddress = status.server_address;
-    }
-    if (serverAddress === '') {
-      serverAddress = window.location.origin;
-    }
-    let encodedServerAddress = encodeURIComponent(serverAddress);
-    const nextLink = localStorage.getItem('chat_link');
-    const mjLink = localStorage.getItem('chat_link2');
-    let nextUrl;
-
-    if (nextLink) {
-      nextUrl = nextLink + `/#/?settings={"key":"sk-${key}","url":"${serverAddress}"}`;
-    } else {
-      nextUrl = `https://app.nextchat.dev/#/?settings={"key":"sk-${key}","url":"${serverAddress}"}`;
-    }
-
-    let url;
-    switch (type) {
-      case 'ama':
-        url = mjLink + `/#/?settings={"key":"sk-${key}","url":"${serverAddress}"}`;
-        break;
-      case 'opencat':
-        url = `opencat://team/join?domain=${encodedServerAddress}&token=sk-${key}`;
-        break;
-      case 'next':
-        url = nextUrl;
-        break;
-      default:
-        url = `sk-${key}`;
-    }
-    // if (await copy(url)) {
-    //     showSuccess('已复制到剪贴板！');
-    // } else {
-    //     showWarning('无法复制到剪贴板，请手动复制，已将令牌填入搜索框。');
-    //     setSearchKeyword(url);
-    // }
-  };
-
   const copyText = async (text) => {
     if (await copy(text)) {
       showSuccess('已复制到剪贴板！');
@@ -408,6 +324,68 @@ const TokensTable = () => {
     window.open(url, '_blank');
   };
 
+  const rotateToken = async (record) => {
+    setLoading(true);
+    const res = await API.post(`/api/token/${record.id}/rotate`);
+    const { success, message, data } = res.data;
+    if (success) {
+      record.key_prefix = data.key_prefix;
+      setNewKeys([{ name: data.name, key: data.key }]);
+    } else {
+      showError(message);
+    }
+    setLoading(false);
+  };
+
+  const renderChatButton = (key) => (
+    <SplitButtonGroup style={{ marginRight: 1 }} aria-label="项目操作按钮组">
+      <Button theme="light" style={{ color: 'rgba(var(--semi-teal-7), 1)' }} onClick={() => {
+        onOpenLink('next', key);
+      }}>聊天</Button>
+      <Dropdown trigger="click" position="bottomRight" menu={
+        [
+          {
+            node: 'item',
+            key: 'next',
+            disabled: !localStorage.getItem('chat_link'),
+            name: 'ChatGPT Next Web',
+            onClick: () => {
+              onOpenLink('next', key);
+            }
+          },
+          {
+            node: 'item',
+            key: 'next-mj',
+            disabled: !localStorage.getItem('chat_link2'),
+            name: 'ChatGPT Web & Midjourney',
+            onClick: () => {
+              onOpenLink('next-mj', key);
+            }
+          },
+          {
+            node: 'item', key: 'ama', name: 'AMA 问天（BotGem）', onClick: () => {
+              onOpenLink('ama', key);
+            }
+          },
+          {
+            node: 'item', key: 'opencat', name: 'OpenCat', onClick: () => {
+              onOpenLink('opencat', key);
+            }
+          },
+          {
+            node: 'item', key: 'lobechat', name: 'LobeChat', onClick: () => {
+              onOpenLink('lobechat', key);
+            }
+          }
+        ]
+      }
+      >
+        <Button style={{ padding: '8px 4px', color: 'rgba(var(--semi-teal-7), 1)' }} type="primary"
+                icon={<IconTreeTriangleDown />}></Button>
+      </Dropdown>
+    </SplitButtonGroup>
+  );
+
   useEffect(() => {
     loadTokens(0, orderBy)
       .then()
@@ -416,10 +394,10 @@ const TokensTable = () => {
       });
   }, [pageSize, orderBy]);
 
-  const removeRecord = key => {
+  const removeRecord = id => {
     let newDataSource = [...tokens];
-    if (key != null) {
-      let idx = newDataSource.findIndex(data => data.key === key);
+    if (id != null) {
+      let idx = newDataSource.findIndex(data => data.id === id);
 
       if (idx > -1) {
         newDataSource.splice(idx, 1);
@@ -516,16 +494,6 @@ const TokensTable = () => {
     }
   };
 
-  const rowSelection = {
-    onSelect: (record, selected) => {
-    },
-    onSelectAll: (selected, selectedRows) => {
-    },
-    onChange: (selectedRowKeys, selectedRows) => {
-      setSelectedKeys(selectedRows);
-    }
-  };
-
   const handleRow = (record, index) => {
     if (record.status !== 1) {
       return {
@@ -557,7 +525,32 @@ const TokensTable = () => {
 
   return (
     <>
-      <EditToken refresh={refresh} editingToken={editingToken} visiable={showEdit} handleClose={closeEdit}></EditToken>
+      <EditToken refresh={refresh} editingToken={editingToken} visiable={showEdit} handleClose={closeEdit}
+                 showKeys={setNewKeys}></EditToken>
+      <Modal
+        title="请立即保存令牌"
+        visible={newKeys.length > 0}
+        onOk={() => setNewKeys([])}
+        onCancel={() => setNewKeys([])}
+        hasCancel={false}
+        okText="我已保存"
+      >
+        <p>令牌只在此处显示一次，系统不保存明文，丢失后只能轮换令牌获取新密钥。</p>
+        {newKeys.map((item) => (
+          <div key={item.key} style={{ marginTop: 10 }}>
+            <div>{item.name}</div>
+            <code style={{ wordBreak: 'break-all' }}>{'sk-' + item.key}</code>
+            <div style={{ marginTop: 5 }}>
+              <Button theme="light" type="secondary" style={{ marginRight: 1 }}
+                      onClick={async () => {
+                        await copyText('sk-' + item.key);
+                      }}
+              >复制</Button>
+              {renderChatButton(item.key)}
+            </div>
+          </div>
+        ))}
+      </Modal>
       <Form layout="horizontal" style={{ marginTop: 10 }} labelPosition={'left'}>
         <Form.Input
           field="keyword"
@@ -591,7 +584,7 @@ const TokensTable = () => {
           setActivePage(1);
         },
         onPageChange: handlePageChange
-      }} loading={loading} rowSelection={rowSelection} onRow={handleRow}>
+      }} loading={loading} onRow={handleRow}>
       </Table>
       <Button theme="light" type="primary" style={{ marginRight: 8 }} onClick={
         () => {
@@ -601,19 +594,6 @@ const TokensTable = () => {
           setShowEdit(true);
         }
       }>添加令牌</Button>
-      <Button label="复制所选令牌" type="warning" onClick={
-        async () => {
-          if (selectedKeys.length === 0) {
-            showError('请至少选择一个令牌！');
-            return;
-          }
-          let keys = '';
-          for (let i = 0; i < selectedKeys.length; i++) {
-            keys += selectedKeys[i].name + '    sk-' + selectedKeys[i].key + '\n';
-          }
-          await copyText(keys);
-        }
-      }>复制所选令牌到剪贴板</Button>
       <Dropdown
         trigger="click"
         position="bottomLeft"
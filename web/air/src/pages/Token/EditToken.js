@@ -159,6 +159,7 @@ const EditToken = (props) => {
     } else {
       // 处理新增多个令牌的情况
       let successCount = 0; // 记录成功创建的令牌数量
+      let createdKeys = []; // 新令牌的密钥只在创建时返回一次
       for (let i = 0; i < tokenCount; i++) {
         let localInputs = { ...inputs };
         if (i !== 0) {
@@ -178,10 +179,11 @@ const EditToken = (props) => {
         }
         // localInputs.model_limits = localInputs.model_limits.join(',');
         let res = await API.post(`/api/token/`, localInputs);
-        const { success, message } = res.data;
+        const { success, message, data } = res.data;
 
         if (success) {
           successCount++;
+          createdKeys.push({ name: data.name, key: data.key });
         } else {
           showError(message);
           break; // 如果创建失败，终止循环
@@ -189,9 +191,10 @@ const EditToken = (props) => {
       }
 
       if (successCount > 0) {
-        showSuccess(`${successCount}个令牌创建成功，请在列表页面点击复制获取令牌！`);
+        showSuccess(`${successCount}个令牌创建成功，请立即复制令牌，令牌只显示一次！`);
         props.refresh();
         props.handleClose();
+        props.showKeys(createdKeys);
       }
     }
     setLoading(false);
@@ -0,0 +1,139 @@
+import PropTypes from 'prop-types';
+import { useState } from 'react';
+import { useSelector } from 'react-redux';
+
+import {
+  Alert,
+  Button,
+  ButtonGroup,
+  Dialog,
+  DialogActions,
+  DialogContent,
+  DialogTitle,
+  MenuItem,
+  Popover,
+  Stack,
+  Typography
+} from '@mui/material';
+
+import { copy } from 'utils/common';
+
+import { IconCaretDownFilled } from '@tabler/icons-react';
+
+const COPY_OPTIONS = [
+  {
+    key: 'next',
+    text: 'ChatGPT Next',
+    url: 'https://app.nextchat.dev/#/?settings={"key":"sk-{key}","url":"{serverAddress}"}',
+    encode: false
+  },
+  { key: 'ama', text: 'BotGem', url: 'ama://set-api-key?server={serverAddress}&key=sk-{key}', encode: true },
+  { key: 'opencat', text: 'OpenCat', url: 'opencat://team/join?domain={serverAddress}&token=sk-{key}', encode: true },
+  { key: 'lobechat', text: 'LobeChat', url: 'https://lobehub.com/?settings={"keyVaults":{"openai":{"apiKey":"sk-{key}","baseURL":"{serverAddress}"}}}', encode: true }
+];
+
+function replacePlaceholders(text, key, serverAddress) {
+  return text.replace('{key}', key).replace('{serverAddress}', serverAddress);
+}
+
+// 新建或轮换后的密钥只返回一次，服务端只保存其哈希
+export default function KeyDialog({ tokenKey, onClose }) {
+  const [open, setOpen] = useState(null);
+  const [menuType, setMenuType] = useState('copy');
+  const siteInfo = useSelector((state) => state.siteInfo);
+
+  const handleOpenMenu = (event, type) => {
+    setMenuType(type);
+    setOpen(event.currentTarget);
+  };
+
+  const handleCloseMenu = () => {
+    setOpen(null);
+  };
+
+  const handleCopy = (option, type) => {
+    let serverAddress = '';
+    if (siteInfo?.server_address) {
+      serverAddress = siteInfo.server_address;
+    } else {
+      serverAddress = window.location.host;
+    }
+
+    if (option.encode) {
+      serverAddress = encodeURIComponent(serverAddress);
+    }
+
+    let url = option.url;
+
+    if (option.key === 'next' && siteInfo?.chat_link) {
+      url = siteInfo.chat_link + `/#/?settings={"key":"sk-{key}","url":"{serverAddress}"}`;
+    }
+
+    const text = replacePlaceholders(url, tokenKey, serverAddress);
+    if (type === 'link') {
+      window.open(text);
+    } else {
+      copy(text);
+    }
+    handleCloseMenu();
+  };
+
+  return (
+    <>
+      <Dialog open={!!tokenKey} onClose={onClose} fullWidth maxWidth={'sm'}>
+        <DialogTitle>请立即保存令牌</DialogTitle>
+        <DialogContent>
+          <Stack spacing={2}>
+            <Alert severity="warning">令牌只在此处显示一次，系统不保存明文，丢失后只能轮换令牌获取新密钥。</Alert>
+            <Typography sx={{ wordBreak: 'break-all', fontFamily: 'monospace' }}>{`sk-${tokenKey}`}</Typography>
+          </Stack>
+        </DialogContent>
+        <DialogActions>
+          <ButtonGroup size="small" aria-label="split button">
+            <Button
+              color="primary"
+              onClick={() => {
+                copy(`sk-${tokenKey}`);
+              }}
+            >
+              复制
+            </Button>
+            <Button size="small" onClick={(e) => handleOpenMenu(e, 'copy')}>
+              <IconCaretDownFilled size={'16px'} />
+            </Button>
+          </ButtonGroup>
+          <ButtonGroup size="small" aria-label="split button">
+            <Button color="primary" onClick={() => handleCopy(COPY_OPTIONS[0], 'link')}>
+              聊天
+            </Button>
+            <Button size="small" onClick={(e) => handleOpenMenu(e, 'link')}>
+              <IconCaretDownFilled size={'16px'} />
+            </Button>
+          </ButtonGroup>
+          <Button onClick={onClose}>我已保存</Button>
+        </DialogActions>
+      </Dialog>
+      <Popover
+        open={!!open}
+        anchorEl={open}
+        onClose={handleCloseMenu}
+        anchorOrigin={{ vertical: 'top', horizontal: 'left' }}
+        transformOrigin={{ vertical: 'top', horizontal: 'right' }}
+        PaperProps={{
+          sx: { width: 140 }
+        }}
+      >
+        {COPY_OPTIONS.map((option, index) => (
+          <MenuItem key={index} onClick={() => handleCopy(option, menuType)}>
+            {option.text}
+          </MenuItem>
+        ))}
+      </Popover>
+    </>
+  );
+}
+
+KeyDialog.propTypes = {
+  tokenKey: PropTypes.string,
+  onClose: PropTypes.func
+};
@@ -15,30 +15,13 @@ import {
   DialogTitle,
   Button,
   Tooltip,
-  Stack,
-  ButtonGroup
+  Stack
 } from '@mui/material';
 
 import TableSwitch from 'ui-component/Switch';
-import { renderQuota, timestamp2string, copy } from 'utils/common';
+import { renderQuota, timestamp2string } from 'utils/common';
 
-import { IconDotsVertical, IconEdit, IconTrash, IconCaretDownFilled } from '@tabler/icons-react';
-
-const COPY_OPTIONS = [
-  {
-    key: 'next',
-    text: 'ChatGPT Next',
-    url: 'https://app.nextchat.dev/#/?settings={"key":"sk-{key}","url":"{serverAddress}"}',
-    encode: false
-  },
-  { key: 'ama', text: 'BotGem', url: 'ama://set-api-key?server={serverAddress}&key=sk-{key}', encode: true },
-  { key: 'opencat', text: 'OpenCat', url: 'opencat://team/join?domain={serverAddress}&token=sk-{key}', encode: true },
-  { key: 'lobechat', text: 'LobeChat', url: 'https://lobehub.com/?settings={"keyVaults":{"openai":{"apiKey":"sk-{key}","baseURL":"{serverAddress}"}}}', encode: true }
-];
-
-function replacePlaceholders(text, key, serverAddress) {
-  return text.replace('{key}', key).replace('{serverAddress}', serverAddress);
-}
+import { IconDotsVertical, IconEdit, IconTrash, IconRefresh } from '@tabler/icons-react';
 
 function createMenu(menuItems) {
   return (
@@ -57,6 +40,7 @@ export default function TokensTableRow({ item, manageToken, handleOpenModal, set
   const [open, setOpen] = useState(null);
   const [menuItems, setMenuItems] = useState(null);
   const [openDelete, setOpenDelete] = useState(false);
+  const [openRotate, setOpenRotate] = useState(false);
   const [statusSwitch, setStatusSwitch] = useState(item.status);
   const siteInfo = useSelector((state) => state.siteInfo);
 
@@ -69,17 +53,17 @@ export default function TokensTableRow({ item, manageToken, handleOpenModal, set
     setOpenDelete(false);
   };
 
-  const handleOpenMenu = (event, type) => {
-    switch (type) {
-      case 'copy':
-        setMenuItems(copyItems);
-        break;
-      case 'link':
-        setMenuItems(linkItems);
-        break;
-      default:
-        setMenuItems(actionItems);
-    }
+  const handleRotateOpen = () => {
+    handleCloseMenu();
+    setOpenRotate(true);
+  };
+
+  const handleRotateClose = () => {
+    setOpenRotate(false);
+  };
+
+  const handleOpenMenu = (event) => {
+    setMenuItems(actionItems);
     setOpen(event.currentTarget);
   };
 
@@ -100,6 +84,11 @@ export default function TokensTableRow({ item, manageToken, handleOpenModal, set
     await manageToken(item.id, 'delete', '');
   };
 
+  const handleRotate = async () => {
+    setOpenRotate(false);
+    await manageToken(item.id, 'rotate', '');
+  };
+
   const actionItems = createMenu([
     {
       text: '编辑',
@@ -111,6 +100,12 @@ export default function TokensTableRow({ item, manageToken, handleOpenModal, set
       },
       color: undefined
     },
+    {
+      text: '轮换',
+      icon: <IconRefresh style={{ marginRight: '16px' }} />,
+      onClick: handleRotateOpen,
+      color: undefined
+    },
     {
       text: '删除',
       icon: <IconTrash style={{ marginRight: '16px' }} />,
@@ -119,57 +114,13 @@ export default function TokensTableRow({ item, manageToken, handleOpenModal, set
     }
   ]);
 
-  const handleCopy = (option, type) => {
-    let serverAddress = '';
-    if (siteInfo?.server_address) {
-      serverAddress = siteInfo.server_address;
-    } else {
-      serverAddress = window.location.host;
-    }
-
-    if (option.encode) {
-      serverAddress = encodeURIComponent(serverAddress);
-    }
-
-    let url = option.url;
-
-    if (option.key === 'next' && siteInfo?.chat_link) {
-      url = siteInfo.chat_link + `/#/?settings={"key":"sk-{key}","url":"{serverAddress}"}`;
-    }
-
-    const key = item.key;
-    const text = replacePlaceholders(url, key, serverAddress);
-    if (type === 'link') {
-      window.open(text);
-    } else {
-      copy(text);
-    }
-    handleCloseMenu();
-  };
-
-  const copyItems = createMenu(
-    COPY_OPTIONS.map((option) => ({
-      text: option.text,
-      icon: undefined,
-      onClick: () => handleCopy(option, 'copy'),
-      color: undefined
-    }))
-  );
-
-  const linkItems = createMenu(
-    COPY_OPTIONS.map((option) => ({
-      text: option.text,
-      icon: undefined,
-      onClick: () => handleCopy(option, 'link'),
-      color: undefined
-    }))
-  );
-
   return (
     <>
       <TableRow tabIndex={item.id}>
         <TableCell>{item.name}</TableCell>
 
+        <TableCell sx={{ fontFamily: 'monospace' }}>{`sk-${item.key_prefix}…`}</TableCell>
+
         <TableCell>
           <Tooltip
             title={(() => {
@@ -207,27 +158,6 @@ export default function TokensTableRow({ item, manageToken, handleOpenModal, set
 
         <TableCell>
           <Stack direction="row" spacing={1}>
-            <ButtonGroup size="small" aria-label="split button">
-              <Button
-                color="primary"
-                onClick={() => {
-                  copy(`sk-${item.key}`);
-                }}
-              >
-                复制
-              </Button>
-              <Button size="small" onClick={(e) => handleOpenMenu(e, 'copy')}>
-                <IconCaretDownFilled size={'16px'} />
-              </Button>
-            </ButtonGroup>
-            <ButtonGroup size="small" aria-label="split button">
-              <Button color="primary" onClick={(e) => handleCopy(COPY_OPTIONS[0], 'link')}>
-                聊天
-              </Button>
-              <Button size="small" onClick={(e) => handleOpenMenu(e, 'link')}>
-                <IconCaretDownFilled size={'16px'} />
-              </Button>
-            </ButtonGroup>
             <IconButton onClick={(e) => handleOpenMenu(e, 'action')} sx={{ color: 'rgb(99, 115, 129)' }}>
               <IconDotsVertical />
             </IconButton>
@@ -247,6 +177,19 @@ export default function TokensTableRow({ item, manageToken, handleOpenModal, set
         {menuItems}
       </Popover>
 
+      <Dialog open={openRotate} onClose={handleRotateClose}>
+        <DialogTitle>轮换Token</DialogTitle>
+        <DialogContent>
+          <DialogContentText>是否为Token {item.name} 生成新密钥？旧密钥在宽限期后失效。</DialogContentText>
+        </DialogContent>
+        <DialogActions>
+          <Button onClick={handleRotateClose}>关闭</Button>
+          <Button onClick={handleRotate} autoFocus>
+            轮换
+          </Button>
+        </DialogActions>
+      </Dialog>
+
       <Dialog open={openDelete} onClose={handleDeleteClose}>
         <DialogTitle>删除Token</DialogTitle>
         <DialogContent>
@@ -59,8 +59,13 @@ function renderBalance(type, balance, t) {
       return <span>¥{balance.toFixed(2)}</span>;
     case 13: // AIGC2D
       return <span>{renderNumber(balance)}</span>;
+    case 15: // Baidu
+    case 47: // Baidu V2
+      return <span>¥{balance.toFixed(2)}</span>;
     case 20: // OpenRouter
       return <span>${balance.toFixed(2)}</span>;
+    case 25: // Moonshot
+      return <span>¥{balance.toFixed(2)}</span>;
     case 36: // DeepSeek
       return <span>¥{balance.toFixed(2)}</span>;
     case 44: // SiliconFlow
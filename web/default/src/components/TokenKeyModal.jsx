@@ -0,0 +1,114 @@
+import React from 'react';
+import { useTranslation } from 'react-i18next';
+import { Button, Dropdown, Form, Message, Modal } from 'semantic-ui-react';
+
+import { copy, showSuccess, showWarning } from '../helpers';
+
+function getServerAddress() {
+  let status = localStorage.getItem('status');
+  let serverAddress = '';
+  if (status) {
+    status = JSON.parse(status);
+    serverAddress = status.server_address;
+  }
+  if (serverAddress === '') {
+    serverAddress = window.location.origin;
+  }
+  return serverAddress;
+}
+
+function getKeyUrl(type, key) {
+  const serverAddress = getServerAddress();
+  const encodedServerAddress = encodeURIComponent(serverAddress);
+  const chatLink = localStorage.getItem('chat_link');
+  switch (type) {
+    case 'ama':
+      return `ama://set-api-key?server=${encodedServerAddress}&key=sk-${key}`;
+    case 'opencat':
+      return `opencat://team/join?domain=${encodedServerAddress}&token=sk-${key}`;
+    case 'next':
+      return (
+        (chatLink ? chatLink + '/#/' : 'https://app.nextchat.dev/#/') +
+        `?settings={"key":"sk-${key}","url":"${serverAddress}"}`
+      );
+    case 'lobechat':
+      return (
+        chatLink +
+        `/?settings={"keyVaults":{"openai":{"apiKey":"sk-${key}","baseURL":"${serverAddress}/v1"}}}`
+      );
+    default:
+      return `sk-${key}`;
+  }
+}
+
+// TokenKeyModal shows a newly created or rotated key, the server only stores its hash so it can't be shown again
+const TokenKeyModal = ({ tokenKey, onClose }) => {
+  const { t } = useTranslation();
+
+  const COPY_OPTIONS = [
+    { key: 'next', text: t('token.copy_options.next'), value: 'next' },
+    { key: 'ama', text: t('token.copy_options.ama'), value: 'ama' },
+    { key: 'opencat', text: t('token.copy_options.opencat'), value: 'opencat' },
+    { key: 'lobe', text: t('token.copy_options.lobe'), value: 'lobechat' },
+  ];
+
+  const OPEN_LINK_OPTIONS = [
+    { key: 'next', text: t('token.copy_options.next'), value: 'next' },
+    { key: 'ama', text: t('token.copy_options.ama'), value: 'ama' },
+    { key: 'opencat', text: t('token.copy_options.opencat'), value: 'opencat' },
+    { key: 'lobe', text: t('token.copy_options.lobe'), value: 'lobechat' },
+  ];
+
+  const onCopy = async (type) => {
+    if (await copy(getKeyUrl(type, tokenKey))) {
+      showSuccess(t('token.messages.copy_success'));
+    } else {
+      showWarning(t('token.key_modal.copy_failed'));
+    }
+  };
+
+  const onOpenLink = (type) => {
+    window.open(getKeyUrl(type === '' ? 'next' : type, tokenKey), '_blank');
+  };
+
+  return (
+    <Modal open={!!tokenKey} onClose={onClose} size="small">
+      <Modal.Header>{t('token.key_modal.title')}</Modal.Header>
+      <Modal.Content>
+        <Message warning>{t('token.key_modal.notice')}</Message>
+        <Form>
+          <Form.Input fluid readOnly value={`sk-${tokenKey}`} />
+        </Form>
+      </Modal.Content>
+      <Modal.Actions>
+        <Button.Group color="green">
+          <Button onClick={() => onCopy('')}>{t('token.copy_options.raw')}</Button>
+          <Dropdown
+            className="button icon"
+            floating
+            trigger={<></>}
+            options={COPY_OPTIONS.map((option) => ({
+              ...option,
+              onClick: () => onCopy(option.value),
+            }))}
+          />
+        </Button.Group>{' '}
+        <Button.Group color="blue">
+          <Button onClick={() => onOpenLink('')}>{t('token.buttons.chat')}</Button>
+          <Dropdown
+            className="button icon"
+            floating
+            trigger={<></>}
+            options={OPEN_LINK_OPTIONS.map((option) => ({
+              ...option,
+              onClick: () => onOpenLink(option.value),
+            }))}
+          />
+        </Button.Group>{' '}
+        <Button onClick={onClose}>{t('token.key_modal.close')}</Button>
+      </Modal.Actions>
+    </Modal>
+  );
+};
+
+export default TokenKeyModal;
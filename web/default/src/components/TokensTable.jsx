@@ -4,8 +4,9 @@ import { Link } from 'react-router-dom';
 import { Button, Dropdown, Form, Label, Pagination, Popup, Table } from 'semantic-ui-react';
 
 import { ITEMS_PER_PAGE } from '../constants';
-import { API, copy, showError, showSuccess, showWarning, timestamp2string } from '../helpers';
+import { API, showError, showSuccess, timestamp2string } from '../helpers';
 import { renderQuota } from '../helpers/render';
+import TokenKeyModal from './TokenKeyModal';
 
 function renderTimestamp(timestamp) {
   return <>{timestamp2string(timestamp)}</>;
@@ -49,21 +50,6 @@ function renderStatus(status, t) {
 const TokensTable = () => {
   const { t } = useTranslation();
 
-  const COPY_OPTIONS = [
-    { key: 'raw', text: t('token.copy_options.raw'), value: '' },
-    { key: 'next', text: t('token.copy_options.next'), value: 'next' },
-    { key: 'ama', text: t('token.copy_options.ama'), value: 'ama' },
-    { key: 'opencat', text: t('token.copy_options.opencat'), value: 'opencat' },
-    { key: 'lobe', text: t('token.copy_options.lobe'), value: 'lobechat' },
-  ];
-
-  const OPEN_LINK_OPTIONS = [
-    { key: 'next', text: t('token.copy_options.next'), value: 'next' },
-    { key: 'ama', text: t('token.copy_options.ama'), value: 'ama' },
-    { key: 'opencat', text: t('token.copy_options.opencat'), value: 'opencat' },
-    { key: 'lobe', text: t('token.copy_options.lobe'), value: 'lobechat' },
-  ];
-
   const [tokens, setTokens] = useState([]);
   const [loading, setLoading] = useState(true);
   const [activePage, setActivePage] = useState(1);
@@ -72,6 +58,7 @@ const TokensTable = () => {
   const [showTopUpModal, setShowTopUpModal] = useState(false);
   const [targetTokenIdx, setTargetTokenIdx] = useState(0);
   const [orderBy, setOrderBy] = useState('');
+  const [newKey, setNewKey] = useState('');
 
   const loadTokens = async (startIdx) => {
     const res = await API.get(`/api/token/?p=${startIdx}&order=${orderBy}`);
@@ -105,93 +92,18 @@ const TokensTable = () => {
     await loadTokens(activePage - 1);
   };
 
-  const onCopy = async (type, key) => {
-    let status = localStorage.getItem('status');
-    let serverAddress = '';
-    if (status) {
-      status = JSON.parse(status);
-      serverAddress = status.server_address;
-    }
-    if (serverAddress === '') {
-      serverAddress = window.location.origin;
-    }
-    let encodedServerAddress = encodeURIComponent(serverAddress);
-    const nextLink = localStorage.getItem('chat_link');
-    let nextUrl;
-
-    if (nextLink) {
-      nextUrl = nextLink + `/#/?settings={"key":"sk-${key}","url":"${serverAddress}"}`;
-    } else {
-      nextUrl = `https://app.nextchat.dev/#/?settings={"key":"sk-${key}","url":"${serverAddress}"}`;
-    }
-
-    let url;
-    switch (type) {
-      case 'ama':
-        url = `ama://set-api-key?server=${encodedServerAddress}&key=sk-${key}`;
-        break;
-      case 'opencat':
-        url = `opencat://team/join?domain=${encodedServerAddress}&token=sk-${key}`;
-        break;
-      case 'next':
-        url = nextUrl;
-        break;
-      case 'lobechat':
-        url =
-          nextLink +
-          `/?settings={"keyVaults":{"openai":{"apiKey":"sk-${key}","baseURL":"${serverAddress}/v1"}}}`;
-        break;
-      default:
-        url = `sk-${key}`;
-    }
-    if (await copy(url)) {
-      showSuccess(t('token.messages.copy_success'));
-    } else {
-      showWarning(t('token.messages.copy_failed'));
-      setSearchKeyword(url);
-    }
-  };
-
-  const onOpenLink = async (type, key) => {
-    let status = localStorage.getItem('status');
-    let serverAddress = '';
-    if (status) {
-      status = JSON.parse(status);
-      serverAddress = status.server_address;
-    }
-    if (serverAddress === '') {
-      serverAddress = window.location.origin;
-    }
-    let encodedServerAddress = encodeURIComponent(serverAddress);
-    const chatLink = localStorage.getItem('chat_link');
-    let defaultUrl;
-
-    if (chatLink) {
-      defaultUrl = chatLink + `/#/?settings={"key":"sk-${key}","url":"${serverAddress}"}`;
+  const rotateToken = async (id) => {
+    const res = await API.post(`/api/token/${id}/rotate`);
+    const { success, message, data } = res.data;
+    if (success) {
+      setNewKey(data.key);
+      let newTokens = [...tokens];
+      let realIdx = newTokens.findIndex((token) => token.id === id);
+      newTokens[realIdx] = data;
+      setTokens(newTokens);
     } else {
-      defaultUrl = `https://app.nextchat.dev/#/?settings={"key":"sk-${key}","url":"${serverAddress}"}`;
-    }
-    let url;
-    switch (type) {
-      case 'ama':
-        url = `ama://set-api-key?server=${encodedServerAddress}&key=sk-${key}`;
-        break;
-
-      case 'opencat':
-        url = `opencat://team/join?domain=${encodedServerAddress}&token=sk-${key}`;
-        break;
-
-      case 'lobechat':
-        url =
-          chatLink +
-          `/?settings={"keyVaults":{"openai":{"apiKey":"sk-${key}","baseURL":"${serverAddress}/v1"}}}`;
-        break;
-
-      default:
-        url = defaultUrl;
+      showError(message);
     }
-
-    window.open(url, '_blank');
   };
 
   useEffect(() => {
@@ -286,6 +198,7 @@ const TokensTable = () => {
 
   return (
     <>
+      <TokenKeyModal tokenKey={newKey} onClose={() => setNewKey('')} />
       <Form onSubmit={searchTokens}>
         <Form.Input
           icon="search"
@@ -301,7 +214,7 @@ const TokensTable = () => {
       <Table basic={'very'} compact size="small">
         <Table.Header>
           <Table.Row>
-            <Table.HeaderCell colSpan="7">
+            <Table.HeaderCell colSpan="8">
               <Button size="tiny" as={Link} to="/token/add" loading={loading}>
                 {t('token.buttons.add')}
               </Button>
@@ -338,6 +251,7 @@ const TokensTable = () => {
             >
               {t('token.table.name')}
             </Table.HeaderCell>
+            <Table.HeaderCell>{t('token.table.key')}</Table.HeaderCell>
             <Table.HeaderCell
               style={{ cursor: 'pointer' }}
               onClick={() => {
@@ -388,23 +302,12 @@ const TokensTable = () => {
             .map((token, idx) => {
               if (token.deleted) return <></>;
 
-              const copyOptionsWithHandlers = COPY_OPTIONS.map((option) => ({
-                ...option,
-                onClick: async () => {
-                  await onCopy(option.value, token.key);
-                },
-              }));
-
-              const openLinkOptionsWithHandlers = OPEN_LINK_OPTIONS.map((option) => ({
-                ...option,
-                onClick: async () => {
-                  await onOpenLink(option.value, token.key);
-                },
-              }));
-
               return (
                 <Table.Row key={token.id}>
                   <Table.Cell>{token.name ? token.name : t('token.table.no_name')}</Table.Cell>
+                  <Table.Cell>
+                    <code>{`sk-${token.key_prefix}…`}</code>
+                  </Table.Cell>
                   <Table.Cell>{renderStatus(token.status, t)}</Table.Cell>
                   <Table.Cell>{renderQuota(token.used_quota, t)}</Table.Cell>
                   <Table.Cell>
@@ -421,18 +324,24 @@ const TokensTable = () => {
                   <Table.Cell>
                     <div className={'flex gap-1 flex-row justify-end'}>
                       <Popup
-                        content={t('token.buttons.copy')}
-                        trigger={
-                          <Button
-                            icon="copy"
-                            color="green"
-                            size="small"
-                            onClick={async () => await onCopy('', token.key)}
-                          />
-                        }
+                        content={t('token.buttons.rotate')}
+                        trigger={<Button icon="sync" color="green" size="small" />}
                         basic
                         position="top center"
-                      />
+                        on="click"
+                        flowing
+                        hoverable
+                      >
+                        <Button
+                          size="small"
+                          color="green"
+                          onClick={() => {
+                            rotateToken(token.id);
+                          }}
+                        >
+                          {t('token.buttons.confirm_rotate')} {token.name}
+                        </Button>
+                      </Popup>
                       <Popup
                         content={t('token.buttons.delete')}
                         trigger={<Button icon="trash alternate" size="small" negative />}
@@ -492,7 +401,7 @@ const TokensTable = () => {
 
         <Table.Footer>
           <Table.Row>
-            <Table.HeaderCell colSpan="7">
+            <Table.HeaderCell colSpan="8">
               <Pagination
                 floated="right"
                 activePage={activePage}
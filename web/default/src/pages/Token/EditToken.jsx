@@ -5,6 +5,7 @@ import { Button, Card, Form, Message } from 'semantic-ui-react';
 
 import { API, copy, showError, showSuccess, timestamp2string } from '../../helpers';
 import { renderQuotaWithPrompt } from '../../helpers/render';
+import TokenKeyModal from '../../components/TokenKeyModal';
 
 const EditToken = () => {
   const { t } = useTranslation();
@@ -13,6 +14,7 @@ const EditToken = () => {
   const isEdit = tokenId !== undefined;
   const [loading, setLoading] = useState(isEdit);
   const [modelOptions, setModelOptions] = useState([]);
+  const [newKey, setNewKey] = useState('');
   const originInputs = {
     name: '',
     remain_quota: isEdit ? 0 : 500000,
@@ -127,13 +129,14 @@ const EditToken = () => {
     } else {
       res = await API.post(`/api/token/`, localInputs);
     }
-    const { success, message } = res.data;
+    const { success, message, data } = res.data;
     if (success) {
       if (isEdit) {
         showSuccess(t('token.edit.messages.update_success'));
       } else {
         showSuccess(t('token.edit.messages.create_success'));
         setInputs(originInputs);
+        setNewKey(data.key);
       }
     } else {
       showError(message);
@@ -142,6 +145,13 @@ const EditToken = () => {
 
   return (
     <div className="dashboard-container">
+      <TokenKeyModal
+        tokenKey={newKey}
+        onClose={() => {
+          setNewKey('');
+          navigate('/token');
+        }}
+      />
       <Card fluid className="chart-card">
         <Card.Content>
           <Card.Header className="header">